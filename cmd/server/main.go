@@ -1,19 +1,44 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
-	"github.com/dosedaf/syncup-users-service/database"
+	"github.com/dosedaf/syncup-users-service/internal/audit"
+	"github.com/dosedaf/syncup-users-service/internal/config"
+	"github.com/dosedaf/syncup-users-service/internal/grpcapi"
 	"github.com/dosedaf/syncup-users-service/internal/handler"
+	"github.com/dosedaf/syncup-users-service/internal/health"
+	"github.com/dosedaf/syncup-users-service/internal/logging"
+	"github.com/dosedaf/syncup-users-service/internal/mailer"
+	"github.com/dosedaf/syncup-users-service/internal/metrics"
+	"github.com/dosedaf/syncup-users-service/internal/outbox"
+	"github.com/dosedaf/syncup-users-service/internal/password"
+	"github.com/dosedaf/syncup-users-service/internal/prune"
 	"github.com/dosedaf/syncup-users-service/internal/repository"
+	"github.com/dosedaf/syncup-users-service/internal/router"
+	"github.com/dosedaf/syncup-users-service/internal/server"
 	"github.com/dosedaf/syncup-users-service/internal/service"
+	"github.com/dosedaf/syncup-users-service/internal/session"
+	"github.com/dosedaf/syncup-users-service/internal/token"
+	"github.com/dosedaf/syncup-users-service/internal/tracing"
+	"github.com/dosedaf/syncup-users-service/internal/webhook"
 	"github.com/dosedaf/syncup-users-service/middleware"
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/joho/godotenv"
+	"go.opentelemetry.io/otel"
 )
 
 func main() {
@@ -21,47 +46,238 @@ func main() {
 
 	err := godotenv.Load()
 	if err != nil {
-		logger.Error("Error loading .env file", "error", err)
+		logger.Info("No .env file loaded", "error", err)
 	}
 
-	runMigrate(os.Getenv("DATABASE_URL"), logger)
-
-	conn, err := database.ConnectDB()
+	cfg, err := config.Load(os.Args[1:], os.LookupEnv)
 	if err != nil {
-		logger.Error("Failed to connect to database", "error", err)
+		if errors.Is(err, flag.ErrHelp) {
+			fmt.Fprint(os.Stderr, config.Usage())
+			os.Exit(0)
+		}
+
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n  %s\n", strings.ReplaceAll(err.Error(), "\n", "\n  "))
 		os.Exit(1)
 	}
+	// validated by config.Load
+	logger, _ = cfg.Logger(os.Stdout)
+	slog.SetDefault(logger)
+	logger.Info("Configuration loaded", "config", cfg)
+	if cfg.LogRedaction == logging.RedactOff {
+		logger.Warn("LOG_REDACTION is off, personal data will be written to logs")
+	}
 
-	jwtSecret := os.Getenv("SECRET")
-	repo := repository.NewUserRepository(conn, logger)
-	svc := service.NewUserService(repo, logger, jwtSecret)
-	h := handler.NewUserHandler(svc, logger)
-	authMiddleware := middleware.NewMiddleware(repo, logger, jwtSecret)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	mux := http.NewServeMux()
-	mux.Handle("POST /api/v1/register", http.HandlerFunc(h.Register))
-	mux.Handle("POST /api/v1/login", http.HandlerFunc(h.Login))
-	mux.Handle("GET /api/v1/me", authMiddleware.JWTMiddleware(http.HandlerFunc(h.Me)))
+	if err = run(ctx, cfg, logger); err != nil {
+		logger.Error("Server exited with error", "error", err)
+		os.Exit(1)
+	}
 
-	logger.Info("Starting server on port 3000")
-	err = http.ListenAndServe(":3000", mux)
+	logger.Info("Server stopped")
+}
+
+// run wires the application together and serves until ctx is cancelled.
+func run(ctx context.Context, cfg *config.Config, logger *slog.Logger) error {
+	provider, shutdownTracing, err := tracing.NewProvider(ctx, cfg.Tracing())
 	if err != nil {
-		logger.Error("Failed to start new server", "error", err)
-		os.Exit(1)
+		return err
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Error("Failed to flush traces", "error", err)
+		}
+	}()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(tracing.Propagator())
+	tracer := tracing.New(provider)
+
+	// both were validated by config.Load
+	hasher, _ := password.NewHasher(cfg.PasswordHasher())
+	pepper, _ := cfg.Pepper()
+	logger.Info("Password pepper loaded", "version", pepper.Current())
+
+	m := metrics.New()
+
+	store, err := openStorage(ctx, cfg, tracer, m, logger)
+	if err != nil {
+		return err
+	}
+
+	publisher, closePublisher, err := outbox.NewPublisher(cfg.Outbox())
+	if err != nil {
+		store.close()
+		return err
+	}
+	// webhook deliveries are enqueued before the configured publisher sees
+	// the event; both tolerate the duplicates a failure of the other causes
+	relay := outbox.NewRelay(store.outbox, outbox.Publishers{webhook.NewEnqueuer(store.webhooks, logger), publisher}, logger, cfg.OutboxPollInterval)
+	dispatcher := webhook.NewDispatcher(store.webhooks, logger, cfg.Webhooks())
+
+	// units of work get the same decorators, so transactional calls are
+	// measured and traced too
+	instrumentUsers := func(users repository.RepositoryInstance) repository.RepositoryInstance {
+		return tracer.UserRepository(m.UserRepository(users))
+	}
+	repo := instrumentUsers(store.users)
+	tx := repository.WrapTx(store.tx, func(repos repository.Repositories) repository.Repositories {
+		repos.Users = instrumentUsers(repos.Users)
+		return repos
+	})
+	sessionRepo := store.sessions
+	auditRepo := store.audit
+	deviceRepo := store.devices
+
+	recorder := audit.NewRecorder(auditRepo, logger, cfg.AuditBufferSize)
+	tracker := session.NewTracker(sessionRepo, logger, cfg.SessionFlushInterval)
+	mail := mailer.NewQueue(newMailer(cfg, logger), logger, cfg.MailBufferSize)
+
+	svc := tracer.Service(service.NewUserService(
+		repo,
+		sessionRepo,
+		logger,
+		cfg.JWTSecret,
+		service.WithPasswordHasher(m.Hasher(hasher)),
+		service.WithPepper(pepper),
+		service.WithAuditRecorder(m.AuditRecorder(recorder)),
+		service.WithDeviceAlerts(deviceRepo, mail, cfg.NotMeURL),
+		service.WithPasswordReset(mail, cfg.ResetURL),
+		service.WithTxManager(tx),
+	))
+	auditSvc := service.NewAuditService(auditRepo, recorder, logger)
+	h := tracer.Handler(handler.NewUserHandler(svc, logger))
+	auditHandler := handler.NewAuditHandler(auditSvc, logger)
+	webhookHandler := handler.NewWebhookHandler(service.NewWebhookService(store.webhooks, recorder, logger), logger)
+	verifier := token.NewVerifier(repo, sessionRepo, tracker, logger, cfg.JWTSecret)
+	authMiddleware := middleware.NewMiddleware(verifier, logger)
+	// validated by config.Load
+	serviceClients, _ := cfg.ServiceClients()
+
+	probes := health.New(logger, cfg.HealthCheckTimeout)
+	for _, checker := range store.checkers {
+		probes.Register(checker)
 	}
+
+	app := router.New(router.Deps{
+		Users:    h,
+		Audit:    auditHandler,
+		Webhooks: webhookHandler,
+		Auth:     authMiddleware,
+		Probes:   probes,
+		Logger:   logger,
+		Metrics:  m,
+		Tracing:  tracer,
+
+		Introspection:  handler.NewIntrospectionHandler(verifier, logger),
+		ServiceClients: serviceClients,
+	})
+
+	// listening here fails startup on a taken port instead of leaving the
+	// service up without its gRPC API
+	grpcLn, err := net.Listen("tcp", cfg.GRPCAddr)
+	if err != nil {
+		closePublisher()
+		store.close()
+		return fmt.Errorf("failed while listening on %s: %w", cfg.GRPCAddr, err)
+	}
+	grpcSrv := grpcapi.New(grpcapi.Deps{
+		Users:          svc,
+		Auth:           verifier,
+		ServiceClients: serviceClients,
+		Logger:         logger,
+	})
+	go func() {
+		if err := grpcSrv.Serve(grpcLn); err != nil {
+			logger.Error("gRPC server stopped unexpectedly", "error", err)
+		}
+	}()
+
+	// metrics get a listener of their own, so the public port never serves
+	// them; only the scraper needs to reach METRICS_ADDR
+	metricsLn, err := net.Listen("tcp", cfg.MetricsAddr)
+	if err != nil {
+		grpcSrv.Shutdown(ctx)
+		closePublisher()
+		store.close()
+		return fmt.Errorf("failed while listening on %s: %w", cfg.MetricsAddr, err)
+	}
+	drainMetrics := serveMetrics(metricsLn, m, cfg.HTTPReadHeaderTimeout, logger)
+
+	srv := server.New(cfg.Server(), app, logger)
+	srv.OnShutdown(probes.SetDraining)
+	srv.OnDrain(grpcSrv.Shutdown)
+	srv.OnDrain(drainMetrics)
+	srv.AddWorker(recorder)
+	srv.AddWorker(tracker)
+	srv.AddWorker(prune.New("sessions", sessionRepo.PruneSessions, logger, cfg.PruneInterval))
+	srv.AddWorker(prune.New("used tokens", store.tokens.PruneUsedTokens, logger, cfg.PruneInterval))
+	srv.AddWorker(mail)
+	srv.AddWorker(relay)
+	srv.AddWorker(dispatcher)
+	srv.AddCloser(func() {
+		if err := closePublisher(); err != nil {
+			logger.Error("Failed to close outbox publisher", "error", err)
+		}
+	})
+	srv.AddCloser(store.close)
+
+	return srv.Run(ctx)
 }
 
-func runMigrate(databaseURL string, logger *slog.Logger) {
-	migration, err := migrate.New("file://migrations", databaseURL)
+// serveMetrics serves GET /metrics on ln and returns the function that
+// drains it.
+func serveMetrics(ln net.Listener, m *metrics.Metrics, readHeaderTimeout time.Duration, logger *slog.Logger) func(ctx context.Context) {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", m.Handler())
+	metricsSrv := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelError),
+	}
+
+	go func() {
+		logger.Info("Starting metrics server", "addr", ln.Addr().String())
+		if err := metricsSrv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Metrics server stopped unexpectedly", "error", err)
+		}
+	}()
+
+	return func(ctx context.Context) {
+		if err := metricsSrv.Shutdown(ctx); err != nil {
+			metricsSrv.Close()
+		}
+	}
+}
+
+func newMailer(cfg *config.Config, logger *slog.Logger) mailer.Mailer {
+	if cfg.SMTPAddr == "" {
+		logger.Warn("SMTP_ADDR not set, emails will be logged instead of sent, without their links")
+		return mailer.NewLogMailer(logger)
+	}
+
+	return mailer.NewSMTPMailer(mailer.SMTPConfig{
+		Addr:     cfg.SMTPAddr,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+		From:     cfg.SMTPFrom,
+	})
+}
+
+func runMigrate(sourceURL string, databaseURL string, logger *slog.Logger) error {
+	migration, err := migrate.New(sourceURL, databaseURL)
 	if err != nil {
-		logger.Error("Unable to create new migrate instance", "error", err)
-		os.Exit(1)
+		return fmt.Errorf("unable to create new migrate instance: %w", err)
 	}
+	defer migration.Close()
 
 	if err = migration.Up(); err != nil && err != migrate.ErrNoChange {
-		logger.Error("Failed to run migrate up", "error", err)
-		os.Exit(1)
+		return fmt.Errorf("failed to run migrate up: %w", err)
 	}
 
 	logger.Info("DB migrated successfully")
+
+	return nil
 }
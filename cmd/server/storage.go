@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/dosedaf/syncup-users-service/database"
+	"github.com/dosedaf/syncup-users-service/internal/config"
+	"github.com/dosedaf/syncup-users-service/internal/health"
+	"github.com/dosedaf/syncup-users-service/internal/metrics"
+	"github.com/dosedaf/syncup-users-service/internal/repository"
+	"github.com/dosedaf/syncup-users-service/internal/repository/memory"
+	"github.com/dosedaf/syncup-users-service/internal/tracing"
+)
+
+// storage holds the repositories for the configured backend along with the
+// readiness checks and cleanup that go with it.
+type storage struct {
+	users    repository.RepositoryInstance
+	sessions repository.SessionRepositoryInstance
+	audit    repository.AuditRepositoryInstance
+	devices  repository.DeviceRepositoryInstance
+	outbox   repository.OutboxRepositoryInstance
+	tokens   repository.TokenRepositoryInstance
+	tx       repository.TxManagerInstance
+	webhooks repository.WebhookRepositoryInstance
+	checkers []health.Checker
+	close    func()
+}
+
+func openStorage(ctx context.Context, cfg *config.Config, tracer *tracing.Tracing, m *metrics.Metrics, logger *slog.Logger) (*storage, error) {
+	if cfg.Storage == config.StorageMemory {
+		logger.Warn("Using in-memory storage, all data will be lost on exit")
+		users, sessions, audit, devices, outbox, tokens := memory.NewUserRepository(), memory.NewSessionRepository(), memory.NewAuditRepository(), memory.NewDeviceRepository(), memory.NewOutboxRepository(), memory.NewTokenRepository()
+		return &storage{
+			users:    users,
+			sessions: sessions,
+			audit:    audit,
+			devices:  devices,
+			outbox:   outbox,
+			tokens:   tokens,
+			tx:       memory.NewTxManager(users, sessions, audit, devices, outbox, tokens),
+			webhooks: memory.NewWebhookRepository(),
+			close:    func() {},
+		}, nil
+	}
+
+	if err := runMigrate(cfg.MigrationsSource, cfg.DatabaseURL, logger); err != nil {
+		return nil, err
+	}
+
+	schemaVersion, err := database.LatestMigrationVersion(cfg.MigrationsSource)
+	if err != nil {
+		return nil, err
+	}
+
+	poolConfig := cfg.Pool()
+	poolConfig.Tracer = tracer.QueryTracer()
+	pool, err := database.ConnectPool(ctx, poolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	logger.Info("DB connection pool started successfully")
+
+	if err = m.RegisterPool(pool); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to register pool metrics: %w", err)
+	}
+
+	return &storage{
+		users:    repository.NewUserRepository(pool, logger),
+		sessions: repository.NewSessionRepository(pool, logger),
+		audit:    repository.NewAuditRepository(pool, logger),
+		devices:  repository.NewDeviceRepository(pool, logger),
+		outbox:   repository.NewOutboxRepository(pool, logger),
+		tokens:   repository.NewTokenRepository(pool, logger),
+		tx:       repository.NewTxManager(pool, logger),
+		webhooks: repository.NewWebhookRepository(pool, logger),
+		checkers: []health.Checker{
+			health.Ping("database", pool),
+			health.Migrations(pool, schemaVersion),
+		},
+		close: func() {
+			pool.Close()
+			logger.Info("DB connection pool closed")
+		},
+	}, nil
+}
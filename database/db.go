@@ -3,26 +3,58 @@ package database
 import (
 	"context"
 	"fmt"
-	"log"
+	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func ConnectDB() (*pgx.Conn, error) {
-	fmt.Println("Starting connection with Postgres Db")
-	connStr := "postgres://postgres:password@db:5432/db?sslmode=disable"
-	conn, err := pgx.Connect(context.Background(), connStr)
+// DBTX is the subset of a connection the repositories use. *pgxpool.Pool and
+// pgx.Tx both satisfy it, and tests can provide a fake.
+type DBTX interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+
+type PoolConfig struct {
+	URL               string
+	MaxConns          int32
+	MinConns          int32
+	MaxConnLifetime   time.Duration
+	MaxConnIdleTime   time.Duration
+	HealthCheckPeriod time.Duration
+	// Tracer, if set, observes every query on the pool's connections.
+	Tracer pgx.QueryTracer
+}
+
+// ConnectPool opens a connection pool and verifies it with a ping.
+func ConnectPool(ctx context.Context, config PoolConfig) (*pgxpool.Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(config.URL)
 	if err != nil {
-		log.Fatal(err)
-		return nil, err
+		return nil, fmt.Errorf("failed while parsing database url: %w", err)
 	}
 
-	if err = conn.Ping(context.Background()); err != nil {
-		log.Println("DB Ping Failed")
-		log.Fatal(err)
+	poolConfig.MaxConns = config.MaxConns
+	poolConfig.MinConns = config.MinConns
+	poolConfig.MaxConnLifetime = config.MaxConnLifetime
+	poolConfig.MaxConnIdleTime = config.MaxConnIdleTime
+	poolConfig.HealthCheckPeriod = config.HealthCheckPeriod
+	if config.Tracer != nil {
+		poolConfig.ConnConfig.Tracer = config.Tracer
 	}
 
-	log.Println("DB Connection started successfully")
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed while creating connection pool: %w", err)
+	}
+
+	if err = pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed while pinging database: %w", err)
+	}
 
-	return conn, nil
+	return pool, nil
 }
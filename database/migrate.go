@@ -0,0 +1,58 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/jackc/pgx/v5"
+)
+
+// LatestMigrationVersion returns the highest migration version available in
+// sourceURL, or 0 if there are none. The source driver for the URL scheme
+// must already be registered.
+func LatestMigrationVersion(sourceURL string) (uint, error) {
+	src, err := source.Open(sourceURL)
+	if err != nil {
+		return 0, fmt.Errorf("failed while opening migration source: %w", err)
+	}
+	defer src.Close()
+
+	version, err := src.First()
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed while reading migration source: %w", err)
+	}
+
+	for {
+		next, err := src.Next(version)
+		if errors.Is(err, os.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed while reading migration source: %w", err)
+		}
+
+		version = next
+	}
+}
+
+// MigrationVersion reads the version golang-migrate recorded in the database.
+func MigrationVersion(ctx context.Context, db DBTX) (version uint, dirty bool, err error) {
+	query := `SELECT version, dirty FROM schema_migrations LIMIT 1`
+
+	var v int64
+	err = db.QueryRow(ctx, query).Scan(&v, &dirty)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed while reading migration version: %w", err)
+	}
+
+	return uint(v), dirty, nil
+}
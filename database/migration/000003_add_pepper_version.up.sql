@@ -0,0 +1,2 @@
+ALTER TABLE users
+    ADD COLUMN pepper_version SMALLINT NOT NULL DEFAULT 0;
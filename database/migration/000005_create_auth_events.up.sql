@@ -0,0 +1,29 @@
+CREATE TABLE
+    auth_events (
+        id BIGSERIAL PRIMARY KEY,
+        event_type VARCHAR(64) NOT NULL,
+        outcome VARCHAR(16) NOT NULL,
+        reason VARCHAR(64) NOT NULL DEFAULT '',
+        actor_id INTEGER,
+        subject_id INTEGER,
+        subject_email VARCHAR(254) NOT NULL DEFAULT '',
+        ip VARCHAR(45) NOT NULL DEFAULT '',
+        user_agent TEXT NOT NULL DEFAULT '',
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW ()
+    );
+
+CREATE INDEX auth_events_subject_id_idx ON auth_events (subject_id, id DESC);
+
+CREATE INDEX auth_events_event_type_idx ON auth_events (event_type, id DESC);
+
+-- the audit trail is append-only, even for the application's own role
+CREATE FUNCTION auth_events_append_only () RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'auth_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER auth_events_append_only BEFORE
+UPDATE
+OR DELETE ON auth_events FOR EACH ROW
+EXECUTE FUNCTION auth_events_append_only ();
@@ -0,0 +1,10 @@
+CREATE TABLE
+    known_devices (
+        user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+        fingerprint VARCHAR(128) NOT NULL,
+        ua_family VARCHAR(64) NOT NULL,
+        ip_prefix VARCHAR(64) NOT NULL,
+        first_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW (),
+        last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW (),
+        PRIMARY KEY (user_id, fingerprint)
+    );
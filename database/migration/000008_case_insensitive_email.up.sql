@@ -0,0 +1,6 @@
+-- emails are unique regardless of case; this fails if existing rows differ
+-- only by case, which have to be merged by hand first
+CREATE UNIQUE INDEX users_email_lower_key ON users (lower(email));
+
+ALTER TABLE users
+    DROP CONSTRAINT users_email_key;
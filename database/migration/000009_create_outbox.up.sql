@@ -0,0 +1,19 @@
+CREATE TABLE
+    outbox (
+        id BIGSERIAL PRIMARY KEY,
+        user_id INTEGER NOT NULL,
+        event_type VARCHAR(64) NOT NULL,
+        payload JSONB NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW (),
+        attempts INTEGER NOT NULL DEFAULT 0,
+        next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW (),
+        last_error TEXT NOT NULL DEFAULT '',
+        published_at TIMESTAMPTZ
+    );
+
+-- no foreign key on user_id: a user.deleted event outlives its user
+
+-- the relay only ever looks at unpublished events, oldest first per user
+CREATE INDEX outbox_pending_idx ON outbox (user_id, id)
+WHERE
+    published_at IS NULL;
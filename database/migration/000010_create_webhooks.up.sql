@@ -0,0 +1,44 @@
+CREATE TABLE
+    webhook_subscriptions (
+        id SERIAL PRIMARY KEY,
+        url TEXT NOT NULL,
+        -- kept in the clear since every delivery is signed with it
+        secret VARCHAR(128) NOT NULL,
+        event_types TEXT[] NOT NULL,
+        description VARCHAR(200) NOT NULL DEFAULT '',
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW ()
+    );
+
+CREATE TABLE
+    webhook_deliveries (
+        id BIGSERIAL PRIMARY KEY,
+        subscription_id INTEGER NOT NULL REFERENCES webhook_subscriptions (id) ON DELETE CASCADE,
+        event_id BIGINT NOT NULL,
+        event_type VARCHAR(64) NOT NULL,
+        payload JSONB NOT NULL,
+        occurred_at TIMESTAMPTZ NOT NULL,
+        status VARCHAR(16) NOT NULL DEFAULT 'pending',
+        attempts INTEGER NOT NULL DEFAULT 0,
+        next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW (),
+        last_error TEXT NOT NULL DEFAULT '',
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW (),
+        delivered_at TIMESTAMPTZ,
+        -- the outbox publishes at least once; this makes enqueueing idempotent
+        UNIQUE (subscription_id, event_id)
+    );
+
+CREATE INDEX webhook_deliveries_pending_idx ON webhook_deliveries (next_attempt_at)
+WHERE
+    status = 'pending';
+
+CREATE TABLE
+    webhook_delivery_attempts (
+        id BIGSERIAL PRIMARY KEY,
+        delivery_id BIGINT NOT NULL REFERENCES webhook_deliveries (id) ON DELETE CASCADE,
+        attempted_at TIMESTAMPTZ NOT NULL,
+        status_code INTEGER NOT NULL DEFAULT 0,
+        error TEXT NOT NULL DEFAULT '',
+        duration_ms BIGINT NOT NULL
+    );
+
+CREATE INDEX webhook_delivery_attempts_delivery_idx ON webhook_delivery_attempts (delivery_id, id);
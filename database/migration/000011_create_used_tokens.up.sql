@@ -0,0 +1,9 @@
+-- ids of single-use tokens that were already redeemed; a row is only needed
+-- until its token would have expired anyway
+CREATE TABLE
+    used_tokens (
+        id VARCHAR(64) PRIMARY KEY,
+        expires_at TIMESTAMPTZ NOT NULL
+    );
+
+CREATE INDEX used_tokens_expires_at_idx ON used_tokens (expires_at);
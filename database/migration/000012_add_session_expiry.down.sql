@@ -0,0 +1,2 @@
+ALTER TABLE sessions
+    DROP COLUMN expires_at;
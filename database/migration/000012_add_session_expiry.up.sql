@@ -0,0 +1,12 @@
+ALTER TABLE sessions
+    ADD COLUMN expires_at TIMESTAMPTZ;
+
+-- existing sessions lasted as long as the one hour token of their login
+UPDATE sessions
+SET
+    expires_at = created_at + INTERVAL '1 hour';
+
+ALTER TABLE sessions
+    ALTER COLUMN expires_at SET NOT NULL;
+
+CREATE INDEX sessions_expires_at_idx ON sessions (expires_at);
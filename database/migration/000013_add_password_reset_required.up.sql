@@ -0,0 +1,3 @@
+-- databases migrated before this had its own migration already have it
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS password_reset_required BOOLEAN NOT NULL DEFAULT FALSE;
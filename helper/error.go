@@ -1,7 +1,83 @@
 package helper
 
-import "errors"
+import (
+	"errors"
+	"strings"
+)
 
 var ErrEmailAlreadyExists = errors.New("email already exists")
 var ErrUserNotFound = errors.New("user not found")
 var ErrWrongPassword = errors.New("wrong password")
+var ErrSessionNotFound = errors.New("session not found")
+var ErrSessionRevoked = errors.New("session revoked")
+var ErrPasswordResetRequired = errors.New("password reset required")
+var ErrInvalidToken = errors.New("invalid token")
+var ErrInvalidRequest = errors.New("invalid request")
+var ErrUnauthorized = errors.New("unauthorized")
+var ErrForbidden = errors.New("forbidden")
+var ErrValidationFailed = errors.New("validation failed")
+var ErrRequestTooLarge = errors.New("request too large")
+var ErrWebhookNotFound = errors.New("webhook subscription not found")
+var ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+
+// clientError wraps a sentinel with a message that is safe to show to the
+// client in place of the sentinel's default one.
+type clientError struct {
+	err error
+	msg string
+}
+
+func (e *clientError) Error() string { return e.msg }
+func (e *clientError) Unwrap() error { return e.err }
+
+func WithMessage(err error, msg string) error {
+	return &clientError{err: err, msg: msg}
+}
+
+// InvalidRequest reports a problem with the request itself. msg is returned
+// to the client as is.
+func InvalidRequest(msg string) error {
+	return WithMessage(ErrInvalidRequest, msg)
+}
+
+// FieldError describes why one field of a request was rejected. Field is the
+// JSON property or query parameter name as the client sent it.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError collects every invalid field of a request so the client
+// can fix them all at once. It matches ErrValidationFailed with errors.Is.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		parts[i] = f.Field + ": " + f.Message
+	}
+	return "validation failed: " + strings.Join(parts, "; ")
+}
+
+func (e *ValidationError) Unwrap() error { return ErrValidationFailed }
+
+func (e *ValidationError) Add(field, msg string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: msg})
+}
+
+// Err returns e, or nil when no field was rejected.
+func (e *ValidationError) Err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// InvalidField reports a single rejected field.
+func InvalidField(field, msg string) error {
+	e := &ValidationError{}
+	e.Add(field, msg)
+	return e
+}
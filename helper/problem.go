@@ -0,0 +1,138 @@
+package helper
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+const ProblemContentType = "application/problem+json"
+
+// ProblemTypePrefix namespaces the problem type URIs. A type is the prefix
+// followed by the problem's code, e.g. "urn:syncup:problem:wrong_password".
+const ProblemTypePrefix = "urn:syncup:problem:"
+
+const internalErrorMessage = "An internal server error occured"
+
+// Problem is an RFC 7807 problem details body. Type and Code identify the
+// kind of failure and never change once published, so clients branch on
+// them rather than on the human readable text.
+//
+// Message repeats the text error responses carried before problem details
+// and is deprecated. It stays in every v1 response and is only dropped in a
+// future /api/v2, so clients can move to Code at their own pace.
+type Problem struct {
+	Type     string       `json:"type"`
+	Code     string       `json:"code"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+	Message  string       `json:"message"`
+}
+
+type errorMapping struct {
+	err     error
+	code    string
+	status  int
+	message string
+}
+
+// errorMappings is the single place sentinel errors are turned into HTTP
+// responses. Codes are part of the API contract; the messages are the ones
+// clients have seen so far.
+var errorMappings = []errorMapping{
+	{ErrValidationFailed, "validation_failed", http.StatusBadRequest, "Validation failed"},
+	{ErrInvalidRequest, "invalid_request", http.StatusBadRequest, "Invalid request"},
+	{ErrRequestTooLarge, "request_too_large", http.StatusRequestEntityTooLarge, "Request body is too large"},
+	{ErrUnauthorized, "unauthorized", http.StatusUnauthorized, "Authorization required"},
+	{ErrForbidden, "forbidden", http.StatusForbidden, "Forbidden"},
+	{ErrEmailAlreadyExists, "email_already_exists", http.StatusConflict, "User with this email already exists"},
+	{ErrUserNotFound, "user_not_found", http.StatusNotFound, "User with this email does not exist"},
+	{ErrWrongPassword, "wrong_password", http.StatusUnauthorized, "Wrong Password"},
+	{ErrPasswordResetRequired, "password_reset_required", http.StatusForbidden, "Password reset required"},
+	{ErrSessionNotFound, "session_not_found", http.StatusNotFound, "Session not found"},
+	{ErrSessionRevoked, "session_revoked", http.StatusUnauthorized, "Session revoked"},
+	{ErrInvalidToken, "invalid_token", http.StatusBadRequest, "Invalid or expired token"},
+	{ErrWebhookNotFound, "webhook_not_found", http.StatusNotFound, "Webhook subscription not found"},
+	{ErrWebhookDeliveryNotFound, "webhook_delivery_not_found", http.StatusNotFound, "Webhook delivery not found"},
+}
+
+const internalErrorCode = "internal_error"
+
+// ProblemFor translates err into a problem. Errors without a mapping become
+// a 500 that reveals nothing about the cause.
+func ProblemFor(err error) Problem {
+	code, status, message := internalErrorCode, http.StatusInternalServerError, internalErrorMessage
+	for _, m := range errorMappings {
+		if errors.Is(err, m.err) {
+			code, status, message = m.code, m.status, m.message
+			break
+		}
+	}
+
+	var clientErr *clientError
+	if errors.As(err, &clientErr) {
+		message = clientErr.msg
+	}
+
+	var fields []FieldError
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		fields = validationErr.Fields
+	}
+
+	return Problem{
+		Type:    ProblemTypePrefix + code,
+		Code:    code,
+		Title:   http.StatusText(status),
+		Status:  status,
+		Detail:  message,
+		Errors:  fields,
+		Message: message,
+	}
+}
+
+// ProblemCodes lists every code ProblemFor can return, for documentation.
+func ProblemCodes() []string {
+	codes := make([]string, 0, len(errorMappings)+1)
+	for _, m := range errorMappings {
+		codes = append(codes, m.code)
+	}
+	return append(codes, internalErrorCode)
+}
+
+// RequestInstance is the problem instance for the request with the given id,
+// so a client can quote it when reporting a failure.
+func RequestInstance(requestID string) string {
+	if requestID == "" {
+		return ""
+	}
+	return "urn:request:" + requestID
+}
+
+func WriteProblem(w http.ResponseWriter, problem Problem) error {
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(problem.Status)
+
+	b, err := json.Marshal(problem)
+	if err != nil {
+		return err
+	}
+
+	if _, err = w.Write(b); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// WriteError writes the problem for err. requestID becomes the instance and
+// may be empty.
+func WriteError(w http.ResponseWriter, requestID string, err error) error {
+	problem := ProblemFor(err)
+	problem.Instance = RequestInstance(requestID)
+
+	return WriteProblem(w, problem)
+}
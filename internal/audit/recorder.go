@@ -0,0 +1,130 @@
+package audit
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/internal/model"
+)
+
+const (
+	DefaultBufferSize    = 1024
+	DefaultBatchSize     = 100
+	DefaultFlushInterval = time.Second
+)
+
+// RecorderInstance accepts audit events without blocking the caller.
+type RecorderInstance interface {
+	Record(event model.AuthEvent)
+}
+
+// Store persists a batch of audit events.
+type Store interface {
+	InsertAuthEvents(ctx context.Context, events []model.AuthEvent) error
+}
+
+// Recorder queues events in a bounded buffer and writes them in batches from
+// a single worker. When the buffer is full events are dropped and counted
+// rather than slowing down logins.
+type Recorder struct {
+	store         Store
+	logger        *slog.Logger
+	events        chan model.AuthEvent
+	batchSize     int
+	flushInterval time.Duration
+	dropped       atomic.Int64
+}
+
+func NewRecorder(store Store, logger *slog.Logger, bufferSize int) *Recorder {
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+
+	return &Recorder{
+		store:         store,
+		logger:        logger,
+		events:        make(chan model.AuthEvent, bufferSize),
+		batchSize:     DefaultBatchSize,
+		flushInterval: DefaultFlushInterval,
+	}
+}
+
+func (r *Recorder) Record(event model.AuthEvent) {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	select {
+	case r.events <- event:
+	default:
+		r.dropped.Add(1)
+		r.logger.Warn(
+			"Audit buffer full, dropping auth event",
+			"type", event.Type,
+			"outcome", event.Outcome,
+		)
+	}
+}
+
+// Dropped returns how many events were discarded because the buffer was full.
+func (r *Recorder) Dropped() int64 {
+	return r.dropped.Load()
+}
+
+// Run writes queued events until ctx is cancelled, then drains whatever is
+// still buffered.
+func (r *Recorder) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]model.AuthEvent, 0, r.batchSize)
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+
+		if err := r.store.InsertAuthEvents(ctx, batch); err != nil {
+			r.logger.Error(
+				"Failed while writing auth events",
+				"count", len(batch),
+				"error", err,
+			)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case event := <-r.events:
+			batch = append(batch, event)
+			if len(batch) >= r.batchSize {
+				flush(ctx)
+			}
+		case <-ticker.C:
+			flush(ctx)
+		case <-ctx.Done():
+			drainCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			for {
+				select {
+				case event := <-r.events:
+					batch = append(batch, event)
+					if len(batch) >= r.batchSize {
+						flush(drainCtx)
+					}
+				default:
+					flush(drainCtx)
+					return
+				}
+			}
+		}
+	}
+}
+
+// Nop discards every event. It is the default when auditing is not wired up.
+type Nop struct{}
+
+func (Nop) Record(model.AuthEvent) {}
@@ -0,0 +1,63 @@
+package audit
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/dosedaf/syncup-users-service/internal/model"
+)
+
+type mockStore struct {
+	mu     sync.Mutex
+	events []model.AuthEvent
+}
+
+func (m *mockStore) InsertAuthEvents(ctx context.Context, events []model.AuthEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.events = append(m.events, events...)
+	return nil
+}
+
+func TestRecorderDrainsOnShutdown(t *testing.T) {
+	store := &mockStore{}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	recorder := NewRecorder(store, logger, 10)
+
+	for range 5 {
+		recorder.Record(model.AuthEvent{Type: model.AuthEventLogin, Outcome: model.OutcomeSuccess})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		recorder.Run(ctx)
+		close(done)
+	}()
+	cancel()
+	<-done
+
+	if len(store.events) != 5 {
+		t.Fatalf("expected 5 events written, got %d", len(store.events))
+	}
+	if store.events[0].CreatedAt.IsZero() {
+		t.Error("expected CreatedAt to be set when recorded")
+	}
+}
+
+func TestRecorderDropsWhenFull(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	recorder := NewRecorder(&mockStore{}, logger, 2)
+
+	for range 3 {
+		recorder.Record(model.AuthEvent{Type: model.AuthEventLogin})
+	}
+
+	if recorder.Dropped() != 1 {
+		t.Errorf("expected one dropped event, got %d", recorder.Dropped())
+	}
+}
@@ -0,0 +1,370 @@
+package config
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/database"
+	"github.com/dosedaf/syncup-users-service/internal/logging"
+	"github.com/dosedaf/syncup-users-service/internal/outbox"
+	"github.com/dosedaf/syncup-users-service/internal/password"
+	"github.com/dosedaf/syncup-users-service/internal/server"
+	"github.com/dosedaf/syncup-users-service/internal/tracing"
+	"github.com/dosedaf/syncup-users-service/internal/webhook"
+	"github.com/dosedaf/syncup-users-service/middleware"
+)
+
+const MinJWTSecretLength = 32
+
+const (
+	StoragePostgres = "postgres"
+	StorageMemory   = "memory"
+)
+
+// Config is the complete service configuration. Every field is settable from
+// a config file, an environment variable and a command line flag, in
+// increasing order of precedence; see Load. The env tag names the variable
+// (with optional aliases after a comma) and the file key, and the flag name
+// is the variable name in lower case with dashes.
+type Config struct {
+	HTTPAddr              string        `env:"HTTP_ADDR" default:":3000" usage:"address the HTTP server listens on"`
+	HTTPReadHeaderTimeout time.Duration `env:"HTTP_READ_HEADER_TIMEOUT" default:"5s" usage:"time allowed to read request headers"`
+	HTTPReadTimeout       time.Duration `env:"HTTP_READ_TIMEOUT" default:"15s" usage:"time allowed to read a whole request"`
+	HTTPWriteTimeout      time.Duration `env:"HTTP_WRITE_TIMEOUT" default:"15s" usage:"time allowed to write a response"`
+	HTTPIdleTimeout       time.Duration `env:"HTTP_IDLE_TIMEOUT" default:"60s" usage:"keep-alive idle timeout"`
+	GRPCAddr              string        `env:"GRPC_ADDR" default:":9090" usage:"address the gRPC server listens on"`
+	// keep it reachable by the scraper only; it is not behind any auth
+	MetricsAddr string `env:"METRICS_ADDR" default:":9091" usage:"address the Prometheus /metrics listener serves on"`
+	// the timeout covers the delay, the drain and the worker flushes, so the
+	// default leaves room within the 10s docker stop grace period
+	ShutdownTimeout    time.Duration `env:"SHUTDOWN_TIMEOUT" default:"8s" usage:"time allowed for the whole shutdown, including the delay, draining requests and flushing background work"`
+	ShutdownDelay      time.Duration `env:"SHUTDOWN_DELAY" default:"0s" usage:"time /readyz reports failure before requests are drained"`
+	HealthCheckTimeout time.Duration `env:"HEALTH_CHECK_TIMEOUT" default:"2s" usage:"time allowed for each readiness check"`
+
+	LogFormat string `env:"LOG_FORMAT" default:"text" usage:"text or json"`
+	LogLevel  string `env:"LOG_LEVEL" default:"info" usage:"debug, info, warn or error"`
+	// the redaction key defaults to one derived from JWT_SECRET, so hashes
+	// match across instances without another secret to distribute
+	LogRedaction     string `env:"LOG_REDACTION" default:"hash" usage:"hash, remove or off; how personal data is written to logs"`
+	LogRedactionKey  string `env:"LOG_REDACTION_KEY" secret:"true" usage:"HMAC key for hashed log values, derived from JWT_SECRET when empty"`
+	LogRedactedAttrs string `env:"LOG_REDACTED_ATTRS" default:"email,to,ip,ip_prefix,user_agent,token,body" usage:"comma separated attribute keys to redact"`
+
+	// memory needs no database and loses everything on exit; it is meant for
+	// local development and demos
+	Storage          string `env:"STORAGE" default:"postgres" usage:"postgres or memory; where users, sessions and audit events are kept"`
+	DatabaseURL      string `env:"DATABASE_URL" secret:"url" usage:"Postgres connection URL, required for postgres storage"`
+	MigrationsSource string `env:"MIGRATIONS_SOURCE" default:"file://migrations" usage:"golang-migrate source URL"`
+
+	DBMaxConns          int32         `env:"DB_MAX_CONNS" default:"10" usage:"maximum pool connections"`
+	DBMinConns          int32         `env:"DB_MIN_CONNS" default:"2" usage:"minimum idle pool connections"`
+	DBMaxConnLifetime   time.Duration `env:"DB_MAX_CONN_LIFETIME" default:"1h" usage:"maximum lifetime of a pooled connection"`
+	DBMaxConnIdleTime   time.Duration `env:"DB_MAX_CONN_IDLE_TIME" default:"30m" usage:"idle time before a pooled connection is closed"`
+	DBHealthCheckPeriod time.Duration `env:"DB_HEALTH_CHECK_PERIOD" default:"1m" usage:"interval between pool health checks"`
+
+	// SECRET is accepted for .env files written before the variable was
+	// renamed to match docker-compose.
+	JWTSecret string `env:"JWT_SECRET,SECRET" secret:"true" usage:"HMAC key used to sign access tokens"`
+	// without any client, POST /api/v1/introspect and the gRPC ValidateToken
+	// reject every caller
+	IntrospectionClients string `env:"INTROSPECTION_CLIENTS" secret:"true" usage:"id:secret entries, comma separated, of services allowed to introspect or validate tokens"`
+
+	PasswordHashAlgorithm string `env:"PASSWORD_HASH_ALGORITHM" default:"bcrypt" usage:"bcrypt or argon2id"`
+	BcryptCost            int    `env:"BCRYPT_COST" default:"10" usage:"bcrypt cost factor"`
+	Argon2MemoryKiB       uint32 `env:"ARGON2_MEMORY_KIB" default:"65536" usage:"argon2id memory in KiB"`
+	Argon2Iterations      uint32 `env:"ARGON2_ITERATIONS" default:"3" usage:"argon2id iterations"`
+	Argon2Parallelism     uint8  `env:"ARGON2_PARALLELISM" default:"2" usage:"argon2id lanes"`
+	PasswordPepperFile    string `env:"PASSWORD_PEPPER_FILE" usage:"file with version:secret pepper entries"`
+	PasswordPepper        string `env:"PASSWORD_PEPPER" secret:"true" usage:"version:secret pepper entries, comma separated"`
+
+	SessionFlushInterval time.Duration `env:"SESSION_FLUSH_INTERVAL" default:"30s" usage:"how often session last-seen times are written"`
+	PruneInterval        time.Duration `env:"PRUNE_INTERVAL" default:"1h" usage:"how often expired sessions and used tokens are deleted"`
+	AuditBufferSize      int           `env:"AUDIT_BUFFER_SIZE" default:"1024" usage:"audit events buffered before new ones are dropped"`
+
+	TracingExporter    string  `env:"TRACING_EXPORTER" default:"none" usage:"none, stdout or otlp; otlp reads OTEL_EXPORTER_OTLP_ENDPOINT"`
+	TracingServiceName string  `env:"OTEL_SERVICE_NAME" default:"users-service" usage:"service name reported on spans"`
+	TracingSampleRatio float64 `env:"TRACING_SAMPLE_RATIO" default:"1" usage:"fraction of new traces sampled, between 0 and 1"`
+
+	SMTPAddr       string `env:"SMTP_ADDR" usage:"SMTP server host:port, emails are logged when empty"`
+	SMTPUsername   string `env:"SMTP_USERNAME" usage:"SMTP username"`
+	SMTPPassword   string `env:"SMTP_PASSWORD" secret:"true" usage:"SMTP password"`
+	SMTPFrom       string `env:"SMTP_FROM" usage:"sender address for outgoing email"`
+	MailBufferSize int    `env:"MAIL_BUFFER_SIZE" default:"100" usage:"emails queued for sending before new ones are dropped"`
+	NotMeURL       string `env:"NOT_ME_URL" default:"http://localhost:3000/security/not-me" usage:"page the \"this wasn't me\" link points to"`
+	ResetURL       string `env:"PASSWORD_RESET_URL" default:"http://localhost:3000/reset-password" usage:"page the password reset link points to"`
+
+	OutboxPublisher    string        `env:"OUTBOX_PUBLISHER" default:"none" usage:"none, stdout, file or webhook; where user lifecycle events are published"`
+	OutboxFile         string        `env:"OUTBOX_FILE" usage:"file events are appended to, required for the file publisher"`
+	OutboxWebhookURL   string        `env:"OUTBOX_WEBHOOK_URL" secret:"url" usage:"URL events are POSTed to, required for the webhook publisher"`
+	OutboxPollInterval time.Duration `env:"OUTBOX_POLL_INTERVAL" default:"1s" usage:"how often the outbox is checked for events to publish"`
+
+	WebhookPollInterval time.Duration `env:"WEBHOOK_POLL_INTERVAL" default:"1s" usage:"how often webhook deliveries are checked for ones that are due"`
+	WebhookTimeout      time.Duration `env:"WEBHOOK_TIMEOUT" default:"10s" usage:"time allowed for a webhook endpoint to respond"`
+	WebhookMaxAttempts  int           `env:"WEBHOOK_MAX_ATTEMPTS" default:"10" usage:"failed attempts after which a webhook delivery is dead-lettered"`
+}
+
+// Validate checks every setting and reports all problems at once.
+func (c *Config) Validate() error {
+	var errs []error
+
+	switch c.Storage {
+	case StoragePostgres:
+		if c.DatabaseURL == "" {
+			errs = append(errs, errors.New("DATABASE_URL is required when STORAGE is postgres"))
+		}
+	case StorageMemory:
+	default:
+		errs = append(errs, fmt.Errorf("STORAGE must be postgres or memory, got %q", c.Storage))
+	}
+	if c.DatabaseURL != "" {
+		if u, err := url.Parse(c.DatabaseURL); err != nil {
+			errs = append(errs, fmt.Errorf("DATABASE_URL is not a valid URL: %w", redactURLError(err)))
+		} else if u.Scheme != "postgres" && u.Scheme != "postgresql" {
+			errs = append(errs, fmt.Errorf("DATABASE_URL must use the postgres scheme, got %q", u.Scheme))
+		}
+	}
+
+	for _, d := range []struct {
+		key   string
+		value time.Duration
+	}{
+		{"HTTP_READ_HEADER_TIMEOUT", c.HTTPReadHeaderTimeout},
+		{"HTTP_READ_TIMEOUT", c.HTTPReadTimeout},
+		{"HTTP_WRITE_TIMEOUT", c.HTTPWriteTimeout},
+		{"HTTP_IDLE_TIMEOUT", c.HTTPIdleTimeout},
+		{"SHUTDOWN_TIMEOUT", c.ShutdownTimeout},
+		{"HEALTH_CHECK_TIMEOUT", c.HealthCheckTimeout},
+	} {
+		if d.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", d.key))
+		}
+	}
+	if c.ShutdownDelay < 0 {
+		errs = append(errs, errors.New("SHUTDOWN_DELAY must not be negative"))
+	}
+	if c.ShutdownTimeout > 0 && c.ShutdownDelay >= c.ShutdownTimeout {
+		errs = append(errs, errors.New("SHUTDOWN_DELAY must be shorter than SHUTDOWN_TIMEOUT, which includes it"))
+	}
+
+	if c.LogFormat != logging.FormatText && c.LogFormat != logging.FormatJSON {
+		errs = append(errs, fmt.Errorf("LOG_FORMAT must be text or json, got %q", c.LogFormat))
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		errs = append(errs, fmt.Errorf("LOG_LEVEL: %w", err))
+	}
+	if _, err := c.Redactor(); err != nil {
+		errs = append(errs, fmt.Errorf("LOG_REDACTION: %w", err))
+	}
+
+	if c.DBMaxConns < 1 {
+		errs = append(errs, errors.New("DB_MAX_CONNS must be at least 1"))
+	}
+	if c.DBMinConns < 0 || c.DBMinConns > c.DBMaxConns {
+		errs = append(errs, errors.New("DB_MIN_CONNS must be between 0 and DB_MAX_CONNS"))
+	}
+
+	if c.JWTSecret == "" {
+		errs = append(errs, errors.New("JWT_SECRET is required"))
+	} else if len(c.JWTSecret) < MinJWTSecretLength {
+		errs = append(errs, fmt.Errorf("JWT_SECRET must be at least %d bytes, got %d", MinJWTSecretLength, len(c.JWTSecret)))
+	}
+
+	if _, err := c.ServiceClients(); err != nil {
+		errs = append(errs, fmt.Errorf("INTROSPECTION_CLIENTS: %w", err))
+	}
+
+	if _, err := password.NewHasher(c.PasswordHasher()); err != nil {
+		errs = append(errs, fmt.Errorf("password hasher: %w", err))
+	}
+
+	if _, err := c.Pepper(); err != nil {
+		errs = append(errs, fmt.Errorf("password pepper: %w", err))
+	}
+	if c.PasswordPepper != "" && c.PasswordPepperFile != "" {
+		errs = append(errs, errors.New("set only one of PASSWORD_PEPPER and PASSWORD_PEPPER_FILE"))
+	}
+
+	if c.SessionFlushInterval <= 0 {
+		errs = append(errs, errors.New("SESSION_FLUSH_INTERVAL must be positive"))
+	}
+	if c.PruneInterval <= 0 {
+		errs = append(errs, errors.New("PRUNE_INTERVAL must be positive"))
+	}
+	if c.AuditBufferSize < 1 {
+		errs = append(errs, errors.New("AUDIT_BUFFER_SIZE must be at least 1"))
+	}
+
+	switch c.TracingExporter {
+	case tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP:
+	default:
+		errs = append(errs, fmt.Errorf("TRACING_EXPORTER must be none, stdout or otlp, got %q", c.TracingExporter))
+	}
+	if c.TracingSampleRatio < 0 || c.TracingSampleRatio > 1 {
+		errs = append(errs, errors.New("TRACING_SAMPLE_RATIO must be between 0 and 1"))
+	}
+
+	if c.MailBufferSize < 1 {
+		errs = append(errs, errors.New("MAIL_BUFFER_SIZE must be at least 1"))
+	}
+	if c.SMTPAddr != "" && c.SMTPFrom == "" {
+		errs = append(errs, errors.New("SMTP_FROM is required when SMTP_ADDR is set"))
+	}
+
+	if u, err := url.Parse(c.NotMeURL); err != nil || !u.IsAbs() {
+		errs = append(errs, fmt.Errorf("NOT_ME_URL must be an absolute URL, got %q", c.NotMeURL))
+	}
+	if u, err := url.Parse(c.ResetURL); err != nil || !u.IsAbs() {
+		errs = append(errs, fmt.Errorf("PASSWORD_RESET_URL must be an absolute URL, got %q", c.ResetURL))
+	}
+
+	switch c.OutboxPublisher {
+	case outbox.PublisherNone, outbox.PublisherStdout:
+	case outbox.PublisherFile:
+		if c.OutboxFile == "" {
+			errs = append(errs, errors.New("OUTBOX_FILE is required when OUTBOX_PUBLISHER is file"))
+		}
+	case outbox.PublisherWebhook:
+		if u, err := url.Parse(c.OutboxWebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, errors.New("OUTBOX_WEBHOOK_URL must be an absolute http or https URL when OUTBOX_PUBLISHER is webhook"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("OUTBOX_PUBLISHER must be none, stdout, file or webhook, got %q", c.OutboxPublisher))
+	}
+	if c.OutboxPollInterval <= 0 {
+		errs = append(errs, errors.New("OUTBOX_POLL_INTERVAL must be positive"))
+	}
+	if c.WebhookPollInterval <= 0 {
+		errs = append(errs, errors.New("WEBHOOK_POLL_INTERVAL must be positive"))
+	}
+	if c.WebhookTimeout <= 0 {
+		errs = append(errs, errors.New("WEBHOOK_TIMEOUT must be positive"))
+	}
+	if c.WebhookMaxAttempts < 1 {
+		errs = append(errs, errors.New("WEBHOOK_MAX_ATTEMPTS must be at least 1"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Logger builds the root logger. Records logged with a request context go
+// through the request-scoped logger and carry trace ids.
+func (c *Config) Logger(w io.Writer) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		return nil, err
+	}
+
+	handler, err := logging.NewHandler(c.LogFormat, level, w)
+	if err != nil {
+		return nil, err
+	}
+
+	redactor, err := c.Redactor()
+	if err != nil {
+		return nil, err
+	}
+
+	return slog.New(logging.NewContextHandler(tracing.NewLogHandler(redactor.Handler(handler)))), nil
+}
+
+func (c *Config) Redactor() (*logging.Redactor, error) {
+	key := []byte(c.LogRedactionKey)
+	if len(key) == 0 && c.JWTSecret != "" {
+		mac := hmac.New(sha256.New, []byte(c.JWTSecret))
+		mac.Write([]byte("log redaction"))
+		key = mac.Sum(nil)
+	}
+
+	return logging.NewRedactor(c.LogRedaction, key, strings.Split(c.LogRedactedAttrs, ","))
+}
+
+func (c *Config) Server() server.Config {
+	return server.Config{
+		Addr:              c.HTTPAddr,
+		ReadHeaderTimeout: c.HTTPReadHeaderTimeout,
+		ReadTimeout:       c.HTTPReadTimeout,
+		WriteTimeout:      c.HTTPWriteTimeout,
+		IdleTimeout:       c.HTTPIdleTimeout,
+		ShutdownTimeout:   c.ShutdownTimeout,
+		ShutdownDelay:     c.ShutdownDelay,
+	}
+}
+
+func (c *Config) Pool() database.PoolConfig {
+	return database.PoolConfig{
+		URL:               c.DatabaseURL,
+		MaxConns:          c.DBMaxConns,
+		MinConns:          c.DBMinConns,
+		MaxConnLifetime:   c.DBMaxConnLifetime,
+		MaxConnIdleTime:   c.DBMaxConnIdleTime,
+		HealthCheckPeriod: c.DBHealthCheckPeriod,
+	}
+}
+
+func (c *Config) Tracing() tracing.Config {
+	return tracing.Config{
+		Exporter:    c.TracingExporter,
+		ServiceName: c.TracingServiceName,
+		SampleRatio: c.TracingSampleRatio,
+		Output:      os.Stdout,
+	}
+}
+
+func (c *Config) Outbox() outbox.Config {
+	return outbox.Config{
+		Publisher:  c.OutboxPublisher,
+		File:       c.OutboxFile,
+		WebhookURL: c.OutboxWebhookURL,
+		Output:     os.Stdout,
+	}
+}
+
+func (c *Config) Webhooks() webhook.Config {
+	return webhook.Config{
+		PollInterval: c.WebhookPollInterval,
+		Timeout:      c.WebhookTimeout,
+		MaxAttempts:  c.WebhookMaxAttempts,
+	}
+}
+
+func (c *Config) PasswordHasher() password.Config {
+	config := password.DefaultConfig()
+	config.Algorithm = c.PasswordHashAlgorithm
+	config.BcryptCost = c.BcryptCost
+	config.Argon2.Memory = c.Argon2MemoryKiB
+	config.Argon2.Iterations = c.Argon2Iterations
+	config.Argon2.Parallelism = c.Argon2Parallelism
+
+	return config
+}
+
+func (c *Config) ServiceClients() (middleware.ServiceClients, error) {
+	return middleware.ParseServiceClients(c.IntrospectionClients)
+}
+
+func (c *Config) Pepper() (*password.Pepper, error) {
+	return password.LoadPepper(c.PasswordPepperFile, c.PasswordPepper)
+}
+
+// LogValue lets the config be logged directly without leaking secrets.
+func (c *Config) LogValue() slog.Value {
+	return slog.GroupValue(redactedAttrs(c)...)
+}
+
+// url.Parse errors quote the whole input, which may contain the password.
+func redactURLError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+
+	return err
+}
@@ -0,0 +1,222 @@
+package config
+
+import (
+	"bytes"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func envFrom(values map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := values[key]
+		return v, ok
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load(nil, envFrom(map[string]string{
+		"DATABASE_URL": "postgres://postgres:password@db:5432/db?sslmode=disable",
+		"JWT_SECRET":   testSecret,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.HTTPAddr != ":3000" || cfg.GRPCAddr != ":9090" || cfg.MetricsAddr != ":9091" || cfg.DBMaxConns != 10 || cfg.SessionFlushInterval != 30*time.Second {
+		t.Errorf("unexpected defaults %+v", cfg)
+	}
+	if cfg.PasswordHashAlgorithm != "bcrypt" || cfg.BcryptCost != 10 {
+		t.Errorf("unexpected password defaults %+v", cfg)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	file := `{"HTTP_ADDR": ":4000", "DB_MAX_CONNS": 20, "DB_MIN_CONNS": 5, "DATABASE_URL": "postgres://file/db"}`
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(
+		[]string{"-config", path, "-http-addr", ":6000"},
+		envFrom(map[string]string{
+			"HTTP_ADDR":    ":5000",
+			"DB_MAX_CONNS": "30",
+			"SECRET":       testSecret,
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.HTTPAddr != ":6000" {
+		t.Errorf("flag should win, got %q", cfg.HTTPAddr)
+	}
+	if cfg.DBMaxConns != 30 {
+		t.Errorf("env should beat file, got %d", cfg.DBMaxConns)
+	}
+	if cfg.DBMinConns != 5 || cfg.DatabaseURL != "postgres://file/db" {
+		t.Errorf("file should beat defaults, got %d, %q", cfg.DBMinConns, cfg.DatabaseURL)
+	}
+	if cfg.JWTSecret != testSecret {
+		t.Error("expected SECRET to be accepted as an alias for JWT_SECRET")
+	}
+}
+
+func TestLoadReportsEveryProblem(t *testing.T) {
+	_, err := Load(nil, envFrom(map[string]string{
+		"DATABASE_URL":            "mysql://localhost/db",
+		"JWT_SECRET":              "too short",
+		"DB_MAX_CONNS":            "lots",
+		"PASSWORD_HASH_ALGORITHM": "md5",
+		"SMTP_ADDR":               "smtp.example.com:587",
+		"PASSWORD_RESET_URL":      "/reset-password",
+	}))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	for _, want := range []string{"DB_MAX_CONNS", "DATABASE_URL", "JWT_SECRET", "md5", "SMTP_FROM", "PASSWORD_RESET_URL"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to mention %s, got:\n%v", want, err)
+		}
+	}
+}
+
+func TestLoadStorage(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{"postgres needs a database", map[string]string{"JWT_SECRET": testSecret}, "DATABASE_URL is required"},
+		{"memory needs no database", map[string]string{"JWT_SECRET": testSecret, "STORAGE": "memory"}, ""},
+		{"unknown backend", map[string]string{"JWT_SECRET": testSecret, "STORAGE": "sqlite"}, "STORAGE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(nil, envFrom(tt.env))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error mentioning %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLoadShutdown(t *testing.T) {
+	base := map[string]string{"JWT_SECRET": testSecret, "STORAGE": "memory"}
+	with := func(extra map[string]string) map[string]string {
+		env := maps.Clone(base)
+		maps.Copy(env, extra)
+		return env
+	}
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{"defaults", base, ""},
+		{"delay within the timeout", with(map[string]string{"SHUTDOWN_DELAY": "3s", "SHUTDOWN_TIMEOUT": "8s"}), ""},
+		{"delay as long as the timeout", with(map[string]string{"SHUTDOWN_DELAY": "8s", "SHUTDOWN_TIMEOUT": "8s"}), "SHUTDOWN_DELAY"},
+		{"negative delay", with(map[string]string{"SHUTDOWN_DELAY": "-1s"}), "SHUTDOWN_DELAY"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(nil, envFrom(tt.env))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error mentioning %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLoadOutbox(t *testing.T) {
+	base := map[string]string{"JWT_SECRET": testSecret, "STORAGE": "memory"}
+	with := func(extra map[string]string) map[string]string {
+		env := maps.Clone(base)
+		maps.Copy(env, extra)
+		return env
+	}
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{"defaults", base, ""},
+		{"file needs a path", with(map[string]string{"OUTBOX_PUBLISHER": "file"}), "OUTBOX_FILE"},
+		{"file", with(map[string]string{"OUTBOX_PUBLISHER": "file", "OUTBOX_FILE": "events.jsonl"}), ""},
+		{"webhook needs a URL", with(map[string]string{"OUTBOX_PUBLISHER": "webhook"}), "OUTBOX_WEBHOOK_URL"},
+		{"webhook needs http", with(map[string]string{"OUTBOX_PUBLISHER": "webhook", "OUTBOX_WEBHOOK_URL": "ftp://example.com"}), "OUTBOX_WEBHOOK_URL"},
+		{"webhook", with(map[string]string{"OUTBOX_PUBLISHER": "webhook", "OUTBOX_WEBHOOK_URL": "https://example.com/events"}), ""},
+		{"unknown publisher", with(map[string]string{"OUTBOX_PUBLISHER": "kafka"}), "OUTBOX_PUBLISHER"},
+		{"poll interval", with(map[string]string{"OUTBOX_POLL_INTERVAL": "0s"}), "OUTBOX_POLL_INTERVAL"},
+		{"webhook poll interval", with(map[string]string{"WEBHOOK_POLL_INTERVAL": "0s"}), "WEBHOOK_POLL_INTERVAL"},
+		{"webhook timeout", with(map[string]string{"WEBHOOK_TIMEOUT": "-1s"}), "WEBHOOK_TIMEOUT"},
+		{"webhook attempts", with(map[string]string{"WEBHOOK_MAX_ATTEMPTS": "0"}), "WEBHOOK_MAX_ATTEMPTS"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(nil, envFrom(tt.env))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error mentioning %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLogValueRedactsSecrets(t *testing.T) {
+	cfg, err := Load(nil, envFrom(map[string]string{
+		"DATABASE_URL":          "postgres://postgres:hunter2@db:5432/db",
+		"JWT_SECRET":            testSecret,
+		"SMTP_ADDR":             "smtp.example.com:587",
+		"SMTP_FROM":             "no-reply@example.com",
+		"SMTP_PASSWORD":         "smtp-password",
+		"INTROSPECTION_CLIENTS": "billing:billing-secret",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	slog.New(slog.NewTextHandler(&buf, nil)).Info("config", "config", cfg)
+	out := buf.String()
+
+	for _, secret := range []string{"hunter2", testSecret, "smtp-password", "billing-secret"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("log output leaked %q:\n%s", secret, out)
+		}
+	}
+	if !strings.Contains(out, "smtp.example.com:587") {
+		t.Errorf("expected non-secret settings in log output:\n%s", out)
+	}
+}
@@ -0,0 +1,254 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type field struct {
+	names  []string
+	def    string
+	usage  string
+	secret string
+	value  reflect.Value
+}
+
+func (f field) key() string {
+	return f.names[0]
+}
+
+func (f field) flagName() string {
+	return strings.ReplaceAll(strings.ToLower(f.key()), "_", "-")
+}
+
+func fields(c *Config) []field {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+
+	var out []field
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup("env")
+		if !ok {
+			continue
+		}
+
+		out = append(out, field{
+			names:  strings.Split(tag, ","),
+			def:    sf.Tag.Get("default"),
+			usage:  sf.Tag.Get("usage"),
+			secret: sf.Tag.Get("secret"),
+			value:  v.Field(i),
+		})
+	}
+
+	return out
+}
+
+// Load builds the configuration from, in increasing order of precedence,
+// field defaults, the JSON config file named by -config or CONFIG_FILE,
+// environment variables and command line flags. Every invalid or missing
+// setting is reported in the returned error, not just the first one.
+func Load(args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	config := &Config{}
+	fs := fields(config)
+
+	flags := flag.NewFlagSet("users-service", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	configFile := flags.String("config", "", "path to a JSON config file")
+	flagValues := make(map[string]*string, len(fs))
+	for _, f := range fs {
+		flagValues[f.key()] = flags.String(f.flagName(), "", f.usage)
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	setFlags := make(map[string]bool)
+	flags.Visit(func(fl *flag.Flag) { setFlags[fl.Name] = true })
+
+	if *configFile == "" {
+		*configFile, _ = lookupEnv("CONFIG_FILE")
+	}
+
+	var errs []error
+	var fileValues map[string]string
+	if *configFile != "" {
+		var err error
+		if fileValues, err = readFile(*configFile, fs); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, f := range fs {
+		raw, source := f.def, "default"
+
+		if v, ok := fileValues[f.key()]; ok {
+			raw, source = v, "config file"
+		}
+
+		for _, name := range f.names {
+			if v, ok := lookupEnv(name); ok && v != "" {
+				raw, source = v, name
+				break
+			}
+		}
+
+		if setFlags[f.flagName()] {
+			raw, source = *flagValues[f.key()], "-"+f.flagName()
+		}
+
+		if raw == "" {
+			continue
+		}
+
+		if err := set(f.value, raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid value from %s: %w", f.key(), source, err))
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return config, nil
+}
+
+// Usage describes every setting, for -help output.
+func Usage() string {
+	var b strings.Builder
+	b.WriteString("Settings (flag / environment variable / config file key):\n")
+	for _, f := range fields(&Config{}) {
+		fmt.Fprintf(&b, "  -%s / %s\n      %s", f.flagName(), strings.Join(f.names, ", "), f.usage)
+		if f.def != "" {
+			fmt.Fprintf(&b, " (default %q)", f.def)
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+func readFile(path string, fs []field) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed while reading config file %s: %w", path, err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+
+	var raw map[string]any
+	if err = decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("failed while parsing config file %s: %w", path, err)
+	}
+
+	known := make(map[string]bool, len(fs))
+	for _, f := range fs {
+		known[f.key()] = true
+	}
+
+	values := make(map[string]string, len(raw))
+	var errs []error
+	for key, v := range raw {
+		if !known[key] {
+			errs = append(errs, fmt.Errorf("config file %s: unknown setting %q", path, key))
+			continue
+		}
+
+		switch v := v.(type) {
+		case string:
+			values[key] = v
+		case json.Number, bool:
+			values[key] = fmt.Sprint(v)
+		default:
+			errs = append(errs, fmt.Errorf("config file %s: %s must be a string, number or boolean", path, key))
+		}
+	}
+
+	return values, errors.Join(errs...)
+}
+
+func set(v reflect.Value, raw string) error {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint8, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+
+	return nil
+}
+
+func redactedAttrs(c *Config) []slog.Attr {
+	var attrs []slog.Attr
+	for _, f := range fields(c) {
+		value := f.value.Interface()
+
+		switch f.secret {
+		case "true":
+			if !f.value.IsZero() {
+				value = "[REDACTED]"
+			}
+		case "url":
+			if u, err := url.Parse(f.value.String()); err == nil {
+				value = u.Redacted()
+			} else {
+				value = "[REDACTED]"
+			}
+		}
+
+		attrs = append(attrs, slog.Any(f.key(), value))
+	}
+
+	return attrs
+}
@@ -0,0 +1,121 @@
+package device
+
+import (
+	"net/netip"
+	"strings"
+
+	"github.com/dosedaf/syncup-users-service/internal/model"
+)
+
+// Fingerprint is a coarse identity for the client a login came from. It is
+// deliberately fuzzy: browser updates and DHCP lease changes within the same
+// network should not look like a new device.
+type Fingerprint struct {
+	UAFamily string
+	IPPrefix string
+}
+
+func (f Fingerprint) String() string {
+	return f.UAFamily + "|" + f.IPPrefix
+}
+
+func FromClient(client model.ClientInfo) Fingerprint {
+	return Fingerprint{
+		UAFamily: UAFamily(client.UserAgent),
+		IPPrefix: IPPrefix(client.IP),
+	}
+}
+
+// UAFamily reduces a user agent to "browser/os", e.g. "Chrome/Windows".
+func UAFamily(userAgent string) string {
+	if userAgent == "" {
+		return "unknown"
+	}
+
+	return browserFamily(userAgent) + "/" + osFamily(userAgent)
+}
+
+func browserFamily(ua string) string {
+	// order matters: Edge and Opera also claim to be Chrome, Chrome claims to
+	// be Safari
+	switch {
+	case strings.Contains(ua, "Edg/"), strings.Contains(ua, "Edge/"):
+		return "Edge"
+	case strings.Contains(ua, "OPR/"), strings.Contains(ua, "Opera"):
+		return "Opera"
+	case strings.Contains(ua, "Firefox/"), strings.Contains(ua, "FxiOS/"):
+		return "Firefox"
+	case strings.Contains(ua, "Chrome/"), strings.Contains(ua, "CriOS/"):
+		return "Chrome"
+	case strings.Contains(ua, "Safari/"):
+		return "Safari"
+	case strings.HasPrefix(ua, "curl/"):
+		return "curl"
+	default:
+		name, _, _ := strings.Cut(ua, "/")
+		if name == "" || len(name) > 32 {
+			return "other"
+		}
+		return name
+	}
+}
+
+func osFamily(ua string) string {
+	switch {
+	case strings.Contains(ua, "Windows"):
+		return "Windows"
+	case strings.Contains(ua, "iPhone"), strings.Contains(ua, "iPad"):
+		return "iOS"
+	case strings.Contains(ua, "Mac OS X"), strings.Contains(ua, "Macintosh"):
+		return "macOS"
+	case strings.Contains(ua, "Android"):
+		return "Android"
+	case strings.Contains(ua, "Linux"):
+		return "Linux"
+	default:
+		return "other"
+	}
+}
+
+// IPPrefix masks an address to its /24 (IPv4) or /48 (IPv6) network.
+func IPPrefix(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "unknown"
+	}
+
+	addr = addr.Unmap()
+	bits := 48
+	if addr.Is4() {
+		bits = 24
+	}
+
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return "unknown"
+	}
+
+	return prefix.String()
+}
+
+type Decision struct {
+	// NewDevice is true when the fingerprint has not been seen for the user.
+	NewDevice bool
+	// Notify is true when the user should be told about the login. The very
+	// first login of an account is new by definition and not worth an alert.
+	Notify bool
+}
+
+func Decide(known []model.KnownDevice, fingerprint Fingerprint) Decision {
+	key := fingerprint.String()
+	for _, d := range known {
+		if d.Fingerprint == key {
+			return Decision{}
+		}
+	}
+
+	return Decision{
+		NewDevice: true,
+		Notify:    len(known) > 0,
+	}
+}
@@ -0,0 +1,71 @@
+package device
+
+import (
+	"testing"
+
+	"github.com/dosedaf/syncup-users-service/internal/model"
+)
+
+func TestUAFamily(t *testing.T) {
+	tests := []struct {
+		ua   string
+		want string
+	}{
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36", "Chrome/Windows"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36 Edg/126.0.0.0", "Edge/Windows"},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_5) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Safari/605.1.15", "Safari/macOS"},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1", "Safari/iOS"},
+		{"Mozilla/5.0 (X11; Linux x86_64; rv:127.0) Gecko/20100101 Firefox/127.0", "Firefox/Linux"},
+		{"curl/8.5.0", "curl/other"},
+		{"", "unknown"},
+	}
+
+	for _, tt := range tests {
+		if got := UAFamily(tt.ua); got != tt.want {
+			t.Errorf("UAFamily(%q) = %q, want %q", tt.ua, got, tt.want)
+		}
+	}
+}
+
+func TestIPPrefix(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"203.0.113.77", "203.0.113.0/24"},
+		{"::ffff:203.0.113.77", "203.0.113.0/24"},
+		{"2001:db8:abcd:12::1", "2001:db8:abcd::/48"},
+		{"not an ip", "unknown"},
+	}
+
+	for _, tt := range tests {
+		if got := IPPrefix(tt.ip); got != tt.want {
+			t.Errorf("IPPrefix(%q) = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestDecide(t *testing.T) {
+	home := Fingerprint{UAFamily: "Chrome/Windows", IPPrefix: "203.0.113.0/24"}
+	known := []model.KnownDevice{{Fingerprint: home.String()}}
+
+	tests := []struct {
+		name        string
+		known       []model.KnownDevice
+		fingerprint Fingerprint
+		want        Decision
+	}{
+		{"first login", nil, home, Decision{NewDevice: true, Notify: false}},
+		{"known device", known, home, Decision{}},
+		{"new network", known, Fingerprint{UAFamily: "Chrome/Windows", IPPrefix: "198.51.100.0/24"}, Decision{NewDevice: true, Notify: true}},
+		{"new browser", known, Fingerprint{UAFamily: "Firefox/Linux", IPPrefix: "203.0.113.0/24"}, Decision{NewDevice: true, Notify: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Decide(tt.known, tt.fingerprint); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
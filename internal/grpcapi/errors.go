@@ -0,0 +1,78 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dosedaf/syncup-users-service/helper"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+// errorDomain is the ErrorInfo domain of every error this service returns.
+const errorDomain = "users.syncup"
+
+// problemCodes maps every helper.ProblemCodes code to the status code it is
+// returned with. TestEveryProblemCodeHasStatusCode keeps it complete.
+var problemCodes = map[string]codes.Code{
+	"validation_failed":          codes.InvalidArgument,
+	"invalid_request":            codes.InvalidArgument,
+	"request_too_large":          codes.ResourceExhausted,
+	"unauthorized":               codes.Unauthenticated,
+	"forbidden":                  codes.PermissionDenied,
+	"email_already_exists":       codes.AlreadyExists,
+	"user_not_found":             codes.NotFound,
+	"wrong_password":             codes.Unauthenticated,
+	"password_reset_required":    codes.FailedPrecondition,
+	"session_not_found":          codes.NotFound,
+	"session_revoked":            codes.Unauthenticated,
+	"invalid_token":              codes.InvalidArgument,
+	"webhook_not_found":          codes.NotFound,
+	"webhook_delivery_not_found": codes.NotFound,
+	"internal_error":             codes.Internal,
+}
+
+// statusFor translates err using helper.ProblemFor, so a failure carries the
+// same code and message over gRPC as over REST. The code goes in an
+// ErrorInfo reason and invalid fields in a BadRequest detail. Errors
+// without a mapping become Internal and reveal nothing about the cause.
+func statusFor(ctx context.Context, err error) *status.Status {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err)
+	}
+
+	problem := helper.ProblemFor(err)
+	code, ok := problemCodes[problem.Code]
+	if !ok {
+		code = codes.Internal
+	}
+
+	info := &errdetails.ErrorInfo{
+		Reason: problem.Code,
+		Domain: errorDomain,
+	}
+	if state, ok := ctx.Value(callStateKey{}).(*callState); ok {
+		info.Metadata = map[string]string{"request_id": state.requestID}
+	}
+
+	details := []protoadapt.MessageV1{info}
+	if len(problem.Errors) > 0 {
+		badRequest := &errdetails.BadRequest{}
+		for _, f := range problem.Errors {
+			badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       f.Field,
+				Description: f.Message,
+			})
+		}
+		details = append(details, badRequest)
+	}
+
+	st := status.New(code, problem.Detail)
+	if withDetails, err := st.WithDetails(details...); err == nil {
+		st = withDetails
+	}
+
+	return st
+}
@@ -0,0 +1,47 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/dosedaf/syncup-users-service/helper"
+	"google.golang.org/grpc/codes"
+)
+
+func TestEveryProblemCodeHasStatusCode(t *testing.T) {
+	for _, code := range helper.ProblemCodes() {
+		if _, ok := problemCodes[code]; !ok {
+			t.Errorf("problem code %q has no gRPC status code", code)
+		}
+	}
+}
+
+func TestStatusFor(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		err     error
+		code    codes.Code
+		message string
+	}{
+		{"sentinel", fmt.Errorf("wrapped: %w", helper.ErrSessionRevoked), codes.Unauthenticated, "Session revoked"},
+		{"custom message", helper.WithMessage(helper.ErrForbidden, "Admin access required"), codes.PermissionDenied, "Admin access required"},
+		{"unmapped", errors.New("connection refused"), codes.Internal, helper.ProblemFor(nil).Detail},
+		{"cancelled", fmt.Errorf("query: %w", context.Canceled), codes.Canceled, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := statusFor(ctx, tt.err)
+			if st.Code() != tt.code {
+				t.Errorf("expected %s, got %s", tt.code, st.Code())
+			}
+			if tt.message != "" && st.Message() != tt.message {
+				t.Errorf("expected message %q, got %q", tt.message, st.Message())
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package grpcapi
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"net"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/helper"
+	"github.com/dosedaf/syncup-users-service/internal/logging"
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/dosedaf/syncup-users-service/internal/token"
+	"github.com/dosedaf/syncup-users-service/middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// requestIDMetadata is the gRPC spelling of the X-Request-ID header.
+const requestIDMetadata = "x-request-id"
+
+type callStateKey struct{}
+
+// callState is filled in by interceptors further in and read back by
+// accessLog, like the request state of the HTTP access log.
+type callState struct {
+	requestID string
+	userID    *int
+}
+
+type identityKey struct{}
+
+// accessLog accepts the caller's x-request-id or generates one, echoes it in
+// the response header, stores a logger carrying it in the context and
+// writes one line per call.
+func accessLog(logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+
+		requestID := middleware.EnsureRequestID(firstMetadata(ctx, requestIDMetadata))
+		_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDMetadata, requestID))
+
+		state := &callState{requestID: requestID}
+		ctx = logging.WithLogger(ctx, logger.With("request_id", requestID))
+		ctx = context.WithValue(ctx, callStateKey{}, state)
+
+		resp, err := handler(ctx, req)
+
+		code := status.Code(err)
+		level := slog.LevelInfo
+		if serverFault(code) {
+			level = slog.LevelError
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", info.FullMethod),
+			slog.String("code", code.String()),
+			slog.Duration("duration", time.Since(start)),
+		}
+		if state.userID != nil {
+			attrs = append(attrs, slog.Int("user_id", *state.userID))
+		}
+
+		logger.LogAttrs(ctx, level, "Call served", attrs...)
+
+		return resp, err
+	}
+}
+
+// mapErrors turns returned errors and panics into statuses, logging them
+// the way the REST error handler does.
+func mapErrors(logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+
+			logger.ErrorContext(ctx, "Recovered from panic",
+				"panic", fmt.Sprint(v),
+				"stack", string(debug.Stack()),
+			)
+			resp, err = nil, statusFor(ctx, fmt.Errorf("panic: %v", v)).Err()
+		}()
+
+		resp, err = handler(ctx, req)
+		if err == nil {
+			return resp, nil
+		}
+
+		st := statusFor(ctx, err)
+		if serverFault(st.Code()) {
+			logger.ErrorContext(ctx, "Call failed", "error", err)
+		} else {
+			logger.InfoContext(ctx, "Call rejected", "code", st.Code().String(), "error", err)
+		}
+
+		return nil, st.Err()
+	}
+}
+
+// authenticate checks the authorization metadata of every method that is
+// not public. Service methods need the Basic credentials of one of clients,
+// as introspection does; the rest need a bearer token, whose identity is
+// put in the context.
+func authenticate(auth Verifier, clients middleware.ServiceClients) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if publicMethods[info.FullMethod] {
+			return handler(ctx, req)
+		}
+
+		authorization := firstMetadata(ctx, "authorization")
+		if authorization == "" {
+			return nil, helper.WithMessage(helper.ErrUnauthorized, "authorization metadata required")
+		}
+
+		if serviceMethods[info.FullMethod] {
+			id, secret, ok := basicCredentials(authorization)
+			if !ok {
+				return nil, helper.WithMessage(helper.ErrUnauthorized, "service client credentials required")
+			}
+			if !clients.Authenticate(id, secret) {
+				return nil, helper.WithMessage(helper.ErrUnauthorized, "invalid service client credentials")
+			}
+
+			if logger := logging.FromContext(ctx, nil); logger != nil {
+				ctx = logging.WithLogger(ctx, logger.With("client_id", id))
+			}
+			return handler(ctx, req)
+		}
+
+		bearer, found := strings.CutPrefix(authorization, "Bearer ")
+		if !found {
+			return nil, helper.WithMessage(helper.ErrUnauthorized, "invalid authorization metadata format")
+		}
+
+		identity, err := auth.Authenticate(ctx, bearer)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(withIdentity(ctx, identity), req)
+	}
+}
+
+// withIdentity stores the authenticated caller and adds it to the access log
+// and the call's logger.
+func withIdentity(ctx context.Context, identity *token.Identity) context.Context {
+	userID := identity.User.ID
+	if state, ok := ctx.Value(callStateKey{}).(*callState); ok {
+		state.userID = &userID
+	}
+	if logger := logging.FromContext(ctx, nil); logger != nil {
+		ctx = logging.WithLogger(ctx, logger.With("user_id", userID))
+	}
+
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// identityFrom returns the caller authenticate let through. A missing
+// identity means the method was wrongly listed as public.
+func identityFrom(ctx context.Context) (*token.Identity, error) {
+	identity, ok := ctx.Value(identityKey{}).(*token.Identity)
+	if !ok {
+		return nil, fmt.Errorf("no authenticated caller in context")
+	}
+
+	return identity, nil
+}
+
+// clientInfo identifies the caller by user agent and the address of the
+// connection, as the REST handlers do.
+func clientInfo(ctx context.Context) model.ClientInfo {
+	var ip string
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		ip = p.Addr.String()
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+	}
+
+	return model.ClientInfo{
+		UserAgent: firstMetadata(ctx, "user-agent"),
+		IP:        ip,
+	}
+}
+
+// basicCredentials parses an HTTP Basic authorization value the way
+// http.Request.BasicAuth does.
+func basicCredentials(authorization string) (id, secret string, ok bool) {
+	encoded, found := strings.CutPrefix(authorization, "Basic ")
+	if !found {
+		return "", "", false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", false
+	}
+
+	return strings.Cut(string(decoded), ":")
+}
+
+func firstMetadata(ctx context.Context, key string) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+// serverFault reports whether code means the server, not the caller, is at
+// fault, the gRPC equivalent of a 5xx.
+func serverFault(code codes.Code) bool {
+	switch code {
+	case codes.Internal, codes.Unknown, codes.DataLoss:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,98 @@
+// Package grpcapi serves the users.v1 gRPC API on its own port next to the
+// REST API. It is a thin layer over the same ServiceInstance the HTTP
+// handlers use: calls are authenticated by the same token.Verifier as
+// JWTMiddleware, and failures are mapped from the helper sentinels to
+// status codes carrying the same stable codes as problem details.
+package grpcapi
+
+import (
+	"context"
+	"log/slog"
+	"net"
+
+	"github.com/dosedaf/syncup-users-service/internal/service"
+	"github.com/dosedaf/syncup-users-service/internal/token"
+	"github.com/dosedaf/syncup-users-service/middleware"
+	usersv1 "github.com/dosedaf/syncup-users-service/proto/users/v1"
+	"google.golang.org/grpc"
+)
+
+// Verifier checks access tokens. *token.Verifier is one. Authenticate is
+// used for the caller's own token and counts as session activity; Verify
+// is used for tokens other services ask about.
+type Verifier interface {
+	Authenticate(ctx context.Context, token string) (*token.Identity, error)
+	Verify(ctx context.Context, token string) (*token.Identity, error)
+}
+
+type Deps struct {
+	Users          service.ServiceInstance
+	Auth           Verifier
+	ServiceClients middleware.ServiceClients
+	Logger         *slog.Logger
+}
+
+// publicMethods can be called without credentials.
+var publicMethods = map[string]bool{
+	usersv1.UserService_Register_FullMethodName: true,
+	usersv1.UserService_Login_FullMethodName:    true,
+}
+
+// serviceMethods are called by other services rather than users, with
+// service client credentials instead of a bearer token.
+var serviceMethods = map[string]bool{
+	usersv1.UserService_ValidateToken_FullMethodName: true,
+}
+
+type Server struct {
+	grpc   *grpc.Server
+	logger *slog.Logger
+}
+
+// New builds the gRPC server. Interceptors run outermost first: the access
+// log, panic recovery and error mapping, then authentication.
+func New(d Deps, opts ...grpc.ServerOption) *Server {
+	opts = append([]grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(
+			accessLog(d.Logger),
+			mapErrors(d.Logger),
+			authenticate(d.Auth, d.ServiceClients),
+		),
+	}, opts...)
+
+	s := grpc.NewServer(opts...)
+	usersv1.RegisterUserServiceServer(s, &usersServer{
+		users: d.Users,
+		auth:  d.Auth,
+	})
+
+	return &Server{
+		grpc:   s,
+		logger: d.Logger,
+	}
+}
+
+// Serve serves calls on ln until Shutdown.
+func (s *Server) Serve(ln net.Listener) error {
+	s.logger.Info("Starting gRPC server", "addr", ln.Addr().String())
+	return s.grpc.Serve(ln)
+}
+
+// Shutdown stops accepting calls and waits for in-flight ones, cancelling
+// whatever is still running once ctx is done. It fits server.OnDrain.
+func (s *Server) Shutdown(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		s.grpc.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.logger.Error("Failed to drain in-flight gRPC calls before the deadline")
+		s.grpc.Stop()
+		<-done
+	}
+	s.logger.Info("gRPC server stopped")
+}
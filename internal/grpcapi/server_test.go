@@ -0,0 +1,338 @@
+package grpcapi_test
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/internal/grpcapi"
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/dosedaf/syncup-users-service/internal/password"
+	"github.com/dosedaf/syncup-users-service/internal/repository/memory"
+	"github.com/dosedaf/syncup-users-service/internal/service"
+	"github.com/dosedaf/syncup-users-service/internal/session"
+	"github.com/dosedaf/syncup-users-service/internal/token"
+	"github.com/dosedaf/syncup-users-service/middleware"
+	usersv1 "github.com/dosedaf/syncup-users-service/proto/users/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const (
+	testJWTSecret    = "a test secret that is long enough for HS256"
+	testPassword     = "a good password"
+	testClientID     = "billing"
+	testClientSecret = "a service client secret"
+)
+
+type testServer struct {
+	client   usersv1.UserServiceClient
+	users    *memory.UserRepository
+	sessions *memory.SessionRepository
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	users := memory.NewUserRepository()
+	sessions := memory.NewSessionRepository()
+
+	// the cheapest bcrypt cost keeps the test fast
+	hasher, err := password.NewHasher(password.Config{Algorithm: password.AlgorithmBcrypt, BcryptCost: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := memory.NewTxManager(users, sessions, memory.NewAuditRepository(), memory.NewDeviceRepository(), memory.NewOutboxRepository(), memory.NewTokenRepository())
+	svc := service.NewUserService(users, sessions, logger, testJWTSecret, service.WithPasswordHasher(hasher), service.WithTxManager(tx))
+	tracker := session.NewTracker(sessions, logger, time.Minute)
+
+	srv := grpcapi.New(grpcapi.Deps{
+		Users:          svc,
+		Auth:           token.NewVerifier(users, sessions, tracker, logger, testJWTSecret),
+		ServiceClients: middleware.ServiceClients{testClientID: testClientSecret},
+		Logger:         logger,
+	})
+
+	ln := bufconn.Listen(1 << 20)
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return ln.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return &testServer{client: usersv1.NewUserServiceClient(conn), users: users, sessions: sessions}
+}
+
+func (s *testServer) register(t *testing.T, email string) {
+	t.Helper()
+
+	_, err := s.client.Register(context.Background(), &usersv1.RegisterRequest{Email: email, Password: testPassword})
+	if err != nil {
+		t.Fatalf("register %s: %v", email, err)
+	}
+}
+
+func (s *testServer) login(t *testing.T, email string) string {
+	t.Helper()
+
+	resp, err := s.client.Login(context.Background(), &usersv1.LoginRequest{Email: email, Password: testPassword})
+	if err != nil {
+		t.Fatalf("login %s: %v", email, err)
+	}
+
+	return resp.GetAccessToken()
+}
+
+func (s *testServer) userID(t *testing.T, email string) int64 {
+	t.Helper()
+
+	user, err := s.users.GetUserByEmail(context.Background(), email)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return int64(user.ID)
+}
+
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func withClient(ctx context.Context, id, secret string) context.Context {
+	credentials := base64.StdEncoding.EncodeToString([]byte(id + ":" + secret))
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Basic "+credentials)
+}
+
+// expectStatus checks err carries code and an ErrorInfo with reason, the
+// problem code the REST API would have returned.
+func expectStatus(t *testing.T, err error, code codes.Code, reason string) *status.Status {
+	t.Helper()
+
+	st, ok := status.FromError(err)
+	if !ok {
+		t.Fatalf("expected a status error, got %v", err)
+	}
+	if st.Code() != code {
+		t.Fatalf("expected %s, got %s: %s", code, st.Code(), st.Message())
+	}
+
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			if info.GetReason() != reason {
+				t.Errorf("expected reason %q, got %q", reason, info.GetReason())
+			}
+			if info.GetMetadata()["request_id"] == "" {
+				t.Error("expected the request id in the error info")
+			}
+			return st
+		}
+	}
+	t.Errorf("expected an ErrorInfo detail in %v", st.Details())
+
+	return st
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := context.Background()
+
+	srv.register(t, "member@example.com")
+	if access := srv.login(t, "member@example.com"); access == "" {
+		t.Error("expected an access token")
+	}
+
+	_, err := srv.client.Register(ctx, &usersv1.RegisterRequest{Email: "member@example.com", Password: testPassword})
+	expectStatus(t, err, codes.AlreadyExists, "email_already_exists")
+
+	_, err = srv.client.Login(ctx, &usersv1.LoginRequest{Email: "member@example.com", Password: "wrong password"})
+	expectStatus(t, err, codes.Unauthenticated, "wrong_password")
+
+	_, err = srv.client.Register(ctx, &usersv1.RegisterRequest{Email: "nope"})
+	st := expectStatus(t, err, codes.InvalidArgument, "validation_failed")
+
+	var fields []string
+	for _, detail := range st.Details() {
+		if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+			for _, v := range badRequest.GetFieldViolations() {
+				fields = append(fields, v.GetField())
+			}
+		}
+	}
+	if len(fields) != 2 || fields[0] != "email" || fields[1] != "password" {
+		t.Errorf("expected email and password violations, got %v", fields)
+	}
+}
+
+func TestGetUser(t *testing.T) {
+	srv := newTestServer(t)
+
+	srv.register(t, "member@example.com")
+	srv.register(t, "other@example.com")
+	srv.register(t, "admin@example.com")
+	if err := srv.users.SetRole("admin@example.com", model.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	member := srv.login(t, "member@example.com")
+	admin := srv.login(t, "admin@example.com")
+	memberID := srv.userID(t, "member@example.com")
+	otherID := srv.userID(t, "other@example.com")
+
+	resp, err := srv.client.GetUser(withToken(member), &usersv1.GetUserRequest{Id: memberID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user := resp.GetUser(); user.GetId() != memberID || user.GetEmail() != "member@example.com" || user.GetCreateTime() == nil {
+		t.Errorf("unexpected user %v", user)
+	}
+
+	_, err = srv.client.GetUser(withToken(member), &usersv1.GetUserRequest{Id: otherID})
+	expectStatus(t, err, codes.PermissionDenied, "forbidden")
+
+	resp, err = srv.client.GetUser(withToken(admin), &usersv1.GetUserRequest{Id: otherID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetUser().GetEmail() != "other@example.com" {
+		t.Errorf("expected admin to get another user, got %v", resp.GetUser())
+	}
+
+	_, err = srv.client.GetUser(withToken(admin), &usersv1.GetUserRequest{Id: 9999})
+	expectStatus(t, err, codes.NotFound, "user_not_found")
+
+	_, err = srv.client.GetUser(context.Background(), &usersv1.GetUserRequest{Id: memberID})
+	expectStatus(t, err, codes.Unauthenticated, "unauthorized")
+
+	_, err = srv.client.GetUser(withToken("not.a.token"), &usersv1.GetUserRequest{Id: memberID})
+	expectStatus(t, err, codes.Unauthenticated, "unauthorized")
+}
+
+func TestBatchGetUsers(t *testing.T) {
+	srv := newTestServer(t)
+
+	srv.register(t, "member@example.com")
+	srv.register(t, "admin@example.com")
+	if err := srv.users.SetRole("admin@example.com", model.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	member := srv.login(t, "member@example.com")
+	admin := srv.login(t, "admin@example.com")
+	memberID := srv.userID(t, "member@example.com")
+	adminID := srv.userID(t, "admin@example.com")
+
+	_, err := srv.client.BatchGetUsers(withToken(member), &usersv1.BatchGetUsersRequest{Ids: []int64{memberID}})
+	expectStatus(t, err, codes.PermissionDenied, "forbidden")
+
+	resp, err := srv.client.BatchGetUsers(withToken(admin), &usersv1.BatchGetUsersRequest{Ids: []int64{adminID, 9999, memberID, adminID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int64
+	for _, user := range resp.GetUsers() {
+		got = append(got, user.GetId())
+	}
+	if len(got) != 2 || got[0] != memberID || got[1] != adminID {
+		t.Errorf("expected users %d and %d in ID order, got %v", memberID, adminID, got)
+	}
+
+	tooMany := make([]int64, service.MaxBatchGetUsers+1)
+	for i := range tooMany {
+		tooMany[i] = int64(i + 1)
+	}
+	_, err = srv.client.BatchGetUsers(withToken(admin), &usersv1.BatchGetUsersRequest{Ids: tooMany})
+	expectStatus(t, err, codes.InvalidArgument, "validation_failed")
+}
+
+func TestValidateToken(t *testing.T) {
+	srv := newTestServer(t)
+	ctx := withClient(context.Background(), testClientID, testClientSecret)
+
+	srv.register(t, "member@example.com")
+	access := srv.login(t, "member@example.com")
+
+	for name, callCtx := range map[string]context.Context{
+		"no credentials": context.Background(),
+		"bearer token":   withToken(access),
+		"wrong secret":   withClient(context.Background(), testClientID, "guess"),
+		"unknown client": withClient(context.Background(), "search", testClientSecret),
+	} {
+		_, err := srv.client.ValidateToken(callCtx, &usersv1.ValidateTokenRequest{Token: access})
+		if status.Code(err) != codes.Unauthenticated {
+			t.Errorf("%s: expected Unauthenticated, got %v", name, err)
+		}
+	}
+
+	resp, err := srv.client.ValidateToken(ctx, &usersv1.ValidateTokenRequest{Token: access})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.GetValid() || resp.GetUser().GetEmail() != "member@example.com" || resp.GetSessionId() == "" {
+		t.Errorf("unexpected response %v", resp)
+	}
+	if expires := resp.GetExpireTime().AsTime(); !expires.After(time.Now()) {
+		t.Errorf("expected an expiry in the future, got %v", expires)
+	}
+
+	resp, err = srv.client.ValidateToken(ctx, &usersv1.ValidateTokenRequest{Token: "not.a.token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetValid() || resp.GetUser() != nil {
+		t.Errorf("expected a garbage token to be invalid, got %v", resp)
+	}
+
+	if err := srv.sessions.RevokeAllSessions(context.Background(), int(srv.userID(t, "member@example.com"))); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = srv.client.ValidateToken(ctx, &usersv1.ValidateTokenRequest{Token: access})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetValid() {
+		t.Error("expected a token of a revoked session to be invalid")
+	}
+
+	_, err = srv.client.ValidateToken(ctx, &usersv1.ValidateTokenRequest{})
+	expectStatus(t, err, codes.InvalidArgument, "validation_failed")
+}
+
+func TestRequestIDIsEchoed(t *testing.T) {
+	srv := newTestServer(t)
+
+	var header metadata.MD
+	client := withClient(context.Background(), testClientID, testClientSecret)
+	ctx := metadata.AppendToOutgoingContext(client, "x-request-id", "caller-chosen-id")
+	_, err := srv.client.ValidateToken(ctx, &usersv1.ValidateTokenRequest{Token: "not.a.token"}, grpc.Header(&header))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := header.Get("x-request-id"); len(got) != 1 || got[0] != "caller-chosen-id" {
+		t.Errorf("expected the caller's request id back, got %v", got)
+	}
+
+	_, err = srv.client.ValidateToken(client, &usersv1.ValidateTokenRequest{Token: "not.a.token"}, grpc.Header(&header))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := header.Get("x-request-id"); len(got) != 1 || got[0] == "" {
+		t.Errorf("expected a generated request id, got %v", got)
+	}
+}
@@ -0,0 +1,148 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/dosedaf/syncup-users-service/helper"
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/dosedaf/syncup-users-service/internal/service"
+	"github.com/dosedaf/syncup-users-service/internal/token"
+	usersv1 "github.com/dosedaf/syncup-users-service/proto/users/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type usersServer struct {
+	usersv1.UnimplementedUserServiceServer
+
+	users service.ServiceInstance
+	auth  Verifier
+}
+
+func (s *usersServer) Register(ctx context.Context, req *usersv1.RegisterRequest) (*usersv1.RegisterResponse, error) {
+	credential := model.Credential{Email: req.GetEmail(), Password: req.GetPassword()}
+	if err := service.ValidateCredential(credential, true); err != nil {
+		return nil, err
+	}
+
+	if err := s.users.Register(ctx, credential, clientInfo(ctx)); err != nil {
+		return nil, fmt.Errorf("failed while registering user: %w", err)
+	}
+
+	return &usersv1.RegisterResponse{}, nil
+}
+
+func (s *usersServer) Login(ctx context.Context, req *usersv1.LoginRequest) (*usersv1.LoginResponse, error) {
+	credential := model.Credential{Email: req.GetEmail(), Password: req.GetPassword()}
+	if err := service.ValidateCredential(credential, false); err != nil {
+		return nil, err
+	}
+
+	token, err := s.users.Login(ctx, credential, clientInfo(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed while logging in: %w", err)
+	}
+
+	return &usersv1.LoginResponse{AccessToken: token}, nil
+}
+
+// GetUser returns the caller themselves, or any user when the caller is an
+// admin.
+func (s *usersServer) GetUser(ctx context.Context, req *usersv1.GetUserRequest) (*usersv1.GetUserResponse, error) {
+	identity, err := identityFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	id := req.GetId()
+	if id < 1 {
+		return nil, helper.InvalidField("id", "must be a positive integer")
+	}
+	if int64(identity.User.ID) != id && identity.User.Role != model.RoleAdmin {
+		return nil, helper.WithMessage(helper.ErrForbidden, "Only admins can get other users")
+	}
+
+	user, err := s.users.GetUser(ctx, int(id))
+	if errors.Is(err, helper.ErrUserNotFound) {
+		return nil, helper.WithMessage(err, "User not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed while getting user: %w", err)
+	}
+
+	return &usersv1.GetUserResponse{User: toProtoUser(user)}, nil
+}
+
+// BatchGetUsers is admin only. Unknown IDs are left out of the response.
+func (s *usersServer) BatchGetUsers(ctx context.Context, req *usersv1.BatchGetUsersRequest) (*usersv1.BatchGetUsersResponse, error) {
+	identity, err := identityFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if identity.User.Role != model.RoleAdmin {
+		return nil, helper.WithMessage(helper.ErrForbidden, "Admin access required")
+	}
+
+	ids := make([]int, 0, len(req.GetIds()))
+	for _, id := range req.GetIds() {
+		if id < 1 {
+			return nil, helper.InvalidField("ids", "must be positive integers")
+		}
+		ids = append(ids, int(id))
+	}
+
+	users, err := s.users.BatchGetUsers(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed while getting users: %w", err)
+	}
+
+	response := &usersv1.BatchGetUsersResponse{Users: make([]*usersv1.User, 0, len(users))}
+	for i := range users {
+		response.Users = append(response.Users, toProtoUser(&users[i]))
+	}
+
+	return response, nil
+}
+
+// ValidateToken lets other services check an access token with the same
+// rules as the REST API. A token that is rejected is reported as invalid
+// rather than failing the call; only internal failures are errors.
+func (s *usersServer) ValidateToken(ctx context.Context, req *usersv1.ValidateTokenRequest) (*usersv1.ValidateTokenResponse, error) {
+	if req.GetToken() == "" {
+		return nil, helper.InvalidField("token", "is required")
+	}
+
+	identity, err := s.auth.Verify(ctx, req.GetToken())
+	if token.Rejected(err) {
+		return &usersv1.ValidateTokenResponse{Valid: false}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed while validating token: %w", err)
+	}
+
+	response := &usersv1.ValidateTokenResponse{
+		Valid:     true,
+		User:      toProtoUser(identity.User),
+		SessionId: identity.Session.ID,
+	}
+	if !identity.ExpiresAt.IsZero() {
+		response.ExpireTime = timestamppb.New(identity.ExpiresAt)
+	}
+
+	return response, nil
+}
+
+func toProtoUser(user *model.User) *usersv1.User {
+	u := &usersv1.User{
+		Id:         int64(user.ID),
+		Email:      user.Email,
+		Role:       user.Role,
+		CreateTime: timestamppb.New(user.CreatedAt),
+	}
+	if user.UpdatedAt != nil {
+		u.UpdateTime = timestamppb.New(*user.UpdatedAt)
+	}
+
+	return u
+}
@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/helper"
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/dosedaf/syncup-users-service/internal/service"
+)
+
+type AuditHandlerInstance interface {
+	MySecurityEvents(w http.ResponseWriter, r *http.Request) error
+	SecurityEvents(w http.ResponseWriter, r *http.Request) error
+}
+
+type AuditHandler struct {
+	service service.AuditServiceInstance
+	logger  *slog.Logger
+}
+
+func NewAuditHandler(service service.AuditServiceInstance, logger *slog.Logger) AuditHandlerInstance {
+	return &AuditHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+type securityEventsResponse struct {
+	Events []model.AuthEvent `json:"events"`
+	// NextBefore is passed back as ?before= to fetch the next page. It is
+	// zero on the last page.
+	NextBefore int64 `json:"next_before"`
+}
+
+func (h *AuditHandler) MySecurityEvents(w http.ResponseWriter, r *http.Request) error {
+	user, err := userFromContext(r)
+	if err != nil {
+		return err
+	}
+
+	filter, err := parseAuthEventFilter(r.URL.Query(), false)
+	if err != nil {
+		return err
+	}
+
+	events, err := h.service.ListUserEvents(r.Context(), user.ID, filter)
+	if err != nil {
+		return fmt.Errorf("failed while listing security events: %w", err)
+	}
+
+	return helper.JSONResponse(w, http.StatusOK, "Security events retrieved successfully", newSecurityEventsResponse(events, filter))
+}
+
+func (h *AuditHandler) SecurityEvents(w http.ResponseWriter, r *http.Request) error {
+	admin, err := userFromContext(r)
+	if err != nil {
+		return err
+	}
+
+	filter, err := parseAuthEventFilter(r.URL.Query(), true)
+	if err != nil {
+		return err
+	}
+
+	events, err := h.service.ListEvents(r.Context(), admin, filter, clientInfo(r))
+	if err != nil {
+		return fmt.Errorf("failed while querying audit log: %w", err)
+	}
+
+	return helper.JSONResponse(w, http.StatusOK, "Security events retrieved successfully", newSecurityEventsResponse(events, filter))
+}
+
+func newSecurityEventsResponse(events []model.AuthEvent, filter model.AuthEventFilter) securityEventsResponse {
+	response := securityEventsResponse{Events: events}
+	if response.Events == nil {
+		response.Events = []model.AuthEvent{}
+	}
+
+	// a full page means there may be more
+	if filter.Limit > 0 && len(events) == filter.Limit {
+		response.NextBefore = events[len(events)-1].ID
+	}
+
+	return response
+}
+
+// parseAuthEventFilter reads audit log filters from the query string. Only
+// admins may filter by user_id and actor_id.
+func parseAuthEventFilter(query url.Values, admin bool) (model.AuthEventFilter, error) {
+	filter := model.AuthEventFilter{
+		Type:    query.Get("type"),
+		Outcome: query.Get("outcome"),
+		Limit:   model.DefaultAuthEventLimit,
+	}
+
+	limit, err := positiveIntParam(query, "limit")
+	if err != nil {
+		return filter, err
+	}
+	if limit > 0 {
+		filter.Limit = int(min(limit, model.MaxAuthEventLimit))
+	}
+
+	if filter.BeforeID, err = positiveIntParam(query, "before"); err != nil {
+		return filter, err
+	}
+	if filter.Since, err = timeParam(query, "since"); err != nil {
+		return filter, err
+	}
+	if filter.Until, err = timeParam(query, "until"); err != nil {
+		return filter, err
+	}
+
+	if !admin {
+		return filter, nil
+	}
+
+	if userID, err := positiveIntParam(query, "user_id"); err != nil {
+		return filter, err
+	} else if userID > 0 {
+		id := int(userID)
+		filter.SubjectID = &id
+	}
+
+	if actorID, err := positiveIntParam(query, "actor_id"); err != nil {
+		return filter, err
+	} else if actorID > 0 {
+		id := int(actorID)
+		filter.ActorID = &id
+	}
+
+	return filter, nil
+}
+
+// positiveIntParam returns 0 when the parameter is absent.
+func positiveIntParam(query url.Values, key string) (int64, error) {
+	raw := query.Get(key)
+	if raw == "" {
+		return 0, nil
+	}
+
+	v, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || v < 1 {
+		return 0, helper.InvalidField(key, "must be a positive integer")
+	}
+
+	return v, nil
+}
+
+// timeParam returns the zero time when the parameter is absent.
+func timeParam(query url.Values, key string) (time.Time, error) {
+	raw := query.Get(key)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+
+	v, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, helper.InvalidField(key, "must be an RFC 3339 timestamp")
+	}
+
+	return v, nil
+}
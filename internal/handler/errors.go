@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/dosedaf/syncup-users-service/helper"
+	"github.com/dosedaf/syncup-users-service/middleware"
+)
+
+// Func is an HTTP handler that reports failure by returning an error
+// instead of writing the error response itself.
+type Func func(w http.ResponseWriter, r *http.Request) error
+
+// ErrorHandler adapts Funcs to http.Handler and is the one place returned
+// errors are logged and written to the client, using helper.ProblemFor.
+type ErrorHandler struct {
+	logger *slog.Logger
+}
+
+func NewErrorHandler(logger *slog.Logger) *ErrorHandler {
+	return &ErrorHandler{
+		logger: logger,
+	}
+}
+
+func (e *ErrorHandler) Handle(f Func) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := middleware.NewResponseRecorder(w)
+
+		err := f(rec, r)
+		if err == nil {
+			return
+		}
+
+		if rec.Written() {
+			// too late for an error response, the client got a partial one
+			e.logger.ErrorContext(r.Context(), "Failed while writing response", "error", err)
+			return
+		}
+
+		problem := helper.ProblemFor(err)
+		problem.Instance = helper.RequestInstance(middleware.RequestID(r.Context()))
+		if problem.Status >= http.StatusInternalServerError {
+			e.logger.ErrorContext(r.Context(), "Request failed", "error", err)
+		} else {
+			e.logger.InfoContext(r.Context(), "Request rejected", "status", problem.Status, "error", err)
+		}
+
+		if writeErr := helper.WriteProblem(rec, problem); writeErr != nil {
+			e.logger.ErrorContext(r.Context(), "failed to write problem response", "error", writeErr)
+		}
+	})
+}
@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dosedaf/syncup-users-service/helper"
+	"github.com/dosedaf/syncup-users-service/middleware"
+)
+
+func TestErrorHandlerMapsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		status  int
+		message string
+	}{
+		{"wrapped sentinel", fmt.Errorf("login: %w", helper.ErrWrongPassword), http.StatusUnauthorized, "Wrong Password"},
+		{"conflict", helper.ErrEmailAlreadyExists, http.StatusConflict, "User with this email already exists"},
+		{"custom message", helper.InvalidRequest("limit must be a positive integer"), http.StatusBadRequest, "limit must be a positive integer"},
+		{"unknown", errors.New("connection refused to 10.0.0.5"), http.StatusInternalServerError, "An internal server error occured"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			errs := NewErrorHandler(slog.New(slog.NewTextHandler(&logs, nil)))
+			h := errs.Handle(func(w http.ResponseWriter, r *http.Request) error {
+				return tt.err
+			})
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if rec.Code != tt.status {
+				t.Errorf("expected %d, got %d", tt.status, rec.Code)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != helper.ProblemContentType {
+				t.Errorf("expected content type %q, got %q", helper.ProblemContentType, ct)
+			}
+
+			var problem helper.Problem
+			if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("invalid body %q: %v", rec.Body.String(), err)
+			}
+			if problem.Status != tt.status || problem.Message != tt.message {
+				t.Errorf("unexpected problem %+v", problem)
+			}
+			if !strings.Contains(logs.String(), tt.err.Error()) {
+				t.Errorf("expected the error to be logged:\n%s", logs.String())
+			}
+		})
+	}
+}
+
+func TestErrorHandlerKeepsWrittenResponse(t *testing.T) {
+	errs := NewErrorHandler(slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil)))
+	h := errs.Handle(func(w http.ResponseWriter, r *http.Request) error {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"data":`))
+		return errors.New("encoder failed")
+	})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"data":` {
+		t.Errorf("expected the partial response untouched, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+// Codes are part of the API contract: every sentinel needs its own, and
+// changing one breaks clients.
+func TestEverySentinelHasStableCode(t *testing.T) {
+	sentinels := map[error]string{
+		helper.ErrEmailAlreadyExists:      "email_already_exists",
+		helper.ErrUserNotFound:            "user_not_found",
+		helper.ErrWrongPassword:           "wrong_password",
+		helper.ErrSessionNotFound:         "session_not_found",
+		helper.ErrSessionRevoked:          "session_revoked",
+		helper.ErrPasswordResetRequired:   "password_reset_required",
+		helper.ErrInvalidToken:            "invalid_token",
+		helper.ErrInvalidRequest:          "invalid_request",
+		helper.ErrUnauthorized:            "unauthorized",
+		helper.ErrForbidden:               "forbidden",
+		helper.ErrValidationFailed:        "validation_failed",
+		helper.ErrRequestTooLarge:         "request_too_large",
+		helper.ErrWebhookNotFound:         "webhook_not_found",
+		helper.ErrWebhookDeliveryNotFound: "webhook_delivery_not_found",
+	}
+
+	for err, code := range sentinels {
+		problem := helper.ProblemFor(fmt.Errorf("wrapped: %w", err))
+		if problem.Code != code {
+			t.Errorf("%v: expected code %q, got %q", err, code, problem.Code)
+		}
+		if problem.Type != helper.ProblemTypePrefix+code {
+			t.Errorf("%v: unexpected type %q", err, problem.Type)
+		}
+	}
+
+	if got := len(helper.ProblemCodes()); got != len(sentinels)+1 {
+		t.Errorf("expected a code per sentinel plus internal_error, got %d", got)
+	}
+}
+
+func TestValidationProblemListsFields(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+	h := NewUserHandler(nil, logger)
+	mux := http.NewServeMux()
+	mux.Handle("POST /api/v1/register", NewErrorHandler(logger).Handle(h.Register))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/register", strings.NewReader(`{"email": "not-an-email"}`))
+	req.Header.Set(middleware.RequestIDHeader, "req-42")
+	rec := httptest.NewRecorder()
+	middleware.AccessLog(logger)(mux).ServeHTTP(rec, req)
+
+	var problem helper.Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("invalid body %q: %v", rec.Body.String(), err)
+	}
+
+	if rec.Code != http.StatusBadRequest || problem.Code != "validation_failed" {
+		t.Fatalf("expected a 400 validation_failed, got %d %q", rec.Code, problem.Code)
+	}
+	want := []helper.FieldError{
+		{Field: "email", Message: "must be a valid email address"},
+		{Field: "password", Message: "is required"},
+	}
+	if fmt.Sprint(problem.Errors) != fmt.Sprint(want) {
+		t.Errorf("expected field errors %v, got %v", want, problem.Errors)
+	}
+	if problem.Instance != "urn:request:req-42" {
+		t.Errorf("expected the request id as instance, got %q", problem.Instance)
+	}
+	if problem.Message == "" {
+		t.Error("message must stay for existing clients")
+	}
+}
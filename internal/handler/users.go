@@ -2,8 +2,11 @@ package handler
 
 import (
 	"errors"
+	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"strings"
 
 	"github.com/dosedaf/syncup-users-service/helper"
 	"github.com/dosedaf/syncup-users-service/internal/model"
@@ -12,9 +15,14 @@ import (
 )
 
 type HandlerInstance interface {
-	Register(w http.ResponseWriter, r *http.Request)
-	Login(w http.ResponseWriter, r *http.Request)
-	Me(w http.ResponseWriter, r *http.Request)
+	Register(w http.ResponseWriter, r *http.Request) error
+	Login(w http.ResponseWriter, r *http.Request) error
+	Me(w http.ResponseWriter, r *http.Request) error
+	Sessions(w http.ResponseWriter, r *http.Request) error
+	RevokeSession(w http.ResponseWriter, r *http.Request) error
+	ReportNotMe(w http.ResponseWriter, r *http.Request) error
+	ForgotPassword(w http.ResponseWriter, r *http.Request) error
+	ResetPassword(w http.ResponseWriter, r *http.Request) error
 }
 
 type Handler struct {
@@ -29,132 +37,214 @@ func NewUserHandler(service service.ServiceInstance, logger *slog.Logger) Handle
 	}
 }
 
-func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) Register(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
 	credential := &model.Credential{}
-	err := helper.ReadJSONRequest(r, credential)
+	err := readJSON(r, credential)
 	if err != nil {
-		h.logger.Error(
-			"Failed while reading JSON request",
-			"error", err,
-		)
+		return err
+	}
+	if err = service.ValidateCredential(*credential, true); err != nil {
+		return err
+	}
 
-		if writeErr := helper.JSONError(w, http.StatusInternalServerError, "An internal server error occured"); writeErr != nil {
-			h.logger.Error("failed to write JSON error response", "error", writeErr)
-		}
-		return
+	err = h.service.Register(ctx, *credential, clientInfo(r))
+	if err != nil {
+		return fmt.Errorf("failed while registering new user: %w", err)
 	}
 
-	err = h.service.Register(ctx, *credential)
+	return helper.JSONResponse(w, http.StatusOK, "User registered successfully", "")
+}
+
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	credential := &model.Credential{}
+
+	err := readJSON(r, credential)
 	if err != nil {
-		if errors.Is(err, helper.ErrEmailAlreadyExists) {
-			h.logger.Info(
-				"User registration blocked: email already exists",
-				"email", credential.Email,
-			)
+		return err
+	}
+	if err = service.ValidateCredential(*credential, false); err != nil {
+		return err
+	}
 
-			if writeErr := helper.JSONError(w, http.StatusConflict, "User with this email already exists"); writeErr != nil {
-				h.logger.Error("failed to write JSON error response", "error", writeErr)
-			}
-			return
-		}
+	tokenStr, err := h.service.Login(ctx, *credential, clientInfo(r))
+	if err != nil {
+		return fmt.Errorf("failed while logging in user: %w", err)
+	}
 
-		h.logger.Error(
-			"Failed while registering new user",
-			"email", credential.Email,
-			"error", err,
-		)
+	return helper.JSONResponse(w, http.StatusOK, "User login successfully", tokenStr)
+}
 
-		if writeErr := helper.JSONError(w, http.StatusInternalServerError, "An internal server error occured"); writeErr != nil {
-			h.logger.Error("failed to write JSON error response", "error", writeErr)
-		}
-		return
+func (h *Handler) Me(w http.ResponseWriter, r *http.Request) error {
+	user, err := userFromContext(r)
+	if err != nil {
+		return err
 	}
 
-	if writeErr := helper.JSONResponse(w, http.StatusOK, "User registered successfully", ""); writeErr != nil {
-		h.logger.Error("failed to write JSON success response", "error", writeErr)
+	response := struct {
+		ID    int    `json:"id"`
+		Email string `json:"email"`
+	}{
+		ID:    user.ID,
+		Email: user.Email,
 	}
+
+	return helper.JSONResponse(w, http.StatusOK, "User details retrieved successfully", response)
 }
 
-func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-	credential := &model.Credential{}
+func (h *Handler) Sessions(w http.ResponseWriter, r *http.Request) error {
+	user, err := userFromContext(r)
+	if err != nil {
+		return err
+	}
+
+	current, _ := r.Context().Value(middleware.SessionContextKey).(*model.Session)
+
+	sessions, err := h.service.ListSessions(r.Context(), user.ID)
+	if err != nil {
+		return fmt.Errorf("failed while listing sessions: %w", err)
+	}
+
+	type sessionResponse struct {
+		model.Session
+		Current bool `json:"current"`
+	}
+
+	response := make([]sessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, sessionResponse{
+			Session: session,
+			Current: current != nil && current.ID == session.ID,
+		})
+	}
+
+	return helper.JSONResponse(w, http.StatusOK, "Sessions retrieved successfully", response)
+}
+
+func (h *Handler) RevokeSession(w http.ResponseWriter, r *http.Request) error {
+	user, err := userFromContext(r)
+	if err != nil {
+		return err
+	}
+
+	err = h.service.RevokeSession(r.Context(), user.ID, r.PathValue("id"), clientInfo(r))
+	if err != nil {
+		return fmt.Errorf("failed while revoking session: %w", err)
+	}
+
+	return helper.JSONResponse(w, http.StatusOK, "Session revoked successfully", "")
+}
+
+func (h *Handler) ReportNotMe(w http.ResponseWriter, r *http.Request) error {
+	body := struct {
+		Token string `json:"token"`
+	}{}
 
-	err := helper.ReadJSONRequest(r, credential)
+	err := readJSON(r, &body)
 	if err != nil {
-		h.logger.Error(
-			"Failed while reading JSON request",
-			"error", err,
-		)
+		return err
+	}
+	if body.Token == "" {
+		return helper.InvalidField("token", "is required")
+	}
 
-		if writeErr := helper.JSONError(w, http.StatusInternalServerError, "An internal server error occured"); writeErr != nil {
-			h.logger.Error("failed to write JSON error response", "error", writeErr)
-		}
-		return
+	err = h.service.ReportNotMe(r.Context(), body.Token, clientInfo(r))
+	if err != nil {
+		return fmt.Errorf("failed while handling unrecognised login report: %w", err)
 	}
 
-	tokenStr, err := h.service.Login(ctx, *credential)
+	return helper.JSONResponse(w, http.StatusOK, "All sessions signed out, please reset your password", "")
+}
+
+func (h *Handler) ForgotPassword(w http.ResponseWriter, r *http.Request) error {
+	body := struct {
+		Email string `json:"email"`
+	}{}
+
+	err := readJSON(r, &body)
 	if err != nil {
-		if errors.Is(err, helper.ErrUserNotFound) {
-			h.logger.Info(
-				"User login blocked: email does not exist",
-				"email", credential.Email,
-			)
+		return err
+	}
+	if strings.TrimSpace(body.Email) == "" {
+		return helper.InvalidField("email", "is required")
+	}
 
-			if writeErr := helper.JSONError(w, http.StatusNotFound, "User with this email does not exist"); writeErr != nil {
-				h.logger.Error("failed to write JSON error response", "error", writeErr)
-			}
-			return
-		}
+	err = h.service.ForgotPassword(r.Context(), body.Email, clientInfo(r))
+	if err != nil {
+		return fmt.Errorf("failed while requesting password reset: %w", err)
+	}
 
-		if errors.Is(err, helper.ErrWrongPassword) {
-			h.logger.Info(
-				"User login blocked: wrong password",
-				"email", credential.Email,
-			)
+	return helper.JSONResponse(w, http.StatusOK, "If an account uses this email, a password reset link was sent to it", "")
+}
 
-			if writeErr := helper.JSONError(w, http.StatusUnauthorized, "Wrong Password"); writeErr != nil {
-				h.logger.Error("failed to write JSON error response", "error", writeErr)
-			}
-			return
-		}
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) error {
+	body := struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}{}
 
-		h.logger.Error(
-			"Failed while logging in user",
-			"email", credential.Email,
-			"error", err,
-		)
+	err := readJSON(r, &body)
+	if err != nil {
+		return err
+	}
 
-		if writeErr := helper.JSONError(w, http.StatusInternalServerError, "An internal server error occured"); writeErr != nil {
-			h.logger.Error("failed to write JSON error response", "error", writeErr)
-		}
-		return
+	errs := &helper.ValidationError{}
+	if body.Token == "" {
+		errs.Add("token", "is required")
+	}
+	if body.Password == "" {
+		errs.Add("password", "is required")
 	}
+	if err := errs.Err(); err != nil {
+		return err
+	}
+
+	err = h.service.ResetPassword(r.Context(), body.Token, body.Password, clientInfo(r))
+	if err != nil {
+		return fmt.Errorf("failed while resetting password: %w", err)
+	}
+
+	return helper.JSONResponse(w, http.StatusOK, "Password reset, please log in again", "")
+}
+
+// readJSON decodes the request body into v, telling bodies over the size
+// limit apart from malformed ones.
+func readJSON(r *http.Request, v any) error {
+	err := helper.ReadJSONRequest(r, v)
 
-	if writeErr := helper.JSONResponse(w, http.StatusOK, "User login successfully", tokenStr); writeErr != nil {
-		h.logger.Error("failed to write JSON success response", "error", writeErr)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return helper.WithMessage(helper.ErrRequestTooLarge, fmt.Sprintf("Request body must not exceed %d bytes", tooLarge.Limit))
 	}
+	if err != nil {
+		return helper.InvalidRequest("Request body must be a JSON object")
+	}
+
+	return nil
 }
 
-func (h *Handler) Me(w http.ResponseWriter, r *http.Request) {
+// userFromContext returns the user JWTMiddleware authenticated. A missing
+// user means the route was registered without the middleware.
+func userFromContext(r *http.Request) (*model.User, error) {
 	user, ok := r.Context().Value(middleware.UserContextKey).(*model.User)
 	if !ok {
-		h.logger.Error("Failed to get user from context")
-		if writeErr := helper.JSONError(w, http.StatusInternalServerError, "An internal server error occured"); writeErr != nil {
-			h.logger.Error("failed to write JSON error response", "error", writeErr)
-		}
-		return
+		return nil, errors.New("no authenticated user in request context")
 	}
 
-	response := struct {
-		ID    int    `json:"id"`
-		Email string `json:"email"`
-	}{
-		ID:    user.ID,
-		Email: user.Email,
+	return user, nil
+}
+
+// clientInfo identifies the caller by user agent and the remote address of
+// the connection. Forwarding headers are ignored since they can be forged.
+func clientInfo(r *http.Request) model.ClientInfo {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
 	}
 
-	if err := helper.JSONResponse(w, http.StatusOK, "User details retrieved successfully", response); err != nil {
-		h.logger.Error("failed to write JSON success response", "error", err)
+	return model.ClientInfo{
+		UserAgent: r.UserAgent(),
+		IP:        ip,
 	}
 }
@@ -0,0 +1,282 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/dosedaf/syncup-users-service/helper"
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/dosedaf/syncup-users-service/internal/service"
+)
+
+const maxWebhookDescriptionLength = 200
+
+type WebhookHandlerInstance interface {
+	CreateSubscription(w http.ResponseWriter, r *http.Request) error
+	Subscriptions(w http.ResponseWriter, r *http.Request) error
+	Subscription(w http.ResponseWriter, r *http.Request) error
+	DeleteSubscription(w http.ResponseWriter, r *http.Request) error
+	Deliveries(w http.ResponseWriter, r *http.Request) error
+	Delivery(w http.ResponseWriter, r *http.Request) error
+	Redeliver(w http.ResponseWriter, r *http.Request) error
+}
+
+type WebhookHandler struct {
+	service service.WebhookServiceInstance
+	logger  *slog.Logger
+}
+
+func NewWebhookHandler(service service.WebhookServiceInstance, logger *slog.Logger) WebhookHandlerInstance {
+	return &WebhookHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+type createWebhookRequest struct {
+	URL         string   `json:"url"`
+	EventTypes  []string `json:"event_types"`
+	Description string   `json:"description"`
+}
+
+// createdWebhookResponse is the only response that carries the signing
+// secret; it cannot be retrieved again.
+type createdWebhookResponse struct {
+	model.WebhookSubscription
+	Secret string `json:"secret"`
+}
+
+type webhookDeliveriesResponse struct {
+	Deliveries []model.WebhookDelivery `json:"deliveries"`
+	// NextBefore is passed back as ?before= to fetch the next page. It is
+	// zero on the last page.
+	NextBefore int64 `json:"next_before"`
+}
+
+type webhookDeliveryResponse struct {
+	model.WebhookDelivery
+	Attempts []model.WebhookDeliveryAttempt `json:"attempt_log"`
+}
+
+func (h *WebhookHandler) CreateSubscription(w http.ResponseWriter, r *http.Request) error {
+	admin, err := userFromContext(r)
+	if err != nil {
+		return err
+	}
+
+	var body createWebhookRequest
+	if err := readJSON(r, &body); err != nil {
+		return err
+	}
+	if err := validateWebhook(body); err != nil {
+		return err
+	}
+
+	subscription := &model.WebhookSubscription{
+		URL:         body.URL,
+		EventTypes:  slices.Compact(slices.Sorted(slices.Values(body.EventTypes))),
+		Description: strings.TrimSpace(body.Description),
+	}
+	err = h.service.CreateSubscription(r.Context(), admin, subscription, clientInfo(r))
+	if err != nil {
+		return fmt.Errorf("failed while creating webhook subscription: %w", err)
+	}
+
+	return helper.JSONResponse(w, http.StatusCreated, "Webhook subscription created, store the secret now as it will not be shown again", createdWebhookResponse{
+		WebhookSubscription: *subscription,
+		Secret:              subscription.Secret,
+	})
+}
+
+func (h *WebhookHandler) Subscriptions(w http.ResponseWriter, r *http.Request) error {
+	subscriptions, err := h.service.ListSubscriptions(r.Context())
+	if err != nil {
+		return fmt.Errorf("failed while listing webhook subscriptions: %w", err)
+	}
+
+	return helper.JSONResponse(w, http.StatusOK, "Webhook subscriptions retrieved successfully", subscriptions)
+}
+
+func (h *WebhookHandler) Subscription(w http.ResponseWriter, r *http.Request) error {
+	id, err := subscriptionID(r)
+	if err != nil {
+		return err
+	}
+
+	subscription, err := h.service.GetSubscription(r.Context(), id)
+	if err != nil {
+		return fmt.Errorf("failed while getting webhook subscription: %w", err)
+	}
+
+	return helper.JSONResponse(w, http.StatusOK, "Webhook subscription retrieved successfully", subscription)
+}
+
+func (h *WebhookHandler) DeleteSubscription(w http.ResponseWriter, r *http.Request) error {
+	admin, err := userFromContext(r)
+	if err != nil {
+		return err
+	}
+
+	id, err := subscriptionID(r)
+	if err != nil {
+		return err
+	}
+
+	err = h.service.DeleteSubscription(r.Context(), admin, id, clientInfo(r))
+	if err != nil {
+		return fmt.Errorf("failed while deleting webhook subscription: %w", err)
+	}
+
+	return helper.JSONResponse(w, http.StatusOK, "Webhook subscription deleted successfully", "")
+}
+
+func (h *WebhookHandler) Deliveries(w http.ResponseWriter, r *http.Request) error {
+	id, err := subscriptionID(r)
+	if err != nil {
+		return err
+	}
+
+	filter, err := parseWebhookDeliveryFilter(r.URL.Query())
+	if err != nil {
+		return err
+	}
+	filter.SubscriptionID = id
+
+	deliveries, err := h.service.ListDeliveries(r.Context(), filter)
+	if err != nil {
+		return fmt.Errorf("failed while listing webhook deliveries: %w", err)
+	}
+
+	response := webhookDeliveriesResponse{Deliveries: deliveries}
+	if response.Deliveries == nil {
+		response.Deliveries = []model.WebhookDelivery{}
+	}
+	// a full page means there may be more
+	if len(deliveries) == filter.Limit {
+		response.NextBefore = deliveries[len(deliveries)-1].ID
+	}
+
+	return helper.JSONResponse(w, http.StatusOK, "Webhook deliveries retrieved successfully", response)
+}
+
+func (h *WebhookHandler) Delivery(w http.ResponseWriter, r *http.Request) error {
+	id, deliveryID, err := deliveryID(r)
+	if err != nil {
+		return err
+	}
+
+	delivery, attempts, err := h.service.GetDelivery(r.Context(), id, deliveryID)
+	if err != nil {
+		return fmt.Errorf("failed while getting webhook delivery: %w", err)
+	}
+	if attempts == nil {
+		attempts = []model.WebhookDeliveryAttempt{}
+	}
+
+	return helper.JSONResponse(w, http.StatusOK, "Webhook delivery retrieved successfully", webhookDeliveryResponse{
+		WebhookDelivery: *delivery,
+		Attempts:        attempts,
+	})
+}
+
+func (h *WebhookHandler) Redeliver(w http.ResponseWriter, r *http.Request) error {
+	admin, err := userFromContext(r)
+	if err != nil {
+		return err
+	}
+
+	id, deliveryID, err := deliveryID(r)
+	if err != nil {
+		return err
+	}
+
+	err = h.service.Redeliver(r.Context(), admin, id, deliveryID, clientInfo(r))
+	if err != nil {
+		return fmt.Errorf("failed while redelivering webhook: %w", err)
+	}
+
+	return helper.JSONResponse(w, http.StatusAccepted, "Webhook delivery queued for redelivery", "")
+}
+
+func validateWebhook(body createWebhookRequest) error {
+	errs := &helper.ValidationError{}
+
+	if u, err := url.Parse(body.URL); body.URL == "" {
+		errs.Add("url", "is required")
+	} else if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs.Add("url", "must be an absolute http or https URL")
+	}
+
+	if len(body.EventTypes) == 0 {
+		errs.Add("event_types", "must list at least one event type")
+	}
+	for _, eventType := range body.EventTypes {
+		if !slices.Contains(model.UserEventTypes, eventType) {
+			errs.Add("event_types", fmt.Sprintf("must be one of %s", strings.Join(model.UserEventTypes, ", ")))
+			break
+		}
+	}
+
+	if len([]rune(body.Description)) > maxWebhookDescriptionLength {
+		errs.Add("description", fmt.Sprintf("must be at most %d characters", maxWebhookDescriptionLength))
+	}
+
+	return errs.Err()
+}
+
+func parseWebhookDeliveryFilter(query url.Values) (model.WebhookDeliveryFilter, error) {
+	filter := model.WebhookDeliveryFilter{
+		Status: query.Get("status"),
+		Limit:  model.DefaultWebhookDeliveryLimit,
+	}
+
+	switch filter.Status {
+	case "", model.WebhookDeliveryPending, model.WebhookDeliveryDelivered, model.WebhookDeliveryDead:
+	default:
+		return filter, helper.InvalidField("status", "must be pending, delivered or dead")
+	}
+
+	limit, err := positiveIntParam(query, "limit")
+	if err != nil {
+		return filter, err
+	}
+	if limit > 0 {
+		filter.Limit = int(min(limit, model.MaxWebhookDeliveryLimit))
+	}
+
+	if filter.BeforeID, err = positiveIntParam(query, "before"); err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
+
+// subscriptionID reads the {id} path parameter. Malformed IDs cannot name a
+// subscription, so they are reported as not found.
+func subscriptionID(r *http.Request) (int, error) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		return 0, helper.ErrWebhookNotFound
+	}
+
+	return id, nil
+}
+
+func deliveryID(r *http.Request) (int, int64, error) {
+	id, err := subscriptionID(r)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	deliveryID, err := strconv.ParseInt(r.PathValue("delivery_id"), 10, 64)
+	if err != nil || deliveryID < 1 {
+		return 0, 0, helper.ErrWebhookDeliveryNotFound
+	}
+
+	return id, deliveryID, nil
+}
@@ -0,0 +1,39 @@
+package health
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dosedaf/syncup-users-service/database"
+)
+
+// Pinger is satisfied by *pgxpool.Pool.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+func Ping(name string, p Pinger) Checker {
+	return NewChecker(name, p.Ping)
+}
+
+// Migrations checks that the schema is at least at the version this binary
+// was built against and that no migration was left half applied. A newer
+// schema is fine: during a rolling deploy the new pods migrate forward while
+// the old ones must keep serving.
+func Migrations(db database.DBTX, expected uint) Checker {
+	return NewChecker("migrations", func(ctx context.Context) error {
+		version, dirty, err := database.MigrationVersion(ctx, db)
+		if err != nil {
+			return err
+		}
+
+		if dirty {
+			return fmt.Errorf("migration %d is dirty", version)
+		}
+		if version < expected {
+			return fmt.Errorf("schema is at version %d, expected at least %d", version, expected)
+		}
+
+		return nil
+	})
+}
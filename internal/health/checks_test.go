@@ -0,0 +1,51 @@
+package health
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dosedaf/syncup-users-service/database"
+	"github.com/jackc/pgx/v5"
+)
+
+// migrationsDB answers the schema_migrations query and nothing else.
+type migrationsDB struct {
+	database.DBTX
+	version int64
+	dirty   bool
+}
+
+func (db migrationsDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return migrationsRow(db)
+}
+
+type migrationsRow migrationsDB
+
+func (r migrationsRow) Scan(dest ...any) error {
+	*dest[0].(*int64) = r.version
+	*dest[1].(*bool) = r.dirty
+	return nil
+}
+
+func TestMigrations(t *testing.T) {
+	tests := []struct {
+		name    string
+		db      migrationsDB
+		wantErr bool
+	}{
+		{"current", migrationsDB{version: 7}, false},
+		// a new release migrated forward during a rolling deploy
+		{"newer", migrationsDB{version: 8}, false},
+		{"older", migrationsDB{version: 6}, true},
+		{"dirty", migrationsDB{version: 7, dirty: true}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Migrations(tt.db, 7).Check(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
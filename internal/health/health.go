@@ -0,0 +1,155 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/helper"
+)
+
+const DefaultTimeout = 2 * time.Second
+
+const (
+	StatusOK      = "ok"
+	StatusFailing = "failing"
+	StatusTimeout = "timeout"
+)
+
+// Checker is one dependency the service needs before it can take traffic.
+// Subsystems register their own checkers with Health.Register.
+type Checker interface {
+	Name() string
+	Check(ctx context.Context) error
+}
+
+type checkerFunc struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+func (c checkerFunc) Name() string                    { return c.name }
+func (c checkerFunc) Check(ctx context.Context) error { return c.check(ctx) }
+
+// NewChecker adapts a function to the Checker interface.
+func NewChecker(name string, check func(ctx context.Context) error) Checker {
+	return checkerFunc{name: name, check: check}
+}
+
+// CheckResult is what the unauthenticated readiness probe reports about a
+// check. Why a check failed is logged, not reported.
+type CheckResult struct {
+	Status     string  `json:"status"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// Health serves the liveness and readiness probes. Liveness only says the
+// process is up; readiness runs every registered check concurrently, each
+// bounded by the timeout, and fails as soon as shutdown has started.
+type Health struct {
+	logger  *slog.Logger
+	timeout time.Duration
+
+	mu       sync.RWMutex
+	checkers []Checker
+
+	draining atomic.Bool
+}
+
+func New(logger *slog.Logger, timeout time.Duration) *Health {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	return &Health{
+		logger:  logger,
+		timeout: timeout,
+	}
+}
+
+func (h *Health) Register(c Checker) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.checkers = append(h.checkers, c)
+}
+
+// SetDraining makes readiness fail from now on, so the orchestrator stops
+// routing new traffic while in-flight requests finish.
+func (h *Health) SetDraining() {
+	h.draining.Store(true)
+}
+
+// Check runs every registered checker and reports whether all of them passed.
+func (h *Health) Check(ctx context.Context) (map[string]CheckResult, bool) {
+	h.mu.RLock()
+	checkers := h.checkers
+	h.mu.RUnlock()
+
+	results := make([]CheckResult, len(checkers))
+	var wg sync.WaitGroup
+	for i, c := range checkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = h.run(ctx, c)
+		}()
+	}
+	wg.Wait()
+
+	healthy := true
+	byName := make(map[string]CheckResult, len(checkers))
+	for i, c := range checkers {
+		if results[i].Status != StatusOK {
+			healthy = false
+		}
+		byName[c.Name()] = results[i]
+	}
+
+	return byName, healthy
+}
+
+func (h *Health) run(ctx context.Context, c Checker) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.Check(ctx)
+	result := CheckResult{
+		Status:     StatusOK,
+		DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+
+	if err != nil {
+		result.Status = StatusFailing
+		if errors.Is(err, context.DeadlineExceeded) {
+			result.Status = StatusTimeout
+		}
+		h.logger.WarnContext(ctx, "Readiness check failed", "check", c.Name(), "status", result.Status, "error", err)
+	}
+
+	return result
+}
+
+func (h *Health) Live(w http.ResponseWriter, r *http.Request) {
+	helper.JSONResponse(w, http.StatusOK, StatusOK, nil)
+}
+
+func (h *Health) Ready(w http.ResponseWriter, r *http.Request) {
+	if h.draining.Load() {
+		helper.JSONError(w, http.StatusServiceUnavailable, "shutting down")
+		return
+	}
+
+	results, healthy := h.Check(r.Context())
+	if !healthy {
+		helper.JSONResponse(w, http.StatusServiceUnavailable, "not ready", results)
+		return
+	}
+
+	helper.JSONResponse(w, http.StatusOK, StatusOK, results)
+}
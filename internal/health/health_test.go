@@ -0,0 +1,121 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+type readyResponse struct {
+	Message string                 `json:"message"`
+	Data    map[string]CheckResult `json:"data"`
+}
+
+func ready(t *testing.T, h *Health) (int, readyResponse) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	h.Ready(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	var body readyResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid JSON body %q: %v", rec.Body.String(), err)
+	}
+
+	return rec.Code, body
+}
+
+func newHealth(timeout time.Duration) *Health {
+	return New(slog.New(slog.NewTextHandler(os.Stdout, nil)), timeout)
+}
+
+func TestReadyAllPassing(t *testing.T) {
+	h := newHealth(time.Second)
+	h.Register(NewChecker("database", func(ctx context.Context) error { return nil }))
+	h.Register(NewChecker("cache", func(ctx context.Context) error { return nil }))
+
+	code, body := ready(t, h)
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if len(body.Data) != 2 || body.Data["database"].Status != StatusOK {
+		t.Errorf("unexpected check detail %+v", body.Data)
+	}
+}
+
+func TestReadyReportsEachCheck(t *testing.T) {
+	var logs bytes.Buffer
+	h := New(slog.New(slog.NewTextHandler(&logs, nil)), 50*time.Millisecond)
+	h.Register(NewChecker("database", func(ctx context.Context) error { return nil }))
+	h.Register(NewChecker("migrations", func(ctx context.Context) error {
+		return errors.New("schema is at version 6, expected 7")
+	}))
+	h.Register(NewChecker("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+
+	start := time.Now()
+	code, body := ready(t, h)
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", code)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("slow check was not bounded by the timeout, took %s", elapsed)
+	}
+
+	if body.Data["database"].Status != StatusOK {
+		t.Errorf("expected database ok, got %+v", body.Data["database"])
+	}
+	if got := body.Data["migrations"]; got.Status != StatusFailing {
+		t.Errorf("expected migrations failing, got %+v", got)
+	}
+	if got := body.Data["slow"]; got.Status != StatusTimeout {
+		t.Errorf("expected slow check to time out, got %+v", got)
+	}
+
+	// the probe is unauthenticated, so the detail only goes to the log
+	if !bytes.Contains(logs.Bytes(), []byte("schema is at version 6")) {
+		t.Errorf("expected the failure logged, got %q", logs.String())
+	}
+}
+
+func TestReadyHidesErrorDetail(t *testing.T) {
+	h := newHealth(time.Second)
+	h.Register(NewChecker("database", func(ctx context.Context) error {
+		return errors.New(`password authentication failed for user "syncup"`)
+	}))
+
+	rec := httptest.NewRecorder()
+	h.Ready(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", rec.Code)
+	}
+	if bytes.Contains(rec.Body.Bytes(), []byte("password")) {
+		t.Errorf("expected no error detail in the response, got %s", rec.Body.String())
+	}
+}
+
+func TestReadyFailsWhileDraining(t *testing.T) {
+	h := newHealth(time.Second)
+	h.Register(NewChecker("database", func(ctx context.Context) error { return nil }))
+
+	h.SetDraining()
+
+	if code, _ := ready(t, h); code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 while draining, got %d", code)
+	}
+
+	rec := httptest.NewRecorder()
+	h.Live(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("liveness should not depend on draining, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,96 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// NewHandler returns the output handler for the configured format.
+func NewHandler(format string, level slog.Level, w io.Writer) (slog.Handler, error) {
+	options := &slog.HandlerOptions{Level: level}
+
+	switch format {
+	case FormatText:
+		return slog.NewTextHandler(w, options), nil
+	case FormatJSON:
+		return slog.NewJSONHandler(w, options), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+}
+
+type loggerKey struct{}
+
+// WithLogger stores a request-scoped logger in ctx.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger stored by WithLogger, or fallback.
+func FromContext(ctx context.Context, fallback *slog.Logger) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return fallback
+}
+
+// contextHandler routes records logged with a context that carries a
+// request-scoped logger through that logger's handler. Components keep the
+// logger they were constructed with and still get the request's attributes,
+// as long as they log with the *Context methods.
+type contextHandler struct {
+	handler slog.Handler
+	// derive replays this handler's WithAttrs and WithGroup calls on a
+	// request-scoped handler.
+	derive func(slog.Handler) slog.Handler
+}
+
+func NewContextHandler(next slog.Handler) slog.Handler {
+	return &contextHandler{
+		handler: next,
+		derive:  func(h slog.Handler) slog.Handler { return h },
+	}
+}
+
+func (h *contextHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	logger, ok := ctx.Value(loggerKey{}).(*slog.Logger)
+	if !ok {
+		return h.handler.Handle(ctx, record)
+	}
+
+	scoped := logger.Handler()
+	// request loggers are normally derived from a logger using this handler;
+	// unwrap it so the record is not routed back here
+	if ch, ok := scoped.(*contextHandler); ok {
+		scoped = ch.handler
+	}
+
+	return h.derive(scoped).Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	derive := h.derive
+	return &contextHandler{
+		handler: h.handler.WithAttrs(attrs),
+		derive:  func(next slog.Handler) slog.Handler { return derive(next).WithAttrs(attrs) },
+	}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	derive := h.derive
+	return &contextHandler{
+		handler: h.handler.WithGroup(name),
+		derive:  func(next slog.Handler) slog.Handler { return derive(next).WithGroup(name) },
+	}
+}
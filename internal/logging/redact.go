@@ -0,0 +1,154 @@
+package logging
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const (
+	// RedactHash replaces values with a keyed hash, so the same email still
+	// correlates across log lines without being readable.
+	RedactHash = "hash"
+	// RedactRemove replaces values with a fixed placeholder.
+	RedactRemove = "remove"
+	// RedactOff logs values as they are, for local development.
+	RedactOff = "off"
+)
+
+const redactedPlaceholder = "[REDACTED]"
+
+// DefaultRedactedAttrs are the attribute keys this service logs personal
+// data or credentials under.
+var DefaultRedactedAttrs = []string{"email", "to", "ip", "ip_prefix", "user_agent", "token", "body"}
+
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+// Redactor rewrites sensitive attribute values before they reach the log
+// output. Attributes are matched by key, case-insensitively and at any group
+// depth; emails embedded in other strings, such as database errors, are
+// rewritten too.
+type Redactor struct {
+	mode  string
+	key   []byte
+	attrs map[string]bool
+}
+
+func NewRedactor(mode string, key []byte, attrs []string) (*Redactor, error) {
+	switch mode {
+	case RedactHash:
+		if len(key) == 0 {
+			return nil, fmt.Errorf("redaction mode %q needs a key", mode)
+		}
+	case RedactRemove, RedactOff:
+	default:
+		return nil, fmt.Errorf("unknown redaction mode %q", mode)
+	}
+
+	set := make(map[string]bool, len(attrs))
+	for _, attr := range attrs {
+		set[strings.ToLower(strings.TrimSpace(attr))] = true
+	}
+
+	return &Redactor{mode: mode, key: key, attrs: set}, nil
+}
+
+// Handler wraps next so every record is redacted. In RedactOff mode next is
+// returned unchanged.
+func (r *Redactor) Handler(next slog.Handler) slog.Handler {
+	if r.mode == RedactOff {
+		return next
+	}
+	return &redactingHandler{next: next, redactor: r}
+}
+
+// Value returns what a sensitive value is logged as.
+func (r *Redactor) Value(value string) string {
+	switch r.mode {
+	case RedactOff:
+		return value
+	case RedactRemove:
+		return redactedPlaceholder
+	}
+
+	// normalise so "Someone@Example.com " and "someone@example.com" match
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(value))))
+	return "hmac:" + hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+func (r *Redactor) attr(a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+
+	if a.Value.Kind() == slog.KindGroup {
+		group := a.Value.Group()
+		redacted := make([]slog.Attr, len(group))
+		for i, inner := range group {
+			redacted[i] = r.attr(inner)
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(redacted...)}
+	}
+
+	if r.attrs[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, r.Value(a.Value.String()))
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		if s := a.Value.String(); strings.Contains(s, "@") {
+			return slog.String(a.Key, r.scrub(s))
+		}
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok && strings.Contains(err.Error(), "@") {
+			return slog.String(a.Key, r.scrub(err.Error()))
+		}
+	}
+
+	return a
+}
+
+func (r *Redactor) scrub(s string) string {
+	return emailPattern.ReplaceAllStringFunc(s, r.Value)
+}
+
+type redactingHandler struct {
+	next     slog.Handler
+	redactor *Redactor
+}
+
+func (h *redactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *redactingHandler) Handle(ctx context.Context, record slog.Record) error {
+	message := record.Message
+	if strings.Contains(message, "@") {
+		message = h.redactor.scrub(message)
+	}
+
+	redacted := slog.NewRecord(record.Time, record.Level, message, record.PC)
+	record.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(h.redactor.attr(a))
+		return true
+	})
+
+	return h.next.Handle(ctx, redacted)
+}
+
+func (h *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = h.redactor.attr(a)
+	}
+
+	return &redactingHandler{next: h.next.WithAttrs(redacted), redactor: h.redactor}
+}
+
+func (h *redactingHandler) WithGroup(name string) slog.Handler {
+	return &redactingHandler{next: h.next.WithGroup(name), redactor: h.redactor}
+}
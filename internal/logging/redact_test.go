@@ -0,0 +1,74 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+const testEmail = "Someone@Example.com"
+
+func newRedactingLogger(t *testing.T, mode string, key string, buf *bytes.Buffer) *slog.Logger {
+	t.Helper()
+
+	redactor, err := NewRedactor(mode, []byte(key), DefaultRedactedAttrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return slog.New(redactor.Handler(slog.NewTextHandler(buf, nil)))
+}
+
+func TestRedactorHashesConfiguredAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newRedactingLogger(t, RedactHash, "test key", &buf)
+
+	logger.Info("User registered", "email", testEmail)
+	logger.With("IP", "203.0.113.7").Info("Login", "email", strings.ToLower(testEmail))
+	logger.Info("Mail queued", slog.Group("message", "to", testEmail))
+	logger.Error("Insert failed", "error", errors.New("duplicate key (email)=("+testEmail+")"))
+	logger.Info("Sending mail to " + testEmail)
+
+	out := buf.String()
+	for _, raw := range []string{testEmail, strings.ToLower(testEmail), "203.0.113.7"} {
+		if strings.Contains(out, raw) {
+			t.Errorf("log output contains %q:\n%s", raw, out)
+		}
+	}
+
+	redactor, _ := NewRedactor(RedactHash, []byte("test key"), DefaultRedactedAttrs)
+	hash := redactor.Value(testEmail)
+	if n := strings.Count(out, hash); n != 5 {
+		t.Errorf("expected the same hash on all 5 lines regardless of case, found %d:\n%s", n, out)
+	}
+
+	other, _ := NewRedactor(RedactHash, []byte("another key"), DefaultRedactedAttrs)
+	if other.Value(testEmail) == hash {
+		t.Error("hashes should depend on the key")
+	}
+}
+
+func TestRedactorRemoveAndOff(t *testing.T) {
+	var removed bytes.Buffer
+	newRedactingLogger(t, RedactRemove, "", &removed).Info("Login", "token", "abc.def.ghi")
+	if strings.Contains(removed.String(), "abc.def.ghi") || !strings.Contains(removed.String(), redactedPlaceholder) {
+		t.Errorf("expected the token to be removed:\n%s", removed.String())
+	}
+
+	var off bytes.Buffer
+	newRedactingLogger(t, RedactOff, "", &off).Info("Login", "email", testEmail)
+	if !strings.Contains(off.String(), testEmail) {
+		t.Errorf("expected raw values with redaction off:\n%s", off.String())
+	}
+}
+
+func TestNewRedactorRequiresKeyForHash(t *testing.T) {
+	if _, err := NewRedactor(RedactHash, nil, DefaultRedactedAttrs); err == nil {
+		t.Error("expected an error without a key")
+	}
+	if _, err := NewRedactor("mask", []byte("key"), DefaultRedactedAttrs); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
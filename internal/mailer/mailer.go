@@ -0,0 +1,84 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/smtp"
+	"strings"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers transactional email.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogMailer logs who messages were for instead of sending them. It is meant
+// for local development and is the default when no SMTP server is set.
+// Bodies are left out: they carry links with live tokens.
+type LogMailer struct {
+	logger *slog.Logger
+}
+
+func NewLogMailer(logger *slog.Logger) Mailer {
+	return &LogMailer{logger: logger}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	m.logger.Info(
+		"Email not sent, logging instead",
+		"to", msg.To,
+		"subject", msg.Subject,
+	)
+
+	return nil
+}
+
+type SMTPConfig struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+type SMTPMailer struct {
+	config SMTPConfig
+}
+
+func NewSMTPMailer(config SMTPConfig) Mailer {
+	return &SMTPMailer{config: config}
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	var auth smtp.Auth
+	if m.config.Username != "" {
+		host, _, _ := strings.Cut(m.config.Addr, ":")
+		auth = smtp.PlainAuth("", m.config.Username, m.config.Password, host)
+	}
+
+	body := fmt.Sprintf(
+		"From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s",
+		m.config.From,
+		msg.To,
+		msg.Subject,
+		msg.Body,
+	)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- smtp.SendMail(m.config.Addr, auth, m.config.From, []string{msg.To}, []byte(body))
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,97 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultBufferSize  = 100
+	DefaultSendTimeout = 5 * time.Second
+)
+
+// ErrQueueFull is returned by Queue.Send when the message was dropped.
+var ErrQueueFull = errors.New("mail queue is full")
+
+// Queue hands messages to next from a single worker, so a slow mail server
+// never holds up the request that triggered the email. When the buffer is
+// full messages are dropped and counted rather than slowing down logins.
+type Queue struct {
+	next        Mailer
+	logger      *slog.Logger
+	messages    chan Message
+	sendTimeout time.Duration
+	dropped     atomic.Int64
+}
+
+func NewQueue(next Mailer, logger *slog.Logger, bufferSize int) *Queue {
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+
+	return &Queue{
+		next:        next,
+		logger:      logger,
+		messages:    make(chan Message, bufferSize),
+		sendTimeout: DefaultSendTimeout,
+	}
+}
+
+// Send queues msg and returns at once. ctx is not used for the delivery,
+// which outlives the caller's request.
+func (q *Queue) Send(ctx context.Context, msg Message) error {
+	select {
+	case q.messages <- msg:
+		return nil
+	default:
+		q.dropped.Add(1)
+		return ErrQueueFull
+	}
+}
+
+// Dropped returns how many messages were discarded because the buffer was
+// full.
+func (q *Queue) Dropped() int64 {
+	return q.dropped.Load()
+}
+
+// Run sends queued messages until ctx is cancelled, then sends whatever is
+// still buffered.
+func (q *Queue) Run(ctx context.Context) {
+	for {
+		select {
+		case msg := <-q.messages:
+			// a message taken just as ctx is cancelled still gets its try
+			q.deliver(context.WithoutCancel(ctx), msg)
+		case <-ctx.Done():
+			drainCtx, cancel := context.WithTimeout(context.Background(), q.sendTimeout)
+			defer cancel()
+
+			for {
+				select {
+				case msg := <-q.messages:
+					q.deliver(drainCtx, msg)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (q *Queue) deliver(ctx context.Context, msg Message) {
+	ctx, cancel := context.WithTimeout(ctx, q.sendTimeout)
+	defer cancel()
+
+	if err := q.next.Send(ctx, msg); err != nil {
+		q.logger.Error(
+			"Failed while sending email",
+			"to", msg.To,
+			"subject", msg.Subject,
+			"error", err,
+		)
+	}
+}
@@ -0,0 +1,63 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+)
+
+type recordingMailer struct {
+	mu   sync.Mutex
+	sent []Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func TestQueueSendsOnShutdown(t *testing.T) {
+	next := &recordingMailer{}
+	queue := NewQueue(next, slog.New(slog.NewTextHandler(io.Discard, nil)), 10)
+
+	for range 3 {
+		if err := queue.Send(context.Background(), Message{To: "someone@example.com"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		queue.Run(ctx)
+		close(done)
+	}()
+	cancel()
+	<-done
+
+	if len(next.sent) != 3 {
+		t.Fatalf("expected 3 messages sent, got %d", len(next.sent))
+	}
+}
+
+func TestQueueDropsWhenFull(t *testing.T) {
+	queue := NewQueue(&recordingMailer{}, slog.New(slog.NewTextHandler(io.Discard, nil)), 2)
+
+	var err error
+	for range 3 {
+		err = queue.Send(context.Background(), Message{To: "someone@example.com"})
+	}
+
+	if !errors.Is(err, ErrQueueFull) {
+		t.Errorf("expected ErrQueueFull, got %v", err)
+	}
+	if queue.Dropped() != 1 {
+		t.Errorf("expected 1 dropped message, got %d", queue.Dropped())
+	}
+}
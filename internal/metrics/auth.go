@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/internal/audit"
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/dosedaf/syncup-users-service/internal/password"
+)
+
+type auditRecorder struct {
+	next    audit.RecorderInstance
+	metrics *Metrics
+}
+
+// AuditRecorder counts login and registration outcomes from the audit events
+// the service already records, then passes every event on to next.
+func (m *Metrics) AuditRecorder(next audit.RecorderInstance) audit.RecorderInstance {
+	return &auditRecorder{next: next, metrics: m}
+}
+
+func (r *auditRecorder) Record(event model.AuthEvent) {
+	switch event.Type {
+	case model.AuthEventLogin:
+		r.metrics.logins.WithLabelValues(event.Outcome, event.Reason).Inc()
+	case model.AuthEventRegister:
+		r.metrics.registrations.WithLabelValues(event.Outcome, event.Reason).Inc()
+	}
+
+	r.next.Record(event)
+}
+
+type hasher struct {
+	next    password.Hasher
+	metrics *Metrics
+}
+
+// Hasher times Hash and Verify on next.
+func (m *Metrics) Hasher(next password.Hasher) password.Hasher {
+	return &hasher{next: next, metrics: m}
+}
+
+func (h *hasher) Hash(plain string) (string, error) {
+	defer h.observe("hash", time.Now())
+	return h.next.Hash(plain)
+}
+
+func (h *hasher) Verify(plain string, encoded string) (bool, error) {
+	defer h.observe("verify", time.Now())
+	return h.next.Verify(plain, encoded)
+}
+
+func (h *hasher) NeedsRehash(encoded string) bool {
+	return h.next.NeedsRehash(encoded)
+}
+
+func (h *hasher) observe(operation string, start time.Time) {
+	h.metrics.hashDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/middleware"
+)
+
+// unmatchedRoute labels requests no pattern matched, so scanners hitting
+// random paths cannot blow up the label cardinality.
+const unmatchedRoute = "unmatched"
+
+// Middleware counts and times every request. It must wrap the ServeMux so
+// that the matched pattern is known once the request has been served.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := middleware.NewResponseRecorder(w)
+
+		next.ServeHTTP(rec, r)
+
+		route := r.Pattern
+		if route == "" {
+			route = unmatchedRoute
+		}
+		code := strconv.Itoa(rec.Status())
+
+		m.httpRequests.WithLabelValues(route, code).Inc()
+		m.httpDuration.WithLabelValues(route, code).Observe(time.Since(start).Seconds())
+	})
+}
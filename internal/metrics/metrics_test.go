@@ -0,0 +1,143 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dosedaf/syncup-users-service/helper"
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/dosedaf/syncup-users-service/internal/password"
+	"github.com/dosedaf/syncup-users-service/internal/repository"
+	"github.com/dosedaf/syncup-users-service/internal/repository/memory"
+	"github.com/dosedaf/syncup-users-service/internal/service"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMiddlewareLabelsByRoutePattern(t *testing.T) {
+	m := New()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("DELETE /api/v1/me/sessions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("GET /api/v1/me", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	})
+	handler := m.Middleware(mux)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodDelete, "/api/v1/me/sessions/abc", nil),
+		httptest.NewRequest(http.MethodDelete, "/api/v1/me/sessions/def", nil),
+		httptest.NewRequest(http.MethodGet, "/api/v1/me", nil),
+		httptest.NewRequest(http.MethodGet, "/wp-login.php", nil),
+	} {
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	for _, tc := range []struct {
+		route  string
+		status string
+		want   float64
+	}{
+		{"DELETE /api/v1/me/sessions/{id}", "204", 2},
+		{"GET /api/v1/me", "200", 1},
+		{unmatchedRoute, "404", 1},
+	} {
+		got := testutil.ToFloat64(m.httpRequests.WithLabelValues(tc.route, tc.status))
+		if got != tc.want {
+			t.Errorf("%s %s: expected %v requests, got %v", tc.route, tc.status, tc.want, got)
+		}
+	}
+}
+
+type captureRecorder struct{ events []model.AuthEvent }
+
+func (r *captureRecorder) Record(event model.AuthEvent) { r.events = append(r.events, event) }
+
+func TestAuditRecorderCountsLoginOutcomes(t *testing.T) {
+	m := New()
+	next := &captureRecorder{}
+	recorder := m.AuditRecorder(next)
+
+	recorder.Record(model.AuthEvent{Type: model.AuthEventLogin, Outcome: model.OutcomeFailure, Reason: "wrong_password"})
+	recorder.Record(model.AuthEvent{Type: model.AuthEventLogin, Outcome: model.OutcomeFailure, Reason: "wrong_password"})
+	recorder.Record(model.AuthEvent{Type: model.AuthEventLogin, Outcome: model.OutcomeSuccess})
+	recorder.Record(model.AuthEvent{Type: model.AuthEventRegister, Outcome: model.OutcomeSuccess})
+	recorder.Record(model.AuthEvent{Type: model.AuthEventSessionRevoke, Outcome: model.OutcomeSuccess})
+
+	if got := testutil.ToFloat64(m.logins.WithLabelValues(model.OutcomeFailure, "wrong_password")); got != 2 {
+		t.Errorf("expected 2 wrong password failures, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.registrations.WithLabelValues(model.OutcomeSuccess, "")); got != 1 {
+		t.Errorf("expected 1 registration, got %v", got)
+	}
+	if len(next.events) != 5 {
+		t.Errorf("expected every event to be forwarded, got %d", len(next.events))
+	}
+}
+
+type stubUserRepo struct {
+	repository.RepositoryInstance
+}
+
+func (stubUserRepo) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	return nil, helper.ErrUserNotFound
+}
+
+func TestUserRepositoryObservesMethods(t *testing.T) {
+	m := New()
+	repo := m.UserRepository(stubUserRepo{})
+
+	if _, err := repo.GetUserByEmail(context.Background(), "a@example.com"); err != helper.ErrUserNotFound {
+		t.Fatalf("expected the wrapped error to pass through, got %v", err)
+	}
+
+	if got := testutil.CollectAndCount(m.queryDuration, namespace+"_repository_query_duration_seconds"); got != 1 {
+		t.Fatalf("expected 1 series, got %d", got)
+	}
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	want := `users_service_repository_query_duration_seconds_count{method="GetUserByEmail",outcome="not_found",repository="users"} 1`
+	if !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("expected exposition to contain %q", want)
+	}
+}
+
+// Register inserts the user inside a transaction; wrapped the way main
+// wraps it, the transaction's repository is observed like the standalone one.
+func TestUserRepositoryObservesCallsInsideTx(t *testing.T) {
+	m := New()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	users, sessions := memory.NewUserRepository(), memory.NewSessionRepository()
+	tx := repository.WrapTx(
+		memory.NewTxManager(users, sessions, memory.NewAuditRepository(), memory.NewDeviceRepository(), memory.NewOutboxRepository(), memory.NewTokenRepository()),
+		func(repos repository.Repositories) repository.Repositories {
+			repos.Users = m.UserRepository(repos.Users)
+			return repos
+		},
+	)
+
+	// the cheapest bcrypt cost keeps the test fast
+	hasher, err := password.NewHasher(password.Config{Algorithm: password.AlgorithmBcrypt, BcryptCost: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := service.NewUserService(m.UserRepository(users), sessions, logger, "a test secret that is long enough for HS256", service.WithPasswordHasher(hasher), service.WithTxManager(tx))
+
+	if err := svc.Register(context.Background(), model.Credential{Email: "new@example.com", Password: "a good password"}, model.ClientInfo{}); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	want := `users_service_repository_query_duration_seconds_count{method="InsertUser",outcome="ok",repository="users"} 1`
+	if !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("expected exposition to contain %q", want)
+	}
+}
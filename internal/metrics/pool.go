@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PoolStater is satisfied by *pgxpool.Pool.
+type PoolStater interface {
+	Stat() *pgxpool.Stat
+}
+
+// poolCollector reads the pool statistics on every scrape instead of
+// polling them in the background.
+type poolCollector struct {
+	pool PoolStater
+
+	acquiredConns      *prometheus.Desc
+	idleConns          *prometheus.Desc
+	totalConns         *prometheus.Desc
+	maxConns           *prometheus.Desc
+	acquires           *prometheus.Desc
+	acquireDuration    *prometheus.Desc
+	emptyAcquires      *prometheus.Desc
+	canceledAcquires   *prometheus.Desc
+	newConns           *prometheus.Desc
+	maxLifetimeDestroy *prometheus.Desc
+	maxIdleDestroy     *prometheus.Desc
+}
+
+func poolDesc(name, help string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", name), help, nil, nil)
+}
+
+// RegisterPool exports the connection pool statistics.
+func (m *Metrics) RegisterPool(pool PoolStater) error {
+	return m.Register(&poolCollector{
+		pool:               pool,
+		acquiredConns:      poolDesc("acquired_connections", "Connections currently checked out of the pool."),
+		idleConns:          poolDesc("idle_connections", "Idle connections in the pool."),
+		totalConns:         poolDesc("total_connections", "Connections currently open, including ones being established."),
+		maxConns:           poolDesc("max_connections", "Maximum size of the pool."),
+		acquires:           poolDesc("acquires_total", "Successful connection acquisitions."),
+		acquireDuration:    poolDesc("acquire_duration_seconds_total", "Total time spent waiting to acquire a connection."),
+		emptyAcquires:      poolDesc("empty_acquires_total", "Acquisitions that had to wait because the pool was empty."),
+		canceledAcquires:   poolDesc("canceled_acquires_total", "Acquisitions cancelled by their context."),
+		newConns:           poolDesc("new_connections_total", "Connections opened."),
+		maxLifetimeDestroy: poolDesc("max_lifetime_destroys_total", "Connections closed for exceeding DB_MAX_CONN_LIFETIME."),
+		maxIdleDestroy:     poolDesc("max_idle_destroys_total", "Connections closed for exceeding DB_MAX_CONN_IDLE_TIME."),
+	})
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+
+	gauge := func(desc *prometheus.Desc, value float64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value)
+	}
+	counter := func(desc *prometheus.Desc, value float64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, value)
+	}
+
+	gauge(c.acquiredConns, float64(stat.AcquiredConns()))
+	gauge(c.idleConns, float64(stat.IdleConns()))
+	gauge(c.totalConns, float64(stat.TotalConns()))
+	gauge(c.maxConns, float64(stat.MaxConns()))
+	counter(c.acquires, float64(stat.AcquireCount()))
+	counter(c.acquireDuration, stat.AcquireDuration().Seconds())
+	counter(c.emptyAcquires, float64(stat.EmptyAcquireCount()))
+	counter(c.canceledAcquires, float64(stat.CanceledAcquireCount()))
+	counter(c.newConns, float64(stat.NewConnsCount()))
+	counter(c.maxLifetimeDestroy, float64(stat.MaxLifetimeDestroyCount()))
+	counter(c.maxIdleDestroy, float64(stat.MaxIdleDestroyCount()))
+}
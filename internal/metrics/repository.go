@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/helper"
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/dosedaf/syncup-users-service/internal/repository"
+)
+
+type userRepository struct {
+	next    repository.RepositoryInstance
+	metrics *Metrics
+}
+
+// UserRepository times every call on next by method name.
+func (m *Metrics) UserRepository(next repository.RepositoryInstance) repository.RepositoryInstance {
+	return &userRepository{next: next, metrics: m}
+}
+
+func (r *userRepository) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	start := time.Now()
+	user, err := r.next.GetUserByEmail(ctx, email)
+	r.observe("GetUserByEmail", start, err)
+
+	return user, err
+}
+
+func (r *userRepository) GetUserByID(ctx context.Context, id int) (*model.User, error) {
+	start := time.Now()
+	user, err := r.next.GetUserByID(ctx, id)
+	r.observe("GetUserByID", start, err)
+
+	return user, err
+}
+
+func (r *userRepository) GetUsersByIDs(ctx context.Context, ids []int) ([]model.User, error) {
+	start := time.Now()
+	users, err := r.next.GetUsersByIDs(ctx, ids)
+	r.observe("GetUsersByIDs", start, err)
+
+	return users, err
+}
+
+func (r *userRepository) IsEmailAvailable(ctx context.Context, email string) error {
+	start := time.Now()
+	err := r.next.IsEmailAvailable(ctx, email)
+	r.observe("IsEmailAvailable", start, err)
+
+	return err
+}
+
+func (r *userRepository) InsertUser(ctx context.Context, credential model.Credential, pepperVersion int) (*model.User, error) {
+	start := time.Now()
+	user, err := r.next.InsertUser(ctx, credential, pepperVersion)
+	r.observe("InsertUser", start, err)
+
+	return user, err
+}
+
+func (r *userRepository) UpdatePasswordHash(ctx context.Context, email string, passwordHash string, pepperVersion int) error {
+	start := time.Now()
+	err := r.next.UpdatePasswordHash(ctx, email, passwordHash, pepperVersion)
+	r.observe("UpdatePasswordHash", start, err)
+
+	return err
+}
+
+func (r *userRepository) SetPasswordResetRequired(ctx context.Context, userID int, required bool) error {
+	start := time.Now()
+	err := r.next.SetPasswordResetRequired(ctx, userID, required)
+	r.observe("SetPasswordResetRequired", start, err)
+
+	return err
+}
+
+func (r *userRepository) observe(method string, start time.Time, err error) {
+	r.metrics.queryDuration.WithLabelValues("users", method, queryOutcome(err)).Observe(time.Since(start).Seconds())
+}
+
+// queryOutcome separates real failures from the sentinel errors repositories
+// return for expected results such as a missing row.
+func queryOutcome(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, helper.ErrUserNotFound):
+		return "not_found"
+	case errors.Is(err, helper.ErrEmailAlreadyExists):
+		return "conflict"
+	default:
+		return "error"
+	}
+}
@@ -0,0 +1,56 @@
+package model
+
+import "time"
+
+// Audited event types. A "this wasn't me" report is the only way an account
+// gets locked, so it stands in for lockouts. There is no lockout after
+// failed logins and no token refresh, clients log in again instead, so
+// neither has an event type.
+const (
+	AuthEventRegister       = "user.register"
+	AuthEventLogin          = "user.login"
+	AuthEventPasswordChange = "user.password_change"
+	AuthEventSessionRevoke  = "session.revoke"
+	AuthEventNotMeReport    = "user.not_me_report"
+	AuthEventAdminAction    = "admin.action"
+)
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// AuthEvent is a single entry in the append-only authentication audit log.
+// ActorID is who performed the action and SubjectID whose account it
+// concerns; they differ for admin actions and are nil when unknown.
+type AuthEvent struct {
+	ID           int64     `json:"id" db:"id"`
+	Type         string    `json:"type" db:"event_type"`
+	Outcome      string    `json:"outcome" db:"outcome"`
+	Reason       string    `json:"reason,omitempty" db:"reason"`
+	ActorID      *int      `json:"actor_id" db:"actor_id"`
+	SubjectID    *int      `json:"subject_id" db:"subject_id"`
+	SubjectEmail string    `json:"subject_email,omitempty" db:"subject_email"`
+	IP           string    `json:"ip" db:"ip"`
+	UserAgent    string    `json:"user_agent" db:"user_agent"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+const (
+	DefaultAuthEventLimit = 50
+	MaxAuthEventLimit     = 200
+)
+
+// AuthEventFilter narrows an audit log query. Zero values match everything.
+// Results are ordered newest first and paginated by passing the smallest ID
+// of the previous page as BeforeID.
+type AuthEventFilter struct {
+	SubjectID *int
+	ActorID   *int
+	Type      string
+	Outcome   string
+	Since     time.Time
+	Until     time.Time
+	BeforeID  int64
+	Limit     int
+}
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// KnownDevice is a client fingerprint a user has logged in from before.
+type KnownDevice struct {
+	UserID      int       `json:"-" db:"user_id"`
+	Fingerprint string    `json:"fingerprint" db:"fingerprint"`
+	UAFamily    string    `json:"ua_family" db:"ua_family"`
+	IPPrefix    string    `json:"ip_prefix" db:"ip_prefix"`
+	FirstSeenAt time.Time `json:"first_seen_at" db:"first_seen_at"`
+	LastSeenAt  time.Time `json:"last_seen_at" db:"last_seen_at"`
+}
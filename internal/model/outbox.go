@@ -0,0 +1,36 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Lifecycle events other services consume. Only registration exists today;
+// the rest are reserved so consumers can be written against the final names.
+const (
+	UserEventRegistered     = "user.registered"
+	UserEventEmailVerified  = "user.email_verified"
+	UserEventProfileChanged = "user.profile_changed"
+	UserEventDeleted        = "user.deleted"
+)
+
+// OutboxEvent is a lifecycle event waiting in the outbox to be published.
+// Events for one user are published in ID order; a failing event holds back
+// the user's later ones until it goes through.
+type OutboxEvent struct {
+	ID            int64           `json:"id" db:"id"`
+	UserID        int             `json:"user_id" db:"user_id"`
+	Type          string          `json:"type" db:"event_type"`
+	Payload       json.RawMessage `json:"data" db:"payload"`
+	CreatedAt     time.Time       `json:"occurred_at" db:"created_at"`
+	Attempts      int             `json:"-" db:"attempts"`
+	NextAttemptAt time.Time       `json:"-" db:"next_attempt_at"`
+	LastError     string          `json:"-" db:"last_error"`
+	PublishedAt   *time.Time      `json:"-" db:"published_at"`
+}
+
+// UserEventPayload is the data carried by user lifecycle events.
+type UserEventPayload struct {
+	UserID int    `json:"user_id"`
+	Email  string `json:"email"`
+}
@@ -2,6 +2,11 @@ package model
 
 import "time"
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type Credential struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
@@ -9,9 +14,12 @@ type Credential struct {
 
 // User represents a user in the database.
 type User struct {
-	ID           int        `json:"id" db:"id"`
-	Email        string     `json:"email" db:"email"`
-	PasswordHash *string    `json:"-" db:"password_hash"` // Pointer to handle nullable
-	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
-	UpdatedAt    *time.Time `json:"updated_at" db:"updated_at"` // Pointer to handle nullable
+	ID                    int        `json:"id" db:"id"`
+	Email                 string     `json:"email" db:"email"`
+	PasswordHash          *string    `json:"-" db:"password_hash"` // Pointer to handle nullable
+	PepperVersion         int        `json:"-" db:"pepper_version"`
+	Role                  string     `json:"role" db:"role"`
+	PasswordResetRequired bool       `json:"-" db:"password_reset_required"`
+	CreatedAt             time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt             *time.Time `json:"updated_at" db:"updated_at"` // Pointer to handle nullable
 }
@@ -0,0 +1,81 @@
+package model
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+)
+
+// UserEventTypes lists the lifecycle event types something records, in the
+// order they are documented. Webhook subscriptions may only ask for these,
+// so a reserved type joins the list once the service emits it.
+var UserEventTypes = []string{
+	UserEventRegistered,
+}
+
+// WebhookSubscription asks for the events of the listed types to be POSTed
+// to URL. Secret signs every delivery and is only shown when the
+// subscription is created.
+type WebhookSubscription struct {
+	ID          int       `json:"id" db:"id"`
+	URL         string    `json:"url" db:"url"`
+	Secret      string    `json:"-" db:"secret"`
+	EventTypes  []string  `json:"event_types" db:"event_types"`
+	Description string    `json:"description" db:"description"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// Wants reports whether the subscription asked for events of eventType.
+func (s *WebhookSubscription) Wants(eventType string) bool {
+	return slices.Contains(s.EventTypes, eventType)
+}
+
+// Delivery states. A pending delivery is retried with backoff until it is
+// delivered or runs out of attempts and is dead-lettered. Dead deliveries
+// stay until an admin redelivers them.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryDead      = "dead"
+)
+
+// WebhookDelivery is one outbox event on its way to one subscription.
+type WebhookDelivery struct {
+	ID             int64           `json:"id" db:"id"`
+	SubscriptionID int             `json:"subscription_id" db:"subscription_id"`
+	EventID        int64           `json:"event_id" db:"event_id"`
+	EventType      string          `json:"event_type" db:"event_type"`
+	Payload        json.RawMessage `json:"payload" db:"payload"`
+	OccurredAt     time.Time       `json:"occurred_at" db:"occurred_at"`
+	Status         string          `json:"status" db:"status"`
+	Attempts       int             `json:"attempts" db:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at" db:"next_attempt_at"`
+	LastError      string          `json:"last_error" db:"last_error"`
+	CreatedAt      time.Time       `json:"created_at" db:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at" db:"delivered_at"`
+}
+
+// WebhookDeliveryAttempt is the log entry of one POST of a delivery.
+// StatusCode is zero when no response was received.
+type WebhookDeliveryAttempt struct {
+	ID          int64     `json:"id" db:"id"`
+	DeliveryID  int64     `json:"delivery_id" db:"delivery_id"`
+	AttemptedAt time.Time `json:"attempted_at" db:"attempted_at"`
+	StatusCode  int       `json:"status_code" db:"status_code"`
+	Error       string    `json:"error" db:"error"`
+	DurationMS  int64     `json:"duration_ms" db:"duration_ms"`
+}
+
+const (
+	DefaultWebhookDeliveryLimit = 50
+	MaxWebhookDeliveryLimit     = 200
+)
+
+// WebhookDeliveryFilter narrows a subscription's delivery log. Results are
+// ordered newest first and paginated like the audit log.
+type WebhookDeliveryFilter struct {
+	SubscriptionID int
+	Status         string
+	BeforeID       int64
+	Limit          int
+}
@@ -0,0 +1,152 @@
+// Package openapi holds the OpenAPI document of the service and checks
+// responses against it, so tests fail when the code and the document drift.
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+//go:embed openapi.json
+var spec []byte
+
+// Spec returns the raw OpenAPI document.
+func Spec() []byte {
+	return spec
+}
+
+// Handler serves the document at /openapi.json.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(spec)
+	})
+}
+
+// Document is the parsed OpenAPI document. Schemas are kept as decoded JSON
+// since only the subset of JSON Schema used by openapi.json is validated.
+type Document struct {
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components struct {
+		Schemas   map[string]any       `json:"schemas"`
+		Responses map[string]*Response `json:"responses"`
+	} `json:"components"`
+}
+
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+type Response struct {
+	Ref     string               `json:"$ref"`
+	Content map[string]MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema any `json:"schema"`
+}
+
+// Load parses the embedded document.
+func Load() (*Document, error) {
+	doc := &Document{}
+	if err := json.Unmarshal(spec, doc); err != nil {
+		return nil, fmt.Errorf("failed to parse openapi.json: %w", err)
+	}
+
+	return doc, nil
+}
+
+// Operations lists every documented operation as a ServeMux pattern, such
+// as "DELETE /api/v1/me/sessions/{id}", sorted.
+func (d *Document) Operations() []string {
+	var ops []string
+	for path, item := range d.Paths {
+		for method := range item {
+			ops = append(ops, strings.ToUpper(method)+" "+path)
+		}
+	}
+	sort.Strings(ops)
+
+	return ops
+}
+
+// ValidateResponse checks that the operation matching method and path, which
+// may carry a query string, documents status and the response content type,
+// and that body conforms to the documented schema.
+func (d *Document) ValidateResponse(method, path string, status int, header http.Header, body []byte) error {
+	op, template := d.operation(method, path)
+	if op == nil {
+		return fmt.Errorf("%s %s is not documented", method, path)
+	}
+	name := method + " " + template
+
+	resp, ok := op.Responses[fmt.Sprint(status)]
+	if !ok {
+		if resp, ok = op.Responses["default"]; !ok {
+			return fmt.Errorf("%s: status %d is not documented", name, status)
+		}
+	}
+	if ref := resp.Ref; ref != "" {
+		if resp, ok = d.Components.Responses[strings.TrimPrefix(ref, "#/components/responses/")]; !ok {
+			return fmt.Errorf("%s: unresolved response %s", name, ref)
+		}
+	}
+
+	contentType, _, _ := strings.Cut(header.Get("Content-Type"), ";")
+	media, ok := resp.Content[strings.TrimSpace(contentType)]
+	if !ok {
+		return fmt.Errorf("%s: content type %q is not documented for status %d", name, contentType, status)
+	}
+
+	if !strings.HasSuffix(contentType, "json") {
+		return nil
+	}
+
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return fmt.Errorf("%s: response is not JSON: %w", name, err)
+	}
+	if err := d.validate(media.Schema, value, "$"); err != nil {
+		return fmt.Errorf("%s %d: %w", name, status, err)
+	}
+
+	return nil
+}
+
+// operation finds the operation whose path template matches path.
+func (d *Document) operation(method, path string) (*Operation, string) {
+	path, _, _ = strings.Cut(path, "?")
+	segments := strings.Split(path, "/")
+	for template, item := range d.Paths {
+		op, ok := item[strings.ToLower(method)]
+		if !ok {
+			continue
+		}
+
+		parts := strings.Split(template, "/")
+		if len(parts) != len(segments) {
+			continue
+		}
+
+		match := true
+		for i, part := range parts {
+			if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+				continue
+			}
+			if part != segments[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return op, template
+		}
+	}
+
+	return nil, ""
+}
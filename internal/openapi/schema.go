@@ -0,0 +1,227 @@
+package openapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/mail"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// validate checks value, as decoded by encoding/json, against a JSON Schema.
+// It supports the keywords openapi.json uses: $ref, type, const, enum,
+// properties, required, additionalProperties, items, anyOf, oneOf, minimum
+// and the date-time and email formats. Anything else is ignored.
+func (d *Document) validate(schema any, value any, at string) error {
+	s, ok := schema.(map[string]any)
+	if !ok {
+		// true and false are valid schemas too
+		if b, isBool := schema.(bool); isBool && !b {
+			return fmt.Errorf("%s: no value is allowed here", at)
+		}
+		return nil
+	}
+
+	if ref, ok := s["$ref"].(string); ok {
+		target, ok := d.Components.Schemas[strings.TrimPrefix(ref, "#/components/schemas/")]
+		if !ok {
+			return fmt.Errorf("%s: unresolved schema %s", at, ref)
+		}
+		return d.validate(target, value, at)
+	}
+
+	if t, ok := s["type"]; ok {
+		if err := checkType(t, value, at); err != nil {
+			return err
+		}
+	}
+
+	if c, ok := s["const"]; ok && !reflect.DeepEqual(c, value) {
+		return fmt.Errorf("%s: expected %v, got %v", at, c, value)
+	}
+
+	if enum, ok := s["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			if reflect.DeepEqual(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: %v is not one of %v", at, value, enum)
+		}
+	}
+
+	if minimum, ok := s["minimum"].(float64); ok {
+		if n, isNumber := value.(float64); isNumber && n < minimum {
+			return fmt.Errorf("%s: %v is below the minimum %v", at, n, minimum)
+		}
+	}
+
+	if format, ok := s["format"].(string); ok {
+		if str, isString := value.(string); isString {
+			if err := checkFormat(format, str); err != nil {
+				return fmt.Errorf("%s: %w", at, err)
+			}
+		}
+	}
+
+	if err := d.validateCombinators(s, value, at); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		return d.validateObject(s, v, at)
+	case []any:
+		if items, ok := s["items"]; ok {
+			for i, item := range v {
+				if err := d.validate(items, item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (d *Document) validateCombinators(s map[string]any, value any, at string) error {
+	if anyOf, ok := s["anyOf"].([]any); ok {
+		var errs []error
+		for _, sub := range anyOf {
+			err := d.validate(sub, value, at)
+			if err == nil {
+				errs = nil
+				break
+			}
+			errs = append(errs, err)
+		}
+		if errs != nil {
+			return fmt.Errorf("%s: matches none of anyOf: %w", at, errors.Join(errs...))
+		}
+	}
+
+	if oneOf, ok := s["oneOf"].([]any); ok {
+		matched := 0
+		for _, sub := range oneOf {
+			if d.validate(sub, value, at) == nil {
+				matched++
+			}
+		}
+		if matched != 1 {
+			return fmt.Errorf("%s: matches %d of oneOf, expected exactly 1", at, matched)
+		}
+	}
+
+	return nil
+}
+
+func (d *Document) validateObject(s map[string]any, v map[string]any, at string) error {
+	if required, ok := s["required"].([]any); ok {
+		for _, name := range required {
+			if _, present := v[name.(string)]; !present {
+				return fmt.Errorf("%s: missing required property %q", at, name)
+			}
+		}
+	}
+
+	properties, _ := s["properties"].(map[string]any)
+
+	// sorted so the first error reported is stable
+	keys := make([]string, 0, len(v))
+	for key := range v {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		path := at + "." + key
+		if prop, ok := properties[key]; ok {
+			if err := d.validate(prop, v[key], path); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if additional, ok := s["additionalProperties"]; ok {
+			if b, isBool := additional.(bool); isBool && !b {
+				return fmt.Errorf("%s: undocumented property", path)
+			}
+			if err := d.validate(additional, v[key], path); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkType accepts a single type or, as in OpenAPI 3.1, a list of them.
+func checkType(t any, value any, at string) error {
+	var types []string
+	switch t := t.(type) {
+	case string:
+		types = []string{t}
+	case []any:
+		for _, name := range t {
+			types = append(types, name.(string))
+		}
+	}
+
+	for _, name := range types {
+		if hasType(name, value) {
+			return nil
+		}
+	}
+
+	got, _ := json.Marshal(value)
+	return fmt.Errorf("%s: expected %s, got %s", at, strings.Join(types, " or "), got)
+}
+
+func hasType(name string, value any) bool {
+	switch name {
+	case "null":
+		return value == nil
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	}
+
+	return false
+}
+
+func checkFormat(format, value string) error {
+	switch format {
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339Nano, value); err != nil {
+			return fmt.Errorf("%q is not a date-time", value)
+		}
+	case "email":
+		if _, err := mail.ParseAddress(value); err != nil {
+			return fmt.Errorf("%q is not an email address", value)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,151 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/internal/model"
+)
+
+const (
+	PublisherNone    = "none"
+	PublisherStdout  = "stdout"
+	PublisherFile    = "file"
+	PublisherWebhook = "webhook"
+
+	DefaultWebhookTimeout = 10 * time.Second
+)
+
+// Publisher delivers one event to consumers. Delivery is at least once: an
+// event whose Publish returned an error, or whose success was not recorded
+// before a crash, is published again, so consumers must deduplicate by ID.
+type Publisher interface {
+	Publish(ctx context.Context, event model.OutboxEvent) error
+}
+
+type Config struct {
+	Publisher  string
+	File       string
+	WebhookURL string
+	// Output receives events from the stdout publisher.
+	Output io.Writer
+}
+
+// NewPublisher builds the configured publisher. The returned function
+// releases whatever it holds open.
+func NewPublisher(config Config) (Publisher, func() error, error) {
+	noClose := func() error { return nil }
+
+	switch config.Publisher {
+	case PublisherNone, "":
+		return Discard{}, noClose, nil
+	case PublisherStdout:
+		return NewWriterPublisher(config.Output), noClose, nil
+	case PublisherFile:
+		f, err := os.OpenFile(config.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed while opening outbox file: %w", err)
+		}
+		return NewWriterPublisher(f), f.Close, nil
+	case PublisherWebhook:
+		return NewWebhookPublisher(config.WebhookURL, &http.Client{Timeout: DefaultWebhookTimeout}), noClose, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown outbox publisher %q", config.Publisher)
+	}
+}
+
+// WriterPublisher writes each event as a line of JSON.
+type WriterPublisher struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterPublisher(w io.Writer) *WriterPublisher {
+	return &WriterPublisher{w: w}
+}
+
+func (p *WriterPublisher) Publish(ctx context.Context, event model.OutboxEvent) error {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, err = p.w.Write(append(b, '\n'))
+	return err
+}
+
+// WebhookPublisher POSTs each event as JSON to a single URL and treats any
+// 2xx response as delivered. The event ID is repeated in a header so that
+// receivers can drop redeliveries without parsing the body.
+type WebhookPublisher struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookPublisher(url string, client *http.Client) *WebhookPublisher {
+	return &WebhookPublisher{
+		url:    url,
+		client: client,
+	}
+}
+
+func (p *WebhookPublisher) Publish(ctx context.Context, event model.OutboxEvent) error {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-ID", strconv.FormatInt(event.ID, 10))
+	req.Header.Set("X-Event-Type", event.Type)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// drain so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+
+	return nil
+}
+
+// Publishers publishes every event to each of its publishers in turn. An
+// error from any of them fails the event, which is then published to all of
+// them again, so each must tolerate duplicates.
+type Publishers []Publisher
+
+func (ps Publishers) Publish(ctx context.Context, event model.OutboxEvent) error {
+	for _, p := range ps {
+		if err := p.Publish(ctx, event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Discard drops every event. Events still count as published, so the outbox
+// does not grow when nothing consumes it.
+type Discard struct{}
+
+func (Discard) Publish(context.Context, model.OutboxEvent) error { return nil }
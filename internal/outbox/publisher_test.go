@@ -0,0 +1,140 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/internal/model"
+)
+
+func testEvent() model.OutboxEvent {
+	return model.OutboxEvent{
+		ID:        7,
+		UserID:    3,
+		Type:      model.UserEventRegistered,
+		Payload:   json.RawMessage(`{"user_id":3,"email":"test@gmail.com"}`),
+		CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Attempts:  2,
+		LastError: "internal detail",
+	}
+}
+
+func TestWriterPublisherWritesJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+	publisher := NewWriterPublisher(&buf)
+
+	for range 2 {
+		if err := publisher.Publish(context.Background(), testEvent()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", buf.String())
+	}
+
+	want := `{"id":7,"user_id":3,"type":"user.registered","data":{"user_id":3,"email":"test@gmail.com"},"occurred_at":"2024-05-01T12:00:00Z"}`
+	if lines[0] != want {
+		t.Errorf("expected %s, got %s", want, lines[0])
+	}
+}
+
+func TestWebhookPublisher(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{"delivered", http.StatusNoContent, false},
+		{"rejected", http.StatusServiceUnavailable, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *http.Request
+			var body []byte
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r
+				body, _ = io.ReadAll(r.Body)
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			publisher := NewWebhookPublisher(srv.URL, srv.Client())
+			err := publisher.Publish(context.Background(), testEvent())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			if got.Method != http.MethodPost || got.Header.Get("Content-Type") != "application/json" {
+				t.Errorf("unexpected request %s %s", got.Method, got.Header.Get("Content-Type"))
+			}
+			if got.Header.Get("X-Event-ID") != "7" || got.Header.Get("X-Event-Type") != model.UserEventRegistered {
+				t.Errorf("unexpected event headers %v", got.Header)
+			}
+
+			var event model.OutboxEvent
+			if err := json.Unmarshal(body, &event); err != nil || event.ID != 7 {
+				t.Errorf("unexpected body %s", body)
+			}
+		})
+	}
+}
+
+func TestNewPublisherFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+
+	for range 2 {
+		publisher, closePublisher, err := NewPublisher(Config{Publisher: PublisherFile, File: path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := publisher.Publish(context.Background(), testEvent()); err != nil {
+			t.Fatal(err)
+		}
+		if err := closePublisher(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(b), "\n"); n != 2 {
+		t.Errorf("expected the file to be appended to, got %d lines", n)
+	}
+}
+
+func TestPublishersStopAtFirstFailure(t *testing.T) {
+	event := testEvent()
+	first := &fakePublisher{}
+	failing := &fakePublisher{failures: map[int64]int{event.ID: 1}}
+	last := &fakePublisher{}
+	publishers := Publishers{first, failing, last}
+
+	if err := publishers.Publish(context.Background(), event); err == nil {
+		t.Fatal("expected the failure to fail the event")
+	}
+	if len(last.deliveredIDs()) != 0 {
+		t.Error("expected publishers after the failing one to be skipped")
+	}
+
+	// the retry goes to every publisher again
+	if err := publishers.Publish(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+	if got := [][]int64{first.deliveredIDs(), failing.deliveredIDs(), last.deliveredIDs()}; len(got[0]) != 2 || len(got[1]) != 1 || len(got[2]) != 1 {
+		t.Errorf("unexpected deliveries %v", got)
+	}
+}
@@ -0,0 +1,168 @@
+// Package outbox publishes the user lifecycle events that services record in
+// the outbox table, in the same transaction as the change they describe.
+package outbox
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/internal/model"
+)
+
+const (
+	DefaultPollInterval = time.Second
+	DefaultBatchSize    = 100
+	// DefaultLease is how long a claimed event is hidden from other relays.
+	// A batch is published within it and what is left is claimed again.
+	DefaultLease      = time.Minute
+	DefaultMinBackoff = time.Second
+	DefaultMaxBackoff = 10 * time.Minute
+)
+
+// Store is the part of the outbox repository the relay uses.
+type Store interface {
+	ClaimOutboxEvents(ctx context.Context, now time.Time, leaseUntil time.Time, limit int) ([]model.OutboxEvent, error)
+	MarkOutboxEventPublished(ctx context.Context, id int64) error
+	MarkOutboxEventFailed(ctx context.Context, id int64, nextAttemptAt time.Time, lastError string) error
+}
+
+// Relay polls the outbox and hands due events to a Publisher. Failed events
+// are retried with exponential backoff for as long as it takes, and a
+// user's later events wait until the failing one goes through. Several
+// relays can share one outbox; claims keep them from publishing the same
+// event at the same time.
+type Relay struct {
+	store        Store
+	publisher    Publisher
+	logger       *slog.Logger
+	pollInterval time.Duration
+	batchSize    int
+	lease        time.Duration
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+	now          func() time.Time
+}
+
+func NewRelay(store Store, publisher Publisher, logger *slog.Logger, pollInterval time.Duration) *Relay {
+	if pollInterval <= 0 {
+		pollInterval = DefaultPollInterval
+	}
+
+	return &Relay{
+		store:        store,
+		publisher:    publisher,
+		logger:       logger,
+		pollInterval: pollInterval,
+		batchSize:    DefaultBatchSize,
+		lease:        DefaultLease,
+		minBackoff:   DefaultMinBackoff,
+		maxBackoff:   DefaultMaxBackoff,
+		now:          time.Now,
+	}
+}
+
+// Run publishes due events until ctx is cancelled. An event that is being
+// published when ctx is cancelled is published again after its lease ends.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		// a full batch means there may be more, so a backlog is worked off
+		// without waiting for the next tick
+		if r.relayBatch(ctx) == r.batchSize && ctx.Err() == nil {
+			continue
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// relayBatch publishes one batch and returns how many events it claimed.
+// Publishing stops when the lease runs out, before another relay could
+// claim the same events, and the events left are published after it.
+func (r *Relay) relayBatch(ctx context.Context) int {
+	claimed := time.Now()
+	now := r.now()
+	events, err := r.store.ClaimOutboxEvents(ctx, now, now.Add(r.lease), r.batchSize)
+	if err != nil {
+		if ctx.Err() == nil {
+			r.logger.ErrorContext(ctx, "Failed while claiming outbox events", "error", err)
+		}
+		return 0
+	}
+
+	ctx, cancel := context.WithDeadline(ctx, claimed.Add(r.lease))
+	defer cancel()
+
+	// claims hold at most one event per user, so publishing them in any
+	// order keeps every user's events in order
+	for _, event := range events {
+		if ctx.Err() != nil {
+			break
+		}
+		r.publish(ctx, event)
+	}
+
+	return len(events)
+}
+
+func (r *Relay) publish(ctx context.Context, event model.OutboxEvent) {
+	err := r.publisher.Publish(ctx, event)
+	if err != nil && ctx.Err() != nil {
+		// cut short by shutdown or the end of the lease, not a failure
+		return
+	}
+
+	// record the outcome even if shutdown started meanwhile, so a delivered
+	// event is not sent again
+	ctx = context.WithoutCancel(ctx)
+
+	if err == nil {
+		if err = r.store.MarkOutboxEventPublished(ctx, event.ID); err != nil {
+			r.logger.ErrorContext(ctx,
+				"Failed while marking outbox event published, it will be delivered again",
+				"id", event.ID,
+				"error", err,
+			)
+		}
+		return
+	}
+
+	delay := r.backoff(event.Attempts)
+	r.logger.WarnContext(ctx,
+		"Failed while publishing outbox event",
+		"id", event.ID,
+		"type", event.Type,
+		"user_id", event.UserID,
+		"attempts", event.Attempts+1,
+		"retry_in", delay,
+		"error", err,
+	)
+
+	if err := r.store.MarkOutboxEventFailed(ctx, event.ID, r.now().Add(delay), err.Error()); err != nil {
+		r.logger.ErrorContext(ctx,
+			"Failed while recording outbox event failure",
+			"id", event.ID,
+			"error", err,
+		)
+	}
+}
+
+// backoff doubles the delay with every failed attempt, up to maxBackoff.
+func (r *Relay) backoff(attempts int) time.Duration {
+	delay := r.minBackoff
+	for range attempts {
+		delay *= 2
+		if delay >= r.maxBackoff {
+			return r.maxBackoff
+		}
+	}
+
+	return delay
+}
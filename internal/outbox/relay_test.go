@@ -0,0 +1,188 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/dosedaf/syncup-users-service/internal/repository/memory"
+)
+
+// fakePublisher fails each event as many times as failures says and records
+// the IDs of the events it delivered, in delivery order. Each publish takes
+// delay.
+type fakePublisher struct {
+	mu        sync.Mutex
+	failures  map[int64]int
+	delay     time.Duration
+	delivered []int64
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, event model.OutboxEvent) error {
+	select {
+	case <-time.After(p.delay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.failures[event.ID] > 0 {
+		p.failures[event.ID]--
+		return errors.New("consumer unavailable")
+	}
+
+	p.delivered = append(p.delivered, event.ID)
+	return nil
+}
+
+func (p *fakePublisher) deliveredIDs() []int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return slices.Clone(p.delivered)
+}
+
+func insertEvents(t *testing.T, store *memory.OutboxRepository, userIDs ...int) {
+	t.Helper()
+
+	for _, userID := range userIDs {
+		event := &model.OutboxEvent{UserID: userID, Type: model.UserEventRegistered, Payload: []byte(`{}`)}
+		if err := store.InsertOutboxEvent(context.Background(), event); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRelayRetriesInOrderPerUser(t *testing.T) {
+	store := memory.NewOutboxRepository()
+	// events 1 and 2 belong to user 1, event 3 to user 2
+	insertEvents(t, store, 1, 1, 2)
+
+	publisher := &fakePublisher{failures: map[int64]int{1: 2}}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	relay := NewRelay(store, publisher, logger, time.Minute)
+
+	now := time.Now()
+	relay.now = func() time.Time { return now }
+
+	steps := []struct {
+		advance time.Duration
+		want    []int64
+	}{
+		// event 1 fails, user 2 is not held up by it
+		{0, []int64{3}},
+		// event 2 waits for event 1 to go through
+		{0, []int64{3}},
+		// the first retry is a second later and fails again
+		{time.Second, []int64{3}},
+		// the second retry waits twice as long
+		{time.Second, []int64{3}},
+		{time.Second, []int64{3, 1}},
+		{0, []int64{3, 1, 2}},
+		{time.Hour, []int64{3, 1, 2}},
+	}
+
+	for i, step := range steps {
+		now = now.Add(step.advance)
+		relay.relayBatch(context.Background())
+
+		if got := publisher.deliveredIDs(); !slices.Equal(got, step.want) {
+			t.Fatalf("step %d: expected %v delivered, got %v", i, step.want, got)
+		}
+	}
+}
+
+func TestRelayBackoff(t *testing.T) {
+	relay := NewRelay(nil, nil, nil, 0)
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{5, 32 * time.Second},
+		{9, 512 * time.Second},
+		{10, DefaultMaxBackoff},
+		{100, DefaultMaxBackoff},
+	}
+
+	for _, tt := range tests {
+		if got := relay.backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestRelayRunDrainsBacklog(t *testing.T) {
+	store := memory.NewOutboxRepository()
+	userIDs := make([]int, 2*DefaultBatchSize+1)
+	for i := range userIDs {
+		userIDs[i] = i + 1
+	}
+	insertEvents(t, store, userIDs...)
+
+	publisher := &fakePublisher{}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	// the poll interval is far longer than the test, so everything has to be
+	// published by following full batches
+	relay := NewRelay(store, publisher, logger, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		relay.Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.After(5 * time.Second)
+	for len(publisher.deliveredIDs()) < len(userIDs) {
+		select {
+		case <-deadline:
+			t.Fatalf("expected %d events delivered, got %d", len(userIDs), len(publisher.deliveredIDs()))
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+
+	cancel()
+	<-done
+}
+
+// A batch that takes longer than its lease stops publishing when the lease
+// runs out, so no event is sent by two relays, and the rest follow later.
+func TestRelayStopsAtLease(t *testing.T) {
+	store := memory.NewOutboxRepository()
+	insertEvents(t, store, 1, 2, 3, 4, 5)
+
+	publisher := &fakePublisher{delay: 40 * time.Millisecond}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	relay := NewRelay(store, publisher, logger, time.Minute)
+	relay.lease = 100 * time.Millisecond
+
+	if claimed := relay.relayBatch(context.Background()); claimed != 5 {
+		t.Fatalf("expected 5 events claimed, got %d", claimed)
+	}
+	if delivered := publisher.deliveredIDs(); len(delivered) == 0 || len(delivered) == 5 {
+		t.Fatalf("expected the batch to stop at its lease, delivered %v", delivered)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(publisher.deliveredIDs()) < 5 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		relay.relayBatch(context.Background())
+	}
+
+	delivered := publisher.deliveredIDs()
+	slices.Sort(delivered)
+	if !slices.Equal(delivered, []int64{1, 2, 3, 4, 5}) {
+		t.Errorf("expected every event delivered once, got %v", delivered)
+	}
+}
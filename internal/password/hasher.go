@@ -0,0 +1,110 @@
+package password
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+var ErrUnsupportedHash = errors.New("unsupported password hash format")
+var ErrMalformedHash = errors.New("malformed password hash")
+
+// Hasher hashes passwords into PHC-style encoded strings and verifies them.
+// Verify accepts every supported algorithm regardless of which one the hasher
+// is configured to produce, so stored hashes keep working after a switch.
+type Hasher interface {
+	Hash(password string) (string, error)
+	Verify(password, encoded string) (bool, error)
+	NeedsRehash(encoded string) bool
+}
+
+type Config struct {
+	Algorithm  string
+	BcryptCost int
+	Argon2     Argon2Params
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Algorithm:  AlgorithmBcrypt,
+		BcryptCost: DefaultBcryptCost,
+		Argon2:     DefaultArgon2Params(),
+	}
+}
+
+type hasher struct {
+	config Config
+}
+
+func NewHasher(config Config) (Hasher, error) {
+	switch config.Algorithm {
+	case AlgorithmBcrypt:
+		if err := validateBcryptCost(config.BcryptCost); err != nil {
+			return nil, err
+		}
+	case AlgorithmArgon2id:
+		if err := config.Argon2.validate(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown password hash algorithm %q", config.Algorithm)
+	}
+
+	return &hasher{config: config}, nil
+}
+
+func (h *hasher) Hash(password string) (string, error) {
+	if h.config.Algorithm == AlgorithmArgon2id {
+		return hashArgon2id(password, h.config.Argon2)
+	}
+
+	return hashBcrypt(password, h.config.BcryptCost)
+}
+
+func (h *hasher) Verify(password, encoded string) (bool, error) {
+	switch algorithmOf(encoded) {
+	case AlgorithmBcrypt:
+		return verifyBcrypt(password, encoded)
+	case AlgorithmArgon2id:
+		return verifyArgon2id(password, encoded)
+	default:
+		return false, ErrUnsupportedHash
+	}
+}
+
+// NeedsRehash reports whether encoded was produced by a different algorithm
+// or with weaker parameters than the hasher is currently configured with.
+func (h *hasher) NeedsRehash(encoded string) bool {
+	if algorithmOf(encoded) != h.config.Algorithm {
+		return true
+	}
+
+	switch h.config.Algorithm {
+	case AlgorithmBcrypt:
+		cost, err := bcryptCost(encoded)
+		return err != nil || cost < h.config.BcryptCost
+	case AlgorithmArgon2id:
+		params, _, _, err := decodeArgon2id(encoded)
+		return err != nil || params.weakerThan(h.config.Argon2)
+	}
+
+	return true
+}
+
+func algorithmOf(encoded string) string {
+	switch {
+	case strings.HasPrefix(encoded, "$2a$"),
+		strings.HasPrefix(encoded, "$2b$"),
+		strings.HasPrefix(encoded, "$2y$"):
+		return AlgorithmBcrypt
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return AlgorithmArgon2id
+	default:
+		return ""
+	}
+}
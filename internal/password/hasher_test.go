@@ -0,0 +1,140 @@
+package password
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func cheapArgon2Config() Config {
+	config := DefaultConfig()
+	config.Algorithm = AlgorithmArgon2id
+	config.Argon2.Memory = 1024
+	config.Argon2.Iterations = 1
+	config.Argon2.Parallelism = 1
+	return config
+}
+
+func TestHashAndVerify(t *testing.T) {
+	bcryptConfig := DefaultConfig()
+	bcryptConfig.BcryptCost = 4
+
+	tests := []struct {
+		name   string
+		config Config
+		prefix string
+	}{
+		{"bcrypt", bcryptConfig, "$2a$04$"},
+		{"argon2id", cheapArgon2Config(), "$argon2id$v=19$m=1024,t=1,p=1$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hasher, err := NewHasher(tt.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			encoded, err := hasher.Hash("correct horse")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(encoded, tt.prefix) {
+				t.Errorf("expected prefix %q, got %q", tt.prefix, encoded)
+			}
+
+			if ok, err := hasher.Verify("correct horse", encoded); err != nil || !ok {
+				t.Errorf("expected match, got %v, %v", ok, err)
+			}
+			if ok, err := hasher.Verify("battery staple", encoded); err != nil || ok {
+				t.Errorf("expected mismatch, got %v, %v", ok, err)
+			}
+			if hasher.NeedsRehash(encoded) {
+				t.Error("fresh hash should not need rehash")
+			}
+		})
+	}
+}
+
+func TestVerifyLegacyBcryptWithArgon2Hasher(t *testing.T) {
+	hasher, err := NewHasher(cheapArgon2Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	legacy := "$2a$10$LpieyNVgH6lpdKZr.bKwPOBR0m.TcppenjlPKWEm5WtUMtPk.ziry"
+	ok, err := hasher.Verify("test", legacy)
+	if err != nil || !ok {
+		t.Fatalf("expected legacy bcrypt hash to verify, got %v, %v", ok, err)
+	}
+	if !hasher.NeedsRehash(legacy) {
+		t.Error("bcrypt hash should need rehash when argon2id is configured")
+	}
+}
+
+func TestNeedsRehashWeakerParameters(t *testing.T) {
+	weak, _ := NewHasher(cheapArgon2Config())
+	encoded, err := weak.Hash("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	strongerConfig := cheapArgon2Config()
+	strongerConfig.Argon2.Iterations = 2
+	stronger, _ := NewHasher(strongerConfig)
+	if !stronger.NeedsRehash(encoded) {
+		t.Error("expected hash with fewer iterations to need rehash")
+	}
+
+	bcryptConfig := DefaultConfig()
+	bcryptConfig.BcryptCost = 12
+	bcryptHasher, _ := NewHasher(bcryptConfig)
+	if !bcryptHasher.NeedsRehash("$2a$10$LpieyNVgH6lpdKZr.bKwPOBR0m.TcppenjlPKWEm5WtUMtPk.ziry") {
+		t.Error("expected cost 10 hash to need rehash at cost 12")
+	}
+}
+
+func TestVerifyUnsupportedHash(t *testing.T) {
+	hasher, _ := NewHasher(DefaultConfig())
+	if _, err := hasher.Verify("test", "$md5$abc"); !errors.Is(err, ErrUnsupportedHash) {
+		t.Errorf("expected ErrUnsupportedHash, got %v", err)
+	}
+	if _, err := hasher.Verify("test", "$argon2id$v=19$garbage"); !errors.Is(err, ErrMalformedHash) {
+		t.Errorf("expected ErrMalformedHash, got %v", err)
+	}
+}
+
+func TestLoadPepper(t *testing.T) {
+	secretA := strings.Repeat("a", MinPepperLength)
+	secretB := strings.Repeat("b", MinPepperLength)
+
+	pepper, err := LoadPepper("", "1:"+secretA+",2:"+secretB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pepper.Current() != 2 {
+		t.Errorf("expected current version 2, got %d", pepper.Current())
+	}
+
+	v1, _ := pepper.Apply(1, "test")
+	v2, _ := pepper.Apply(2, "test")
+	if v1 == v2 || v1 == "test" {
+		t.Error("expected distinct peppered values per version")
+	}
+
+	if _, err := pepper.Apply(3, "test"); !errors.Is(err, ErrUnknownPepperVersion) {
+		t.Errorf("expected ErrUnknownPepperVersion, got %v", err)
+	}
+
+	if _, err := LoadPepper("", "1:short"); err == nil {
+		t.Error("expected short pepper to be rejected")
+	}
+
+	none, err := LoadPepper("", "")
+	if err != nil || none != nil {
+		t.Fatalf("expected no pepper, got %v, %v", none, err)
+	}
+	if plain, _ := none.Apply(0, "test"); plain != "test" {
+		t.Error("version 0 should leave the password unchanged")
+	}
+}
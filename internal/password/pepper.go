@@ -0,0 +1,124 @@
+package password
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// MinPepperLength is the minimum accepted length of a pepper secret in bytes.
+const MinPepperLength = 32
+
+var ErrUnknownPepperVersion = errors.New("unknown pepper version")
+
+// Pepper holds the server-side secrets mixed into passwords before hashing.
+// Each secret has a version so that hashes can record which one they were
+// made with; version 0 means "no pepper" and is always available so hashes
+// created before peppering was enabled keep verifying. A nil *Pepper behaves
+// as if only version 0 exists.
+type Pepper struct {
+	keys    map[int][]byte
+	current int
+}
+
+func NewPepper(keys map[int][]byte) (*Pepper, error) {
+	p := &Pepper{keys: make(map[int][]byte, len(keys))}
+
+	for version, key := range keys {
+		if version < 1 {
+			return nil, fmt.Errorf("pepper version must be positive, got %d", version)
+		}
+		if len(key) < MinPepperLength {
+			return nil, fmt.Errorf("pepper version %d must be at least %d bytes", version, MinPepperLength)
+		}
+
+		p.keys[version] = key
+		if version > p.current {
+			p.current = version
+		}
+	}
+
+	return p, nil
+}
+
+// Current returns the version new hashes should be created with.
+func (p *Pepper) Current() int {
+	if p == nil {
+		return 0
+	}
+
+	return p.current
+}
+
+// Apply returns the peppered form of password for the given version. The
+// HMAC output is base64 encoded so it never contains NUL bytes and stays
+// under bcrypt's 72 byte input limit.
+func (p *Pepper) Apply(version int, password string) (string, error) {
+	if version == 0 {
+		return password, nil
+	}
+
+	if p == nil {
+		return "", fmt.Errorf("%w: %d", ErrUnknownPepperVersion, version)
+	}
+
+	key, ok := p.keys[version]
+	if !ok {
+		return "", fmt.Errorf("%w: %d", ErrUnknownPepperVersion, version)
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(password))
+
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// LoadPepper reads pepper secrets from the file at path if set, otherwise
+// from the raw env value. Both use the same format: "version:secret" entries
+// separated by newlines or commas. It returns nil when neither is set.
+func LoadPepper(path string, env string) (*Pepper, error) {
+	raw := env
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed while reading pepper file: %w", err)
+		}
+		raw = string(b)
+	}
+
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+
+	keys := make(map[int][]byte)
+	entries := strings.FieldsFunc(raw, func(r rune) bool { return r == '\n' || r == ',' })
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		versionStr, secret, found := strings.Cut(entry, ":")
+		if !found {
+			return nil, errors.New("pepper entries must have the form version:secret")
+		}
+
+		version, err := strconv.Atoi(strings.TrimSpace(versionStr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid pepper version %q: %w", versionStr, err)
+		}
+
+		if _, exists := keys[version]; exists {
+			return nil, fmt.Errorf("duplicate pepper version %d", version)
+		}
+
+		keys[version] = []byte(strings.TrimSpace(secret))
+	}
+
+	return NewPepper(keys)
+}
@@ -0,0 +1,283 @@
+//go:build integration
+
+// Package pgtest runs a disposable PostgreSQL server for integration tests.
+// The server is initialised with initdb in a temporary directory and only
+// listens on a unix socket, so tests need the PostgreSQL binaries but no
+// network and no running database.
+//
+// The binaries are looked up in $PG_BIN, then on $PATH, then in the usual
+// Debian location /usr/lib/postgresql/*/bin. Without them every test that
+// asks for a database is skipped.
+package pgtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/database"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	superuser    = "postgres"
+	port         = 5432
+	templateName = "pgtest_migrated"
+	startTimeout = 30 * time.Second
+)
+
+// Server is a running PostgreSQL instance holding a template database with
+// every migration applied. Each test gets its own copy of the template.
+type Server struct {
+	dataDir   string
+	socketDir string
+	cmd       *exec.Cmd
+	exited    chan struct{}
+	databases atomic.Int64
+
+	// err is why the server could not be started
+	err error
+}
+
+var server *Server
+
+// Main starts the server, runs the package's tests and stops it again. Call
+// it from TestMain:
+//
+//	func TestMain(m *testing.M) { os.Exit(pgtest.Main(m)) }
+func Main(m *testing.M) int {
+	server = start()
+	defer server.stop()
+
+	if server.err != nil {
+		fmt.Fprintf(os.Stderr, "pgtest: database tests will be skipped: %v\n", server.err)
+	}
+
+	return m.Run()
+}
+
+// NewDatabase returns a pool on a fresh, migrated database that is dropped
+// when the test ends. It skips the test if no server could be started.
+func NewDatabase(t testing.TB) *pgxpool.Pool {
+	t.Helper()
+
+	if server == nil {
+		t.Fatal("pgtest: NewDatabase called without pgtest.Main in TestMain")
+	}
+	if server.err != nil {
+		t.Skipf("pgtest: %v", server.err)
+	}
+
+	ctx := context.Background()
+	name := fmt.Sprintf("pgtest_%d", server.databases.Add(1))
+	if err := server.exec(ctx, fmt.Sprintf("CREATE DATABASE %s TEMPLATE %s", name, templateName)); err != nil {
+		t.Fatalf("pgtest: %v", err)
+	}
+
+	pool, err := database.ConnectPool(ctx, database.PoolConfig{URL: server.url(name), MaxConns: 16})
+	if err != nil {
+		t.Fatalf("pgtest: %v", err)
+	}
+
+	t.Cleanup(func() {
+		pool.Close()
+		if err := server.exec(ctx, "DROP DATABASE "+name); err != nil {
+			t.Errorf("pgtest: %v", err)
+		}
+	})
+
+	return pool
+}
+
+func start() *Server {
+	s := &Server{exited: make(chan struct{})}
+
+	if os.Geteuid() == 0 {
+		s.err = errors.New("postgres refuses to run as root")
+		return s
+	}
+
+	bin, err := findBinaries()
+	if err != nil {
+		s.err = err
+		return s
+	}
+
+	// unix socket paths are limited to about 100 bytes, so keep them short
+	if s.dataDir, err = os.MkdirTemp("", "pgtest-data"); err != nil {
+		s.err = err
+		return s
+	}
+	if s.socketDir, err = os.MkdirTemp("", "pgtest-sock"); err != nil {
+		s.err = err
+		return s
+	}
+
+	initdb := exec.Command(filepath.Join(bin, "initdb"),
+		"-D", s.dataDir,
+		"-U", superuser,
+		"-A", "trust",
+		"-E", "UTF8",
+		"--no-sync",
+	)
+	if out, err := initdb.CombinedOutput(); err != nil {
+		s.err = fmt.Errorf("initdb failed: %w\n%s", err, out)
+		return s
+	}
+
+	// durability settings are off since the data is thrown away
+	s.cmd = exec.Command(filepath.Join(bin, "postgres"),
+		"-D", s.dataDir,
+		"-k", s.socketDir,
+		"-p", fmt.Sprint(port),
+		"-c", "listen_addresses=",
+		"-c", "fsync=off",
+		"-c", "synchronous_commit=off",
+		"-c", "full_page_writes=off",
+		"-c", "log_min_messages=warning",
+	)
+	s.cmd.Stderr = &prefixWriter{prefix: "postgres: "}
+	if err = s.cmd.Start(); err != nil {
+		s.err = fmt.Errorf("failed to start postgres: %w", err)
+		return s
+	}
+	go func() {
+		s.cmd.Wait()
+		close(s.exited)
+	}()
+
+	if s.err = s.waitReady(); s.err != nil {
+		return s
+	}
+
+	s.err = s.createTemplate()
+	return s
+}
+
+func (s *Server) stop() {
+	if s.cmd != nil && s.cmd.Process != nil {
+		// SIGINT is postgres' fast shutdown
+		s.cmd.Process.Signal(os.Interrupt)
+		select {
+		case <-s.exited:
+		case <-time.After(10 * time.Second):
+			s.cmd.Process.Kill()
+		}
+	}
+
+	for _, dir := range []string{s.dataDir, s.socketDir} {
+		if dir != "" {
+			os.RemoveAll(dir)
+		}
+	}
+}
+
+func (s *Server) url(db string) string {
+	return fmt.Sprintf("postgres://%s@/%s?host=%s&port=%d&sslmode=disable", superuser, db, s.socketDir, port)
+}
+
+func (s *Server) exec(ctx context.Context, sql string) error {
+	conn, err := pgx.Connect(ctx, s.url("postgres"))
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+
+	_, err = conn.Exec(ctx, sql)
+	return err
+}
+
+func (s *Server) waitReady() error {
+	deadline := time.Now().Add(startTimeout)
+	for {
+		err := s.exec(context.Background(), "SELECT 1")
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-s.exited:
+			return errors.New("postgres exited during startup")
+		default:
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("postgres did not become ready: %w", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// createTemplate applies database/migration once, so each test only pays
+// for a CREATE DATABASE.
+func (s *Server) createTemplate() error {
+	if err := s.exec(context.Background(), "CREATE DATABASE "+templateName); err != nil {
+		return err
+	}
+
+	migration, err := migrate.New("file://"+migrationsDir(), s.url(templateName))
+	if err != nil {
+		return fmt.Errorf("unable to create new migrate instance: %w", err)
+	}
+	defer migration.Close()
+
+	if err = migration.Up(); err != nil {
+		return fmt.Errorf("failed to run migrate up: %w", err)
+	}
+
+	return nil
+}
+
+// migrationsDir is database/migration, found relative to this file so tests
+// work from any package directory.
+func migrationsDir() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "..", "database", "migration")
+}
+
+func findBinaries() (string, error) {
+	if dir := os.Getenv("PG_BIN"); dir != "" {
+		return dir, nil
+	}
+
+	if path, err := exec.LookPath("initdb"); err == nil {
+		return filepath.Dir(path), nil
+	}
+
+	// Debian and Ubuntu keep the server binaries off $PATH
+	dirs, _ := filepath.Glob("/usr/lib/postgresql/*/bin")
+	for _, dir := range dirs {
+		if _, err := os.Stat(filepath.Join(dir, "initdb")); err == nil {
+			return dir, nil
+		}
+	}
+
+	return "", errors.New("PostgreSQL binaries not found, set PG_BIN or add initdb to PATH")
+}
+
+// prefixWriter forwards postgres' log to stderr, where go test shows it for
+// failing runs.
+type prefixWriter struct {
+	prefix string
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.SplitAfter(string(p), "\n") {
+		if line != "" {
+			fmt.Fprint(os.Stderr, w.prefix+line)
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,68 @@
+// Package prune deletes rows that are no longer needed, such as expired
+// sessions, from a background worker.
+package prune
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+const DefaultInterval = time.Hour
+
+// Func deletes what expired before before and returns how much it deleted.
+type Func func(ctx context.Context, before time.Time) (int64, error)
+
+// Pruner runs a Func on an interval.
+type Pruner struct {
+	name     string
+	prune    Func
+	logger   *slog.Logger
+	interval time.Duration
+}
+
+// New returns a Pruner for prune. name says what is pruned in log lines.
+func New(name string, prune Func, logger *slog.Logger, interval time.Duration) *Pruner {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	return &Pruner{
+		name:     name,
+		prune:    prune,
+		logger:   logger,
+		interval: interval,
+	}
+}
+
+// Run prunes once at start and then on every interval until ctx is
+// cancelled. Nothing is lost by stopping, so it does not prune on the way
+// out.
+func (p *Pruner) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.run(ctx)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *Pruner) run(ctx context.Context) {
+	pruned, err := p.prune(ctx, time.Now())
+	if err != nil {
+		if ctx.Err() == nil {
+			p.logger.Error("Failed while pruning", "name", p.name, "error", err)
+		}
+		return
+	}
+
+	if pruned > 0 {
+		p.logger.Info("Pruned expired rows", "name", p.name, "count", pruned)
+	}
+}
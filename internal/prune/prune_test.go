@@ -0,0 +1,37 @@
+package prune
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPrunerRunsOnStartAndEveryInterval(t *testing.T) {
+	var calls atomic.Int32
+	prune := func(ctx context.Context, before time.Time) (int64, error) {
+		if time.Since(before) > time.Second {
+			t.Errorf("expected before to be the current time, got %v", before)
+		}
+		calls.Add(1)
+		return 1, nil
+	}
+	pruner := New("test", prune, slog.New(slog.NewTextHandler(io.Discard, nil)), 20*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		pruner.Run(ctx)
+		close(done)
+	}()
+
+	time.Sleep(70 * time.Millisecond)
+	cancel()
+	<-done
+
+	if n := calls.Load(); n < 3 {
+		t.Errorf("expected a prune at start and on every tick, got %d", n)
+	}
+}
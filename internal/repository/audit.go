@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/dosedaf/syncup-users-service/database"
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/jackc/pgx/v5"
+)
+
+type AuditRepositoryInstance interface {
+	InsertAuthEvents(ctx context.Context, events []model.AuthEvent) error
+	ListAuthEvents(ctx context.Context, filter model.AuthEventFilter) ([]model.AuthEvent, error)
+}
+
+type AuditRepository struct {
+	db     database.DBTX
+	logger *slog.Logger
+}
+
+func NewAuditRepository(db database.DBTX, logger *slog.Logger) AuditRepositoryInstance {
+	return &AuditRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (r *AuditRepository) InsertAuthEvents(ctx context.Context, events []model.AuthEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	rows := make([][]any, 0, len(events))
+	for _, e := range events {
+		rows = append(rows, []any{
+			e.Type,
+			e.Outcome,
+			e.Reason,
+			e.ActorID,
+			e.SubjectID,
+			e.SubjectEmail,
+			e.IP,
+			e.UserAgent,
+			e.CreatedAt,
+		})
+	}
+
+	_, err := r.db.CopyFrom(
+		ctx,
+		pgx.Identifier{"auth_events"},
+		[]string{"event_type", "outcome", "reason", "actor_id", "subject_id", "subject_email", "ip", "user_agent", "created_at"},
+		pgx.CopyFromRows(rows),
+	)
+	if err != nil {
+		r.logger.ErrorContext(ctx,
+			"Failed while inserting auth events",
+			"count", len(events),
+			"error", err,
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (r *AuditRepository) ListAuthEvents(ctx context.Context, filter model.AuthEventFilter) ([]model.AuthEvent, error) {
+	conditions := []string{"TRUE"}
+	args := pgx.NamedArgs{}
+
+	if filter.SubjectID != nil {
+		conditions = append(conditions, "subject_id=@subject_id")
+		args["subject_id"] = *filter.SubjectID
+	}
+	if filter.ActorID != nil {
+		conditions = append(conditions, "actor_id=@actor_id")
+		args["actor_id"] = *filter.ActorID
+	}
+	if filter.Type != "" {
+		conditions = append(conditions, "event_type=@event_type")
+		args["event_type"] = filter.Type
+	}
+	if filter.Outcome != "" {
+		conditions = append(conditions, "outcome=@outcome")
+		args["outcome"] = filter.Outcome
+	}
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, "created_at>=@since")
+		args["since"] = filter.Since
+	}
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, "created_at<@until")
+		args["until"] = filter.Until
+	}
+	if filter.BeforeID > 0 {
+		conditions = append(conditions, "id<@before_id")
+		args["before_id"] = filter.BeforeID
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = model.DefaultAuthEventLimit
+	}
+	if limit > model.MaxAuthEventLimit {
+		limit = model.MaxAuthEventLimit
+	}
+	args["limit"] = limit
+
+	query := fmt.Sprintf(`SELECT id, event_type, outcome, reason, actor_id, subject_id, subject_email, ip, user_agent, created_at
+		FROM auth_events WHERE %s ORDER BY id DESC LIMIT @limit`, strings.Join(conditions, " AND "))
+
+	rows, err := r.db.Query(ctx, query, args)
+	if err != nil {
+		r.logger.ErrorContext(ctx, "Failed while querying auth events", "error", err)
+		return nil, err
+	}
+
+	events, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.AuthEvent, error) {
+		var e model.AuthEvent
+		err := row.Scan(
+			&e.ID,
+			&e.Type,
+			&e.Outcome,
+			&e.Reason,
+			&e.ActorID,
+			&e.SubjectID,
+			&e.SubjectEmail,
+			&e.IP,
+			&e.UserAgent,
+			&e.CreatedAt,
+		)
+		return e, err
+	})
+	if err != nil {
+		r.logger.ErrorContext(ctx, "Failed while scanning auth events", "error", err)
+		return nil, err
+	}
+
+	return events, nil
+}
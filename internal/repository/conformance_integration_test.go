@@ -0,0 +1,33 @@
+//go:build integration
+
+package repository_test
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/dosedaf/syncup-users-service/internal/pgtest"
+	"github.com/dosedaf/syncup-users-service/internal/repository"
+	"github.com/dosedaf/syncup-users-service/internal/repository/repotest"
+)
+
+func TestConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repotest.Repositories {
+		pool := pgtest.NewDatabase(t)
+		logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+		return repotest.Repositories{
+			Repositories: repository.Repositories{
+				Users:    repository.NewUserRepository(pool, logger),
+				Sessions: repository.NewSessionRepository(pool, logger),
+				Audit:    repository.NewAuditRepository(pool, logger),
+				Devices:  repository.NewDeviceRepository(pool, logger),
+				Outbox:   repository.NewOutboxRepository(pool, logger),
+				Tokens:   repository.NewTokenRepository(pool, logger),
+			},
+			Tx:       repository.NewTxManager(pool, logger),
+			Webhooks: repository.NewWebhookRepository(pool, logger),
+		}
+	})
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/dosedaf/syncup-users-service/database"
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/jackc/pgx/v5"
+)
+
+type DeviceRepositoryInstance interface {
+	ListKnownDevices(ctx context.Context, userID int) ([]model.KnownDevice, error)
+	UpsertKnownDevice(ctx context.Context, device model.KnownDevice) error
+}
+
+type DeviceRepository struct {
+	db     database.DBTX
+	logger *slog.Logger
+}
+
+func NewDeviceRepository(db database.DBTX, logger *slog.Logger) DeviceRepositoryInstance {
+	return &DeviceRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (r *DeviceRepository) ListKnownDevices(ctx context.Context, userID int) ([]model.KnownDevice, error) {
+	query := `SELECT user_id, fingerprint, ua_family, ip_prefix, first_seen_at, last_seen_at
+		FROM known_devices WHERE user_id=@user_id`
+	args := pgx.NamedArgs{
+		"user_id": userID,
+	}
+
+	rows, err := r.db.Query(ctx, query, args)
+	if err != nil {
+		r.logger.ErrorContext(ctx,
+			"Failed while querying known devices",
+			"user_id", userID,
+			"error", err,
+		)
+		return nil, err
+	}
+
+	devices, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.KnownDevice, error) {
+		var d model.KnownDevice
+		err := row.Scan(&d.UserID, &d.Fingerprint, &d.UAFamily, &d.IPPrefix, &d.FirstSeenAt, &d.LastSeenAt)
+		return d, err
+	})
+	if err != nil {
+		r.logger.ErrorContext(ctx,
+			"Failed while scanning known devices",
+			"user_id", userID,
+			"error", err,
+		)
+		return nil, err
+	}
+
+	return devices, nil
+}
+
+func (r *DeviceRepository) UpsertKnownDevice(ctx context.Context, device model.KnownDevice) error {
+	query := `INSERT INTO known_devices (user_id, fingerprint, ua_family, ip_prefix)
+		VALUES (@user_id, @fingerprint, @ua_family, @ip_prefix)
+		ON CONFLICT (user_id, fingerprint) DO UPDATE SET last_seen_at=NOW()`
+	args := pgx.NamedArgs{
+		"user_id":     device.UserID,
+		"fingerprint": device.Fingerprint,
+		"ua_family":   device.UAFamily,
+		"ip_prefix":   device.IPPrefix,
+	}
+
+	if _, err := r.db.Exec(ctx, query, args); err != nil {
+		r.logger.ErrorContext(ctx,
+			"Failed while upserting known device",
+			"user_id", device.UserID,
+			"error", err,
+		)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,116 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/dosedaf/syncup-users-service/internal/repository"
+)
+
+// AuditRepository keeps events in insertion order, which is also ID order,
+// so listing walks the slice backwards.
+type AuditRepository struct {
+	mu     sync.RWMutex
+	nextID int64
+	events []model.AuthEvent
+}
+
+func NewAuditRepository() *AuditRepository {
+	return &AuditRepository{nextID: 1}
+}
+
+var _ repository.AuditRepositoryInstance = (*AuditRepository)(nil)
+
+func (r *AuditRepository) InsertAuthEvents(ctx context.Context, events []model.AuthEvent) error {
+	r.insert(events)
+
+	return nil
+}
+
+// insert stores events and returns the IDs they were given.
+func (r *AuditRepository) insert(events []model.AuthEvent) []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := make([]int64, 0, len(events))
+	for _, e := range events {
+		e.ID = r.nextID
+		r.nextID++
+		r.events = append(r.events, copyAuthEvent(e))
+		ids = append(ids, e.ID)
+	}
+
+	return ids
+}
+
+func (r *AuditRepository) ListAuthEvents(ctx context.Context, filter model.AuthEventFilter) ([]model.AuthEvent, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = model.DefaultAuthEventLimit
+	}
+	if limit > model.MaxAuthEventLimit {
+		limit = model.MaxAuthEventLimit
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	events := []model.AuthEvent{}
+	for i := len(r.events) - 1; i >= 0 && len(events) < limit; i-- {
+		if e := r.events[i]; matchesAuthEvent(e, filter) {
+			events = append(events, copyAuthEvent(e))
+		}
+	}
+
+	return events, nil
+}
+
+// matchesAuthEvent mirrors the WHERE clause the Postgres version builds.
+func matchesAuthEvent(e model.AuthEvent, filter model.AuthEventFilter) bool {
+	switch {
+	case filter.SubjectID != nil && (e.SubjectID == nil || *e.SubjectID != *filter.SubjectID):
+		return false
+	case filter.ActorID != nil && (e.ActorID == nil || *e.ActorID != *filter.ActorID):
+		return false
+	case filter.Type != "" && e.Type != filter.Type:
+		return false
+	case filter.Outcome != "" && e.Outcome != filter.Outcome:
+		return false
+	case !filter.Since.IsZero() && e.CreatedAt.Before(filter.Since):
+		return false
+	case !filter.Until.IsZero() && !e.CreatedAt.Before(filter.Until):
+		return false
+	case filter.BeforeID > 0 && e.ID >= filter.BeforeID:
+		return false
+	}
+
+	return true
+}
+
+func copyAuthEvent(e model.AuthEvent) model.AuthEvent {
+	if e.ActorID != nil {
+		actor := *e.ActorID
+		e.ActorID = &actor
+	}
+	if e.SubjectID != nil {
+		subject := *e.SubjectID
+		e.SubjectID = &subject
+	}
+
+	return e
+}
+
+// remove deletes the events with the given IDs. Later events keep their
+// IDs, leaving a gap like a rolled back Postgres insert.
+func (r *AuditRepository) remove(ids []int64) func() {
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		r.events = slices.DeleteFunc(r.events, func(e model.AuthEvent) bool {
+			return slices.Contains(ids, e.ID)
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/dosedaf/syncup-users-service/internal/repository"
+)
+
+type deviceKey struct {
+	userID      int
+	fingerprint string
+}
+
+type DeviceRepository struct {
+	mu      sync.RWMutex
+	devices map[deviceKey]model.KnownDevice
+}
+
+func NewDeviceRepository() *DeviceRepository {
+	return &DeviceRepository{
+		devices: make(map[deviceKey]model.KnownDevice),
+	}
+}
+
+var _ repository.DeviceRepositoryInstance = (*DeviceRepository)(nil)
+
+func (r *DeviceRepository) ListKnownDevices(ctx context.Context, userID int) ([]model.KnownDevice, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	devices := []model.KnownDevice{}
+	for key, device := range r.devices {
+		if key.userID == userID {
+			devices = append(devices, device)
+		}
+	}
+
+	// Postgres returns rows in no particular order; a stable one keeps
+	// callers from depending on map iteration
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].Fingerprint < devices[j].Fingerprint
+	})
+
+	return devices, nil
+}
+
+// UpsertKnownDevice only refreshes last_seen_at for a known fingerprint, like
+// the ON CONFLICT clause of the SQL version.
+func (r *DeviceRepository) UpsertKnownDevice(ctx context.Context, device model.KnownDevice) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	key := deviceKey{userID: device.UserID, fingerprint: device.Fingerprint}
+
+	if stored, ok := r.devices[key]; ok {
+		stored.LastSeenAt = now
+		r.devices[key] = stored
+		return nil
+	}
+
+	device.FirstSeenAt = now
+	device.LastSeenAt = now
+	r.devices[key] = device
+
+	return nil
+}
+
+// keep saves the device, or its absence, and returns a function that puts
+// it back.
+func (r *DeviceRepository) keep(device model.KnownDevice) func() {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	key := deviceKey{userID: device.UserID, fingerprint: device.Fingerprint}
+	saved, ok := r.devices[key]
+
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if ok {
+			r.devices[key] = saved
+		} else {
+			delete(r.devices, key)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/dosedaf/syncup-users-service/internal/repository"
+	"github.com/dosedaf/syncup-users-service/internal/repository/repotest"
+)
+
+func TestConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repotest.Repositories {
+		users, sessions, audit, devices, outbox, tokens := NewUserRepository(), NewSessionRepository(), NewAuditRepository(), NewDeviceRepository(), NewOutboxRepository(), NewTokenRepository()
+
+		return repotest.Repositories{
+			Repositories: repository.Repositories{
+				Users:    users,
+				Sessions: sessions,
+				Audit:    audit,
+				Devices:  devices,
+				Outbox:   outbox,
+				Tokens:   tokens,
+			},
+			Tx:       NewTxManager(users, sessions, audit, devices, outbox, tokens),
+			Webhooks: NewWebhookRepository(),
+		}
+	})
+}
@@ -0,0 +1,181 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/dosedaf/syncup-users-service/internal/repository"
+)
+
+// OutboxRepository keeps events in ID order, like the audit log.
+type OutboxRepository struct {
+	mu     sync.Mutex
+	nextID int64
+	events []model.OutboxEvent
+}
+
+func NewOutboxRepository() *OutboxRepository {
+	return &OutboxRepository{nextID: 1}
+}
+
+var _ repository.OutboxRepositoryInstance = (*OutboxRepository)(nil)
+
+func (r *OutboxRepository) InsertOutboxEvent(ctx context.Context, event *model.OutboxEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	event.ID = r.nextID
+	r.nextID++
+	event.CreatedAt = now
+	event.NextAttemptAt = now
+
+	stored := *event
+	stored.Payload = slices.Clone(event.Payload)
+	stored.Attempts = 0
+	stored.LastError = ""
+	stored.PublishedAt = nil
+	r.events = append(r.events, stored)
+
+	return nil
+}
+
+func (r *OutboxRepository) ClaimOutboxEvents(ctx context.Context, now time.Time, leaseUntil time.Time, limit int) ([]model.OutboxEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// walking in ID order, the first unpublished event seen for a user is
+	// that user's head; anything after it has to wait
+	seen := make(map[int]bool)
+	claimed := []model.OutboxEvent{}
+	for i := range r.events {
+		if len(claimed) >= limit {
+			break
+		}
+
+		e := &r.events[i]
+		if e.PublishedAt != nil || seen[e.UserID] {
+			continue
+		}
+		seen[e.UserID] = true
+
+		if e.NextAttemptAt.After(now) {
+			continue
+		}
+		e.NextAttemptAt = leaseUntil
+		claimed = append(claimed, copyOutboxEvent(*e))
+	}
+
+	return claimed, nil
+}
+
+func (r *OutboxRepository) MarkOutboxEventPublished(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e := r.find(id); e != nil {
+		now := time.Now()
+		e.PublishedAt = &now
+		e.LastError = ""
+	}
+
+	return nil
+}
+
+func (r *OutboxRepository) MarkOutboxEventFailed(ctx context.Context, id int64, nextAttemptAt time.Time, lastError string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e := r.find(id); e != nil {
+		e.Attempts++
+		e.NextAttemptAt = nextAttemptAt
+		e.LastError = lastError
+	}
+
+	return nil
+}
+
+// find returns the stored event with the given id, or nil. Events are kept
+// in ID order.
+func (r *OutboxRepository) find(id int64) *model.OutboxEvent {
+	i, found := slices.BinarySearchFunc(r.events, id, func(e model.OutboxEvent, id int64) int {
+		return cmp.Compare(e.ID, id)
+	})
+	if !found {
+		return nil
+	}
+
+	return &r.events[i]
+}
+
+// save copies the stored events with the given IDs, for restore.
+func (r *OutboxRepository) save(ids []int64) map[int64]model.OutboxEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	saved := make(map[int64]model.OutboxEvent, len(ids))
+	for _, id := range ids {
+		if e := r.find(id); e != nil {
+			saved[id] = copyOutboxEvent(*e)
+		}
+	}
+
+	return saved
+}
+
+// restore returns a function that puts back the events save copied.
+func (r *OutboxRepository) restore(saved map[int64]model.OutboxEvent) func() {
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		for id, e := range saved {
+			if stored := r.find(id); stored != nil {
+				*stored = e
+			}
+		}
+	}
+}
+
+// remove returns a function that deletes the event with id. Later events
+// keep their IDs, leaving a gap like a rolled back Postgres insert.
+func (r *OutboxRepository) remove(id int64) func() {
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		r.events = slices.DeleteFunc(r.events, func(e model.OutboxEvent) bool {
+			return e.ID == id
+		})
+	}
+}
+
+// unpublished returns the IDs of every event not yet published, the ones a
+// claim may change.
+func (r *OutboxRepository) unpublished() []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var ids []int64
+	for _, e := range r.events {
+		if e.PublishedAt == nil {
+			ids = append(ids, e.ID)
+		}
+	}
+
+	return ids
+}
+
+func copyOutboxEvent(e model.OutboxEvent) model.OutboxEvent {
+	e.Payload = slices.Clone(e.Payload)
+	if e.PublishedAt != nil {
+		published := *e.PublishedAt
+		e.PublishedAt = &published
+	}
+
+	return e
+}
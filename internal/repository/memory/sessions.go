@@ -0,0 +1,198 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/helper"
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/dosedaf/syncup-users-service/internal/repository"
+)
+
+type SessionRepository struct {
+	mu       sync.RWMutex
+	sessions map[string]*model.Session
+}
+
+func NewSessionRepository() *SessionRepository {
+	return &SessionRepository{
+		sessions: make(map[string]*model.Session),
+	}
+}
+
+var _ repository.SessionRepositoryInstance = (*SessionRepository)(nil)
+
+func (r *SessionRepository) InsertSession(ctx context.Context, session *model.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	session.CreatedAt = now
+	session.LastSeenAt = now
+
+	stored := *session
+	stored.RevokedAt = nil
+	r.sessions[session.ID] = &stored
+
+	return nil
+}
+
+func (r *SessionRepository) GetSession(ctx context.Context, id string) (*model.Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	session, ok := r.sessions[id]
+	if !ok {
+		return nil, helper.ErrSessionNotFound
+	}
+
+	return copySession(session), nil
+}
+
+func (r *SessionRepository) ListActiveSessions(ctx context.Context, userID int) ([]model.Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	sessions := []model.Session{}
+	for _, session := range r.sessions {
+		if session.UserID == userID && session.RevokedAt == nil && session.ExpiresAt.After(now) {
+			sessions = append(sessions, *copySession(session))
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+
+	return sessions, nil
+}
+
+func (r *SessionRepository) RevokeSession(ctx context.Context, userID int, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// revoking someone else's session looks the same as a missing one
+	session, ok := r.sessions[id]
+	if !ok || session.UserID != userID || session.RevokedAt != nil {
+		return helper.ErrSessionNotFound
+	}
+
+	now := time.Now()
+	session.RevokedAt = &now
+
+	return nil
+}
+
+func (r *SessionRepository) RevokeAllSessions(ctx context.Context, userID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for _, session := range r.sessions {
+		if session.UserID == userID && session.RevokedAt == nil {
+			session.RevokedAt = &now
+		}
+	}
+
+	return nil
+}
+
+// TouchSessions never moves last_seen_at backwards, like the SQL version.
+func (r *SessionRepository) TouchSessions(ctx context.Context, lastSeen map[string]time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, t := range lastSeen {
+		if session, ok := r.sessions[id]; ok && t.After(session.LastSeenAt) {
+			session.LastSeenAt = t
+		}
+	}
+
+	return nil
+}
+
+func (r *SessionRepository) PruneSessions(ctx context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var pruned int64
+	for id, session := range r.sessions {
+		if session.ExpiresAt.Before(before) {
+			delete(r.sessions, id)
+			pruned++
+		}
+	}
+
+	return pruned, nil
+}
+
+// expiredBefore returns the IDs of the sessions PruneSessions would delete.
+func (r *SessionRepository) expiredBefore(before time.Time) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var ids []string
+	for id, session := range r.sessions {
+		if session.ExpiresAt.Before(before) {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
+
+func copySession(session *model.Session) *model.Session {
+	copied := *session
+	if session.RevokedAt != nil {
+		revoked := *session.RevokedAt
+		copied.RevokedAt = &revoked
+	}
+
+	return &copied
+}
+
+// keep saves the sessions with the given IDs, or their absence, and
+// returns a function that puts them back.
+func (r *SessionRepository) keep(ids ...string) func() {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	saved := make(map[string]*model.Session, len(ids))
+	for _, id := range ids {
+		if session, ok := r.sessions[id]; ok {
+			saved[id] = copySession(session)
+		} else {
+			saved[id] = nil
+		}
+	}
+
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		for id, session := range saved {
+			if session != nil {
+				r.sessions[id] = session
+			} else {
+				delete(r.sessions, id)
+			}
+		}
+	}
+}
+
+// keepUser is keep for every session of the user.
+func (r *SessionRepository) keepUser(userID int) func() {
+	r.mu.RLock()
+	var ids []string
+	for id, session := range r.sessions {
+		if session.UserID == userID {
+			ids = append(ids, id)
+		}
+	}
+	r.mu.RUnlock()
+
+	return r.keep(ids...)
+}
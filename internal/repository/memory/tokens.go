@@ -0,0 +1,89 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/helper"
+	"github.com/dosedaf/syncup-users-service/internal/repository"
+)
+
+type TokenRepository struct {
+	mu   sync.Mutex
+	used map[string]time.Time
+}
+
+func NewTokenRepository() *TokenRepository {
+	return &TokenRepository{
+		used: make(map[string]time.Time),
+	}
+}
+
+var _ repository.TokenRepositoryInstance = (*TokenRepository)(nil)
+
+func (r *TokenRepository) UseToken(ctx context.Context, id string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.used[id]; ok {
+		return helper.ErrInvalidToken
+	}
+	r.used[id] = expiresAt
+
+	return nil
+}
+
+func (r *TokenRepository) PruneUsedTokens(ctx context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var pruned int64
+	for id, expiresAt := range r.used {
+		if expiresAt.Before(before) {
+			delete(r.used, id)
+			pruned++
+		}
+	}
+
+	return pruned, nil
+}
+
+// expiredBefore returns the tokens PruneUsedTokens would forget.
+func (r *TokenRepository) expiredBefore(before time.Time) map[string]time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	expired := make(map[string]time.Time)
+	for id, expiresAt := range r.used {
+		if expiresAt.Before(before) {
+			expired[id] = expiresAt
+		}
+	}
+
+	return expired
+}
+
+// restore returns a function that puts back the tokens expiredBefore
+// returned.
+func (r *TokenRepository) restore(saved map[string]time.Time) func() {
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		for id, expiresAt := range saved {
+			r.used[id] = expiresAt
+		}
+	}
+}
+
+// forget returns a function that makes the token with the given id usable
+// again.
+func (r *TokenRepository) forget(id string) func() {
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		delete(r.used, id)
+	}
+}
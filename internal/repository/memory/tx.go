@@ -0,0 +1,268 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/dosedaf/syncup-users-service/internal/repository"
+)
+
+// TxManager runs units of work one at a time. The repositories a unit of
+// work gets record how to undo each of their writes, and a failed unit of
+// work undoes exactly those, so writes made outside WithinTx in the
+// meantime survive the rollback. There is no isolation from such writes
+// while the unit of work runs, which is fine for development and tests but
+// is why production uses Postgres.
+type TxManager struct {
+	mu       sync.Mutex
+	users    *UserRepository
+	sessions *SessionRepository
+	audit    *AuditRepository
+	devices  *DeviceRepository
+	outbox   *OutboxRepository
+	tokens   *TokenRepository
+}
+
+func NewTxManager(users *UserRepository, sessions *SessionRepository, audit *AuditRepository, devices *DeviceRepository, outbox *OutboxRepository, tokens *TokenRepository) *TxManager {
+	return &TxManager{
+		users:    users,
+		sessions: sessions,
+		audit:    audit,
+		devices:  devices,
+		outbox:   outbox,
+		tokens:   tokens,
+	}
+}
+
+var _ repository.TxManagerInstance = (*TxManager)(nil)
+
+func (m *TxManager) WithinTx(ctx context.Context, fn func(ctx context.Context, repos repository.Repositories) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	undo := &undoLog{}
+
+	// deferred so that a panic in fn rolls back too
+	committed := false
+	defer func() {
+		if !committed {
+			undo.rollback()
+		}
+	}()
+
+	repos := repository.Repositories{
+		Users:    txUserRepository{m.users, undo},
+		Sessions: txSessionRepository{m.sessions, undo},
+		Audit:    txAuditRepository{m.audit, undo},
+		Devices:  txDeviceRepository{m.devices, undo},
+		Outbox:   txOutboxRepository{m.outbox, undo},
+		Tokens:   txTokenRepository{m.tokens, undo},
+	}
+	if err := fn(ctx, repos); err != nil {
+		return err
+	}
+	committed = true
+
+	return nil
+}
+
+// undoLog collects the functions that undo the writes of a unit of work.
+type undoLog struct {
+	mu   sync.Mutex
+	undo []func()
+}
+
+// record adds undo unless the write it belongs to failed, in which case
+// there is nothing to undo.
+func (l *undoLog) record(undo func(), err error) {
+	if err != nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.undo = append(l.undo, undo)
+}
+
+// rollback undoes the writes, latest first.
+func (l *undoLog) rollback() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i := len(l.undo) - 1; i >= 0; i-- {
+		l.undo[i]()
+	}
+}
+
+// The tx repositories read straight through and record an undo for every
+// write. TestTxRepositoriesWrapEveryWrite fails when a write is added to a
+// repository interface without a wrapper here.
+
+type txUserRepository struct {
+	*UserRepository
+	undo *undoLog
+}
+
+func (r txUserRepository) InsertUser(ctx context.Context, credential model.Credential, pepperVersion int) (*model.User, error) {
+	restore := r.keep(credential.Email)
+	user, err := r.UserRepository.InsertUser(ctx, credential, pepperVersion)
+	r.undo.record(restore, err)
+
+	return user, err
+}
+
+func (r txUserRepository) UpdatePasswordHash(ctx context.Context, email string, passwordHash string, pepperVersion int) error {
+	restore := r.keep(email)
+	err := r.UserRepository.UpdatePasswordHash(ctx, email, passwordHash, pepperVersion)
+	r.undo.record(restore, err)
+
+	return err
+}
+
+func (r txUserRepository) SetPasswordResetRequired(ctx context.Context, userID int, required bool) error {
+	restore := r.keep(r.emailOf(userID))
+	err := r.UserRepository.SetPasswordResetRequired(ctx, userID, required)
+	r.undo.record(restore, err)
+
+	return err
+}
+
+type txSessionRepository struct {
+	*SessionRepository
+	undo *undoLog
+}
+
+func (r txSessionRepository) InsertSession(ctx context.Context, session *model.Session) error {
+	restore := r.keep(session.ID)
+	err := r.SessionRepository.InsertSession(ctx, session)
+	r.undo.record(restore, err)
+
+	return err
+}
+
+func (r txSessionRepository) RevokeSession(ctx context.Context, userID int, id string) error {
+	restore := r.keep(id)
+	err := r.SessionRepository.RevokeSession(ctx, userID, id)
+	r.undo.record(restore, err)
+
+	return err
+}
+
+func (r txSessionRepository) RevokeAllSessions(ctx context.Context, userID int) error {
+	restore := r.keepUser(userID)
+	err := r.SessionRepository.RevokeAllSessions(ctx, userID)
+	r.undo.record(restore, err)
+
+	return err
+}
+
+func (r txSessionRepository) TouchSessions(ctx context.Context, lastSeen map[string]time.Time) error {
+	ids := make([]string, 0, len(lastSeen))
+	for id := range lastSeen {
+		ids = append(ids, id)
+	}
+
+	restore := r.keep(ids...)
+	err := r.SessionRepository.TouchSessions(ctx, lastSeen)
+	r.undo.record(restore, err)
+
+	return err
+}
+
+func (r txSessionRepository) PruneSessions(ctx context.Context, before time.Time) (int64, error) {
+	restore := r.keep(r.expiredBefore(before)...)
+	pruned, err := r.SessionRepository.PruneSessions(ctx, before)
+	r.undo.record(restore, err)
+
+	return pruned, err
+}
+
+type txAuditRepository struct {
+	*AuditRepository
+	undo *undoLog
+}
+
+func (r txAuditRepository) InsertAuthEvents(ctx context.Context, events []model.AuthEvent) error {
+	r.undo.record(r.remove(r.insert(events)), nil)
+
+	return nil
+}
+
+type txDeviceRepository struct {
+	*DeviceRepository
+	undo *undoLog
+}
+
+func (r txDeviceRepository) UpsertKnownDevice(ctx context.Context, device model.KnownDevice) error {
+	restore := r.keep(device)
+	err := r.DeviceRepository.UpsertKnownDevice(ctx, device)
+	r.undo.record(restore, err)
+
+	return err
+}
+
+type txOutboxRepository struct {
+	*OutboxRepository
+	undo *undoLog
+}
+
+func (r txOutboxRepository) InsertOutboxEvent(ctx context.Context, event *model.OutboxEvent) error {
+	err := r.OutboxRepository.InsertOutboxEvent(ctx, event)
+	r.undo.record(r.remove(event.ID), err)
+
+	return err
+}
+
+func (r txOutboxRepository) ClaimOutboxEvents(ctx context.Context, now time.Time, leaseUntil time.Time, limit int) ([]model.OutboxEvent, error) {
+	saved := r.save(r.unpublished())
+	claimed, err := r.OutboxRepository.ClaimOutboxEvents(ctx, now, leaseUntil, limit)
+
+	// only the claimed events changed; restoring the rest could undo
+	// writes made outside the unit of work
+	changed := make(map[int64]model.OutboxEvent, len(claimed))
+	for _, e := range claimed {
+		changed[e.ID] = saved[e.ID]
+	}
+	r.undo.record(r.restore(changed), err)
+
+	return claimed, err
+}
+
+func (r txOutboxRepository) MarkOutboxEventPublished(ctx context.Context, id int64) error {
+	restore := r.restore(r.save([]int64{id}))
+	err := r.OutboxRepository.MarkOutboxEventPublished(ctx, id)
+	r.undo.record(restore, err)
+
+	return err
+}
+
+func (r txOutboxRepository) MarkOutboxEventFailed(ctx context.Context, id int64, nextAttemptAt time.Time, lastError string) error {
+	restore := r.restore(r.save([]int64{id}))
+	err := r.OutboxRepository.MarkOutboxEventFailed(ctx, id, nextAttemptAt, lastError)
+	r.undo.record(restore, err)
+
+	return err
+}
+
+type txTokenRepository struct {
+	*TokenRepository
+	undo *undoLog
+}
+
+func (r txTokenRepository) UseToken(ctx context.Context, id string, expiresAt time.Time) error {
+	err := r.TokenRepository.UseToken(ctx, id, expiresAt)
+	r.undo.record(r.forget(id), err)
+
+	return err
+}
+
+func (r txTokenRepository) PruneUsedTokens(ctx context.Context, before time.Time) (int64, error) {
+	restore := r.restore(r.expiredBefore(before))
+	pruned, err := r.TokenRepository.PruneUsedTokens(ctx, before)
+	r.undo.record(restore, err)
+
+	return pruned, err
+}
@@ -0,0 +1,72 @@
+package memory
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"testing"
+
+	"github.com/dosedaf/syncup-users-service/internal/repository"
+)
+
+// The tx repositories embed the plain ones, so a write method added to a
+// repository interface would be promoted and skip the undo log. Every
+// method has to be listed here as a read or be declared on the tx type.
+func TestTxRepositoriesWrapEveryWrite(t *testing.T) {
+	tests := []struct {
+		txType string
+		iface  reflect.Type
+		reads  []string
+	}{
+		{"txUserRepository", reflect.TypeFor[repository.RepositoryInstance](), []string{"GetUserByEmail", "GetUserByID", "GetUsersByIDs", "IsEmailAvailable"}},
+		{"txSessionRepository", reflect.TypeFor[repository.SessionRepositoryInstance](), []string{"GetSession", "ListActiveSessions"}},
+		{"txAuditRepository", reflect.TypeFor[repository.AuditRepositoryInstance](), []string{"ListAuthEvents"}},
+		{"txDeviceRepository", reflect.TypeFor[repository.DeviceRepositoryInstance](), []string{"ListKnownDevices"}},
+		{"txOutboxRepository", reflect.TypeFor[repository.OutboxRepositoryInstance](), nil},
+		{"txTokenRepository", reflect.TypeFor[repository.TokenRepositoryInstance](), nil},
+	}
+
+	declared := txMethods(t)
+	for _, tt := range tests {
+		reads := make(map[string]bool)
+		for _, name := range tt.reads {
+			reads[name] = true
+		}
+
+		for i := range tt.iface.NumMethod() {
+			name := tt.iface.Method(i).Name
+			if !reads[name] && !declared[tt.txType][name] {
+				t.Errorf("%s does not record an undo for %s.%s", tt.txType, tt.iface.Name(), name)
+			}
+		}
+	}
+}
+
+// txMethods returns the methods tx.go declares, by receiver type.
+func txMethods(t *testing.T) map[string]map[string]bool {
+	t.Helper()
+
+	f, err := parser.ParseFile(token.NewFileSet(), "tx.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	methods := make(map[string]map[string]bool)
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv == nil {
+			continue
+		}
+		receiver, ok := fn.Recv.List[0].Type.(*ast.Ident)
+		if !ok {
+			continue
+		}
+		if methods[receiver.Name] == nil {
+			methods[receiver.Name] = make(map[string]bool)
+		}
+		methods[receiver.Name][fn.Name.Name] = true
+	}
+
+	return methods
+}
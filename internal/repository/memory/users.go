@@ -0,0 +1,213 @@
+// Package memory implements the repository interfaces in memory, for local
+// development without Postgres and for tests. Every implementation is safe
+// for concurrent use and returns the same sentinel errors as its Postgres
+// counterpart. Data is lost when the process exits.
+package memory
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/helper"
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/dosedaf/syncup-users-service/internal/repository"
+)
+
+// UserRepository keys users by lower-cased email, the in-memory version of
+// the unique index on lower(email).
+type UserRepository struct {
+	mu      sync.RWMutex
+	nextID  int
+	byEmail map[string]*model.User
+}
+
+func NewUserRepository() *UserRepository {
+	return &UserRepository{
+		nextID:  1,
+		byEmail: make(map[string]*model.User),
+	}
+}
+
+var _ repository.RepositoryInstance = (*UserRepository)(nil)
+
+func (r *UserRepository) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.byEmail[strings.ToLower(email)]
+	if !ok {
+		return nil, helper.ErrUserNotFound
+	}
+
+	return copyUser(user), nil
+}
+
+func (r *UserRepository) GetUserByID(ctx context.Context, id int) (*model.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.byEmail {
+		if user.ID == id {
+			return copyUser(user), nil
+		}
+	}
+
+	return nil, helper.ErrUserNotFound
+}
+
+func (r *UserRepository) GetUsersByIDs(ctx context.Context, ids []int) ([]model.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := []model.User{}
+	for _, user := range r.byEmail {
+		if slices.Contains(ids, user.ID) {
+			users = append(users, *copyUser(user))
+		}
+	}
+	slices.SortFunc(users, func(a, b model.User) int {
+		return a.ID - b.ID
+	})
+
+	return users, nil
+}
+
+func (r *UserRepository) IsEmailAvailable(ctx context.Context, email string) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, ok := r.byEmail[strings.ToLower(email)]; ok {
+		return helper.ErrEmailAlreadyExists
+	}
+
+	return nil
+}
+
+func (r *UserRepository) InsertUser(ctx context.Context, credential model.Credential, pepperVersion int) (*model.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := strings.ToLower(credential.Email)
+	if _, ok := r.byEmail[key]; ok {
+		return nil, helper.ErrEmailAlreadyExists
+	}
+
+	hash := credential.Password
+	user := &model.User{
+		ID:            r.nextID,
+		Email:         credential.Email,
+		PasswordHash:  &hash,
+		PepperVersion: pepperVersion,
+		Role:          model.RoleUser,
+		CreatedAt:     time.Now(),
+	}
+	r.byEmail[key] = user
+	r.nextID++
+
+	return copyUser(user), nil
+}
+
+func (r *UserRepository) UpdatePasswordHash(ctx context.Context, email string, passwordHash string, pepperVersion int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.byEmail[strings.ToLower(email)]
+	if !ok {
+		return helper.ErrUserNotFound
+	}
+
+	now := time.Now()
+	user.PasswordHash = &passwordHash
+	user.PepperVersion = pepperVersion
+	user.UpdatedAt = &now
+
+	return nil
+}
+
+func (r *UserRepository) SetPasswordResetRequired(ctx context.Context, userID int, required bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, user := range r.byEmail {
+		if user.ID == userID {
+			now := time.Now()
+			user.PasswordResetRequired = required
+			user.UpdatedAt = &now
+			return nil
+		}
+	}
+
+	return helper.ErrUserNotFound
+}
+
+// SetRole changes a user's role. There is no API for it; it stands in for
+// the manual UPDATE an operator runs against Postgres.
+func (r *UserRepository) SetRole(email string, role string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.byEmail[strings.ToLower(email)]
+	if !ok {
+		return helper.ErrUserNotFound
+	}
+	user.Role = role
+
+	return nil
+}
+
+// copyUser keeps callers from mutating stored users through the pointers.
+func copyUser(user *model.User) *model.User {
+	copied := *user
+	if user.PasswordHash != nil {
+		hash := *user.PasswordHash
+		copied.PasswordHash = &hash
+	}
+	if user.UpdatedAt != nil {
+		updated := *user.UpdatedAt
+		copied.UpdatedAt = &updated
+	}
+
+	return &copied
+}
+
+// keep saves the user stored under email, or its absence, and returns a
+// function that puts it back. Rolled back inserts leave a gap in the IDs,
+// like a Postgres sequence.
+func (r *UserRepository) keep(email string) func() {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	key := strings.ToLower(email)
+	saved, ok := r.byEmail[key]
+	if ok {
+		saved = copyUser(saved)
+	}
+
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if ok {
+			r.byEmail[key] = saved
+		} else {
+			delete(r.byEmail, key)
+		}
+	}
+}
+
+// emailOf returns the email of the user with id, or "" if there is none.
+func (r *UserRepository) emailOf(id int) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.byEmail {
+		if user.ID == id {
+			return user.Email
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,293 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/helper"
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/dosedaf/syncup-users-service/internal/repository"
+)
+
+// WebhookRepository keeps deliveries and attempts in ID order, like the
+// audit log. Deleted subscriptions take their deliveries with them, as the
+// foreign key cascade does in Postgres.
+type WebhookRepository struct {
+	mu            sync.Mutex
+	subscriptions map[int]*model.WebhookSubscription
+	nextID        int
+	deliveries    []*model.WebhookDelivery
+	attempts      []model.WebhookDeliveryAttempt
+}
+
+func NewWebhookRepository() *WebhookRepository {
+	return &WebhookRepository{
+		subscriptions: make(map[int]*model.WebhookSubscription),
+	}
+}
+
+var _ repository.WebhookRepositoryInstance = (*WebhookRepository)(nil)
+
+func (r *WebhookRepository) InsertWebhookSubscription(ctx context.Context, subscription *model.WebhookSubscription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	subscription.ID = r.nextID
+	subscription.CreatedAt = time.Now()
+	r.subscriptions[subscription.ID] = copyWebhookSubscription(subscription)
+
+	return nil
+}
+
+func (r *WebhookRepository) ListWebhookSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	subscriptions := make([]model.WebhookSubscription, 0, len(r.subscriptions))
+	for _, s := range r.subscriptions {
+		subscriptions = append(subscriptions, *copyWebhookSubscription(s))
+	}
+	sort.Slice(subscriptions, func(i, j int) bool {
+		return subscriptions[i].ID < subscriptions[j].ID
+	})
+
+	return subscriptions, nil
+}
+
+func (r *WebhookRepository) GetWebhookSubscription(ctx context.Context, id int) (*model.WebhookSubscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.subscriptions[id]
+	if !ok {
+		return nil, helper.ErrWebhookNotFound
+	}
+
+	return copyWebhookSubscription(s), nil
+}
+
+func (r *WebhookRepository) DeleteWebhookSubscription(ctx context.Context, id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.subscriptions[id]; !ok {
+		return helper.ErrWebhookNotFound
+	}
+	delete(r.subscriptions, id)
+
+	// deliveries keep their slots so that IDs stay positions
+	for i, d := range r.deliveries {
+		if d != nil && d.SubscriptionID == id {
+			r.deliveries[i] = nil
+		}
+	}
+
+	return nil
+}
+
+func (r *WebhookRepository) EnqueueWebhookDeliveries(ctx context.Context, event model.OutboxEvent) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := make([]int, 0, len(r.subscriptions))
+	for id, s := range r.subscriptions {
+		if s.Wants(event.Type) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+
+	now := time.Now()
+	created := 0
+	for _, id := range ids {
+		if r.enqueued(id, event.ID) {
+			continue
+		}
+
+		r.deliveries = append(r.deliveries, &model.WebhookDelivery{
+			ID:             int64(len(r.deliveries) + 1),
+			SubscriptionID: id,
+			EventID:        event.ID,
+			EventType:      event.Type,
+			Payload:        slices.Clone(event.Payload),
+			OccurredAt:     event.CreatedAt,
+			Status:         model.WebhookDeliveryPending,
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+		})
+		created++
+	}
+
+	return created, nil
+}
+
+func (r *WebhookRepository) enqueued(subscriptionID int, eventID int64) bool {
+	for _, d := range r.deliveries {
+		if d != nil && d.SubscriptionID == subscriptionID && d.EventID == eventID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *WebhookRepository) ClaimWebhookDeliveries(ctx context.Context, now time.Time, leaseUntil time.Time, limit int) ([]model.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var due []*model.WebhookDelivery
+	for _, d := range r.deliveries {
+		if d != nil && d.Status == model.WebhookDeliveryPending && !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+	// the order of the Postgres claim
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+	})
+
+	claimed := []model.WebhookDelivery{}
+	for _, d := range due {
+		if len(claimed) >= limit {
+			break
+		}
+		d.NextAttemptAt = leaseUntil
+		claimed = append(claimed, copyWebhookDelivery(d))
+	}
+	sort.Slice(claimed, func(i, j int) bool {
+		return claimed[i].ID < claimed[j].ID
+	})
+
+	return claimed, nil
+}
+
+func (r *WebhookRepository) RecordWebhookAttempt(ctx context.Context, attempt model.WebhookDeliveryAttempt, status string, nextAttemptAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d := r.find(attempt.DeliveryID)
+	if d == nil {
+		return nil
+	}
+
+	attempt.ID = int64(len(r.attempts) + 1)
+	r.attempts = append(r.attempts, attempt)
+
+	d.Status = status
+	d.Attempts++
+	d.NextAttemptAt = nextAttemptAt
+	d.LastError = attempt.Error
+	if status == model.WebhookDeliveryDelivered {
+		deliveredAt := attempt.AttemptedAt
+		d.DeliveredAt = &deliveredAt
+	}
+
+	return nil
+}
+
+func (r *WebhookRepository) ListWebhookDeliveries(ctx context.Context, filter model.WebhookDeliveryFilter) ([]model.WebhookDelivery, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = model.DefaultWebhookDeliveryLimit
+	}
+	if limit > model.MaxWebhookDeliveryLimit {
+		limit = model.MaxWebhookDeliveryLimit
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	deliveries := []model.WebhookDelivery{}
+	for i := len(r.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		d := r.deliveries[i]
+		switch {
+		case d == nil,
+			d.SubscriptionID != filter.SubscriptionID,
+			filter.Status != "" && d.Status != filter.Status,
+			filter.BeforeID > 0 && d.ID >= filter.BeforeID:
+			continue
+		}
+		deliveries = append(deliveries, copyWebhookDelivery(d))
+	}
+
+	return deliveries, nil
+}
+
+func (r *WebhookRepository) GetWebhookDelivery(ctx context.Context, id int64) (*model.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d := r.find(id)
+	if d == nil {
+		return nil, helper.ErrWebhookDeliveryNotFound
+	}
+
+	delivery := copyWebhookDelivery(d)
+	return &delivery, nil
+}
+
+func (r *WebhookRepository) ListWebhookDeliveryAttempts(ctx context.Context, deliveryID int64) ([]model.WebhookDeliveryAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attempts := []model.WebhookDeliveryAttempt{}
+	if r.find(deliveryID) == nil {
+		return attempts, nil
+	}
+	for _, a := range r.attempts {
+		if a.DeliveryID == deliveryID {
+			attempts = append(attempts, a)
+		}
+	}
+
+	return attempts, nil
+}
+
+func (r *WebhookRepository) RedeliverWebhookDelivery(ctx context.Context, id int64, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d := r.find(id)
+	if d == nil {
+		return helper.ErrWebhookDeliveryNotFound
+	}
+
+	d.Status = model.WebhookDeliveryPending
+	d.Attempts = 0
+	d.NextAttemptAt = now
+	d.DeliveredAt = nil
+
+	return nil
+}
+
+// find returns the stored delivery with the given id, or nil if it never
+// existed or its subscription was deleted.
+func (r *WebhookRepository) find(id int64) *model.WebhookDelivery {
+	if id < 1 || id > int64(len(r.deliveries)) {
+		return nil
+	}
+
+	return r.deliveries[id-1]
+}
+
+func copyWebhookSubscription(s *model.WebhookSubscription) *model.WebhookSubscription {
+	c := *s
+	c.EventTypes = slices.Clone(s.EventTypes)
+
+	return &c
+}
+
+func copyWebhookDelivery(d *model.WebhookDelivery) model.WebhookDelivery {
+	c := *d
+	c.Payload = slices.Clone(d.Payload)
+	if d.DeliveredAt != nil {
+		deliveredAt := *d.DeliveredAt
+		c.DeliveredAt = &deliveredAt
+	}
+
+	return c
+}
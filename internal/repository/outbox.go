@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/database"
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/jackc/pgx/v5"
+)
+
+// OutboxRepositoryInstance stores lifecycle events until the relay has
+// published them. Events are inserted in the same transaction as the change
+// they describe, so one is never committed without the other.
+type OutboxRepositoryInstance interface {
+	InsertOutboxEvent(ctx context.Context, event *model.OutboxEvent) error
+	// ClaimOutboxEvents returns up to limit events that are due at now, at
+	// most one per user and always that user's oldest unpublished one, and
+	// hides them from other claims until leaseUntil. A relay that dies
+	// while holding a claim delays its events by the lease, not forever.
+	ClaimOutboxEvents(ctx context.Context, now time.Time, leaseUntil time.Time, limit int) ([]model.OutboxEvent, error)
+	MarkOutboxEventPublished(ctx context.Context, id int64) error
+	MarkOutboxEventFailed(ctx context.Context, id int64, nextAttemptAt time.Time, lastError string) error
+}
+
+type OutboxRepository struct {
+	db     database.DBTX
+	logger *slog.Logger
+}
+
+func NewOutboxRepository(db database.DBTX, logger *slog.Logger) OutboxRepositoryInstance {
+	return &OutboxRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (r *OutboxRepository) InsertOutboxEvent(ctx context.Context, event *model.OutboxEvent) error {
+	query := `INSERT INTO outbox (user_id, event_type, payload)
+		VALUES (@user_id, @event_type, @payload)
+		RETURNING id, created_at, next_attempt_at`
+	args := pgx.NamedArgs{
+		"user_id":    event.UserID,
+		"event_type": event.Type,
+		"payload":    []byte(event.Payload),
+	}
+
+	err := r.db.QueryRow(ctx, query, args).Scan(&event.ID, &event.CreatedAt, &event.NextAttemptAt)
+	if err != nil {
+		r.logger.ErrorContext(ctx,
+			"Failed while inserting outbox event",
+			"user_id", event.UserID,
+			"type", event.Type,
+			"error", err,
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (r *OutboxRepository) ClaimOutboxEvents(ctx context.Context, now time.Time, leaseUntil time.Time, limit int) ([]model.OutboxEvent, error) {
+	// the innermost query picks each user's oldest unpublished event, so a
+	// later event can never overtake one that is still being retried
+	query := `UPDATE outbox SET next_attempt_at=@lease_until
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE id IN (
+				SELECT DISTINCT ON (user_id) id FROM outbox
+				WHERE published_at IS NULL
+				ORDER BY user_id, id
+			) AND next_attempt_at <= @now
+			ORDER BY id
+			LIMIT @limit
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, user_id, event_type, payload, created_at, attempts, next_attempt_at, last_error, published_at`
+	args := pgx.NamedArgs{
+		"now":         now,
+		"lease_until": leaseUntil,
+		"limit":       limit,
+	}
+
+	rows, err := r.db.Query(ctx, query, args)
+	if err != nil {
+		r.logger.ErrorContext(ctx, "Failed while claiming outbox events", "error", err)
+		return nil, err
+	}
+
+	events, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.OutboxEvent, error) {
+		var e model.OutboxEvent
+		err := row.Scan(
+			&e.ID,
+			&e.UserID,
+			&e.Type,
+			&e.Payload,
+			&e.CreatedAt,
+			&e.Attempts,
+			&e.NextAttemptAt,
+			&e.LastError,
+			&e.PublishedAt,
+		)
+		return e, err
+	})
+	if err != nil {
+		r.logger.ErrorContext(ctx, "Failed while scanning outbox events", "error", err)
+		return nil, err
+	}
+
+	// RETURNING does not keep the subquery's order
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].ID < events[j].ID
+	})
+
+	return events, nil
+}
+
+func (r *OutboxRepository) MarkOutboxEventPublished(ctx context.Context, id int64) error {
+	query := "UPDATE outbox SET published_at=NOW(), last_error='' WHERE id=@id"
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+
+	if _, err := r.db.Exec(ctx, query, args); err != nil {
+		r.logger.ErrorContext(ctx,
+			"Failed while marking outbox event published",
+			"id", id,
+			"error", err,
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (r *OutboxRepository) MarkOutboxEventFailed(ctx context.Context, id int64, nextAttemptAt time.Time, lastError string) error {
+	query := `UPDATE outbox SET attempts=attempts+1, next_attempt_at=@next_attempt_at, last_error=@last_error
+		WHERE id=@id`
+	args := pgx.NamedArgs{
+		"id":              id,
+		"next_attempt_at": nextAttemptAt,
+		"last_error":      lastError,
+	}
+
+	if _, err := r.db.Exec(ctx, query, args); err != nil {
+		r.logger.ErrorContext(ctx,
+			"Failed while recording outbox event failure",
+			"id", id,
+			"error", err,
+		)
+		return err
+	}
+
+	return nil
+}
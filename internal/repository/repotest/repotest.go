@@ -0,0 +1,1212 @@
+// Package repotest is a conformance suite for implementations of the
+// repository interfaces. Every backend runs the same tests, so callers can
+// swap one for another without noticing.
+package repotest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/helper"
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/dosedaf/syncup-users-service/internal/repository"
+)
+
+// Repositories is one backend's set of repositories, sharing a store so that
+// rows in one can reference users in another, and a transaction manager
+// over the same store.
+type Repositories struct {
+	repository.Repositories
+	Tx       repository.TxManagerInstance
+	Webhooks repository.WebhookRepositoryInstance
+}
+
+// Run runs the whole suite. open is called once per test and must return
+// repositories on an empty store.
+func Run(t *testing.T, open func(t *testing.T) Repositories) {
+	t.Run("Users", func(t *testing.T) { testUsers(t, open) })
+	t.Run("Sessions", func(t *testing.T) { testSessions(t, open) })
+	t.Run("Audit", func(t *testing.T) { testAudit(t, open) })
+	t.Run("Devices", func(t *testing.T) { testDevices(t, open) })
+	t.Run("Outbox", func(t *testing.T) { testOutbox(t, open) })
+	t.Run("Webhooks", func(t *testing.T) { testWebhooks(t, open) })
+	t.Run("Tokens", func(t *testing.T) { testTokens(t, open) })
+	t.Run("Tx", func(t *testing.T) { testTx(t, open) })
+}
+
+const existingEmail = "existing@example.com"
+
+// seedUser inserts a user and checks it reads back as InsertUser returned it.
+func seedUser(t *testing.T, users repository.RepositoryInstance, email string) *model.User {
+	t.Helper()
+
+	ctx := context.Background()
+	inserted, err := users.InsertUser(ctx, model.Credential{Email: email, Password: "hash-v1"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := users.GetUserByEmail(ctx, email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != inserted.ID || user.Email != inserted.Email || !user.CreatedAt.Equal(inserted.CreatedAt) {
+		t.Fatalf("InsertUser returned %+v, but the stored user is %+v", inserted, user)
+	}
+
+	return user
+}
+
+func testUsers(t *testing.T, open func(t *testing.T) Repositories) {
+	t.Run("GetUserByEmail", func(t *testing.T) {
+		users := open(t).Users
+		seeded := seedUser(t, users, existingEmail)
+
+		user, err := users.GetUserByEmail(context.Background(), existingEmail)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.ID != seeded.ID || user.Email != existingEmail {
+			t.Errorf("unexpected user %+v", user)
+		}
+		if user.PasswordHash == nil || *user.PasswordHash != "hash-v1" || user.PepperVersion != 1 {
+			t.Errorf("password hash and pepper version not stored: %+v", user)
+		}
+		if user.Role != model.RoleUser || user.PasswordResetRequired {
+			t.Errorf("unexpected defaults for a new user: %+v", user)
+		}
+		if user.CreatedAt.IsZero() || user.UpdatedAt != nil {
+			t.Errorf("unexpected timestamps for a new user: %+v", user)
+		}
+
+		if _, err := users.GetUserByEmail(context.Background(), "nobody@example.com"); !errors.Is(err, helper.ErrUserNotFound) {
+			t.Errorf("expected ErrUserNotFound for an unknown email, got %v", err)
+		}
+	})
+
+	t.Run("GetUserByID", func(t *testing.T) {
+		users := open(t).Users
+		seeded := seedUser(t, users, existingEmail)
+
+		user, err := users.GetUserByID(context.Background(), seeded.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.ID != seeded.ID || user.Email != existingEmail || user.Role != model.RoleUser {
+			t.Errorf("unexpected user %+v", user)
+		}
+
+		if _, err := users.GetUserByID(context.Background(), seeded.ID+1); !errors.Is(err, helper.ErrUserNotFound) {
+			t.Errorf("expected ErrUserNotFound for an unknown id, got %v", err)
+		}
+	})
+
+	t.Run("GetUsersByIDs", func(t *testing.T) {
+		users := open(t).Users
+		first := seedUser(t, users, "first@example.com")
+		second := seedUser(t, users, "second@example.com")
+		seedUser(t, users, "third@example.com")
+
+		// unknown IDs are left out and the order of ids does not matter
+		found, err := users.GetUsersByIDs(context.Background(), []int{second.ID, 9999, first.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(found) != 2 || found[0].Email != "first@example.com" || found[1].Email != "second@example.com" {
+			t.Errorf("expected the first and second users in ID order, got %+v", found)
+		}
+
+		none, err := users.GetUsersByIDs(context.Background(), []int{9999})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(none) != 0 {
+			t.Errorf("expected no users, got %+v", none)
+		}
+	})
+
+	t.Run("returned users are copies", func(t *testing.T) {
+		users := open(t).Users
+		user := seedUser(t, users, existingEmail)
+
+		*user.PasswordHash = "changed"
+		user.Role = model.RoleAdmin
+
+		stored, err := users.GetUserByEmail(context.Background(), existingEmail)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *stored.PasswordHash != "hash-v1" || stored.Role != model.RoleUser {
+			t.Errorf("mutating a returned user changed the store: %+v", stored)
+		}
+	})
+
+	t.Run("IsEmailAvailable", func(t *testing.T) {
+		users := open(t).Users
+		seedUser(t, users, existingEmail)
+
+		if err := users.IsEmailAvailable(context.Background(), "new@example.com"); err != nil {
+			t.Errorf("expected a new email to be available, got %v", err)
+		}
+		if err := users.IsEmailAvailable(context.Background(), existingEmail); !errors.Is(err, helper.ErrEmailAlreadyExists) {
+			t.Errorf("expected ErrEmailAlreadyExists, got %v", err)
+		}
+	})
+
+	t.Run("InsertUser assigns distinct IDs", func(t *testing.T) {
+		users := open(t).Users
+		first := seedUser(t, users, "first@example.com")
+		second := seedUser(t, users, "second@example.com")
+
+		if first.ID == 0 || first.ID == second.ID {
+			t.Errorf("expected distinct non-zero IDs, got %d and %d", first.ID, second.ID)
+		}
+	})
+
+	t.Run("InsertUser rejects duplicates regardless of case", func(t *testing.T) {
+		users := open(t).Users
+		seedUser(t, users, existingEmail)
+
+		for _, email := range []string{existingEmail, "Existing@Example.COM"} {
+			user, err := users.InsertUser(context.Background(), model.Credential{Email: email, Password: "hash"}, 0)
+			if !errors.Is(err, helper.ErrEmailAlreadyExists) || user != nil {
+				t.Errorf("expected ErrEmailAlreadyExists for %s, got %v, %v", email, user, err)
+			}
+		}
+	})
+
+	t.Run("emails are matched regardless of case", func(t *testing.T) {
+		users := open(t).Users
+		seeded := seedUser(t, users, "Mixed.Case@Example.com")
+
+		user, err := users.GetUserByEmail(context.Background(), "mixed.case@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.ID != seeded.ID || user.Email != "Mixed.Case@Example.com" {
+			t.Errorf("expected the email to be stored as typed, got %+v", user)
+		}
+		if err := users.IsEmailAvailable(context.Background(), "MIXED.CASE@EXAMPLE.COM"); !errors.Is(err, helper.ErrEmailAlreadyExists) {
+			t.Errorf("expected ErrEmailAlreadyExists, got %v", err)
+		}
+		if err := users.UpdatePasswordHash(context.Background(), "mixed.case@example.com", "hash-v2", 2); err != nil {
+			t.Errorf("expected the hash to be updated, got %v", err)
+		}
+	})
+
+	// registration checks availability and inserts separately, so the
+	// insert itself has to stop concurrent sign-ups with one email
+	t.Run("InsertUser has one winner under concurrency", func(t *testing.T) {
+		users := open(t).Users
+
+		const attempts = 10
+		var wg sync.WaitGroup
+		errs := make([]error, attempts)
+		start := make(chan struct{})
+
+		for i := range attempts {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				// vary the case so the race also covers case-insensitivity
+				email := "race@example.com"
+				if i%2 == 1 {
+					email = "Race@Example.com"
+				}
+				_, errs[i] = users.InsertUser(context.Background(), model.Credential{Email: email, Password: "hash"}, 0)
+			}()
+		}
+		close(start)
+		wg.Wait()
+
+		winners := 0
+		for _, err := range errs {
+			switch {
+			case err == nil:
+				winners++
+			case !errors.Is(err, helper.ErrEmailAlreadyExists):
+				t.Errorf("expected losers to get ErrEmailAlreadyExists, got %v", err)
+			}
+		}
+		if winners != 1 {
+			t.Errorf("expected exactly one insert to succeed, got %d: %v", winners, errs)
+		}
+	})
+
+	t.Run("UpdatePasswordHash", func(t *testing.T) {
+		users := open(t).Users
+		seedUser(t, users, existingEmail)
+
+		if err := users.UpdatePasswordHash(context.Background(), existingEmail, "hash-v2", 2); err != nil {
+			t.Fatal(err)
+		}
+		user, err := users.GetUserByEmail(context.Background(), existingEmail)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *user.PasswordHash != "hash-v2" || user.PepperVersion != 2 || user.UpdatedAt == nil {
+			t.Errorf("password hash not updated: %+v", user)
+		}
+
+		if err := users.UpdatePasswordHash(context.Background(), "nobody@example.com", "hash", 1); !errors.Is(err, helper.ErrUserNotFound) {
+			t.Errorf("expected ErrUserNotFound, got %v", err)
+		}
+	})
+
+	t.Run("SetPasswordResetRequired", func(t *testing.T) {
+		users := open(t).Users
+		seeded := seedUser(t, users, existingEmail)
+
+		for _, required := range []bool{true, false} {
+			if err := users.SetPasswordResetRequired(context.Background(), seeded.ID, required); err != nil {
+				t.Fatal(err)
+			}
+			user, err := users.GetUserByEmail(context.Background(), existingEmail)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.PasswordResetRequired != required {
+				t.Errorf("expected password_reset_required=%v, got %+v", required, user)
+			}
+		}
+
+		if err := users.SetPasswordResetRequired(context.Background(), seeded.ID+1000, true); !errors.Is(err, helper.ErrUserNotFound) {
+			t.Errorf("expected ErrUserNotFound, got %v", err)
+		}
+	})
+}
+
+func testSessions(t *testing.T, open func(t *testing.T) Repositories) {
+	// newSession inserts a session belonging to user.
+	newSession := func(t *testing.T, repos Repositories, user *model.User, id string) *model.Session {
+		t.Helper()
+
+		session := &model.Session{ID: id, UserID: user.ID, UserAgent: "test", IP: "192.0.2.1", ExpiresAt: time.Now().Add(time.Hour)}
+		if err := repos.Sessions.InsertSession(context.Background(), session); err != nil {
+			t.Fatal(err)
+		}
+
+		return session
+	}
+
+	t.Run("InsertSession and GetSession", func(t *testing.T) {
+		repos := open(t)
+		user := seedUser(t, repos.Users, existingEmail)
+		inserted := newSession(t, repos, user, "session-1")
+
+		if inserted.CreatedAt.IsZero() || inserted.LastSeenAt.IsZero() {
+			t.Errorf("expected timestamps to be set on insert: %+v", inserted)
+		}
+
+		session, err := repos.Sessions.GetSession(context.Background(), "session-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if session.UserID != user.ID || session.UserAgent != "test" || session.IP != "192.0.2.1" || session.RevokedAt != nil {
+			t.Errorf("unexpected session %+v", session)
+		}
+		if session.ExpiresAt.Sub(inserted.ExpiresAt).Abs() > time.Millisecond {
+			t.Errorf("expected expires_at %v, got %v", inserted.ExpiresAt, session.ExpiresAt)
+		}
+
+		if _, err := repos.Sessions.GetSession(context.Background(), "missing"); !errors.Is(err, helper.ErrSessionNotFound) {
+			t.Errorf("expected ErrSessionNotFound, got %v", err)
+		}
+	})
+
+	t.Run("ListActiveSessions orders by last seen", func(t *testing.T) {
+		repos := open(t)
+		user := seedUser(t, repos.Users, existingEmail)
+		other := seedUser(t, repos.Users, "other@example.com")
+
+		if sessions, err := repos.Sessions.ListActiveSessions(context.Background(), user.ID); err != nil || sessions == nil || len(sessions) != 0 {
+			t.Errorf("expected an empty list, got %v, %v", sessions, err)
+		}
+
+		newSession(t, repos, user, "older")
+		newSession(t, repos, user, "newer")
+		newSession(t, repos, other, "someone-elses")
+
+		now := time.Now()
+		if err := repos.Sessions.TouchSessions(context.Background(), map[string]time.Time{
+			"older": now.Add(time.Minute),
+			"newer": now.Add(2 * time.Minute),
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		sessions, err := repos.Sessions.ListActiveSessions(context.Background(), user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sessions) != 2 || sessions[0].ID != "newer" || sessions[1].ID != "older" {
+			t.Errorf("expected newer then older, got %+v", sessions)
+		}
+	})
+
+	t.Run("ListActiveSessions leaves out expired sessions", func(t *testing.T) {
+		repos := open(t)
+		user := seedUser(t, repos.Users, existingEmail)
+		newSession(t, repos, user, "current")
+		expired := &model.Session{ID: "expired", UserID: user.ID, ExpiresAt: time.Now().Add(-time.Minute)}
+		if err := repos.Sessions.InsertSession(context.Background(), expired); err != nil {
+			t.Fatal(err)
+		}
+
+		sessions, err := repos.Sessions.ListActiveSessions(context.Background(), user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sessions) != 1 || sessions[0].ID != "current" {
+			t.Errorf("expected only the current session, got %+v", sessions)
+		}
+	})
+
+	t.Run("PruneSessions", func(t *testing.T) {
+		repos := open(t)
+		user := seedUser(t, repos.Users, existingEmail)
+		newSession(t, repos, user, "current")
+		for _, id := range []string{"expired", "expired-and-revoked"} {
+			if err := repos.Sessions.InsertSession(context.Background(), &model.Session{ID: id, UserID: user.ID, ExpiresAt: time.Now().Add(-time.Minute)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := repos.Sessions.RevokeSession(context.Background(), user.ID, "expired-and-revoked"); err != nil {
+			t.Fatal(err)
+		}
+
+		pruned, err := repos.Sessions.PruneSessions(context.Background(), time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pruned != 2 {
+			t.Errorf("expected 2 sessions pruned, got %d", pruned)
+		}
+		if _, err := repos.Sessions.GetSession(context.Background(), "expired"); !errors.Is(err, helper.ErrSessionNotFound) {
+			t.Errorf("expected the expired session to be gone, got %v", err)
+		}
+		if _, err := repos.Sessions.GetSession(context.Background(), "current"); err != nil {
+			t.Errorf("expected the current session to survive, got %v", err)
+		}
+	})
+
+	t.Run("TouchSessions never moves backwards", func(t *testing.T) {
+		repos := open(t)
+		user := seedUser(t, repos.Users, existingEmail)
+		inserted := newSession(t, repos, user, "session-1")
+
+		if err := repos.Sessions.TouchSessions(context.Background(), map[string]time.Time{
+			"session-1": inserted.LastSeenAt.Add(-time.Hour),
+			"missing":   time.Now(),
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		session, err := repos.Sessions.GetSession(context.Background(), "session-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if session.LastSeenAt.Before(inserted.LastSeenAt.Add(-time.Millisecond)) {
+			t.Errorf("last seen moved backwards from %v to %v", inserted.LastSeenAt, session.LastSeenAt)
+		}
+	})
+
+	t.Run("RevokeSession", func(t *testing.T) {
+		repos := open(t)
+		user := seedUser(t, repos.Users, existingEmail)
+		other := seedUser(t, repos.Users, "other@example.com")
+		newSession(t, repos, user, "session-1")
+
+		if err := repos.Sessions.RevokeSession(context.Background(), other.ID, "session-1"); !errors.Is(err, helper.ErrSessionNotFound) {
+			t.Errorf("expected revoking another user's session to fail with ErrSessionNotFound, got %v", err)
+		}
+		if err := repos.Sessions.RevokeSession(context.Background(), user.ID, "session-1"); err != nil {
+			t.Fatal(err)
+		}
+		if err := repos.Sessions.RevokeSession(context.Background(), user.ID, "session-1"); !errors.Is(err, helper.ErrSessionNotFound) {
+			t.Errorf("expected revoking twice to fail with ErrSessionNotFound, got %v", err)
+		}
+
+		session, err := repos.Sessions.GetSession(context.Background(), "session-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if session.RevokedAt == nil {
+			t.Error("expected revoked_at to be set")
+		}
+	})
+
+	t.Run("RevokeAllSessions", func(t *testing.T) {
+		repos := open(t)
+		user := seedUser(t, repos.Users, existingEmail)
+		other := seedUser(t, repos.Users, "other@example.com")
+		newSession(t, repos, user, "mine-1")
+		newSession(t, repos, user, "mine-2")
+		newSession(t, repos, other, "theirs")
+
+		if err := repos.Sessions.RevokeAllSessions(context.Background(), user.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		if sessions, err := repos.Sessions.ListActiveSessions(context.Background(), user.ID); err != nil || len(sessions) != 0 {
+			t.Errorf("expected no active sessions, got %v, %v", sessions, err)
+		}
+		if sessions, err := repos.Sessions.ListActiveSessions(context.Background(), other.ID); err != nil || len(sessions) != 1 {
+			t.Errorf("expected other users' sessions to survive, got %v, %v", sessions, err)
+		}
+	})
+}
+
+func testAudit(t *testing.T, open func(t *testing.T) Repositories) {
+	// events are stored at whole seconds so both backends compare equal
+	base := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	subject, actor := 1, 2
+
+	seed := func(t *testing.T, audit repository.AuditRepositoryInstance) {
+		t.Helper()
+
+		events := []model.AuthEvent{
+			{Type: model.AuthEventRegister, Outcome: model.OutcomeSuccess, SubjectID: &subject, ActorID: &subject, IP: "192.0.2.1", CreatedAt: base},
+			{Type: model.AuthEventLogin, Outcome: model.OutcomeFailure, Reason: "wrong_password", SubjectID: &subject, IP: "192.0.2.1", CreatedAt: base.Add(time.Minute)},
+			{Type: model.AuthEventLogin, Outcome: model.OutcomeSuccess, SubjectID: &subject, ActorID: &subject, IP: "192.0.2.1", CreatedAt: base.Add(2 * time.Minute)},
+			{Type: model.AuthEventAdminAction, Outcome: model.OutcomeSuccess, SubjectID: &subject, ActorID: &actor, IP: "192.0.2.2", CreatedAt: base.Add(3 * time.Minute)},
+			{Type: model.AuthEventLogin, Outcome: model.OutcomeFailure, Reason: "user_not_found", SubjectEmail: "ghost@example.com", IP: "192.0.2.3", CreatedAt: base.Add(4 * time.Minute)},
+		}
+		if err := audit.InsertAuthEvents(context.Background(), events); err != nil {
+			t.Fatal(err)
+		}
+		if err := audit.InsertAuthEvents(context.Background(), nil); err != nil {
+			t.Errorf("expected inserting nothing to succeed, got %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter func(all []model.AuthEvent) model.AuthEventFilter
+		want   []int // minutes after base, newest first
+	}{
+		{"everything", func([]model.AuthEvent) model.AuthEventFilter { return model.AuthEventFilter{} }, []int{4, 3, 2, 1, 0}},
+		{"by subject", func([]model.AuthEvent) model.AuthEventFilter { return model.AuthEventFilter{SubjectID: &subject} }, []int{3, 2, 1, 0}},
+		{"by actor", func([]model.AuthEvent) model.AuthEventFilter { return model.AuthEventFilter{ActorID: &actor} }, []int{3}},
+		{"by type", func([]model.AuthEvent) model.AuthEventFilter {
+			return model.AuthEventFilter{Type: model.AuthEventLogin}
+		}, []int{4, 2, 1}},
+		{"by outcome", func([]model.AuthEvent) model.AuthEventFilter {
+			return model.AuthEventFilter{Outcome: model.OutcomeFailure}
+		}, []int{4, 1}},
+		{"since is inclusive, until exclusive", func([]model.AuthEvent) model.AuthEventFilter {
+			return model.AuthEventFilter{Since: base.Add(time.Minute), Until: base.Add(3 * time.Minute)}
+		}, []int{2, 1}},
+		{"limit", func([]model.AuthEvent) model.AuthEventFilter { return model.AuthEventFilter{Limit: 2} }, []int{4, 3}},
+		{"before id", func(all []model.AuthEvent) model.AuthEventFilter {
+			return model.AuthEventFilter{BeforeID: all[1].ID, Limit: 2}
+		}, []int{2, 1}},
+		{"no matches", func([]model.AuthEvent) model.AuthEventFilter {
+			return model.AuthEventFilter{Type: model.AuthEventNotMeReport}
+		}, []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			audit := open(t).Audit
+			seed(t, audit)
+
+			all, err := audit.ListAuthEvents(context.Background(), model.AuthEventFilter{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			events, err := audit.ListAuthEvents(context.Background(), tt.filter(all))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if events == nil {
+				t.Fatal("expected an empty list rather than nil")
+			}
+
+			got := make([]int, 0, len(events))
+			for _, e := range events {
+				got = append(got, int(e.CreatedAt.Sub(base)/time.Minute))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expected events at minutes %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("fields round trip", func(t *testing.T) {
+		audit := open(t).Audit
+		seed(t, audit)
+
+		events, err := audit.ListAuthEvents(context.Background(), model.AuthEventFilter{Outcome: model.OutcomeFailure, SubjectID: &subject})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 1 {
+			t.Fatalf("expected one event, got %+v", events)
+		}
+
+		e := events[0]
+		if e.ID == 0 || e.Type != model.AuthEventLogin || e.Reason != "wrong_password" || e.ActorID != nil || e.IP != "192.0.2.1" || !e.CreatedAt.Equal(base.Add(time.Minute)) {
+			t.Errorf("unexpected event %+v", e)
+		}
+	})
+}
+
+func testDevices(t *testing.T, open func(t *testing.T) Repositories) {
+	t.Run("UpsertKnownDevice", func(t *testing.T) {
+		repos := open(t)
+		user := seedUser(t, repos.Users, existingEmail)
+		other := seedUser(t, repos.Users, "other@example.com")
+
+		if devices, err := repos.Devices.ListKnownDevices(context.Background(), user.ID); err != nil || devices == nil || len(devices) != 0 {
+			t.Errorf("expected an empty list, got %v, %v", devices, err)
+		}
+
+		device := model.KnownDevice{UserID: user.ID, Fingerprint: "fp-1", UAFamily: "Firefox", IPPrefix: "192.0.2.0/24"}
+		if err := repos.Devices.UpsertKnownDevice(context.Background(), device); err != nil {
+			t.Fatal(err)
+		}
+		if err := repos.Devices.UpsertKnownDevice(context.Background(), model.KnownDevice{UserID: other.ID, Fingerprint: "fp-1", UAFamily: "Chrome", IPPrefix: "198.51.100.0/24"}); err != nil {
+			t.Fatal(err)
+		}
+
+		devices, err := repos.Devices.ListKnownDevices(context.Background(), user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(devices) != 1 {
+			t.Fatalf("expected one device, got %+v", devices)
+		}
+		first := devices[0]
+		if first.UserID != user.ID || first.UAFamily != "Firefox" || first.IPPrefix != "192.0.2.0/24" || first.FirstSeenAt.IsZero() {
+			t.Errorf("unexpected device %+v", first)
+		}
+
+		// a known fingerprint only refreshes last seen
+		device.UAFamily = "Changed"
+		if err := repos.Devices.UpsertKnownDevice(context.Background(), device); err != nil {
+			t.Fatal(err)
+		}
+		devices, err = repos.Devices.ListKnownDevices(context.Background(), user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(devices) != 1 || devices[0].UAFamily != "Firefox" || !devices[0].FirstSeenAt.Equal(first.FirstSeenAt) || devices[0].LastSeenAt.Before(first.LastSeenAt) {
+			t.Errorf("expected the upsert to only refresh last seen, got %+v", devices)
+		}
+	})
+}
+
+// claim claims due events at now with a one minute lease.
+func claim(t *testing.T, outbox repository.OutboxRepositoryInstance, now time.Time, limit int) []model.OutboxEvent {
+	t.Helper()
+
+	events, err := outbox.ClaimOutboxEvents(context.Background(), now, now.Add(time.Minute), limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if events == nil {
+		t.Fatal("expected an empty list rather than nil")
+	}
+
+	return events
+}
+
+func eventIDs(events []model.OutboxEvent) []int64 {
+	ids := make([]int64, 0, len(events))
+	for _, e := range events {
+		ids = append(ids, e.ID)
+	}
+
+	return ids
+}
+
+func testOutbox(t *testing.T, open func(t *testing.T) Repositories) {
+	insert := func(t *testing.T, outbox repository.OutboxRepositoryInstance, userID int, email string) *model.OutboxEvent {
+		t.Helper()
+
+		payload, err := json.Marshal(model.UserEventPayload{UserID: userID, Email: email})
+		if err != nil {
+			t.Fatal(err)
+		}
+		event := &model.OutboxEvent{UserID: userID, Type: model.UserEventRegistered, Payload: payload}
+		if err := outbox.InsertOutboxEvent(context.Background(), event); err != nil {
+			t.Fatal(err)
+		}
+		if event.ID == 0 || event.CreatedAt.IsZero() {
+			t.Fatalf("expected the ID and creation time to be set, got %+v", event)
+		}
+
+		return event
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		outbox := open(t).Outbox
+		inserted := insert(t, outbox, 1, "someone@example.com")
+
+		events := claim(t, outbox, time.Now(), 10)
+		if len(events) != 1 {
+			t.Fatalf("expected one event, got %+v", events)
+		}
+
+		e := events[0]
+		if e.ID != inserted.ID || e.UserID != 1 || e.Type != model.UserEventRegistered || e.Attempts != 0 || e.PublishedAt != nil {
+			t.Errorf("unexpected event %+v", e)
+		}
+		// JSONB normalises whitespace, so compare the decoded payload
+		var payload model.UserEventPayload
+		if err := json.Unmarshal(e.Payload, &payload); err != nil || payload.Email != "someone@example.com" {
+			t.Errorf("payload did not round trip: %s, %v", e.Payload, err)
+		}
+	})
+
+	t.Run("claims are leased", func(t *testing.T) {
+		outbox := open(t).Outbox
+		insert(t, outbox, 1, "someone@example.com")
+		now := time.Now()
+
+		if events := claim(t, outbox, now, 10); len(events) != 1 {
+			t.Fatalf("expected one event, got %+v", events)
+		}
+		if events := claim(t, outbox, now, 10); len(events) != 0 {
+			t.Errorf("expected a claimed event to be hidden until its lease ends, got %+v", events)
+		}
+		if events := claim(t, outbox, now.Add(2*time.Minute), 10); len(events) != 1 {
+			t.Errorf("expected the event again once the lease ended, got %+v", events)
+		}
+	})
+
+	t.Run("one event per user, in order", func(t *testing.T) {
+		outbox := open(t).Outbox
+		first := insert(t, outbox, 1, "first@example.com")
+		second := insert(t, outbox, 1, "first@example.com")
+		other := insert(t, outbox, 2, "other@example.com")
+		now := time.Now()
+
+		if got := eventIDs(claim(t, outbox, now, 10)); !slices.Equal(got, []int64{first.ID, other.ID}) {
+			t.Fatalf("expected each user's oldest event, got %v", got)
+		}
+
+		ctx := context.Background()
+		if err := outbox.MarkOutboxEventPublished(ctx, other.ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := outbox.MarkOutboxEventFailed(ctx, first.ID, now.Add(5*time.Minute), "receiver down"); err != nil {
+			t.Fatal(err)
+		}
+
+		// the first event is backing off, and the second must not overtake it
+		if got := eventIDs(claim(t, outbox, now.Add(2*time.Minute), 10)); len(got) != 0 {
+			t.Fatalf("expected nothing due while the first event backs off, got %v", got)
+		}
+
+		retried := claim(t, outbox, now.Add(6*time.Minute), 10)
+		if len(retried) != 1 || retried[0].ID != first.ID || retried[0].Attempts != 1 || retried[0].LastError != "receiver down" {
+			t.Fatalf("expected the first event to be retried with its failure recorded, got %+v", retried)
+		}
+
+		if err := outbox.MarkOutboxEventPublished(ctx, first.ID); err != nil {
+			t.Fatal(err)
+		}
+		if got := eventIDs(claim(t, outbox, now.Add(6*time.Minute), 10)); !slices.Equal(got, []int64{second.ID}) {
+			t.Errorf("expected the second event once the first was published, got %v", got)
+		}
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		outbox := open(t).Outbox
+		for userID := 1; userID <= 3; userID++ {
+			insert(t, outbox, userID, fmt.Sprintf("user%d@example.com", userID))
+		}
+
+		if events := claim(t, outbox, time.Now(), 2); len(events) != 2 {
+			t.Errorf("expected two events, got %+v", events)
+		}
+	})
+}
+
+func testWebhooks(t *testing.T, open func(t *testing.T) Repositories) {
+	ctx := context.Background()
+
+	subscribe := func(t *testing.T, webhooks repository.WebhookRepositoryInstance, eventTypes ...string) *model.WebhookSubscription {
+		t.Helper()
+
+		s := &model.WebhookSubscription{
+			URL:         "https://partner.example.com/hooks",
+			Secret:      "whsec_test",
+			EventTypes:  eventTypes,
+			Description: "partner",
+		}
+		if err := webhooks.InsertWebhookSubscription(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+		if s.ID == 0 || s.CreatedAt.IsZero() {
+			t.Fatalf("expected the ID and creation time to be set, got %+v", s)
+		}
+
+		return s
+	}
+
+	event := func(id int64, eventType string) model.OutboxEvent {
+		return model.OutboxEvent{
+			ID:        id,
+			UserID:    1,
+			Type:      eventType,
+			Payload:   json.RawMessage(`{"user_id": 1, "email": "someone@example.com"}`),
+			CreatedAt: time.Now().Truncate(time.Millisecond),
+		}
+	}
+
+	enqueue := func(t *testing.T, webhooks repository.WebhookRepositoryInstance, e model.OutboxEvent, want int) {
+		t.Helper()
+
+		n, err := webhooks.EnqueueWebhookDeliveries(ctx, e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != want {
+			t.Fatalf("expected %d deliveries of event %d, got %d", want, e.ID, n)
+		}
+	}
+
+	claimDeliveries := func(t *testing.T, webhooks repository.WebhookRepositoryInstance, now time.Time) []model.WebhookDelivery {
+		t.Helper()
+
+		deliveries, err := webhooks.ClaimWebhookDeliveries(ctx, now, now.Add(time.Minute), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deliveries == nil {
+			t.Fatal("expected an empty list rather than nil")
+		}
+
+		return deliveries
+	}
+
+	t.Run("subscriptions", func(t *testing.T) {
+		webhooks := open(t).Webhooks
+		first := subscribe(t, webhooks, model.UserEventRegistered)
+		second := subscribe(t, webhooks, model.UserEventRegistered, model.UserEventDeleted)
+
+		got, err := webhooks.GetWebhookSubscription(ctx, second.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.URL != second.URL || got.Secret != "whsec_test" || got.Description != "partner" ||
+			!slices.Equal(got.EventTypes, second.EventTypes) || !got.CreatedAt.Equal(second.CreatedAt) {
+			t.Errorf("subscription did not round trip: %+v", got)
+		}
+
+		list, err := webhooks.ListWebhookSubscriptions(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != 2 || list[0].ID != first.ID || list[1].ID != second.ID {
+			t.Errorf("expected both subscriptions in ID order, got %+v", list)
+		}
+
+		if err := webhooks.DeleteWebhookSubscription(ctx, first.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := webhooks.GetWebhookSubscription(ctx, first.ID); !errors.Is(err, helper.ErrWebhookNotFound) {
+			t.Errorf("expected ErrWebhookNotFound after delete, got %v", err)
+		}
+		if err := webhooks.DeleteWebhookSubscription(ctx, first.ID); !errors.Is(err, helper.ErrWebhookNotFound) {
+			t.Errorf("expected ErrWebhookNotFound deleting twice, got %v", err)
+		}
+	})
+
+	t.Run("no subscriptions", func(t *testing.T) {
+		webhooks := open(t).Webhooks
+
+		list, err := webhooks.ListWebhookSubscriptions(ctx)
+		if err != nil || list == nil || len(list) != 0 {
+			t.Errorf("expected an empty list, got %v, %v", list, err)
+		}
+		enqueue(t, webhooks, event(1, model.UserEventRegistered), 0)
+	})
+
+	t.Run("enqueue fans out once", func(t *testing.T) {
+		webhooks := open(t).Webhooks
+		registered := subscribe(t, webhooks, model.UserEventRegistered)
+		subscribe(t, webhooks, model.UserEventDeleted)
+
+		e := event(7, model.UserEventRegistered)
+		enqueue(t, webhooks, e, 1)
+		// the outbox may publish the same event again
+		enqueue(t, webhooks, e, 0)
+
+		deliveries := claimDeliveries(t, webhooks, time.Now())
+		if len(deliveries) != 1 {
+			t.Fatalf("expected one delivery, got %+v", deliveries)
+		}
+		d := deliveries[0]
+		if d.SubscriptionID != registered.ID || d.EventID != 7 || d.EventType != model.UserEventRegistered ||
+			d.Status != model.WebhookDeliveryPending || d.Attempts != 0 || !d.OccurredAt.Equal(e.CreatedAt) {
+			t.Errorf("unexpected delivery %+v", d)
+		}
+		var payload model.UserEventPayload
+		if err := json.Unmarshal(d.Payload, &payload); err != nil || payload.Email != "someone@example.com" {
+			t.Errorf("payload did not round trip: %s, %v", d.Payload, err)
+		}
+	})
+
+	t.Run("attempts, dead letters and redelivery", func(t *testing.T) {
+		webhooks := open(t).Webhooks
+		subscription := subscribe(t, webhooks, model.UserEventRegistered)
+		enqueue(t, webhooks, event(1, model.UserEventRegistered), 1)
+		now := time.Now()
+
+		d := claimDeliveries(t, webhooks, now)[0]
+		if again := claimDeliveries(t, webhooks, now); len(again) != 0 {
+			t.Fatalf("expected a claimed delivery to be hidden until its lease ends, got %+v", again)
+		}
+
+		failed := model.WebhookDeliveryAttempt{DeliveryID: d.ID, AttemptedAt: now, StatusCode: 503, Error: "unexpected status 503", DurationMS: 12}
+		if err := webhooks.RecordWebhookAttempt(ctx, failed, model.WebhookDeliveryPending, now.Add(5*time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		if due := claimDeliveries(t, webhooks, now.Add(2*time.Minute)); len(due) != 0 {
+			t.Fatalf("expected nothing due while the delivery backs off, got %+v", due)
+		}
+
+		retried := claimDeliveries(t, webhooks, now.Add(6*time.Minute))
+		if len(retried) != 1 || retried[0].Attempts != 1 || retried[0].LastError != "unexpected status 503" {
+			t.Fatalf("expected the delivery to be retried with its failure recorded, got %+v", retried)
+		}
+
+		dead := model.WebhookDeliveryAttempt{DeliveryID: d.ID, AttemptedAt: now.Add(6 * time.Minute), Error: "connection refused", DurationMS: 3}
+		if err := webhooks.RecordWebhookAttempt(ctx, dead, model.WebhookDeliveryDead, now.Add(6*time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		if due := claimDeliveries(t, webhooks, now.Add(time.Hour)); len(due) != 0 {
+			t.Fatalf("expected a dead delivery never to be claimed, got %+v", due)
+		}
+
+		attempts, err := webhooks.ListWebhookDeliveryAttempts(ctx, d.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(attempts) != 2 || attempts[0].StatusCode != 503 || attempts[1].Error != "connection refused" || attempts[1].DurationMS != 3 {
+			t.Errorf("unexpected attempt log %+v", attempts)
+		}
+
+		if err := webhooks.RedeliverWebhookDelivery(ctx, d.ID, now.Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		redelivered := claimDeliveries(t, webhooks, now.Add(time.Hour))
+		if len(redelivered) != 1 || redelivered[0].Attempts != 0 || redelivered[0].Status != model.WebhookDeliveryPending {
+			t.Fatalf("expected the delivery to be pending with fresh attempts, got %+v", redelivered)
+		}
+
+		delivered := model.WebhookDeliveryAttempt{DeliveryID: d.ID, AttemptedAt: now.Add(time.Hour), StatusCode: 204, DurationMS: 8}
+		if err := webhooks.RecordWebhookAttempt(ctx, delivered, model.WebhookDeliveryDelivered, now.Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		got, err := webhooks.GetWebhookDelivery(ctx, d.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != model.WebhookDeliveryDelivered || got.DeliveredAt == nil || got.LastError != "" || got.Attempts != 1 {
+			t.Errorf("unexpected delivered delivery %+v", got)
+		}
+
+		if err := webhooks.RedeliverWebhookDelivery(ctx, d.ID+100, now); !errors.Is(err, helper.ErrWebhookDeliveryNotFound) {
+			t.Errorf("expected ErrWebhookDeliveryNotFound, got %v", err)
+		}
+		if _, err := webhooks.GetWebhookDelivery(ctx, d.ID+100); !errors.Is(err, helper.ErrWebhookDeliveryNotFound) {
+			t.Errorf("expected ErrWebhookDeliveryNotFound, got %v", err)
+		}
+
+		// deleting the subscription takes its deliveries with it
+		if err := webhooks.DeleteWebhookSubscription(ctx, subscription.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := webhooks.GetWebhookDelivery(ctx, d.ID); !errors.Is(err, helper.ErrWebhookDeliveryNotFound) {
+			t.Errorf("expected the delivery to be deleted with its subscription, got %v", err)
+		}
+	})
+
+	t.Run("delivery log", func(t *testing.T) {
+		webhooks := open(t).Webhooks
+		subscription := subscribe(t, webhooks, model.UserEventRegistered)
+		other := subscribe(t, webhooks, model.UserEventRegistered)
+		for id := int64(1); id <= 3; id++ {
+			enqueue(t, webhooks, event(id, model.UserEventRegistered), 2)
+		}
+
+		list := func(filter model.WebhookDeliveryFilter) []int64 {
+			t.Helper()
+
+			deliveries, err := webhooks.ListWebhookDeliveries(ctx, filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			eventIDs := make([]int64, 0, len(deliveries))
+			for _, d := range deliveries {
+				if d.SubscriptionID != filter.SubscriptionID {
+					t.Fatalf("delivery %d of subscription %d listed for %d", d.ID, d.SubscriptionID, filter.SubscriptionID)
+				}
+				eventIDs = append(eventIDs, d.EventID)
+			}
+			return eventIDs
+		}
+
+		if got := list(model.WebhookDeliveryFilter{SubscriptionID: subscription.ID}); !slices.Equal(got, []int64{3, 2, 1}) {
+			t.Errorf("expected newest first, got %v", got)
+		}
+		if got := list(model.WebhookDeliveryFilter{SubscriptionID: other.ID, Limit: 2}); !slices.Equal(got, []int64{3, 2}) {
+			t.Errorf("expected the limit to apply, got %v", got)
+		}
+
+		deliveries, err := webhooks.ListWebhookDeliveries(ctx, model.WebhookDeliveryFilter{SubscriptionID: subscription.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := list(model.WebhookDeliveryFilter{SubscriptionID: subscription.ID, BeforeID: deliveries[1].ID}); !slices.Equal(got, []int64{1}) {
+			t.Errorf("expected the page before the second delivery, got %v", got)
+		}
+
+		dead := model.WebhookDeliveryAttempt{DeliveryID: deliveries[0].ID, AttemptedAt: time.Now(), Error: "gone", DurationMS: 1}
+		if err := webhooks.RecordWebhookAttempt(ctx, dead, model.WebhookDeliveryDead, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		if got := list(model.WebhookDeliveryFilter{SubscriptionID: subscription.ID, Status: model.WebhookDeliveryDead}); !slices.Equal(got, []int64{3}) {
+			t.Errorf("expected only the dead delivery, got %v", got)
+		}
+		if got := list(model.WebhookDeliveryFilter{SubscriptionID: subscription.ID + other.ID}); len(got) != 0 {
+			t.Errorf("expected no deliveries for an unknown subscription, got %v", got)
+		}
+	})
+}
+
+func testTokens(t *testing.T, open func(t *testing.T) Repositories) {
+	t.Run("UseToken", func(t *testing.T) {
+		tokens := open(t).Tokens
+		expiresAt := time.Now().Add(time.Hour)
+
+		if err := tokens.UseToken(context.Background(), "token-1", expiresAt); err != nil {
+			t.Fatal(err)
+		}
+		if err := tokens.UseToken(context.Background(), "token-1", expiresAt); !errors.Is(err, helper.ErrInvalidToken) {
+			t.Errorf("expected ErrInvalidToken for a used token, got %v", err)
+		}
+		if err := tokens.UseToken(context.Background(), "token-2", expiresAt); err != nil {
+			t.Errorf("expected another token to be usable, got %v", err)
+		}
+	})
+
+	t.Run("rolled back use", func(t *testing.T) {
+		repos := open(t)
+		expiresAt := time.Now().Add(time.Hour)
+
+		err := repos.Tx.WithinTx(context.Background(), func(ctx context.Context, tx repository.Repositories) error {
+			if err := tx.Tokens.UseToken(ctx, "token-1", expiresAt); err != nil {
+				return err
+			}
+			return errors.New("roll back")
+		})
+		if err == nil {
+			t.Fatal("expected fn's error to be returned")
+		}
+
+		if err := repos.Tokens.UseToken(context.Background(), "token-1", expiresAt); err != nil {
+			t.Errorf("expected a token whose use was rolled back to be usable, got %v", err)
+		}
+	})
+
+	t.Run("PruneUsedTokens", func(t *testing.T) {
+		tokens := open(t).Tokens
+		if err := tokens.UseToken(context.Background(), "expired", time.Now().Add(-time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		if err := tokens.UseToken(context.Background(), "current", time.Now().Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+
+		pruned, err := tokens.PruneUsedTokens(context.Background(), time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pruned != 1 {
+			t.Errorf("expected 1 token pruned, got %d", pruned)
+		}
+		if err := tokens.UseToken(context.Background(), "current", time.Now().Add(time.Hour)); !errors.Is(err, helper.ErrInvalidToken) {
+			t.Errorf("expected the current token to stay used, got %v", err)
+		}
+	})
+}
+
+func testTx(t *testing.T, open func(t *testing.T) Repositories) {
+	errRollback := errors.New("roll back")
+
+	// writeAll touches every repository, so a rollback has something to undo
+	// in each of them.
+	writeAll := func(ctx context.Context, repos repository.Repositories) error {
+		user, err := repos.Users.InsertUser(ctx, model.Credential{Email: "tx@example.com", Password: "hash"}, 1)
+		if err != nil {
+			return err
+		}
+		if err := repos.Sessions.InsertSession(ctx, &model.Session{ID: "tx-session", UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+			return err
+		}
+		if err := repos.Audit.InsertAuthEvents(ctx, []model.AuthEvent{{Type: model.AuthEventRegister, Outcome: model.OutcomeSuccess, SubjectID: &user.ID, CreatedAt: time.Now()}}); err != nil {
+			return err
+		}
+		if err := repos.Devices.UpsertKnownDevice(ctx, model.KnownDevice{UserID: user.ID, Fingerprint: "fp", UAFamily: "Firefox", IPPrefix: "192.0.2.0/24"}); err != nil {
+			return err
+		}
+		if err := repos.Outbox.InsertOutboxEvent(ctx, &model.OutboxEvent{UserID: user.ID, Type: model.UserEventRegistered, Payload: json.RawMessage(`{}`)}); err != nil {
+			return err
+		}
+
+		// reads inside the unit of work see its own writes
+		if _, err := repos.Users.GetUserByEmail(ctx, "tx@example.com"); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	// assertWritten checks whether writeAll's changes are visible outside
+	// the unit of work.
+	assertWritten := func(t *testing.T, repos Repositories, want bool) {
+		t.Helper()
+		ctx := context.Background()
+
+		user, err := repos.Users.GetUserByEmail(ctx, "tx@example.com")
+		if !want {
+			if !errors.Is(err, helper.ErrUserNotFound) {
+				t.Errorf("expected the user to be rolled back, got %+v, %v", user, err)
+			}
+			if _, err := repos.Sessions.GetSession(ctx, "tx-session"); !errors.Is(err, helper.ErrSessionNotFound) {
+				t.Errorf("expected the session to be rolled back, got %v", err)
+			}
+			if events, err := repos.Audit.ListAuthEvents(ctx, model.AuthEventFilter{}); err != nil || len(events) != 0 {
+				t.Errorf("expected the audit event to be rolled back, got %v, %v", events, err)
+			}
+			if events := claim(t, repos.Outbox, time.Now().Add(time.Minute), 10); len(events) != 0 {
+				t.Errorf("expected the outbox event to be rolled back, got %+v", events)
+			}
+			return
+		}
+
+		if err != nil {
+			t.Fatalf("expected the user to be committed, got %v", err)
+		}
+		if _, err := repos.Sessions.GetSession(ctx, "tx-session"); err != nil {
+			t.Errorf("expected the session to be committed, got %v", err)
+		}
+		if events, err := repos.Audit.ListAuthEvents(ctx, model.AuthEventFilter{}); err != nil || len(events) != 1 {
+			t.Errorf("expected the audit event to be committed, got %v, %v", events, err)
+		}
+		if devices, err := repos.Devices.ListKnownDevices(ctx, user.ID); err != nil || len(devices) != 1 {
+			t.Errorf("expected the device to be committed, got %v, %v", devices, err)
+		}
+		if events := claim(t, repos.Outbox, time.Now().Add(time.Minute), 10); len(events) != 1 {
+			t.Errorf("expected the outbox event to be committed, got %+v", events)
+		}
+	}
+
+	t.Run("commits when fn succeeds", func(t *testing.T) {
+		repos := open(t)
+
+		if err := repos.Tx.WithinTx(context.Background(), writeAll); err != nil {
+			t.Fatal(err)
+		}
+		assertWritten(t, repos, true)
+	})
+
+	t.Run("rolls back when fn fails", func(t *testing.T) {
+		repos := open(t)
+
+		err := repos.Tx.WithinTx(context.Background(), func(ctx context.Context, tx repository.Repositories) error {
+			if err := writeAll(ctx, tx); err != nil {
+				return err
+			}
+			return errRollback
+		})
+		if !errors.Is(err, errRollback) {
+			t.Fatalf("expected fn's error to be returned, got %v", err)
+		}
+		assertWritten(t, repos, false)
+	})
+
+	t.Run("rolls back when fn panics", func(t *testing.T) {
+		repos := open(t)
+
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected the panic to propagate")
+				}
+			}()
+			_ = repos.Tx.WithinTx(context.Background(), func(ctx context.Context, tx repository.Repositories) error {
+				if err := writeAll(ctx, tx); err != nil {
+					return err
+				}
+				panic("boom")
+			})
+		}()
+		assertWritten(t, repos, false)
+	})
+
+	t.Run("keeps writes made outside on rollback", func(t *testing.T) {
+		repos := open(t)
+
+		err := repos.Tx.WithinTx(context.Background(), func(ctx context.Context, tx repository.Repositories) error {
+			if err := writeAll(ctx, tx); err != nil {
+				return err
+			}
+			// written while the unit of work is running, but not by it
+			seedUser(t, repos.Users, existingEmail)
+			if err := repos.Audit.InsertAuthEvents(ctx, []model.AuthEvent{{Type: model.AuthEventLogin, Outcome: model.OutcomeSuccess, CreatedAt: time.Now()}}); err != nil {
+				t.Fatal(err)
+			}
+			return errRollback
+		})
+		if !errors.Is(err, errRollback) {
+			t.Fatalf("expected fn's error to be returned, got %v", err)
+		}
+
+		if _, err := repos.Users.GetUserByEmail(context.Background(), "tx@example.com"); !errors.Is(err, helper.ErrUserNotFound) {
+			t.Errorf("expected the unit of work's user to be rolled back, got %v", err)
+		}
+		if _, err := repos.Users.GetUserByEmail(context.Background(), existingEmail); err != nil {
+			t.Errorf("expected the user written outside to survive the rollback, got %v", err)
+		}
+		events, err := repos.Audit.ListAuthEvents(context.Background(), model.AuthEventFilter{})
+		if err != nil || len(events) != 1 || events[0].Type != model.AuthEventLogin {
+			t.Errorf("expected only the audit event written outside to survive the rollback, got %v, %v", events, err)
+		}
+	})
+
+	t.Run("keeps earlier writes on rollback", func(t *testing.T) {
+		repos := open(t)
+		seeded := seedUser(t, repos.Users, existingEmail)
+
+		err := repos.Tx.WithinTx(context.Background(), func(ctx context.Context, tx repository.Repositories) error {
+			if err := tx.Users.SetPasswordResetRequired(ctx, seeded.ID, true); err != nil {
+				return err
+			}
+			return errRollback
+		})
+		if !errors.Is(err, errRollback) {
+			t.Fatalf("expected fn's error to be returned, got %v", err)
+		}
+
+		user, err := repos.Users.GetUserByEmail(context.Background(), existingEmail)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.PasswordResetRequired {
+			t.Error("expected the update to be rolled back")
+		}
+	})
+}
@@ -0,0 +1,237 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/database"
+	"github.com/dosedaf/syncup-users-service/helper"
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/jackc/pgx/v5"
+)
+
+type SessionRepositoryInstance interface {
+	InsertSession(ctx context.Context, session *model.Session) error
+	GetSession(ctx context.Context, id string) (*model.Session, error)
+	ListActiveSessions(ctx context.Context, userID int) ([]model.Session, error)
+	RevokeSession(ctx context.Context, userID int, id string) error
+	RevokeAllSessions(ctx context.Context, userID int) error
+	TouchSessions(ctx context.Context, lastSeen map[string]time.Time) error
+	PruneSessions(ctx context.Context, before time.Time) (int64, error)
+}
+
+type SessionRepository struct {
+	db     database.DBTX
+	logger *slog.Logger
+}
+
+func NewSessionRepository(db database.DBTX, logger *slog.Logger) SessionRepositoryInstance {
+	return &SessionRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (r *SessionRepository) InsertSession(ctx context.Context, session *model.Session) error {
+	query := `INSERT INTO sessions (id, user_id, user_agent, ip, expires_at)
+		VALUES (@id, @user_id, @user_agent, @ip, @expires_at)
+		RETURNING created_at, last_seen_at`
+	args := pgx.NamedArgs{
+		"id":         session.ID,
+		"user_id":    session.UserID,
+		"user_agent": session.UserAgent,
+		"ip":         session.IP,
+		"expires_at": session.ExpiresAt,
+	}
+
+	err := r.db.QueryRow(ctx, query, args).Scan(&session.CreatedAt, &session.LastSeenAt)
+	if err != nil {
+		r.logger.ErrorContext(ctx,
+			"Failed while inserting session",
+			"user_id", session.UserID,
+			"error", err,
+		)
+
+		return err
+	}
+
+	return nil
+}
+
+func (r *SessionRepository) GetSession(ctx context.Context, id string) (*model.Session, error) {
+	query := `SELECT id, user_id, user_agent, ip, created_at, last_seen_at, expires_at, revoked_at
+		FROM sessions WHERE id=@id`
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+
+	session := &model.Session{}
+	err := r.db.QueryRow(ctx, query, args).Scan(
+		&session.ID,
+		&session.UserID,
+		&session.UserAgent,
+		&session.IP,
+		&session.CreatedAt,
+		&session.LastSeenAt,
+		&session.ExpiresAt,
+		&session.RevokedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, helper.ErrSessionNotFound
+		}
+
+		r.logger.ErrorContext(ctx,
+			"Failed while scanning for session by id",
+			"error", err,
+		)
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func (r *SessionRepository) ListActiveSessions(ctx context.Context, userID int) ([]model.Session, error) {
+	query := `SELECT id, user_id, user_agent, ip, created_at, last_seen_at, expires_at, revoked_at
+		FROM sessions WHERE user_id=@user_id AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_seen_at DESC`
+	args := pgx.NamedArgs{
+		"user_id": userID,
+	}
+
+	rows, err := r.db.Query(ctx, query, args)
+	if err != nil {
+		r.logger.ErrorContext(ctx,
+			"Failed while querying sessions",
+			"user_id", userID,
+			"error", err,
+		)
+		return nil, err
+	}
+
+	sessions, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.Session, error) {
+		var session model.Session
+		err := row.Scan(
+			&session.ID,
+			&session.UserID,
+			&session.UserAgent,
+			&session.IP,
+			&session.CreatedAt,
+			&session.LastSeenAt,
+			&session.ExpiresAt,
+			&session.RevokedAt,
+		)
+		return session, err
+	})
+	if err != nil {
+		r.logger.ErrorContext(ctx,
+			"Failed while scanning sessions",
+			"user_id", userID,
+			"error", err,
+		)
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func (r *SessionRepository) RevokeSession(ctx context.Context, userID int, id string) error {
+	query := `UPDATE sessions SET revoked_at=NOW()
+		WHERE id=@id AND user_id=@user_id AND revoked_at IS NULL`
+	args := pgx.NamedArgs{
+		"id":      id,
+		"user_id": userID,
+	}
+
+	tag, err := r.db.Exec(ctx, query, args)
+	if err != nil {
+		r.logger.ErrorContext(ctx,
+			"Failed while revoking session",
+			"user_id", userID,
+			"error", err,
+		)
+		return err
+	}
+
+	// revoking someone else's session looks the same as a missing one
+	if tag.RowsAffected() == 0 {
+		return helper.ErrSessionNotFound
+	}
+
+	return nil
+}
+
+func (r *SessionRepository) RevokeAllSessions(ctx context.Context, userID int) error {
+	query := "UPDATE sessions SET revoked_at=NOW() WHERE user_id=@user_id AND revoked_at IS NULL"
+	args := pgx.NamedArgs{
+		"user_id": userID,
+	}
+
+	if _, err := r.db.Exec(ctx, query, args); err != nil {
+		r.logger.ErrorContext(ctx,
+			"Failed while revoking all sessions",
+			"user_id", userID,
+			"error", err,
+		)
+		return err
+	}
+
+	return nil
+}
+
+// TouchSessions writes a batch of last-seen timestamps in one statement. A
+// timestamp never moves last_seen_at backwards.
+func (r *SessionRepository) TouchSessions(ctx context.Context, lastSeen map[string]time.Time) error {
+	if len(lastSeen) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(lastSeen))
+	times := make([]time.Time, 0, len(lastSeen))
+	for id, t := range lastSeen {
+		ids = append(ids, id)
+		times = append(times, t)
+	}
+
+	query := `UPDATE sessions SET last_seen_at = GREATEST(sessions.last_seen_at, v.last_seen)
+		FROM (SELECT unnest(@ids::text[]) AS id, unnest(@times::timestamptz[]) AS last_seen) v
+		WHERE sessions.id = v.id`
+	args := pgx.NamedArgs{
+		"ids":   ids,
+		"times": times,
+	}
+
+	if _, err := r.db.Exec(ctx, query, args); err != nil {
+		r.logger.ErrorContext(ctx,
+			"Failed while touching sessions",
+			"count", len(lastSeen),
+			"error", err,
+		)
+		return err
+	}
+
+	return nil
+}
+
+// PruneSessions deletes the sessions that expired before before, revoked or
+// not; their tokens can no longer be used either way.
+func (r *SessionRepository) PruneSessions(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM sessions WHERE expires_at < @before`
+	args := pgx.NamedArgs{
+		"before": before,
+	}
+
+	tag, err := r.db.Exec(ctx, query, args)
+	if err != nil {
+		r.logger.ErrorContext(ctx,
+			"Failed while pruning sessions",
+			"error", err,
+		)
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
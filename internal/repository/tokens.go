@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/database"
+	"github.com/dosedaf/syncup-users-service/helper"
+	"github.com/jackc/pgx/v5"
+)
+
+// TokenRepositoryInstance remembers which single-use tokens were redeemed.
+type TokenRepositoryInstance interface {
+	// UseToken records that the token with the given id was redeemed. It
+	// returns helper.ErrInvalidToken when the token was redeemed before.
+	// expiresAt is when the token stops being valid on its own; the record
+	// is not needed after that.
+	UseToken(ctx context.Context, id string, expiresAt time.Time) error
+	// PruneUsedTokens forgets the tokens that expired before before and
+	// returns how many it forgot.
+	PruneUsedTokens(ctx context.Context, before time.Time) (int64, error)
+}
+
+type TokenRepository struct {
+	db     database.DBTX
+	logger *slog.Logger
+}
+
+func NewTokenRepository(db database.DBTX, logger *slog.Logger) TokenRepositoryInstance {
+	return &TokenRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (r *TokenRepository) UseToken(ctx context.Context, id string, expiresAt time.Time) error {
+	query := `INSERT INTO used_tokens (id, expires_at) VALUES (@id, @expires_at)
+		ON CONFLICT (id) DO NOTHING`
+	args := pgx.NamedArgs{
+		"id":         id,
+		"expires_at": expiresAt,
+	}
+
+	tag, err := r.db.Exec(ctx, query, args)
+	if err != nil {
+		r.logger.ErrorContext(ctx,
+			"Failed while recording used token",
+			"error", err,
+		)
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return helper.ErrInvalidToken
+	}
+
+	return nil
+}
+
+// PruneUsedTokens deletes the records of expired tokens. Expired tokens are
+// rejected before they are looked up, so the records are not needed.
+func (r *TokenRepository) PruneUsedTokens(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM used_tokens WHERE expires_at < @before`
+	args := pgx.NamedArgs{
+		"before": before,
+	}
+
+	tag, err := r.db.Exec(ctx, query, args)
+	if err != nil {
+		r.logger.ErrorContext(ctx,
+			"Failed while pruning used tokens",
+			"error", err,
+		)
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
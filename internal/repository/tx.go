@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Repositories is the set of repositories a unit of work can use. Inside a
+// transaction every one of them runs on the same connection.
+type Repositories struct {
+	Users    RepositoryInstance
+	Sessions SessionRepositoryInstance
+	Audit    AuditRepositoryInstance
+	Devices  DeviceRepositoryInstance
+	Outbox   OutboxRepositoryInstance
+	Tokens   TokenRepositoryInstance
+}
+
+// TxManagerInstance runs several repository calls as one unit of work.
+// WithinTx commits when fn returns nil and rolls back otherwise. fn may be
+// run more than once when the transaction is retried, so it must not have
+// side effects outside the repositories it is given.
+type TxManagerInstance interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context, repos Repositories) error) error
+}
+
+// WrapTx returns a TxManagerInstance that passes the repositories of every
+// unit of work of next through wrap, so the decorators applied to the
+// standalone repositories, such as metrics and tracing, see the calls made
+// inside transactions too.
+func WrapTx(next TxManagerInstance, wrap func(Repositories) Repositories) TxManagerInstance {
+	return &wrappedTxManager{next: next, wrap: wrap}
+}
+
+type wrappedTxManager struct {
+	next TxManagerInstance
+	wrap func(Repositories) Repositories
+}
+
+func (m *wrappedTxManager) WithinTx(ctx context.Context, fn func(ctx context.Context, repos Repositories) error) error {
+	return m.next.WithinTx(ctx, func(ctx context.Context, repos Repositories) error {
+		return fn(ctx, m.wrap(repos))
+	})
+}
+
+// TxBeginner is satisfied by *pgxpool.Pool.
+type TxBeginner interface {
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+}
+
+const (
+	// SQLSTATEs for conflicts that succeed when the transaction is rerun
+	serializationFailure = "40001"
+	deadlockDetected     = "40P01"
+
+	DefaultTxMaxAttempts = 3
+	txRetryBackoff       = 10 * time.Millisecond
+)
+
+// TxManager runs units of work in Postgres transactions. A unit of work
+// that fails with a serialization failure or a deadlock is run again, up to
+// maxAttempts times, since it would succeed once the conflict is gone. Any
+// other error, or a panic, rolls the transaction back.
+type TxManager struct {
+	db          TxBeginner
+	logger      *slog.Logger
+	options     pgx.TxOptions
+	maxAttempts int
+}
+
+// TxOption configures a TxManager.
+type TxOption func(*TxManager)
+
+// WithIsolationLevel sets the isolation level of every transaction. The
+// default is serializable, so that composed operations behave as if they ran
+// one at a time and conflicts surface as retryable serialization failures.
+func WithIsolationLevel(level pgx.TxIsoLevel) TxOption {
+	return func(m *TxManager) {
+		m.options.IsoLevel = level
+	}
+}
+
+// WithMaxAttempts caps how often a transaction is run before its last
+// serialization failure is returned.
+func WithMaxAttempts(n int) TxOption {
+	return func(m *TxManager) {
+		m.maxAttempts = n
+	}
+}
+
+func NewTxManager(db TxBeginner, logger *slog.Logger, opts ...TxOption) TxManagerInstance {
+	m := &TxManager{
+		db:          db,
+		logger:      logger,
+		options:     pgx.TxOptions{IsoLevel: pgx.Serializable},
+		maxAttempts: DefaultTxMaxAttempts,
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+func (m *TxManager) WithinTx(ctx context.Context, fn func(ctx context.Context, repos Repositories) error) error {
+	for attempt := 1; ; attempt++ {
+		err := m.run(ctx, fn)
+		if err == nil || !isRetryable(err) || attempt >= m.maxAttempts {
+			return err
+		}
+
+		m.logger.WarnContext(ctx,
+			"Retrying transaction after a conflict",
+			"attempt", attempt,
+			"error", err,
+		)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(txRetryBackoff << (attempt - 1)):
+		}
+	}
+}
+
+func (m *TxManager) run(ctx context.Context, fn func(ctx context.Context, repos Repositories) error) error {
+	tx, err := m.db.BeginTx(ctx, m.options)
+	if err != nil {
+		m.logger.ErrorContext(ctx, "Failed while beginning transaction", "error", err)
+		return fmt.Errorf("failed while beginning transaction: %w", err)
+	}
+
+	// a panicking fn must not leave the connection inside a transaction
+	defer func() {
+		if p := recover(); p != nil {
+			m.rollback(ctx, tx)
+			panic(p)
+		}
+	}()
+
+	repos := Repositories{
+		Users:    NewUserRepository(tx, m.logger),
+		Sessions: NewSessionRepository(tx, m.logger),
+		Audit:    NewAuditRepository(tx, m.logger),
+		Devices:  NewDeviceRepository(tx, m.logger),
+		Outbox:   NewOutboxRepository(tx, m.logger),
+		Tokens:   NewTokenRepository(tx, m.logger),
+	}
+
+	if err = fn(ctx, repos); err != nil {
+		m.rollback(ctx, tx)
+		return err
+	}
+
+	// serialization failures are often only detected on commit
+	if err = tx.Commit(ctx); err != nil {
+		if !isRetryable(err) {
+			m.logger.ErrorContext(ctx, "Failed while committing transaction", "error", err)
+		}
+		return fmt.Errorf("failed while committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (m *TxManager) rollback(ctx context.Context, tx pgx.Tx) {
+	// the rollback must happen even if ctx was what made fn fail
+	ctx = context.WithoutCancel(ctx)
+	if err := tx.Rollback(ctx); err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+		m.logger.ErrorContext(ctx, "Failed while rolling back transaction", "error", err)
+	}
+}
+
+func isRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+
+	return pgErr.Code == serializationFailure || pgErr.Code == deadlockDetected
+}
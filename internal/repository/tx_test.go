@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// fakeTx only implements what TxManager calls itself; fn in these tests
+// never touches the repositories.
+type fakeTx struct {
+	pgx.Tx
+	db *fakeBeginner
+}
+
+func (tx *fakeTx) Commit(ctx context.Context) error {
+	tx.db.commits++
+	if len(tx.db.commitErrs) > 0 {
+		err := tx.db.commitErrs[0]
+		tx.db.commitErrs = tx.db.commitErrs[1:]
+		return err
+	}
+	return nil
+}
+
+func (tx *fakeTx) Rollback(ctx context.Context) error {
+	tx.db.rollbacks++
+	return nil
+}
+
+type fakeBeginner struct {
+	options    pgx.TxOptions
+	commitErrs []error
+	commits    int
+	rollbacks  int
+}
+
+func (db *fakeBeginner) BeginTx(ctx context.Context, options pgx.TxOptions) (pgx.Tx, error) {
+	db.options = options
+	return &fakeTx{db: db}, nil
+}
+
+func TestWithinTxRetries(t *testing.T) {
+	serialization := &pgconn.PgError{Code: serializationFailure}
+	deadlock := &pgconn.PgError{Code: deadlockDetected}
+	errOther := errors.New("not a conflict")
+
+	tests := []struct {
+		name          string
+		commitErrs    []error
+		fnErrs        []error
+		wantErr       error
+		wantRuns      int
+		wantRollbacks int
+	}{
+		{"commits first time", nil, nil, nil, 1, 0},
+		{"retries serialization failures on commit", []error{serialization, serialization}, nil, nil, 3, 0},
+		{"retries deadlocks from fn", nil, []error{fmt.Errorf("wrapped: %w", deadlock)}, nil, 2, 1},
+		{"gives up after max attempts", []error{serialization, serialization, serialization}, nil, serialization, 3, 0},
+		{"does not retry other errors", nil, []error{errOther}, errOther, 1, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &fakeBeginner{commitErrs: tt.commitErrs}
+			m := NewTxManager(db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+			runs := 0
+			fnErrs := tt.fnErrs
+			err := m.WithinTx(context.Background(), func(ctx context.Context, repos Repositories) error {
+				runs++
+				if repos.Users == nil || repos.Sessions == nil || repos.Audit == nil || repos.Devices == nil || repos.Outbox == nil {
+					t.Error("expected every repository to be bound to the transaction")
+				}
+				if len(fnErrs) > 0 {
+					err := fnErrs[0]
+					fnErrs = fnErrs[1:]
+					return err
+				}
+				return nil
+			})
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if runs != tt.wantRuns || db.rollbacks != tt.wantRollbacks {
+				t.Errorf("expected %d runs and %d rollbacks, got %d and %d", tt.wantRuns, tt.wantRollbacks, runs, db.rollbacks)
+			}
+			if db.options.IsoLevel != pgx.Serializable {
+				t.Errorf("expected serializable transactions, got %q", db.options.IsoLevel)
+			}
+		})
+	}
+}
+
+func TestWithinTxRollsBackOnPanic(t *testing.T) {
+	db := &fakeBeginner{}
+	m := NewTxManager(db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected the panic to propagate")
+		}
+		if db.rollbacks != 1 || db.commits != 0 {
+			t.Errorf("expected one rollback and no commit, got %d and %d", db.rollbacks, db.commits)
+		}
+	}()
+
+	_ = m.WithinTx(context.Background(), func(ctx context.Context, repos Repositories) error {
+		panic("boom")
+	})
+}
+
+// wrappedUsers marks the user repository WrapTx handed to fn.
+type wrappedUsers struct {
+	RepositoryInstance
+}
+
+func TestWrapTx(t *testing.T) {
+	db := &fakeBeginner{}
+	m := WrapTx(NewTxManager(db, slog.New(slog.NewTextHandler(io.Discard, nil))), func(repos Repositories) Repositories {
+		repos.Users = wrappedUsers{repos.Users}
+		return repos
+	})
+
+	err := m.WithinTx(context.Background(), func(ctx context.Context, repos Repositories) error {
+		users, ok := repos.Users.(wrappedUsers)
+		if !ok {
+			t.Fatalf("expected the wrapped user repository, got %T", repos.Users)
+		}
+		if _, ok := users.RepositoryInstance.(*Repository); !ok {
+			t.Errorf("expected the wrapper to get the transaction's repository, got %T", users.RepositoryInstance)
+		}
+		if repos.Sessions == nil {
+			t.Error("expected the other repositories to be passed through")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.commits != 1 {
+		t.Errorf("expected one commit, got %d", db.commits)
+	}
+}
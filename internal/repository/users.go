@@ -5,53 +5,55 @@ import (
 	"errors"
 	"log/slog"
 
+	"github.com/dosedaf/syncup-users-service/database"
 	"github.com/dosedaf/syncup-users-service/helper"
 	"github.com/dosedaf/syncup-users-service/internal/model"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
+// uniqueViolation is the SQLSTATE Postgres reports when an insert or update
+// would break a unique index.
+const uniqueViolation = "23505"
+
+// RepositoryInstance compares emails case-insensitively, matching the unique
+// index on lower(email), and stores them as the user typed them.
 type RepositoryInstance interface {
 	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
+	GetUserByID(ctx context.Context, id int) (*model.User, error)
+	// GetUsersByIDs returns the users that exist among ids, ordered by ID.
+	GetUsersByIDs(ctx context.Context, ids []int) ([]model.User, error)
 	IsEmailAvailable(ctx context.Context, email string) error
-	InsertUser(ctx context.Context, credential model.Credential) error
-	GetHashedPassword(ctx context.Context, email string) (string, error)
+	InsertUser(ctx context.Context, credential model.Credential, pepperVersion int) (*model.User, error)
+	UpdatePasswordHash(ctx context.Context, email string, passwordHash string, pepperVersion int) error
+	SetPasswordResetRequired(ctx context.Context, userID int, required bool) error
 }
 
 type Repository struct {
-	conn   *pgx.Conn
+	db     database.DBTX
 	logger *slog.Logger
 }
 
-func NewUserRepository(conn *pgx.Conn, logger *slog.Logger) RepositoryInstance {
+func NewUserRepository(db database.DBTX, logger *slog.Logger) RepositoryInstance {
 	return &Repository{
-		conn:   conn,
+		db:     db,
 		logger: logger,
 	}
 }
 
 func (r *Repository) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
-	query := "SELECT id, email, password_hash, created_at, updated_at FROM users WHERE email=@email"
+	query := "SELECT " + userColumns + " FROM users WHERE lower(email)=lower(@email)"
 	args := pgx.NamedArgs{
 		"email": email,
 	}
 
-	row := r.conn.QueryRow(ctx, query, args)
-	user := &model.User{}
-
-	err := row.Scan(
-		&user.ID,
-		&user.Email,
-		&user.PasswordHash,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
-
+	user, err := scanUser(r.db.QueryRow(ctx, query, args))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, helper.ErrUserNotFound
 		}
 
-		r.logger.Error(
+		r.logger.ErrorContext(ctx,
 			"Failed while scanning for user by email",
 			"email", email,
 			"error", err,
@@ -62,15 +64,73 @@ func (r *Repository) GetUserByEmail(ctx context.Context, email string) (*model.U
 	return user, nil
 }
 
+func (r *Repository) GetUserByID(ctx context.Context, id int) (*model.User, error) {
+	query := "SELECT " + userColumns + " FROM users WHERE id=@id"
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+
+	user, err := scanUser(r.db.QueryRow(ctx, query, args))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, helper.ErrUserNotFound
+		}
+
+		r.logger.ErrorContext(ctx,
+			"Failed while scanning for user by id",
+			"user_id", id,
+			"error", err,
+		)
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (r *Repository) GetUsersByIDs(ctx context.Context, ids []int) ([]model.User, error) {
+	query := "SELECT " + userColumns + " FROM users WHERE id = ANY(@ids) ORDER BY id"
+	args := pgx.NamedArgs{
+		"ids": ids,
+	}
+
+	rows, err := r.db.Query(ctx, query, args)
+	if err != nil {
+		r.logger.ErrorContext(ctx,
+			"Failed while querying users by id",
+			"count", len(ids),
+			"error", err,
+		)
+		return nil, err
+	}
+
+	users, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.User, error) {
+		user, err := scanUser(row)
+		if err != nil {
+			return model.User{}, err
+		}
+		return *user, nil
+	})
+	if err != nil {
+		r.logger.ErrorContext(ctx,
+			"Failed while scanning users by id",
+			"count", len(ids),
+			"error", err,
+		)
+		return nil, err
+	}
+
+	return users, nil
+}
+
 func (r *Repository) IsEmailAvailable(ctx context.Context, email string) error {
-	query := "SELECT email FROM users WHERE email=@email"
+	query := "SELECT email FROM users WHERE lower(email)=lower(@email)"
 	args := pgx.NamedArgs{
 		"email": email,
 	}
 
 	var emailDb string
 
-	row := r.conn.QueryRow(ctx, query, args)
+	row := r.db.QueryRow(ctx, query, args)
 
 	err := row.Scan(&emailDb)
 	if err != nil {
@@ -78,7 +138,7 @@ func (r *Repository) IsEmailAvailable(ctx context.Context, email string) error {
 			return nil
 		}
 
-		r.logger.Error(
+		r.logger.ErrorContext(ctx,
 			"Failed while scanning row",
 			"email", email,
 			"error", err,
@@ -90,52 +150,107 @@ func (r *Repository) IsEmailAvailable(ctx context.Context, email string) error {
 	return helper.ErrEmailAlreadyExists
 }
 
-func (r *Repository) InsertUser(ctx context.Context, credential model.Credential) error {
-	query := "INSERT INTO users (email, password_hash) VALUES (@email, @password_hash)"
+// InsertUser relies on the unique index rather than a prior lookup, so of
+// several concurrent registrations for one email exactly one succeeds and
+// the rest get ErrEmailAlreadyExists.
+func (r *Repository) InsertUser(ctx context.Context, credential model.Credential, pepperVersion int) (*model.User, error) {
+	query := `INSERT INTO users (email, password_hash, pepper_version) VALUES (@email, @password_hash, @pepper_version)
+		RETURNING ` + userColumns
 	args := pgx.NamedArgs{
-		"email":         credential.Email,
-		"password_hash": string(credential.Password),
+		"email":          credential.Email,
+		"password_hash":  string(credential.Password),
+		"pepper_version": pepperVersion,
 	}
 
-	_, err := r.conn.Exec(ctx, query, args)
+	user, err := scanUser(r.db.QueryRow(ctx, query, args))
 	if err != nil {
-		r.logger.Error(
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return nil, helper.ErrEmailAlreadyExists
+		}
+
+		r.logger.ErrorContext(ctx,
 			"Failed while executing query",
 			"email", credential.Email,
 			"error", err,
 		)
 
-		return err
+		return nil, err
 	}
 
-	return nil
+	return user, nil
 }
 
-func (r *Repository) GetHashedPassword(ctx context.Context, email string) (string, error) {
-	query := "SELECT password_hash FROM users WHERE email=@email"
+func (r *Repository) UpdatePasswordHash(ctx context.Context, email string, passwordHash string, pepperVersion int) error {
+	query := "UPDATE users SET password_hash=@password_hash, pepper_version=@pepper_version, updated_at=NOW() WHERE lower(email)=lower(@email)"
 	args := pgx.NamedArgs{
-		"email": email,
+		"email":          email,
+		"password_hash":  passwordHash,
+		"pepper_version": pepperVersion,
 	}
 
-	var passwordDb string
+	tag, err := r.db.Exec(ctx, query, args)
+	if err != nil {
+		r.logger.ErrorContext(ctx,
+			"Failed while updating password hash",
+			"email", email,
+			"error", err,
+		)
 
-	row := r.conn.QueryRow(ctx, query, args)
+		return err
+	}
 
-	err := row.Scan(&passwordDb)
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			// no log, since not found isnt a service error
-			return "", helper.ErrUserNotFound
-		}
+	if tag.RowsAffected() == 0 {
+		return helper.ErrUserNotFound
+	}
 
-		r.logger.Error(
-			"Failed while scanning the row",
-			"email", email,
+	return nil
+}
+
+func (r *Repository) SetPasswordResetRequired(ctx context.Context, userID int, required bool) error {
+	query := "UPDATE users SET password_reset_required=@required, updated_at=NOW() WHERE id=@id"
+	args := pgx.NamedArgs{
+		"id":       userID,
+		"required": required,
+	}
+
+	tag, err := r.db.Exec(ctx, query, args)
+	if err != nil {
+		r.logger.ErrorContext(ctx,
+			"Failed while updating password reset flag",
+			"user_id", userID,
 			"error", err,
 		)
 
-		return "", err
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return helper.ErrUserNotFound
+	}
+
+	return nil
+}
+
+const userColumns = "id, email, password_hash, pepper_version, role, password_reset_required, created_at, updated_at"
+
+// scanUser reads a row selected with userColumns.
+func scanUser(row pgx.Row) (*model.User, error) {
+	user := &model.User{}
+
+	err := row.Scan(
+		&user.ID,
+		&user.Email,
+		&user.PasswordHash,
+		&user.PepperVersion,
+		&user.Role,
+		&user.PasswordResetRequired,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
 	}
 
-	return passwordDb, nil
+	return user, nil
 }
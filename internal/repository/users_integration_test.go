@@ -0,0 +1,246 @@
+//go:build integration
+
+package repository
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dosedaf/syncup-users-service/helper"
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/dosedaf/syncup-users-service/internal/pgtest"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(pgtest.Main(m))
+}
+
+const existingEmail = "existing@example.com"
+
+// newSeededUserRepository returns a repository on a fresh database holding
+// one user, existingEmail.
+func newSeededUserRepository(t *testing.T) (RepositoryInstance, *model.User) {
+	t.Helper()
+
+	pool := pgtest.NewDatabase(t)
+	repo := NewUserRepository(pool, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	ctx := context.Background()
+	if _, err := repo.InsertUser(ctx, model.Credential{Email: existingEmail, Password: "hash-v1"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	user, err := repo.GetUserByEmail(ctx, existingEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return repo, user
+}
+
+func TestGetUserByEmail(t *testing.T) {
+	repo, seeded := newSeededUserRepository(t)
+
+	tests := []struct {
+		name    string
+		email   string
+		wantErr error
+	}{
+		{"existing user", existingEmail, nil},
+		{"unknown email", "nobody@example.com", helper.ErrUserNotFound},
+		{"emails are matched regardless of case", "Existing@Example.com", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := repo.GetUserByEmail(context.Background(), tt.email)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			if user.ID != seeded.ID || user.Email != existingEmail {
+				t.Errorf("unexpected user %+v", user)
+			}
+			if user.PasswordHash == nil || *user.PasswordHash != "hash-v1" || user.PepperVersion != 1 {
+				t.Errorf("password hash and pepper version not stored: %+v", user)
+			}
+			if user.Role != model.RoleUser || user.PasswordResetRequired {
+				t.Errorf("unexpected defaults for a new user: %+v", user)
+			}
+			if user.CreatedAt.IsZero() || user.UpdatedAt != nil {
+				t.Errorf("unexpected timestamps for a new user: %+v", user)
+			}
+		})
+	}
+}
+
+func TestIsEmailAvailable(t *testing.T) {
+	repo, _ := newSeededUserRepository(t)
+
+	tests := []struct {
+		name    string
+		email   string
+		wantErr error
+	}{
+		{"free email", "new@example.com", nil},
+		{"taken email", existingEmail, helper.ErrEmailAlreadyExists},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := repo.IsEmailAvailable(context.Background(), tt.email); !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestInsertUser(t *testing.T) {
+	repo, _ := newSeededUserRepository(t)
+
+	tests := []struct {
+		name       string
+		credential model.Credential
+		wantErr    bool
+		wantErrIs  error
+	}{
+		{"new user", model.Credential{Email: "new@example.com", Password: "hash"}, false, nil},
+		{"duplicate email", model.Credential{Email: existingEmail, Password: "hash"}, true, helper.ErrEmailAlreadyExists},
+		{"duplicate email in another case", model.Credential{Email: strings.ToUpper(existingEmail), Password: "hash"}, true, helper.ErrEmailAlreadyExists},
+		{"email longer than the column", model.Credential{Email: strings.Repeat("a", 250) + "@example.com", Password: "hash"}, true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := repo.InsertUser(context.Background(), tt.credential, 3)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error: %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErrIs != nil && !errors.Is(err, tt.wantErrIs) {
+				t.Fatalf("expected error %v, got %v", tt.wantErrIs, err)
+			}
+			if err != nil {
+				return
+			}
+
+			// RETURNING hands back the row with its defaults filled in
+			if user.ID == 0 || user.Email != tt.credential.Email || user.PepperVersion != 3 || user.Role != model.RoleUser || user.CreatedAt.IsZero() {
+				t.Errorf("unexpected returned user %+v", user)
+			}
+			if err = repo.IsEmailAvailable(context.Background(), tt.credential.Email); !errors.Is(err, helper.ErrEmailAlreadyExists) {
+				t.Errorf("expected the inserted email to be taken, got %v", err)
+			}
+		})
+	}
+}
+
+// Registration checks availability and inserts in separate statements, so
+// the unique index is what stops concurrent sign-ups with one email.
+func TestInsertUserUniqueEmailRace(t *testing.T) {
+	repo, _ := newSeededUserRepository(t)
+
+	const attempts = 10
+	var wg sync.WaitGroup
+	errs := make([]error, attempts)
+	start := make(chan struct{})
+
+	for i := range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, errs[i] = repo.InsertUser(context.Background(), model.Credential{Email: "race@example.com", Password: "hash"}, 0)
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	winners := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			winners++
+		case !errors.Is(err, helper.ErrEmailAlreadyExists):
+			t.Errorf("expected losers to get ErrEmailAlreadyExists, got %v", err)
+		}
+	}
+	if winners != 1 {
+		t.Errorf("expected exactly one insert to succeed, got %d: %v", winners, errs)
+	}
+}
+
+func TestUpdatePasswordHash(t *testing.T) {
+	repo, _ := newSeededUserRepository(t)
+
+	tests := []struct {
+		name    string
+		email   string
+		wantErr error
+	}{
+		{"existing user", existingEmail, nil},
+		{"unknown email", "nobody@example.com", helper.ErrUserNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := repo.UpdatePasswordHash(context.Background(), tt.email, "hash-v2", 2)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			user, err := repo.GetUserByEmail(context.Background(), tt.email)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *user.PasswordHash != "hash-v2" || user.PepperVersion != 2 || user.UpdatedAt == nil {
+				t.Errorf("expected the new hash, pepper version and updated_at: %+v", user)
+			}
+		})
+	}
+}
+
+func TestSetPasswordResetRequired(t *testing.T) {
+	repo, seeded := newSeededUserRepository(t)
+
+	tests := []struct {
+		name     string
+		userID   int
+		required bool
+		wantErr  error
+	}{
+		{"flag a user", seeded.ID, true, nil},
+		{"clear the flag", seeded.ID, false, nil},
+		{"unknown user", seeded.ID + 1000, true, helper.ErrUserNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := repo.SetPasswordResetRequired(context.Background(), tt.userID, tt.required)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			user, err := repo.GetUserByEmail(context.Background(), existingEmail)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.PasswordResetRequired != tt.required {
+				t.Errorf("expected password_reset_required=%v, got %v", tt.required, user.PasswordResetRequired)
+			}
+		})
+	}
+}
@@ -0,0 +1,394 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/database"
+	"github.com/dosedaf/syncup-users-service/helper"
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/jackc/pgx/v5"
+)
+
+// WebhookRepositoryInstance stores webhook subscriptions, the deliveries
+// owed to them and a log of every delivery attempt.
+type WebhookRepositoryInstance interface {
+	InsertWebhookSubscription(ctx context.Context, subscription *model.WebhookSubscription) error
+	ListWebhookSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error)
+	GetWebhookSubscription(ctx context.Context, id int) (*model.WebhookSubscription, error)
+	DeleteWebhookSubscription(ctx context.Context, id int) error
+
+	// EnqueueWebhookDeliveries creates a pending delivery of event for every
+	// subscription that wants it and returns how many were created. An event
+	// that was enqueued before is skipped, so it is safe to call again.
+	EnqueueWebhookDeliveries(ctx context.Context, event model.OutboxEvent) (int, error)
+	// ClaimWebhookDeliveries returns up to limit pending deliveries that are
+	// due at now, longest overdue first and sorted by ID, and hides them from
+	// other claims until leaseUntil.
+	ClaimWebhookDeliveries(ctx context.Context, now time.Time, leaseUntil time.Time, limit int) ([]model.WebhookDelivery, error)
+	// RecordWebhookAttempt logs attempt and moves its delivery to status,
+	// to be tried again at nextAttemptAt if it is still pending.
+	RecordWebhookAttempt(ctx context.Context, attempt model.WebhookDeliveryAttempt, status string, nextAttemptAt time.Time) error
+
+	ListWebhookDeliveries(ctx context.Context, filter model.WebhookDeliveryFilter) ([]model.WebhookDelivery, error)
+	GetWebhookDelivery(ctx context.Context, id int64) (*model.WebhookDelivery, error)
+	ListWebhookDeliveryAttempts(ctx context.Context, deliveryID int64) ([]model.WebhookDeliveryAttempt, error)
+	// RedeliverWebhookDelivery makes a delivery pending and due at now with
+	// a fresh set of attempts, whatever its status. Its log is kept.
+	RedeliverWebhookDelivery(ctx context.Context, id int64, now time.Time) error
+}
+
+type WebhookRepository struct {
+	db     database.DBTX
+	logger *slog.Logger
+}
+
+func NewWebhookRepository(db database.DBTX, logger *slog.Logger) WebhookRepositoryInstance {
+	return &WebhookRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+const webhookDeliveryColumns = `id, subscription_id, event_id, event_type, payload, occurred_at, status,
+	attempts, next_attempt_at, last_error, created_at, delivered_at`
+
+func scanWebhookDelivery(row pgx.CollectableRow) (model.WebhookDelivery, error) {
+	var d model.WebhookDelivery
+	err := row.Scan(
+		&d.ID,
+		&d.SubscriptionID,
+		&d.EventID,
+		&d.EventType,
+		&d.Payload,
+		&d.OccurredAt,
+		&d.Status,
+		&d.Attempts,
+		&d.NextAttemptAt,
+		&d.LastError,
+		&d.CreatedAt,
+		&d.DeliveredAt,
+	)
+	return d, err
+}
+
+func (r *WebhookRepository) InsertWebhookSubscription(ctx context.Context, subscription *model.WebhookSubscription) error {
+	query := `INSERT INTO webhook_subscriptions (url, secret, event_types, description)
+		VALUES (@url, @secret, @event_types, @description)
+		RETURNING id, created_at`
+	args := pgx.NamedArgs{
+		"url":         subscription.URL,
+		"secret":      subscription.Secret,
+		"event_types": subscription.EventTypes,
+		"description": subscription.Description,
+	}
+
+	err := r.db.QueryRow(ctx, query, args).Scan(&subscription.ID, &subscription.CreatedAt)
+	if err != nil {
+		r.logger.ErrorContext(ctx, "Failed while inserting webhook subscription", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *WebhookRepository) ListWebhookSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error) {
+	query := `SELECT id, url, secret, event_types, description, created_at
+		FROM webhook_subscriptions ORDER BY id`
+
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		r.logger.ErrorContext(ctx, "Failed while listing webhook subscriptions", "error", err)
+		return nil, err
+	}
+
+	subscriptions, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.WebhookSubscription, error) {
+		var s model.WebhookSubscription
+		err := row.Scan(&s.ID, &s.URL, &s.Secret, &s.EventTypes, &s.Description, &s.CreatedAt)
+		return s, err
+	})
+	if err != nil {
+		r.logger.ErrorContext(ctx, "Failed while scanning webhook subscriptions", "error", err)
+		return nil, err
+	}
+
+	return subscriptions, nil
+}
+
+func (r *WebhookRepository) GetWebhookSubscription(ctx context.Context, id int) (*model.WebhookSubscription, error) {
+	query := `SELECT id, url, secret, event_types, description, created_at
+		FROM webhook_subscriptions WHERE id=@id`
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+
+	s := &model.WebhookSubscription{}
+	err := r.db.QueryRow(ctx, query, args).Scan(&s.ID, &s.URL, &s.Secret, &s.EventTypes, &s.Description, &s.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, helper.ErrWebhookNotFound
+		}
+
+		r.logger.ErrorContext(ctx,
+			"Failed while getting webhook subscription",
+			"id", id,
+			"error", err,
+		)
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (r *WebhookRepository) DeleteWebhookSubscription(ctx context.Context, id int) error {
+	query := "DELETE FROM webhook_subscriptions WHERE id=@id"
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+
+	tag, err := r.db.Exec(ctx, query, args)
+	if err != nil {
+		r.logger.ErrorContext(ctx,
+			"Failed while deleting webhook subscription",
+			"id", id,
+			"error", err,
+		)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return helper.ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+func (r *WebhookRepository) EnqueueWebhookDeliveries(ctx context.Context, event model.OutboxEvent) (int, error) {
+	query := `INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload, occurred_at)
+		SELECT id, @event_id, @event_type, @payload, @occurred_at FROM webhook_subscriptions
+		WHERE @event_type::text = ANY (event_types)
+		ON CONFLICT (subscription_id, event_id) DO NOTHING`
+	args := pgx.NamedArgs{
+		"event_id":    event.ID,
+		"event_type":  event.Type,
+		"payload":     []byte(event.Payload),
+		"occurred_at": event.CreatedAt,
+	}
+
+	tag, err := r.db.Exec(ctx, query, args)
+	if err != nil {
+		r.logger.ErrorContext(ctx,
+			"Failed while enqueueing webhook deliveries",
+			"event_id", event.ID,
+			"error", err,
+		)
+		return 0, err
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+func (r *WebhookRepository) ClaimWebhookDeliveries(ctx context.Context, now time.Time, leaseUntil time.Time, limit int) ([]model.WebhookDelivery, error) {
+	query := `UPDATE webhook_deliveries SET next_attempt_at=@lease_until
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status='pending' AND next_attempt_at <= @now
+			ORDER BY next_attempt_at, id
+			LIMIT @limit
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + webhookDeliveryColumns
+	args := pgx.NamedArgs{
+		"now":         now,
+		"lease_until": leaseUntil,
+		"limit":       limit,
+	}
+
+	rows, err := r.db.Query(ctx, query, args)
+	if err != nil {
+		r.logger.ErrorContext(ctx, "Failed while claiming webhook deliveries", "error", err)
+		return nil, err
+	}
+
+	deliveries, err := pgx.CollectRows(rows, scanWebhookDelivery)
+	if err != nil {
+		r.logger.ErrorContext(ctx, "Failed while scanning webhook deliveries", "error", err)
+		return nil, err
+	}
+
+	// RETURNING does not keep the subquery's order
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].ID < deliveries[j].ID
+	})
+
+	return deliveries, nil
+}
+
+func (r *WebhookRepository) RecordWebhookAttempt(ctx context.Context, attempt model.WebhookDeliveryAttempt, status string, nextAttemptAt time.Time) error {
+	// one statement, so the log never disagrees with the delivery
+	query := `WITH attempt AS (
+			INSERT INTO webhook_delivery_attempts (delivery_id, attempted_at, status_code, error, duration_ms)
+			VALUES (@delivery_id, @attempted_at, @status_code, @error, @duration_ms)
+		)
+		UPDATE webhook_deliveries SET
+			status=@status::text,
+			attempts=attempts+1,
+			next_attempt_at=@next_attempt_at,
+			last_error=@error,
+			delivered_at=CASE WHEN @status::text='delivered' THEN @attempted_at::timestamptz ELSE delivered_at END
+		WHERE id=@delivery_id`
+	args := pgx.NamedArgs{
+		"delivery_id":     attempt.DeliveryID,
+		"attempted_at":    attempt.AttemptedAt,
+		"status_code":     attempt.StatusCode,
+		"error":           attempt.Error,
+		"duration_ms":     attempt.DurationMS,
+		"status":          status,
+		"next_attempt_at": nextAttemptAt,
+	}
+
+	if _, err := r.db.Exec(ctx, query, args); err != nil {
+		r.logger.ErrorContext(ctx,
+			"Failed while recording webhook delivery attempt",
+			"delivery_id", attempt.DeliveryID,
+			"error", err,
+		)
+		return err
+	}
+
+	return nil
+}
+
+func (r *WebhookRepository) ListWebhookDeliveries(ctx context.Context, filter model.WebhookDeliveryFilter) ([]model.WebhookDelivery, error) {
+	conditions := []string{"subscription_id=@subscription_id"}
+	args := pgx.NamedArgs{
+		"subscription_id": filter.SubscriptionID,
+	}
+
+	if filter.Status != "" {
+		conditions = append(conditions, "status=@status")
+		args["status"] = filter.Status
+	}
+	if filter.BeforeID > 0 {
+		conditions = append(conditions, "id<@before_id")
+		args["before_id"] = filter.BeforeID
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = model.DefaultWebhookDeliveryLimit
+	}
+	if limit > model.MaxWebhookDeliveryLimit {
+		limit = model.MaxWebhookDeliveryLimit
+	}
+	args["limit"] = limit
+
+	query := fmt.Sprintf(`SELECT %s FROM webhook_deliveries WHERE %s ORDER BY id DESC LIMIT @limit`,
+		webhookDeliveryColumns, strings.Join(conditions, " AND "))
+
+	rows, err := r.db.Query(ctx, query, args)
+	if err != nil {
+		r.logger.ErrorContext(ctx, "Failed while querying webhook deliveries", "error", err)
+		return nil, err
+	}
+
+	deliveries, err := pgx.CollectRows(rows, scanWebhookDelivery)
+	if err != nil {
+		r.logger.ErrorContext(ctx, "Failed while scanning webhook deliveries", "error", err)
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+func (r *WebhookRepository) GetWebhookDelivery(ctx context.Context, id int64) (*model.WebhookDelivery, error) {
+	query := "SELECT " + webhookDeliveryColumns + " FROM webhook_deliveries WHERE id=@id"
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+
+	rows, err := r.db.Query(ctx, query, args)
+	if err != nil {
+		r.logger.ErrorContext(ctx,
+			"Failed while getting webhook delivery",
+			"id", id,
+			"error", err,
+		)
+		return nil, err
+	}
+
+	d, err := pgx.CollectExactlyOneRow(rows, scanWebhookDelivery)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, helper.ErrWebhookDeliveryNotFound
+		}
+
+		r.logger.ErrorContext(ctx,
+			"Failed while scanning webhook delivery",
+			"id", id,
+			"error", err,
+		)
+		return nil, err
+	}
+
+	return &d, nil
+}
+
+func (r *WebhookRepository) ListWebhookDeliveryAttempts(ctx context.Context, deliveryID int64) ([]model.WebhookDeliveryAttempt, error) {
+	query := `SELECT id, delivery_id, attempted_at, status_code, error, duration_ms
+		FROM webhook_delivery_attempts WHERE delivery_id=@delivery_id ORDER BY id`
+	args := pgx.NamedArgs{
+		"delivery_id": deliveryID,
+	}
+
+	rows, err := r.db.Query(ctx, query, args)
+	if err != nil {
+		r.logger.ErrorContext(ctx,
+			"Failed while listing webhook delivery attempts",
+			"delivery_id", deliveryID,
+			"error", err,
+		)
+		return nil, err
+	}
+
+	attempts, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.WebhookDeliveryAttempt, error) {
+		var a model.WebhookDeliveryAttempt
+		err := row.Scan(&a.ID, &a.DeliveryID, &a.AttemptedAt, &a.StatusCode, &a.Error, &a.DurationMS)
+		return a, err
+	})
+	if err != nil {
+		r.logger.ErrorContext(ctx, "Failed while scanning webhook delivery attempts", "error", err)
+		return nil, err
+	}
+
+	return attempts, nil
+}
+
+func (r *WebhookRepository) RedeliverWebhookDelivery(ctx context.Context, id int64, now time.Time) error {
+	query := `UPDATE webhook_deliveries
+		SET status='pending', attempts=0, next_attempt_at=@now, delivered_at=NULL
+		WHERE id=@id`
+	args := pgx.NamedArgs{
+		"id":  id,
+		"now": now,
+	}
+
+	tag, err := r.db.Exec(ctx, query, args)
+	if err != nil {
+		r.logger.ErrorContext(ctx,
+			"Failed while redelivering webhook delivery",
+			"id", id,
+			"error", err,
+		)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return helper.ErrWebhookDeliveryNotFound
+	}
+
+	return nil
+}
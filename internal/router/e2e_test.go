@@ -0,0 +1,370 @@
+package router_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/dosedaf/syncup-users-service/internal/router"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestRegisterLoginMe(t *testing.T) {
+	srv := newTestServer(t)
+
+	srv.register(t, "someone@example.com")
+	token := srv.login(t, "someone@example.com")
+
+	var me struct {
+		Data struct {
+			ID    int    `json:"id"`
+			Email string `json:"email"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(srv.call(t, http.MethodGet, "/api/v1/me", token, "", http.StatusOK), &me); err != nil {
+		t.Fatal(err)
+	}
+	if me.Data.ID == 0 || me.Data.Email != "someone@example.com" {
+		t.Errorf("unexpected user %+v", me.Data)
+	}
+}
+
+func TestEmailsAreCaseInsensitive(t *testing.T) {
+	srv := newTestServer(t)
+
+	srv.register(t, "Someone@Example.com")
+
+	body := srv.call(t, http.MethodPost, "/api/v1/register", "", credentials("someone@example.com"), http.StatusConflict)
+	if code := problemCode(t, body); code != "email_already_exists" {
+		t.Errorf("expected code email_already_exists, got %q", code)
+	}
+
+	token := srv.login(t, "SOMEONE@example.com")
+	srv.call(t, http.MethodGet, "/api/v1/me", token, "", http.StatusOK)
+}
+
+func TestPasswordReset(t *testing.T) {
+	srv := newTestServer(t)
+
+	srv.register(t, "someone@example.com")
+	oldToken := srv.login(t, "someone@example.com")
+
+	// unknown emails get the same answer and no email
+	srv.call(t, http.MethodPost, "/api/v1/password/forgot", "", `{"email": "nobody@example.com"}`, http.StatusOK)
+	srv.call(t, http.MethodPost, "/api/v1/password/forgot", "", `{"email": "someone@example.com"}`, http.StatusOK)
+	sent := srv.mail.messages()
+	if len(sent) != 1 || sent[0].To != "someone@example.com" {
+		t.Fatalf("expected one reset email to someone@example.com, got %+v", sent)
+	}
+
+	body := sent[0].Body
+	start := strings.Index(body, testResetURL)
+	if start < 0 {
+		t.Fatalf("no reset link in %q", body)
+	}
+	link, err := url.Parse(strings.Fields(body[start:])[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	resetBody := `{"token": "` + link.Query().Get("token") + `", "password": "a new password"}`
+
+	srv.call(t, http.MethodPost, "/api/v1/password/reset", "", resetBody, http.StatusOK)
+
+	// sessions from before the reset are gone, and so is the old password
+	srv.call(t, http.MethodGet, "/api/v1/me", oldToken, "", http.StatusUnauthorized)
+	srv.call(t, http.MethodPost, "/api/v1/login", "", credentials("someone@example.com"), http.StatusUnauthorized)
+	srv.call(t, http.MethodPost, "/api/v1/login", "", `{"email": "someone@example.com", "password": "a new password"}`, http.StatusOK)
+
+	reused := srv.call(t, http.MethodPost, "/api/v1/password/reset", "", resetBody, http.StatusBadRequest)
+	if code := problemCode(t, reused); code != "invalid_token" {
+		t.Errorf("expected code invalid_token for a reused reset token, got %q", code)
+	}
+}
+
+// sessionFromToken reads the session id a real login put in its token.
+func sessionFromToken(t *testing.T, token string) string {
+	t.Helper()
+
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		t.Fatal(err)
+	}
+	sid, _ := claims["sid"].(string)
+
+	return sid
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key any, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+func TestRejectedTokens(t *testing.T) {
+	srv := newTestServer(t)
+
+	srv.register(t, "someone@example.com")
+	sid := sessionFromToken(t, srv.login(t, "someone@example.com"))
+
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"sub": "someone@example.com",
+			"sid": sid,
+			"iat": time.Now().Unix(),
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+	}
+	with := func(key string, value any) jwt.MapClaims {
+		claims := valid()
+		claims[key] = value
+		return claims
+	}
+	without := func(key string) jwt.MapClaims {
+		claims := valid()
+		delete(claims, key)
+		return claims
+	}
+
+	// a token built like the real ones must pass, or the cases below prove
+	// nothing
+	srv.call(t, http.MethodGet, "/api/v1/me", sign(t, jwt.SigningMethodHS256, []byte(testJWTSecret), valid()), "", http.StatusOK)
+
+	tests := []struct {
+		name     string
+		token    string
+		wantCode string
+	}{
+		{"expired", sign(t, jwt.SigningMethodHS256, []byte(testJWTSecret), with("exp", time.Now().Add(-time.Minute).Unix())), "unauthorized"},
+		{"not yet valid", sign(t, jwt.SigningMethodHS256, []byte(testJWTSecret), with("nbf", time.Now().Add(time.Hour).Unix())), "unauthorized"},
+		{"forged signature", sign(t, jwt.SigningMethodHS256, []byte("not the server's secret at all"), valid()), "unauthorized"},
+		{"alg none", sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, valid()), "unauthorized"},
+		{"tampered payload", tamper(t, sign(t, jwt.SigningMethodHS256, []byte(testJWTSecret), valid())), "unauthorized"},
+		{"unknown user", sign(t, jwt.SigningMethodHS256, []byte(testJWTSecret), with("sub", "ghost@example.com")), "unauthorized"},
+		{"unknown session", sign(t, jwt.SigningMethodHS256, []byte(testJWTSecret), with("sid", "not-a-session")), "session_revoked"},
+		{"missing session", sign(t, jwt.SigningMethodHS256, []byte(testJWTSecret), without("sid")), "unauthorized"},
+		{"garbage", "not-a-jwt", "unauthorized"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := srv.call(t, http.MethodGet, "/api/v1/me", tt.token, "", http.StatusUnauthorized)
+			if code := problemCode(t, body); code != tt.wantCode {
+				t.Errorf("expected code %q, got %q", tt.wantCode, code)
+			}
+		})
+	}
+}
+
+func TestRevokedSession(t *testing.T) {
+	srv := newTestServer(t)
+
+	srv.register(t, "someone@example.com")
+	token := srv.login(t, "someone@example.com")
+	other := srv.login(t, "someone@example.com")
+
+	srv.call(t, http.MethodDelete, "/api/v1/me/sessions/"+sessionFromToken(t, token), other, "", http.StatusOK)
+
+	body := srv.call(t, http.MethodGet, "/api/v1/me", token, "", http.StatusUnauthorized)
+	if code := problemCode(t, body); code != "session_revoked" {
+		t.Errorf("expected code session_revoked, got %q", code)
+	}
+	srv.call(t, http.MethodGet, "/api/v1/me", other, "", http.StatusOK)
+}
+
+// tamper swaps the payload of a signed token for one claiming another user.
+func tamper(t *testing.T, token string) string {
+	t.Helper()
+
+	parts := strings.Split(token, ".")
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		t.Fatal(err)
+	}
+	claims["sub"] = "admin@example.com"
+
+	b, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts[1] = base64.RawURLEncoding.EncodeToString(b)
+
+	return strings.Join(parts, ".")
+}
+
+func TestAuthorizationHeaderFormats(t *testing.T) {
+	srv := newTestServer(t)
+
+	srv.register(t, "someone@example.com")
+	token := srv.login(t, "someone@example.com")
+
+	tests := []struct {
+		name   string
+		header []string
+	}{
+		{"missing", nil},
+		{"empty", []string{""}},
+		{"token without scheme", []string{token}},
+		{"basic scheme", []string{"Basic c29tZW9uZTpwYXNzd29yZA=="}},
+		{"lowercase scheme", []string{"bearer " + token}},
+		{"scheme only", []string{"Bearer "}},
+		{"extra space", []string{"Bearer  " + token}},
+		{"trailing data", []string{"Bearer " + token + " extra"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, srv.URL+"/api/v1/me", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, value := range tt.header {
+				req.Header.Add("Authorization", value)
+			}
+
+			srv.do(t, req, http.StatusUnauthorized)
+		})
+	}
+}
+
+func TestMalformedBodies(t *testing.T) {
+	srv := newTestServer(t)
+
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		wantCode string
+	}{
+		{"not JSON", "/api/v1/register", `email=someone@example.com`, "invalid_request"},
+		{"truncated", "/api/v1/register", `{"email": "someone@example.com", "pass`, "invalid_request"},
+		{"array", "/api/v1/login", `[]`, "invalid_request"},
+		{"wrong field type", "/api/v1/login", `{"email": 42, "password": "x"}`, "invalid_request"},
+		{"empty body", "/api/v1/login", ``, "invalid_request"},
+		{"empty object", "/api/v1/register", `{}`, "validation_failed"},
+		{"null", "/api/v1/register", `null`, "validation_failed"},
+		{"not-me without token", "/api/v1/security/not-me", `{"token": ""}`, "validation_failed"},
+		{"forgot without email", "/api/v1/password/forgot", `{"email": " "}`, "validation_failed"},
+		{"reset without password", "/api/v1/password/reset", `{"token": "x"}`, "validation_failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := srv.call(t, http.MethodPost, tt.path, "", tt.body, http.StatusBadRequest)
+			if code := problemCode(t, body); code != tt.wantCode {
+				t.Errorf("expected code %q, got %q", tt.wantCode, code)
+			}
+		})
+	}
+}
+
+func TestLargeBodies(t *testing.T) {
+	srv := newTestServer(t)
+
+	padding := strings.Repeat("a", router.DefaultMaxBodyBytes)
+	paths := []string{"/api/v1/register", "/api/v1/login", "/api/v1/security/not-me", "/api/v1/password/forgot", "/api/v1/password/reset"}
+
+	for _, path := range paths {
+		t.Run(path, func(t *testing.T) {
+			body := srv.call(t, http.MethodPost, path, "", `{"email": "`+padding+`@example.com", "password": "x", "token": "x"}`, http.StatusRequestEntityTooLarge)
+			if code := problemCode(t, body); code != "request_too_large" {
+				t.Errorf("expected code request_too_large, got %q", code)
+			}
+		})
+	}
+
+	// the limit must not get in the way of the server afterwards
+	srv.register(t, "someone@example.com")
+}
+
+func TestIntrospect(t *testing.T) {
+	srv := newTestServer(t)
+
+	srv.register(t, "someone@example.com")
+	token := srv.login(t, "someone@example.com")
+	srv.register(t, "admin@example.com")
+	if err := srv.users.SetRole("admin@example.com", model.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+
+	type introspection struct {
+		Active    bool   `json:"active"`
+		Scope     string `json:"scope"`
+		TokenType string `json:"token_type"`
+		Sub       string `json:"sub"`
+		Username  string `json:"username"`
+		Exp       int64  `json:"exp"`
+		SessionID string `json:"sid"`
+		AuthTime  int64  `json:"auth_time"`
+	}
+	introspect := func(token string) (introspection, string) {
+		t.Helper()
+
+		body := srv.introspect(t, testClientID, testClientSecret, token, http.StatusOK)
+		var resp introspection
+		if err := json.Unmarshal(body, &resp); err != nil {
+			t.Fatal(err)
+		}
+
+		return resp, strings.TrimSpace(string(body))
+	}
+
+	var me struct {
+		Data struct {
+			ID int `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(srv.call(t, http.MethodGet, "/api/v1/me", token, "", http.StatusOK), &me); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, _ := introspect(token)
+	sid := sessionFromToken(t, token)
+	if !resp.Active || resp.Sub != strconv.Itoa(me.Data.ID) || resp.Username != "someone@example.com" || resp.SessionID != sid {
+		t.Errorf("unexpected introspection %+v", resp)
+	}
+	if resp.Scope != "user" || resp.TokenType != "Bearer" || resp.Exp <= time.Now().Unix() || resp.AuthTime == 0 {
+		t.Errorf("unexpected introspection %+v", resp)
+	}
+
+	if resp, _ := introspect(srv.login(t, "admin@example.com")); resp.Scope != "user admin" {
+		t.Errorf("expected admin scope, got %q", resp.Scope)
+	}
+
+	// emailed report tokens are signed with the same key but are not access
+	// tokens
+	reportToken := sign(t, jwt.SigningMethodHS256, []byte(testJWTSecret), jwt.MapClaims{
+		"sub":     "someone@example.com",
+		"purpose": "not_me",
+		"exp":     time.Now().Add(time.Hour).Unix(),
+	})
+	if _, body := introspect(reportToken); body != `{"active":false}` {
+		t.Errorf("expected an inactive token with nothing else, got %s", body)
+	}
+
+	srv.call(t, http.MethodDelete, "/api/v1/me/sessions/"+sid, token, "", http.StatusOK)
+	if resp, _ := introspect(token); resp.Active {
+		t.Error("expected the token of a revoked session to be inactive")
+	}
+
+	// RFC 7662 requests are form encoded
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/api/v1/introspect", strings.NewReader(`{"token": "x"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(testClientID, testClientSecret)
+	if code := problemCode(t, srv.do(t, req, http.StatusBadRequest)); code != "invalid_request" {
+		t.Errorf("expected code invalid_request, got %q", code)
+	}
+}
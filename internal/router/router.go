@@ -0,0 +1,110 @@
+// Package router builds the service's HTTP handler: every route, the
+// authentication in front of them and the middleware around the mux. main and
+// the end-to-end tests both build it here, so the tests exercise exactly
+// what is deployed.
+package router
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/dosedaf/syncup-users-service/internal/handler"
+	"github.com/dosedaf/syncup-users-service/internal/health"
+	"github.com/dosedaf/syncup-users-service/internal/metrics"
+	"github.com/dosedaf/syncup-users-service/internal/openapi"
+	"github.com/dosedaf/syncup-users-service/internal/tracing"
+	"github.com/dosedaf/syncup-users-service/middleware"
+)
+
+// DefaultMaxBodyBytes bounds request bodies when Deps.MaxBodyBytes is zero.
+// The largest legitimate body is a login, well under a kilobyte.
+const DefaultMaxBodyBytes = 1 << 20
+
+type Deps struct {
+	Users    handler.HandlerInstance
+	Audit    handler.AuditHandlerInstance
+	Webhooks handler.WebhookHandlerInstance
+	Auth     *middleware.Middleware
+	Probes   *health.Health
+	Logger   *slog.Logger
+
+	// Introspection is served to ServiceClients only.
+	Introspection  handler.IntrospectionHandlerInstance
+	ServiceClients middleware.ServiceClients
+
+	// Metrics and Tracing are optional; without them requests are not
+	// instrumented. /metrics is served on a listener of its own, not here.
+	Metrics *metrics.Metrics
+	Tracing *tracing.Tracing
+
+	MaxBodyBytes int64
+}
+
+// Route is one endpoint of the service. Patterns use ServeMux syntax, which
+// is also how internal/openapi/openapi.json spells its paths.
+type Route struct {
+	Pattern string
+	Handler http.Handler
+}
+
+// Routes lists every endpoint the service serves. Adding one here without
+// documenting it in openapi.json fails TestRoutesMatchOpenAPI.
+func Routes(d Deps) []Route {
+	errs := handler.NewErrorHandler(d.Logger)
+	admin := func(h func(http.ResponseWriter, *http.Request) error) http.Handler {
+		return d.Auth.JWTMiddleware(d.Auth.RequireAdmin(errs.Handle(h)))
+	}
+	serviceClient := middleware.RequireServiceClient(d.ServiceClients, d.Logger)
+
+	return []Route{
+		{"GET /healthz", http.HandlerFunc(d.Probes.Live)},
+		{"GET /readyz", http.HandlerFunc(d.Probes.Ready)},
+		{"GET /openapi.json", openapi.Handler()},
+		{"POST /api/v1/register", errs.Handle(d.Users.Register)},
+		{"POST /api/v1/login", errs.Handle(d.Users.Login)},
+		{"GET /api/v1/me", d.Auth.JWTMiddleware(errs.Handle(d.Users.Me))},
+		{"GET /api/v1/me/sessions", d.Auth.JWTMiddleware(errs.Handle(d.Users.Sessions))},
+		{"DELETE /api/v1/me/sessions/{id}", d.Auth.JWTMiddleware(errs.Handle(d.Users.RevokeSession))},
+		{"POST /api/v1/security/not-me", errs.Handle(d.Users.ReportNotMe)},
+		{"POST /api/v1/password/forgot", errs.Handle(d.Users.ForgotPassword)},
+		{"POST /api/v1/password/reset", errs.Handle(d.Users.ResetPassword)},
+		{"GET /api/v1/me/security-events", d.Auth.JWTMiddleware(errs.Handle(d.Audit.MySecurityEvents))},
+		{"POST /api/v1/introspect", serviceClient(errs.Handle(d.Introspection.Introspect))},
+		{"GET /api/v1/admin/security-events", admin(d.Audit.SecurityEvents)},
+		{"POST /api/v1/admin/webhooks", admin(d.Webhooks.CreateSubscription)},
+		{"GET /api/v1/admin/webhooks", admin(d.Webhooks.Subscriptions)},
+		{"GET /api/v1/admin/webhooks/{id}", admin(d.Webhooks.Subscription)},
+		{"DELETE /api/v1/admin/webhooks/{id}", admin(d.Webhooks.DeleteSubscription)},
+		{"GET /api/v1/admin/webhooks/{id}/deliveries", admin(d.Webhooks.Deliveries)},
+		{"GET /api/v1/admin/webhooks/{id}/deliveries/{delivery_id}", admin(d.Webhooks.Delivery)},
+		{"POST /api/v1/admin/webhooks/{id}/deliveries/{delivery_id}/redeliver", admin(d.Webhooks.Redeliver)},
+	}
+}
+
+// New returns the complete handler for d: the routes wrapped in tracing,
+// access logging, metrics, panic recovery and the body size limit, outermost
+// first.
+func New(d Deps) http.Handler {
+	mux := http.NewServeMux()
+	for _, route := range Routes(d) {
+		mux.Handle(route.Pattern, route.Handler)
+	}
+
+	maxBodyBytes := d.MaxBodyBytes
+	if maxBodyBytes <= 0 {
+		maxBodyBytes = DefaultMaxBodyBytes
+	}
+
+	var h http.Handler = middleware.LimitBody(maxBodyBytes)(mux)
+	h = middleware.Recover(d.Logger)(h)
+	if d.Metrics != nil {
+		h = d.Metrics.Middleware(h)
+	}
+	h = middleware.AccessLog(d.Logger)(h)
+	// tracing goes outermost so access log lines carry the trace id
+	if d.Tracing != nil {
+		h = d.Tracing.Middleware(h)
+	}
+
+	return h
+}
@@ -0,0 +1,421 @@
+package router_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/helper"
+	"github.com/dosedaf/syncup-users-service/internal/audit"
+	"github.com/dosedaf/syncup-users-service/internal/handler"
+	"github.com/dosedaf/syncup-users-service/internal/health"
+	"github.com/dosedaf/syncup-users-service/internal/mailer"
+	"github.com/dosedaf/syncup-users-service/internal/metrics"
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/dosedaf/syncup-users-service/internal/openapi"
+	"github.com/dosedaf/syncup-users-service/internal/password"
+	"github.com/dosedaf/syncup-users-service/internal/repository/memory"
+	"github.com/dosedaf/syncup-users-service/internal/router"
+	"github.com/dosedaf/syncup-users-service/internal/service"
+	"github.com/dosedaf/syncup-users-service/internal/session"
+	"github.com/dosedaf/syncup-users-service/internal/token"
+	"github.com/dosedaf/syncup-users-service/middleware"
+)
+
+const (
+	testJWTSecret = "a test secret that is long enough for HS256"
+	testPassword  = "a good password"
+	testResetURL  = "https://syncup.example/reset-password"
+
+	testClientID     = "billing"
+	testClientSecret = "a service client secret"
+)
+
+type testServer struct {
+	*httptest.Server
+	deps     router.Deps
+	users    *memory.UserRepository
+	webhooks *memory.WebhookRepository
+	mail     *testMailer
+	doc      *openapi.Document
+}
+
+// testMailer keeps the emails the service sends.
+type testMailer struct {
+	mu   sync.Mutex
+	sent []mailer.Message
+}
+
+func (m *testMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func (m *testMailer) messages() []mailer.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return slices.Clone(m.sent)
+}
+
+// newTestServer serves router.New, as main builds it, with real handlers,
+// services and middleware on top of the in-memory repositories.
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	doc, err := openapi.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	users := memory.NewUserRepository()
+	sessions := memory.NewSessionRepository()
+	subject := 1
+	auditRepo := memory.NewAuditRepository()
+	if err := auditRepo.InsertAuthEvents(context.Background(), []model.AuthEvent{{
+		Type:      model.AuthEventLogin,
+		Outcome:   model.OutcomeSuccess,
+		SubjectID: &subject,
+		IP:        "192.0.2.1",
+		UserAgent: "Go-http-client/1.1",
+		CreatedAt: time.Now(),
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the cheapest bcrypt cost keeps the test fast
+	hasher, err := password.NewHasher(password.Config{Algorithm: password.AlgorithmBcrypt, BcryptCost: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := memory.NewTxManager(users, sessions, auditRepo, memory.NewDeviceRepository(), memory.NewOutboxRepository(), memory.NewTokenRepository())
+	mail := &testMailer{}
+	svc := service.NewUserService(users, sessions, logger, testJWTSecret,
+		service.WithPasswordHasher(hasher),
+		service.WithTxManager(tx),
+		service.WithPasswordReset(mail, testResetURL))
+	auditSvc := service.NewAuditService(auditRepo, audit.Nop{}, logger)
+	webhooks := memory.NewWebhookRepository()
+	webhookSvc := service.NewWebhookService(webhooks, audit.Nop{}, logger)
+	tracker := session.NewTracker(sessions, logger, time.Minute)
+	verifier := token.NewVerifier(users, sessions, tracker, logger, testJWTSecret)
+
+	probes := health.New(logger, time.Second)
+	probes.Register(health.NewChecker("database", func(ctx context.Context) error { return nil }))
+
+	deps := router.Deps{
+		Users:    handler.NewUserHandler(svc, logger),
+		Audit:    handler.NewAuditHandler(auditSvc, logger),
+		Webhooks: handler.NewWebhookHandler(webhookSvc, logger),
+		Auth:     middleware.NewMiddleware(verifier, logger),
+		Probes:   probes,
+		Logger:   logger,
+		Metrics:  metrics.New(),
+
+		Introspection:  handler.NewIntrospectionHandler(verifier, logger),
+		ServiceClients: middleware.ServiceClients{testClientID: testClientSecret},
+	}
+
+	srv := httptest.NewServer(router.New(deps))
+	t.Cleanup(srv.Close)
+
+	return &testServer{Server: srv, deps: deps, users: users, webhooks: webhooks, mail: mail, doc: doc}
+}
+
+// do sends req, checks the status and validates the response against
+// openapi.json, so every test doubles as a contract test.
+func (s *testServer) do(t *testing.T, req *http.Request, wantStatus int) []byte {
+	t.Helper()
+
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != wantStatus {
+		t.Fatalf("%s %s: expected %d, got %d: %s", req.Method, req.URL.Path, wantStatus, resp.StatusCode, b)
+	}
+	if err := s.doc.ValidateResponse(req.Method, req.URL.RequestURI(), resp.StatusCode, resp.Header, b); err != nil {
+		t.Errorf("%v\nbody: %s", err, b)
+	}
+
+	return b
+}
+
+// call sends body to path with token as bearer token, if any.
+func (s *testServer) call(t *testing.T, method, path, token, body string, wantStatus int) []byte {
+	t.Helper()
+
+	req, err := http.NewRequest(method, s.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return s.do(t, req, wantStatus)
+}
+
+func (s *testServer) register(t *testing.T, email string) {
+	t.Helper()
+	s.call(t, http.MethodPost, "/api/v1/register", "", credentials(email), http.StatusOK)
+}
+
+func (s *testServer) login(t *testing.T, email string) string {
+	t.Helper()
+
+	var resp helper.Response
+	b := s.call(t, http.MethodPost, "/api/v1/login", "", credentials(email), http.StatusOK)
+	if err := json.Unmarshal(b, &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	return resp.Data.(string)
+}
+
+// introspect posts token to /api/v1/introspect as the service client id
+// with secret, skipping authentication when id is empty.
+func (s *testServer) introspect(t *testing.T, id, secret, token string, wantStatus int) []byte {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, s.URL+"/api/v1/introspect", strings.NewReader(url.Values{"token": {token}}.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if id != "" {
+		req.SetBasicAuth(id, secret)
+	}
+
+	return s.do(t, req, wantStatus)
+}
+
+func credentials(email string) string {
+	return `{"email": "` + email + `", "password": "` + testPassword + `"}`
+}
+
+func problemCode(t *testing.T, body []byte) string {
+	t.Helper()
+
+	var problem helper.Problem
+	if err := json.Unmarshal(body, &problem); err != nil {
+		t.Fatalf("invalid problem %q: %v", body, err)
+	}
+
+	return problem.Code
+}
+
+func TestRoutesMatchOpenAPI(t *testing.T) {
+	doc, err := openapi.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var registered []string
+	for _, route := range router.Routes(newTestServer(t).deps) {
+		registered = append(registered, route.Pattern)
+	}
+	slices.Sort(registered)
+
+	if documented := doc.Operations(); !slices.Equal(registered, documented) {
+		t.Errorf("routes and openapi.json differ\nregistered: %v\ndocumented: %v", registered, documented)
+	}
+}
+
+func TestProblemCodesMatchOpenAPI(t *testing.T) {
+	var doc struct {
+		Components struct {
+			Schemas struct {
+				Problem struct {
+					Properties struct {
+						Code struct {
+							Enum []string `json:"enum"`
+						} `json:"code"`
+					} `json:"properties"`
+				} `json:"Problem"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(openapi.Spec(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	documented := doc.Components.Schemas.Problem.Properties.Code.Enum
+	codes := helper.ProblemCodes()
+	slices.Sort(documented)
+	slices.Sort(codes)
+	if !slices.Equal(codes, documented) {
+		t.Errorf("problem codes and openapi.json differ\ncode: %v\ndocumented: %v", codes, documented)
+	}
+}
+
+// Metrics are served on a listener of their own; the public port must not
+// give them away.
+func TestMetricsAreNotPublic(t *testing.T) {
+	srv := newTestServer(t)
+
+	resp, err := http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for /metrics, got %d", resp.StatusCode)
+	}
+}
+
+// Every response below, successful or not, must match openapi.json.
+func TestResponsesConformToOpenAPI(t *testing.T) {
+	srv := newTestServer(t)
+	call := srv.call
+
+	const email = "member@example.com"
+	const admin = "admin@example.com"
+
+	call(t, http.MethodGet, "/healthz", "", "", http.StatusOK)
+	call(t, http.MethodGet, "/readyz", "", "", http.StatusOK)
+	call(t, http.MethodGet, "/openapi.json", "", "", http.StatusOK)
+
+	srv.register(t, email)
+	srv.register(t, admin)
+	if err := srv.users.SetRole(admin, model.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+
+	call(t, http.MethodPost, "/api/v1/register", "", credentials(email), http.StatusConflict)
+	call(t, http.MethodPost, "/api/v1/register", "", `{"email": "nope"}`, http.StatusBadRequest)
+	call(t, http.MethodPost, "/api/v1/register", "", `not json`, http.StatusBadRequest)
+
+	call(t, http.MethodPost, "/api/v1/login", "", `{"email": "`+email+`", "password": "wrong"}`, http.StatusUnauthorized)
+	call(t, http.MethodPost, "/api/v1/login", "", `{"email": "ghost@example.com", "password": "wrong"}`, http.StatusNotFound)
+	token := srv.login(t, email)
+	adminToken := srv.login(t, admin)
+
+	call(t, http.MethodGet, "/api/v1/me", token, "", http.StatusOK)
+	call(t, http.MethodGet, "/api/v1/me", "", "", http.StatusUnauthorized)
+	call(t, http.MethodGet, "/api/v1/me", "not.a.token", "", http.StatusUnauthorized)
+
+	call(t, http.MethodGet, "/api/v1/me/sessions", token, "", http.StatusOK)
+	call(t, http.MethodDelete, "/api/v1/me/sessions/does-not-exist", token, "", http.StatusNotFound)
+
+	call(t, http.MethodGet, "/api/v1/me/security-events", token, "", http.StatusOK)
+	call(t, http.MethodGet, "/api/v1/me/security-events?limit=0", token, "", http.StatusBadRequest)
+	call(t, http.MethodGet, "/api/v1/admin/security-events", token, "", http.StatusForbidden)
+	call(t, http.MethodGet, "/api/v1/admin/security-events?user_id=1", adminToken, "", http.StatusOK)
+
+	const webhook = `{"url": "https://partner.example.com/hooks", "event_types": ["user.registered"], "description": "CRM sync"}`
+	call(t, http.MethodPost, "/api/v1/admin/webhooks", token, webhook, http.StatusForbidden)
+	call(t, http.MethodPost, "/api/v1/admin/webhooks", adminToken, `{"url": "ftp://partner.example.com", "event_types": ["user.exploded"]}`, http.StatusBadRequest)
+	call(t, http.MethodPost, "/api/v1/admin/webhooks", adminToken, `{"url": "https://partner.example.com/hooks", "event_types": ["user.deleted"]}`, http.StatusBadRequest)
+	var created struct {
+		Data struct {
+			ID int `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(call(t, http.MethodPost, "/api/v1/admin/webhooks", adminToken, webhook, http.StatusCreated), &created); err != nil {
+		t.Fatal(err)
+	}
+	hook := "/api/v1/admin/webhooks/" + strconv.Itoa(created.Data.ID)
+	call(t, http.MethodGet, "/api/v1/admin/webhooks", adminToken, "", http.StatusOK)
+	call(t, http.MethodGet, hook, adminToken, "", http.StatusOK)
+	call(t, http.MethodGet, "/api/v1/admin/webhooks/999", adminToken, "", http.StatusNotFound)
+
+	if _, err := srv.webhooks.EnqueueWebhookDeliveries(context.Background(), model.OutboxEvent{
+		ID:        1,
+		UserID:    1,
+		Type:      model.UserEventRegistered,
+		Payload:   []byte(`{"user_id": 1, "email": "member@example.com"}`),
+		CreatedAt: time.Now(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var deliveries struct {
+		Data struct {
+			Deliveries []struct {
+				ID int64 `json:"id"`
+			} `json:"deliveries"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(call(t, http.MethodGet, hook+"/deliveries", adminToken, "", http.StatusOK), &deliveries); err != nil {
+		t.Fatal(err)
+	}
+	delivery := hook + "/deliveries/" + strconv.FormatInt(deliveries.Data.Deliveries[0].ID, 10)
+	call(t, http.MethodGet, hook+"/deliveries?status=lost", adminToken, "", http.StatusBadRequest)
+	call(t, http.MethodGet, delivery, adminToken, "", http.StatusOK)
+	call(t, http.MethodGet, hook+"/deliveries/999", adminToken, "", http.StatusNotFound)
+	call(t, http.MethodPost, delivery+"/redeliver", adminToken, "", http.StatusAccepted)
+	call(t, http.MethodDelete, hook, adminToken, "", http.StatusOK)
+	call(t, http.MethodDelete, hook, adminToken, "", http.StatusNotFound)
+
+	srv.introspect(t, testClientID, testClientSecret, token, http.StatusOK)
+	srv.introspect(t, testClientID, testClientSecret, "not.a.token", http.StatusOK)
+	srv.introspect(t, testClientID, testClientSecret, "", http.StatusBadRequest)
+	srv.introspect(t, testClientID, "wrong secret", token, http.StatusUnauthorized)
+	srv.introspect(t, "", "", token, http.StatusUnauthorized)
+
+	call(t, http.MethodPost, "/api/v1/security/not-me", "", `{}`, http.StatusBadRequest)
+	call(t, http.MethodPost, "/api/v1/security/not-me", "", `{"token": "forged"}`, http.StatusBadRequest)
+	call(t, http.MethodPost, "/api/v1/password/forgot", "", `{}`, http.StatusBadRequest)
+	call(t, http.MethodPost, "/api/v1/password/forgot", "", `{"email": "nobody@example.com"}`, http.StatusOK)
+	call(t, http.MethodPost, "/api/v1/password/reset", "", `{}`, http.StatusBadRequest)
+	call(t, http.MethodPost, "/api/v1/password/reset", "", `{"token": "forged", "password": "x"}`, http.StatusBadRequest)
+
+	var sessions struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(call(t, http.MethodGet, "/api/v1/me/sessions", token, "", http.StatusOK), &sessions); err != nil {
+		t.Fatal(err)
+	}
+	call(t, http.MethodDelete, "/api/v1/me/sessions/"+sessions.Data[0].ID, token, "", http.StatusOK)
+	call(t, http.MethodGet, "/api/v1/me", token, "", http.StatusUnauthorized)
+}
+
+// The validator itself must reject responses that break the schema, or the
+// tests above prove nothing.
+func TestValidateResponseRejectsDrift(t *testing.T) {
+	doc, err := openapi.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := http.Header{"Content-Type": []string{"application/json"}}
+
+	bodies := map[string]string{
+		"missing field":   `{"message": "ok", "data": {"id": 1}}`,
+		"wrong type":      `{"message": "ok", "data": {"id": "1", "email": "a@example.com"}}`,
+		"undocumented":    `{"message": "ok", "data": {"id": 1, "email": "a@example.com", "role": "user"}}`,
+		"not an envelope": `[]`,
+	}
+	for name, body := range bodies {
+		if err := doc.ValidateResponse(http.MethodGet, "/api/v1/me", http.StatusOK, header, []byte(body)); err == nil {
+			t.Errorf("%s: expected %s to be rejected", name, body)
+		}
+	}
+
+	if err := doc.ValidateResponse(http.MethodGet, "/api/v1/me", http.StatusTeapot, header, []byte(`{}`)); err == nil {
+		t.Error("expected an undocumented status to be rejected")
+	}
+	if err := doc.ValidateResponse(http.MethodGet, "/api/v1/me", http.StatusOK, http.Header{}, []byte(`{}`)); err == nil {
+		t.Error("expected an undocumented content type to be rejected")
+	}
+}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	Addr              string
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// ShutdownTimeout bounds the whole shutdown: the delay, draining
+	// in-flight requests and waiting for workers to flush. Closers run
+	// after it even if something is still unfinished.
+	ShutdownTimeout time.Duration
+	// ShutdownDelay keeps serving for a while after the OnShutdown hooks
+	// ran, so load balancers see the failing readiness probe before the
+	// listener goes away.
+	ShutdownDelay time.Duration
+}
+
+// Worker is a background task that runs until its context is cancelled.
+type Worker interface {
+	Run(ctx context.Context)
+}
+
+// Server owns the HTTP server and everything that has to be stopped with it.
+// On shutdown it drains HTTP and any OnDrain listeners first, then stops the
+// workers (which may still need the database to flush), and finally runs the
+// closers in reverse order of registration.
+type Server struct {
+	http            *http.Server
+	logger          *slog.Logger
+	shutdownTimeout time.Duration
+	shutdownDelay   time.Duration
+
+	workers    []Worker
+	onShutdown []func()
+	drainers   []func(ctx context.Context)
+	closers    []func()
+}
+
+func New(config Config, handler http.Handler, logger *slog.Logger) *Server {
+	return &Server{
+		http: &http.Server{
+			Addr:              config.Addr,
+			Handler:           handler,
+			ReadHeaderTimeout: config.ReadHeaderTimeout,
+			ReadTimeout:       config.ReadTimeout,
+			WriteTimeout:      config.WriteTimeout,
+			IdleTimeout:       config.IdleTimeout,
+			ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelError),
+		},
+		logger:          logger,
+		shutdownTimeout: config.ShutdownTimeout,
+		shutdownDelay:   config.ShutdownDelay,
+	}
+}
+
+func (s *Server) AddWorker(w Worker) {
+	s.workers = append(s.workers, w)
+}
+
+// OnShutdown registers f to run as soon as shutdown begins, before requests
+// are drained.
+func (s *Server) OnShutdown(f func()) {
+	s.onShutdown = append(s.onShutdown, f)
+}
+
+// OnDrain registers f to drain another listener, such as a gRPC server,
+// alongside HTTP. f must return by the time ctx, which carries the shutdown
+// deadline, is done; workers are stopped only after every f returned.
+func (s *Server) OnDrain(f func(ctx context.Context)) {
+	s.drainers = append(s.drainers, f)
+}
+
+// AddCloser registers f to run after HTTP is drained and workers stopped.
+func (s *Server) AddCloser(f func()) {
+	s.closers = append(s.closers, f)
+}
+
+// Run listens on the configured address and serves until ctx is cancelled.
+func (s *Server) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.http.Addr)
+	if err != nil {
+		s.stop(nil)
+		return fmt.Errorf("failed while listening on %s: %w", s.http.Addr, err)
+	}
+
+	return s.Serve(ctx, ln)
+}
+
+// Serve is Run on an existing listener.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	workerCtx, cancelWorkers := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for _, w := range s.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.Run(workerCtx)
+		}()
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		s.logger.Info("Starting server", "addr", ln.Addr().String())
+		serveErr <- s.http.Serve(ln)
+	}()
+
+	var err error
+	var shutdownCtx context.Context
+	var cancel context.CancelFunc
+	select {
+	case err = <-serveErr:
+		// the server failed on its own, nothing left to drain
+		s.logger.Error("Server stopped unexpectedly", "error", err)
+
+		shutdownCtx, cancel = context.WithTimeout(context.Background(), s.shutdownTimeout)
+		s.drain(shutdownCtx).Wait()
+	case <-ctx.Done():
+		s.logger.Info("Shutting down, draining in-flight requests", "timeout", s.shutdownTimeout)
+		// one deadline covers every step, so the process exits within the
+		// timeout however the time is split between them
+		shutdownCtx, cancel = context.WithTimeout(context.Background(), s.shutdownTimeout)
+		for _, f := range s.onShutdown {
+			f()
+		}
+		select {
+		case <-time.After(s.shutdownDelay):
+		case <-shutdownCtx.Done():
+		}
+
+		drained := s.drain(shutdownCtx)
+		err = s.http.Shutdown(shutdownCtx)
+		drained.Wait()
+
+		if err != nil {
+			s.logger.Error("Failed to drain in-flight requests before the deadline", "error", err)
+			s.http.Close()
+		}
+
+		if serveErr := <-serveErr; !errors.Is(serveErr, http.ErrServerClosed) {
+			err = errors.Join(err, serveErr)
+		}
+	}
+
+	defer cancel()
+
+	s.stop(func() {
+		cancelWorkers()
+		stopped := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+			s.logger.Info("Background workers stopped")
+		case <-shutdownCtx.Done():
+			s.logger.Error("Failed to stop background workers before the deadline")
+		}
+	})
+
+	return err
+}
+
+// drain starts every drainer and returns a WaitGroup that is done once they
+// all returned.
+func (s *Server) drain(ctx context.Context) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	for _, f := range s.drainers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f(ctx)
+		}()
+	}
+
+	return &wg
+}
+
+func (s *Server) stop(stopWorkers func()) {
+	if stopWorkers != nil {
+		stopWorkers()
+	}
+
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		s.closers[i]()
+	}
+}
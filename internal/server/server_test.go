@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingWorker struct {
+	record func(string)
+}
+
+func (w *recordingWorker) Run(ctx context.Context) {
+	<-ctx.Done()
+	w.record("worker stopped")
+}
+
+// stuckWorker ignores cancellation until the test ends.
+type stuckWorker struct {
+	release chan struct{}
+}
+
+func (w *stuckWorker) Run(ctx context.Context) {
+	<-w.release
+}
+
+func TestShutdownDrainsSlowRequest(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	started := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(300 * time.Millisecond)
+		io.WriteString(w, "done")
+	})
+
+	var mu sync.Mutex
+	var events []string
+	record := func(event string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}
+
+	srv := New(Config{
+		ReadHeaderTimeout: time.Second,
+		ReadTimeout:       time.Second,
+		WriteTimeout:      time.Second,
+		IdleTimeout:       time.Second,
+		ShutdownTimeout:   5 * time.Second,
+	}, mux, logger)
+
+	srv.AddWorker(&recordingWorker{record: record})
+	srv.OnShutdown(func() { record("shutdown started") })
+	srv.OnDrain(func(ctx context.Context) {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("expected drain context to carry the shutdown timeout")
+		}
+		record("grpc drained")
+	})
+	srv.AddCloser(func() { record("pool closed") })
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- srv.Serve(ctx, ln)
+	}()
+
+	type result struct {
+		status int
+		body   string
+		err    error
+	}
+	response := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/slow")
+		if err != nil {
+			response <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		response <- result{status: resp.StatusCode, body: string(body), err: err}
+	}()
+
+	<-started
+	cancel()
+
+	res := <-response
+	if res.err != nil {
+		t.Fatalf("in-flight request failed during shutdown: %v", res.err)
+	}
+	if res.status != http.StatusOK || res.body != "done" {
+		t.Errorf("unexpected response %d %q", res.status, res.body)
+	}
+
+	if err := <-runErr; err != nil {
+		t.Fatalf("expected clean shutdown, got %v", err)
+	}
+
+	if _, err := net.DialTimeout("tcp", addr, 200*time.Millisecond); err == nil {
+		t.Error("expected listener to be closed after shutdown")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"shutdown started", "grpc drained", "worker stopped", "pool closed"}
+	if len(events) != len(want) {
+		t.Fatalf("expected events %v, got %v", want, events)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("expected events %v, got %v", want, events)
+			break
+		}
+	}
+}
+
+func TestShutdownStaysWithinTimeout(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	srv := New(Config{
+		ShutdownTimeout: 300 * time.Millisecond,
+		ShutdownDelay:   100 * time.Millisecond,
+	}, http.NewServeMux(), logger)
+
+	worker := &stuckWorker{release: make(chan struct{})}
+	t.Cleanup(func() { close(worker.release) })
+	srv.AddWorker(worker)
+
+	var drainDeadline time.Time
+	srv.OnDrain(func(ctx context.Context) {
+		drainDeadline, _ = ctx.Deadline()
+		<-ctx.Done()
+	})
+	closed := make(chan struct{})
+	srv.AddCloser(func() { close(closed) })
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- srv.Serve(ctx, ln)
+	}()
+
+	start := time.Now()
+	cancel()
+
+	select {
+	case <-runErr:
+	case <-time.After(2 * time.Second):
+		t.Fatal("shutdown did not finish, expected the stuck worker to be given up on")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected shutdown to take about the 300ms timeout, took %v", elapsed)
+	}
+	if got := drainDeadline.Sub(start); got > 350*time.Millisecond {
+		t.Errorf("expected the drain deadline to include the delay, got %v after shutdown started", got)
+	}
+
+	select {
+	case <-closed:
+	default:
+		t.Error("expected closers to run after the deadline")
+	}
+}
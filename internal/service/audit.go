@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/dosedaf/syncup-users-service/internal/audit"
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/dosedaf/syncup-users-service/internal/repository"
+)
+
+type AuditServiceInstance interface {
+	ListUserEvents(ctx context.Context, userID int, filter model.AuthEventFilter) ([]model.AuthEvent, error)
+	ListEvents(ctx context.Context, admin *model.User, filter model.AuthEventFilter, client model.ClientInfo) ([]model.AuthEvent, error)
+}
+
+type AuditService struct {
+	repository repository.AuditRepositoryInstance
+	recorder   audit.RecorderInstance
+	logger     *slog.Logger
+}
+
+func NewAuditService(repo repository.AuditRepositoryInstance, recorder audit.RecorderInstance, logger *slog.Logger) AuditServiceInstance {
+	return &AuditService{
+		repository: repo,
+		recorder:   recorder,
+		logger:     logger,
+	}
+}
+
+// ListUserEvents returns security events about the given user's own account.
+// Any subject in the filter is overridden.
+func (s *AuditService) ListUserEvents(ctx context.Context, userID int, filter model.AuthEventFilter) ([]model.AuthEvent, error) {
+	filter.SubjectID = &userID
+	filter.ActorID = nil
+
+	events, err := s.repository.ListAuthEvents(ctx, filter)
+	if err != nil {
+		s.logger.ErrorContext(ctx,
+			"Failed while listing security events",
+			"user_id", userID,
+			"error", err,
+		)
+
+		return nil, fmt.Errorf("failed while listing security events for user %d: %w", userID, err)
+	}
+
+	return events, nil
+}
+
+// ListEvents queries the whole audit log. The query itself is audited since
+// the log contains other users' personal data.
+func (s *AuditService) ListEvents(ctx context.Context, admin *model.User, filter model.AuthEventFilter, client model.ClientInfo) ([]model.AuthEvent, error) {
+	events, err := s.repository.ListAuthEvents(ctx, filter)
+	if err != nil {
+		s.logger.ErrorContext(ctx,
+			"Failed while querying audit log",
+			"admin_id", admin.ID,
+			"error", err,
+		)
+
+		s.recorder.Record(model.AuthEvent{
+			Type:      model.AuthEventAdminAction,
+			Outcome:   model.OutcomeFailure,
+			Reason:    "audit_query",
+			ActorID:   &admin.ID,
+			SubjectID: filter.SubjectID,
+			IP:        client.IP,
+			UserAgent: client.UserAgent,
+		})
+
+		return nil, fmt.Errorf("failed while querying audit log: %w", err)
+	}
+
+	s.recorder.Record(model.AuthEvent{
+		Type:      model.AuthEventAdminAction,
+		Outcome:   model.OutcomeSuccess,
+		Reason:    "audit_query",
+		ActorID:   &admin.ID,
+		SubjectID: filter.SubjectID,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+	})
+
+	return events, nil
+}
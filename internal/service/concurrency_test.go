@@ -0,0 +1,258 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/helper"
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/dosedaf/syncup-users-service/internal/password"
+	"github.com/dosedaf/syncup-users-service/internal/repository"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// fakeDB is a concurrency-safe stand-in for the connection pool that
+// understands just the statements registration and login issue. It lets the
+// real repositories run under heavy parallelism without a database.
+type fakeDB struct {
+	mu       sync.Mutex
+	users    map[string]*model.User
+	sessions map[string]*model.Session
+	nextID   int
+}
+
+func newFakeDB() *fakeDB {
+	return &fakeDB{
+		users:    make(map[string]*model.User),
+		sessions: make(map[string]*model.Session),
+	}
+}
+
+type fakeRow struct {
+	values []any
+	err    error
+}
+
+func (r fakeRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+
+	if len(dest) != len(r.values) {
+		return fmt.Errorf("fake row has %d values, scanned into %d", len(r.values), len(dest))
+	}
+
+	for i, d := range dest {
+		reflect.ValueOf(d).Elem().Set(reflect.ValueOf(r.values[i]))
+	}
+
+	return nil
+}
+
+func (db *fakeDB) Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, fmt.Errorf("fakeDB: unsupported exec %q", sql)
+}
+
+func (db *fakeDB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return nil, fmt.Errorf("fakeDB: unsupported query %q", sql)
+}
+
+func (db *fakeDB) QueryRow(ctx context.Context, sql string, arguments ...any) pgx.Row {
+	args := arguments[0].(pgx.NamedArgs)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	switch {
+	case strings.HasPrefix(sql, "INSERT INTO users"):
+		// users are keyed like the unique index on lower(email)
+		email := args["email"].(string)
+		if _, exists := db.users[strings.ToLower(email)]; exists {
+			return fakeRow{err: &pgconn.PgError{Code: "23505"}}
+		}
+
+		db.nextID++
+		hash := args["password_hash"].(string)
+		user := &model.User{
+			ID:            db.nextID,
+			Email:         email,
+			PasswordHash:  &hash,
+			PepperVersion: args["pepper_version"].(int),
+			Role:          model.RoleUser,
+			CreatedAt:     time.Now(),
+		}
+		db.users[strings.ToLower(email)] = user
+		return userRow(user)
+
+	case strings.HasPrefix(sql, "SELECT email FROM users"):
+		user, ok := db.users[strings.ToLower(args["email"].(string))]
+		if !ok {
+			return fakeRow{err: pgx.ErrNoRows}
+		}
+		return fakeRow{values: []any{user.Email}}
+
+	case strings.HasPrefix(sql, "SELECT id, email, password_hash"):
+		user, ok := db.users[strings.ToLower(args["email"].(string))]
+		if !ok {
+			return fakeRow{err: pgx.ErrNoRows}
+		}
+		return userRow(user)
+
+	case strings.HasPrefix(sql, "INSERT INTO sessions"):
+		now := time.Now()
+		id := args["id"].(string)
+		if _, exists := db.sessions[id]; exists {
+			return fakeRow{err: &pgconn.PgError{Code: "23505"}}
+		}
+
+		db.sessions[id] = &model.Session{
+			ID:         id,
+			UserID:     args["user_id"].(int),
+			CreatedAt:  now,
+			LastSeenAt: now,
+			ExpiresAt:  args["expires_at"].(time.Time),
+		}
+		return fakeRow{values: []any{now, now}}
+	}
+
+	return fakeRow{err: fmt.Errorf("fakeDB: unsupported query row %q", sql)}
+}
+
+func userRow(user *model.User) fakeRow {
+	return fakeRow{values: []any{
+		user.ID,
+		user.Email,
+		user.PasswordHash,
+		user.PepperVersion,
+		user.Role,
+		user.PasswordResetRequired,
+		user.CreatedAt,
+		user.UpdatedAt,
+	}}
+}
+
+func (db *fakeDB) CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error) {
+	return 0, errors.New("fakeDB: copy not supported")
+}
+
+func TestConcurrentRegisterAndLogin(t *testing.T) {
+	const workers = 64
+
+	db := newFakeDB()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	config := password.DefaultConfig()
+	config.BcryptCost = 4
+	hasher, err := password.NewHasher(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := NewUserService(
+		repository.NewUserRepository(db, logger),
+		repository.NewSessionRepository(db, logger),
+		logger,
+		"dummy scretaljwlkdjflsjdfjldjf",
+		WithPasswordHasher(hasher),
+	)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			credential := model.Credential{
+				Email:    fmt.Sprintf("user%d@gmail.com", i),
+				Password: fmt.Sprintf("password-%d", i),
+			}
+			client := model.ClientInfo{UserAgent: "test", IP: "127.0.0.1"}
+
+			if err := service.Register(context.Background(), credential, client); err != nil {
+				errs <- fmt.Errorf("register %s: %w", credential.Email, err)
+				return
+			}
+
+			if _, err := service.Login(context.Background(), credential, client); err != nil {
+				errs <- fmt.Errorf("login %s: %w", credential.Email, err)
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if len(db.users) != workers || len(db.sessions) != workers {
+		t.Errorf("expected %d users and sessions, got %d and %d", workers, len(db.users), len(db.sessions))
+	}
+}
+
+// Registrations that race past the availability check are stopped by the
+// unique index, so exactly one wins and the rest get a conflict.
+func TestConcurrentRegisterSameEmail(t *testing.T) {
+	const workers = 32
+
+	db := newFakeDB()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	config := password.DefaultConfig()
+	config.BcryptCost = 4
+	hasher, err := password.NewHasher(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := NewUserService(
+		repository.NewUserRepository(db, logger),
+		repository.NewSessionRepository(db, logger),
+		logger,
+		"dummy scretaljwlkdjflsjdfjldjf",
+		WithPasswordHasher(hasher),
+	)
+
+	var wg sync.WaitGroup
+	errs := make([]error, workers)
+	start := make(chan struct{})
+	for i := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			email := "same@gmail.com"
+			if i%2 == 1 {
+				email = "Same@Gmail.com"
+			}
+			<-start
+			errs[i] = service.Register(context.Background(), model.Credential{Email: email, Password: "password"}, model.ClientInfo{})
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	winners := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			winners++
+		case !errors.Is(err, helper.ErrEmailAlreadyExists):
+			t.Errorf("expected losers to get ErrEmailAlreadyExists, got %v", err)
+		}
+	}
+	if winners != 1 || len(db.users) != 1 {
+		t.Errorf("expected exactly one registration to succeed, got %d winners and %d users", winners, len(db.users))
+	}
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/helper"
+	"github.com/dosedaf/syncup-users-service/internal/device"
+	"github.com/dosedaf/syncup-users-service/internal/mailer"
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/dosedaf/syncup-users-service/internal/repository"
+)
+
+const (
+	notMePurpose  = "not_me"
+	notMeTokenTTL = 7 * 24 * time.Hour
+)
+
+// WithDeviceAlerts emails users when they log in from a device they have not
+// used before. m should queue rather than send, as mailer.Queue does, since
+// alerts are sent from inside Login. notMeURL is the page the "this wasn't
+// me" link points to; it receives the report token as ?token= and should
+// POST it back to /api/v1/security/not-me, so that link scanners
+// prefetching the URL cannot lock the account.
+func WithDeviceAlerts(devices repository.DeviceRepositoryInstance, m mailer.Mailer, notMeURL string) Option {
+	return func(s *Service) {
+		s.devices = devices
+		s.mailer = m
+		s.notMeURL = notMeURL
+	}
+}
+
+// checkDevice remembers the client the user logged in from and sends an alert
+// when it is new. Failures are logged and never block the login.
+func (s *Service) checkDevice(ctx context.Context, user *model.User, client model.ClientInfo) {
+	if s.devices == nil {
+		return
+	}
+
+	fingerprint := device.FromClient(client)
+
+	known, err := s.devices.ListKnownDevices(ctx, user.ID)
+	if err != nil {
+		s.logger.ErrorContext(ctx,
+			"Failed while listing known devices",
+			"user_id", user.ID,
+			"error", err,
+		)
+		return
+	}
+
+	decision := device.Decide(known, fingerprint)
+
+	err = s.devices.UpsertKnownDevice(ctx, model.KnownDevice{
+		UserID:      user.ID,
+		Fingerprint: fingerprint.String(),
+		UAFamily:    fingerprint.UAFamily,
+		IPPrefix:    fingerprint.IPPrefix,
+	})
+	if err != nil {
+		s.logger.ErrorContext(ctx,
+			"Failed while saving known device",
+			"user_id", user.ID,
+			"error", err,
+		)
+	}
+
+	if !decision.Notify {
+		return
+	}
+
+	s.logger.InfoContext(ctx,
+		"Login from new device",
+		"user_id", user.ID,
+		"ua_family", fingerprint.UAFamily,
+		"ip_prefix", fingerprint.IPPrefix,
+	)
+
+	if err := s.sendNewDeviceAlert(ctx, user, fingerprint); err != nil {
+		s.logger.ErrorContext(ctx,
+			"Failed while sending new device alert",
+			"user_id", user.ID,
+			"error", err,
+		)
+	}
+}
+
+func (s *Service) sendNewDeviceAlert(ctx context.Context, user *model.User, fingerprint device.Fingerprint) error {
+	token, err := s.signEmailToken(user.Email, notMePurpose, notMeTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	link := s.notMeURL + "?token=" + url.QueryEscape(token)
+
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "New sign-in to your SyncUp account",
+		Body: fmt.Sprintf(
+			"Your account was just signed in to from %s on network %s.\n\n"+
+				"If this was you, you can ignore this email.\n\n"+
+				"If this wasn't you, open the link below to sign out everywhere and reset your password:\n%s\n",
+			fingerprint.UAFamily,
+			fingerprint.IPPrefix,
+			link,
+		),
+	})
+}
+
+// ReportNotMe handles the "this wasn't me" link from a new device alert. It
+// revokes every session of the account and requires a password reset before
+// the next login. Each report token is accepted once.
+func (s *Service) ReportNotMe(ctx context.Context, tokenStr string, client model.ClientInfo) error {
+	token, err := s.parseEmailToken(ctx, tokenStr, notMePurpose)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.repository.GetUserByEmail(ctx, token.email)
+	if err != nil {
+		if errors.Is(err, helper.ErrUserNotFound) {
+			return helper.ErrInvalidToken
+		}
+
+		s.logger.ErrorContext(ctx,
+			"Failed while getting user by email",
+			"email", token.email,
+			"error", err,
+		)
+		return fmt.Errorf("failed while getting user %s: %w", token.email, err)
+	}
+
+	// a lockout that revokes sessions but leaves the password usable, or the
+	// other way round, would be worse than none
+	err = s.tx.WithinTx(ctx, func(ctx context.Context, repos repository.Repositories) error {
+		// used up in the same transaction, so a failed lockout can be retried
+		// with the same link
+		if err := token.use(ctx, repos); err != nil {
+			return err
+		}
+		if err := repos.Sessions.RevokeAllSessions(ctx, user.ID); err != nil {
+			return fmt.Errorf("failed while revoking sessions for user %d: %w", user.ID, err)
+		}
+		if err := repos.Users.SetPasswordResetRequired(ctx, user.ID, true); err != nil {
+			return fmt.Errorf("failed while requiring password reset for user %d: %w", user.ID, err)
+		}
+		return nil
+	})
+	if errors.Is(err, helper.ErrInvalidToken) {
+		s.logger.InfoContext(ctx, "Rejected reused report token", "user_id", user.ID)
+		return err
+	}
+	if err != nil {
+		s.logger.ErrorContext(ctx,
+			"Failed while locking account",
+			"user_id", user.ID,
+			"error", err,
+		)
+		return err
+	}
+
+	s.logger.InfoContext(ctx, "Account locked after unrecognised login report", "user_id", user.ID)
+	s.audit.Record(authEvent(model.AuthEventNotMeReport, model.OutcomeSuccess, "", &user.ID, user.Email, client))
+
+	return nil
+}
@@ -0,0 +1,313 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/helper"
+	"github.com/dosedaf/syncup-users-service/internal/mailer"
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/dosedaf/syncup-users-service/internal/repository"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type mockDeviceRepo struct {
+	MockListKnownDevices  func(ctx context.Context, userID int) ([]model.KnownDevice, error)
+	MockUpsertKnownDevice func(ctx context.Context, device model.KnownDevice) error
+}
+
+func (m *mockDeviceRepo) ListKnownDevices(ctx context.Context, userID int) ([]model.KnownDevice, error) {
+	return m.MockListKnownDevices(ctx, userID)
+}
+
+func (m *mockDeviceRepo) UpsertKnownDevice(ctx context.Context, device model.KnownDevice) error {
+	return m.MockUpsertKnownDevice(ctx, device)
+}
+
+// mockTokenRepo remembers used token ids like the real repositories do.
+type mockTokenRepo struct {
+	used map[string]bool
+}
+
+func (m *mockTokenRepo) UseToken(ctx context.Context, id string, expiresAt time.Time) error {
+	if m.used[id] {
+		return helper.ErrInvalidToken
+	}
+	if m.used == nil {
+		m.used = make(map[string]bool)
+	}
+	m.used[id] = true
+	return nil
+}
+
+func (m *mockTokenRepo) PruneUsedTokens(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+// mockTxManager hands fn the repositories a real transaction would bind to
+// its connection and reports whether the unit of work committed.
+type mockTxManager struct {
+	repos     repository.Repositories
+	committed bool
+}
+
+func (m *mockTxManager) WithinTx(ctx context.Context, fn func(ctx context.Context, repos repository.Repositories) error) error {
+	err := fn(ctx, m.repos)
+	m.committed = err == nil
+	return err
+}
+
+type mockMailer struct {
+	sent []mailer.Message
+}
+
+func (m *mockMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func TestLoginFromNewDeviceSendsAlert(t *testing.T) {
+	credential := model.Credential{
+		Email:    "test@gmail.com",
+		Password: "test",
+	}
+	client := model.ClientInfo{
+		UserAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:127.0) Gecko/20100101 Firefox/127.0",
+		IP:        "198.51.100.7",
+	}
+
+	mock := &mockRepo{
+		MockGetUserByEmail: func(ctx context.Context, email string) (*model.User, error) {
+			return userWithHash(email, "$2a$10$LpieyNVgH6lpdKZr.bKwPOBR0m.TcppenjlPKWEm5WtUMtPk.ziry", 0), nil
+		},
+	}
+
+	var saved model.KnownDevice
+	devices := &mockDeviceRepo{
+		MockListKnownDevices: func(ctx context.Context, userID int) ([]model.KnownDevice, error) {
+			return []model.KnownDevice{{UserID: userID, Fingerprint: "Chrome/Windows|203.0.113.0/24"}}, nil
+		},
+		MockUpsertKnownDevice: func(ctx context.Context, device model.KnownDevice) error {
+			saved = device
+			return nil
+		},
+	}
+	m := &mockMailer{}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	service := NewUserService(mock, &mockSessionRepo{}, logger, "dummy scretaljwlkdjflsjdfjldjf",
+		WithDeviceAlerts(devices, m, "https://syncup.example/security/not-me"))
+	if _, err := service.Login(context.Background(), credential, client); err != nil {
+		t.Fatal(err)
+	}
+
+	if saved.Fingerprint != "Firefox/Linux|198.51.100.0/24" {
+		t.Errorf("unexpected saved device %+v", saved)
+	}
+
+	if len(m.sent) != 1 {
+		t.Fatalf("expected one alert, got %d", len(m.sent))
+	}
+	if m.sent[0].To != credential.Email || !strings.Contains(m.sent[0].Body, "https://syncup.example/security/not-me?token=") {
+		t.Errorf("unexpected alert %+v", m.sent[0])
+	}
+}
+
+func TestLoginFromKnownDeviceDoesNotAlert(t *testing.T) {
+	credential := model.Credential{
+		Email:    "test@gmail.com",
+		Password: "test",
+	}
+	client := model.ClientInfo{UserAgent: "curl/8.5.0", IP: "203.0.113.9"}
+
+	mock := &mockRepo{
+		MockGetUserByEmail: func(ctx context.Context, email string) (*model.User, error) {
+			return userWithHash(email, "$2a$10$LpieyNVgH6lpdKZr.bKwPOBR0m.TcppenjlPKWEm5WtUMtPk.ziry", 0), nil
+		},
+	}
+	devices := &mockDeviceRepo{
+		MockListKnownDevices: func(ctx context.Context, userID int) ([]model.KnownDevice, error) {
+			return []model.KnownDevice{{UserID: userID, Fingerprint: "curl/other|203.0.113.0/24"}}, nil
+		},
+		MockUpsertKnownDevice: func(ctx context.Context, device model.KnownDevice) error { return nil },
+	}
+	m := &mockMailer{}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	service := NewUserService(mock, &mockSessionRepo{}, logger, "dummy scretaljwlkdjflsjdfjldjf",
+		WithDeviceAlerts(devices, m, "https://syncup.example/security/not-me"))
+	if _, err := service.Login(context.Background(), credential, client); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.sent) != 0 {
+		t.Errorf("expected no alert, got %d", len(m.sent))
+	}
+}
+
+func TestReportNotMeRevokesSessionsAndRequiresReset(t *testing.T) {
+	credential := model.Credential{
+		Email:    "test@gmail.com",
+		Password: "test",
+	}
+
+	resetRequired := false
+	mock := &mockRepo{
+		MockGetUserByEmail: func(ctx context.Context, email string) (*model.User, error) {
+			user := userWithHash(email, "$2a$10$LpieyNVgH6lpdKZr.bKwPOBR0m.TcppenjlPKWEm5WtUMtPk.ziry", 0)
+			user.PasswordResetRequired = resetRequired
+			return user, nil
+		},
+		MockSetPasswordResetRequired: func(ctx context.Context, userID int, required bool) error {
+			resetRequired = required
+			return nil
+		},
+	}
+
+	revokedAll := false
+	sessions := &mockSessionRepo{
+		MockRevokeAllSessions: func(ctx context.Context, userID int) error {
+			revokedAll = true
+			return nil
+		},
+	}
+	devices := &mockDeviceRepo{
+		MockListKnownDevices: func(ctx context.Context, userID int) ([]model.KnownDevice, error) {
+			return []model.KnownDevice{{Fingerprint: "somewhere else"}}, nil
+		},
+		MockUpsertKnownDevice: func(ctx context.Context, device model.KnownDevice) error { return nil },
+	}
+	m := &mockMailer{}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	service := NewUserService(mock, sessions, logger, "dummy scretaljwlkdjflsjdfjldjf",
+		WithDeviceAlerts(devices, m, "https://syncup.example/security/not-me"),
+		WithUsedTokens(&mockTokenRepo{}))
+	if _, err := service.Login(context.Background(), credential, model.ClientInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.sent) != 1 {
+		t.Fatalf("expected one alert, got %d", len(m.sent))
+	}
+
+	body := m.sent[0].Body
+	rawURL := strings.TrimSpace(body[strings.Index(body, "https://"):])
+	link, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.ReportNotMe(context.Background(), link.Query().Get("token"), model.ClientInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	if !revokedAll || !resetRequired {
+		t.Errorf("expected sessions revoked and reset required, got %v, %v", revokedAll, resetRequired)
+	}
+
+	// a leaked link must not lock the account again after it was reset
+	if err := service.ReportNotMe(context.Background(), link.Query().Get("token"), model.ClientInfo{}); !errors.Is(err, helper.ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken for a reused report token, got %v", err)
+	}
+
+	if _, err := service.Login(context.Background(), credential, model.ClientInfo{}); !errors.Is(err, helper.ErrPasswordResetRequired) {
+		t.Errorf("expected ErrPasswordResetRequired, got %v", err)
+	}
+}
+
+func TestReportNotMeRejectsLoginToken(t *testing.T) {
+	credential := model.Credential{
+		Email:    "test@gmail.com",
+		Password: "test",
+	}
+
+	mock := &mockRepo{
+		MockGetUserByEmail: func(ctx context.Context, email string) (*model.User, error) {
+			return userWithHash(email, "$2a$10$LpieyNVgH6lpdKZr.bKwPOBR0m.TcppenjlPKWEm5WtUMtPk.ziry", 0), nil
+		},
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	service := NewUserService(mock, &mockSessionRepo{}, logger, "dummy scretaljwlkdjflsjdfjldjf")
+	loginToken, err := service.Login(context.Background(), credential, model.ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.ReportNotMe(context.Background(), loginToken, model.ClientInfo{}); !errors.Is(err, helper.ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken, got %v", err)
+	}
+}
+
+func TestReportNotMeWithoutUsedTokens(t *testing.T) {
+	const secret = "dummy scretaljwlkdjflsjdfjldjf"
+
+	user := userWithHash("test@gmail.com", "hash", 0)
+	mock := &mockRepo{
+		MockGetUserByEmail: func(ctx context.Context, email string) (*model.User, error) { return user, nil },
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	service := NewUserService(mock, &mockSessionRepo{}, logger, secret)
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":     user.Email,
+		"purpose": notMePurpose,
+		"jti":     "report-1",
+		"exp":     time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.ReportNotMe(context.Background(), token, model.ClientInfo{}); err == nil || errors.Is(err, helper.ErrInvalidToken) {
+		t.Errorf("expected a configuration error, got %v", err)
+	}
+}
+
+func TestReportNotMeLocksAccountAtomically(t *testing.T) {
+	const secret = "dummy scretaljwlkdjflsjdfjldjf"
+
+	user := userWithHash("test@gmail.com", "hash", 0)
+	errWrite := errors.New("write failed")
+
+	// the service's own repositories must not be written to; only the ones
+	// bound to the transaction
+	outside := &mockRepo{
+		MockGetUserByEmail: func(ctx context.Context, email string) (*model.User, error) { return user, nil },
+	}
+	tx := &mockTxManager{repos: repository.Repositories{
+		Users: &mockRepo{
+			MockSetPasswordResetRequired: func(ctx context.Context, userID int, required bool) error { return errWrite },
+		},
+		Sessions: &mockSessionRepo{
+			MockRevokeAllSessions: func(ctx context.Context, userID int) error { return nil },
+		},
+		Tokens: &mockTokenRepo{},
+	}}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	service := NewUserService(outside, &mockSessionRepo{}, logger, secret, WithTxManager(tx))
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":     user.Email,
+		"purpose": notMePurpose,
+		"jti":     "report-1",
+		"exp":     time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.ReportNotMe(context.Background(), token, model.ClientInfo{}); !errors.Is(err, errWrite) {
+		t.Errorf("expected the failed write to be returned, got %v", err)
+	}
+	if tx.committed {
+		t.Error("expected the unit of work to roll back when one write fails")
+	}
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/dosedaf/syncup-users-service/internal/repository"
+)
+
+// recordUserEvent adds a lifecycle event about user to the outbox, from where
+// the relay publishes it. It has to run in the unit of work that made the
+// change, so the event is committed exactly when the change is. Without a
+// transaction manager the service has no outbox and records nothing.
+func recordUserEvent(ctx context.Context, repos repository.Repositories, eventType string, user *model.User) error {
+	if repos.Outbox == nil {
+		return nil
+	}
+
+	payload, err := json.Marshal(model.UserEventPayload{
+		UserID: user.ID,
+		Email:  user.Email,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = repos.Outbox.InsertOutboxEvent(ctx, &model.OutboxEvent{
+		UserID:  user.ID,
+		Type:    eventType,
+		Payload: payload,
+	})
+	if err != nil {
+		return fmt.Errorf("failed while recording %s event: %w", eventType, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/dosedaf/syncup-users-service/helper"
+	"github.com/dosedaf/syncup-users-service/internal/logging"
+	"github.com/dosedaf/syncup-users-service/internal/model"
+)
+
+// Every service path below logs the email; none of it may reach the output
+// once the handler from main is in place.
+func TestServiceLogsNoRawEmail(t *testing.T) {
+	const email = "private.person@example.com"
+
+	redactor, err := logging.NewRedactor(logging.RedactHash, []byte("test key"), logging.DefaultRedactedAttrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	logger := slog.New(redactor.Handler(slog.NewJSONHandler(&buf, nil)))
+
+	mock := &mockRepo{
+		MockIsEmailAvailable: func(context.Context, string) error { return helper.ErrEmailAlreadyExists },
+		MockGetUserByEmail: func(ctx context.Context, email string) (*model.User, error) {
+			return nil, helper.ErrUserNotFound
+		},
+	}
+	service := NewUserService(mock, &mockSessionRepo{}, logger, "dummy scretaljwlkdjflsjdfjldjf")
+
+	credential := model.Credential{Email: email, Password: "thisisapassword"}
+	client := model.ClientInfo{IP: "198.51.100.23", UserAgent: "curl/8.0"}
+	service.Register(context.Background(), credential, client)
+	service.Login(context.Background(), credential, client)
+
+	out := buf.String()
+	if out == "" {
+		t.Fatal("expected the service to log something")
+	}
+	if strings.Contains(out, email) {
+		t.Errorf("raw email reached the log output:\n%s", out)
+	}
+	if !strings.Contains(out, redactor.Value(email)) {
+		t.Errorf("expected the hashed email for correlation:\n%s", out)
+	}
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/helper"
+	"github.com/dosedaf/syncup-users-service/internal/mailer"
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/dosedaf/syncup-users-service/internal/repository"
+)
+
+const (
+	resetPurpose  = "password_reset"
+	resetTokenTTL = time.Hour
+)
+
+// WithPasswordReset lets users who forgot their password, or whose account
+// was locked by a "this wasn't me" report, set a new one. m should queue, as
+// for WithDeviceAlerts. resetURL is the page the emailed link points to; it
+// receives the reset token as ?token= and should POST it back to
+// /api/v1/password/reset along with the new password.
+func WithPasswordReset(m mailer.Mailer, resetURL string) Option {
+	return func(s *Service) {
+		s.resetMailer = m
+		s.resetURL = resetURL
+	}
+}
+
+// ForgotPassword emails a password reset link to email. It succeeds whether
+// or not an account uses that email, so it cannot be used to find out.
+func (s *Service) ForgotPassword(ctx context.Context, email string, client model.ClientInfo) error {
+	if s.resetMailer == nil {
+		return errors.New("password reset is not configured")
+	}
+
+	user, err := s.repository.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, helper.ErrUserNotFound) {
+			s.logger.InfoContext(ctx,
+				"Password reset not sent: user with this email does not exist",
+				"email", email,
+			)
+			return nil
+		}
+
+		s.logger.ErrorContext(ctx,
+			"Failed while getting user by email",
+			"email", email,
+			"error", err,
+		)
+		return fmt.Errorf("failed while getting user %s: %w", email, err)
+	}
+
+	// failures are only logged; an error here would tell apart the emails
+	// that have an account
+	if err := s.sendResetLink(ctx, user); err != nil {
+		s.logger.ErrorContext(ctx,
+			"Failed while sending password reset link",
+			"user_id", user.ID,
+			"error", err,
+		)
+	}
+
+	return nil
+}
+
+func (s *Service) sendResetLink(ctx context.Context, user *model.User) error {
+	token, err := s.signEmailToken(user.Email, resetPurpose, resetTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	link := s.resetURL + "?token=" + url.QueryEscape(token)
+
+	return s.resetMailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your SyncUp password",
+		Body: fmt.Sprintf(
+			"Someone asked to reset the password of your SyncUp account.\n\n"+
+				"If this was you, open the link below within an hour to choose a new password:\n%s\n\n"+
+				"If it wasn't, you can ignore this email; your password stays as it is.\n",
+			link,
+		),
+	})
+}
+
+// ResetPassword sets a new password with the token from a reset link. It
+// signs out every session and lifts a reset requirement left by a "this
+// wasn't me" report. Each reset token is accepted once.
+func (s *Service) ResetPassword(ctx context.Context, tokenStr string, newPassword string, client model.ClientInfo) error {
+	token, err := s.parseEmailToken(ctx, tokenStr, resetPurpose)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.repository.GetUserByEmail(ctx, token.email)
+	if err != nil {
+		if errors.Is(err, helper.ErrUserNotFound) {
+			return helper.ErrInvalidToken
+		}
+
+		s.logger.ErrorContext(ctx,
+			"Failed while getting user by email",
+			"email", token.email,
+			"error", err,
+		)
+		return fmt.Errorf("failed while getting user %s: %w", token.email, err)
+	}
+
+	hashedPassword, pepperVersion, err := s.hashPassword(newPassword)
+	if err != nil {
+		s.logger.ErrorContext(ctx,
+			"Failed while generating hashed password",
+			"user_id", user.ID,
+			"error", err,
+		)
+		return err
+	}
+
+	err = s.tx.WithinTx(ctx, func(ctx context.Context, repos repository.Repositories) error {
+		if err := token.use(ctx, repos); err != nil {
+			return err
+		}
+		if err := repos.Users.UpdatePasswordHash(ctx, user.Email, hashedPassword, pepperVersion); err != nil {
+			return fmt.Errorf("failed while updating password of user %d: %w", user.ID, err)
+		}
+		if err := repos.Users.SetPasswordResetRequired(ctx, user.ID, false); err != nil {
+			return fmt.Errorf("failed while lifting password reset requirement of user %d: %w", user.ID, err)
+		}
+		// whoever knew the old password may still be signed in
+		if err := repos.Sessions.RevokeAllSessions(ctx, user.ID); err != nil {
+			return fmt.Errorf("failed while revoking sessions for user %d: %w", user.ID, err)
+		}
+		return nil
+	})
+	if errors.Is(err, helper.ErrInvalidToken) {
+		s.logger.InfoContext(ctx, "Rejected reused reset token", "user_id", user.ID)
+		return err
+	}
+	if err != nil {
+		s.logger.ErrorContext(ctx,
+			"Failed while resetting password",
+			"user_id", user.ID,
+			"error", err,
+		)
+		return err
+	}
+
+	s.logger.InfoContext(ctx, "Password reset", "user_id", user.ID)
+	s.audit.Record(authEvent(model.AuthEventPasswordChange, model.OutcomeSuccess, "reset", &user.ID, user.Email, client))
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/dosedaf/syncup-users-service/helper"
+	"github.com/dosedaf/syncup-users-service/internal/model"
+)
+
+func TestResetPasswordLiftsLockout(t *testing.T) {
+	credential := model.Credential{
+		Email:    "test@gmail.com",
+		Password: "a new password",
+	}
+
+	// locked by a "this wasn't me" report
+	user := userWithHash(credential.Email, "$2a$10$LpieyNVgH6lpdKZr.bKwPOBR0m.TcppenjlPKWEm5WtUMtPk.ziry", 0)
+	user.PasswordResetRequired = true
+	mock := &mockRepo{
+		MockGetUserByEmail: func(ctx context.Context, email string) (*model.User, error) {
+			if email != user.Email {
+				return nil, helper.ErrUserNotFound
+			}
+			return user, nil
+		},
+		MockUpdatePasswordHash: func(ctx context.Context, email string, passwordHash string, pepperVersion int) error {
+			user.PasswordHash = &passwordHash
+			return nil
+		},
+		MockSetPasswordResetRequired: func(ctx context.Context, userID int, required bool) error {
+			user.PasswordResetRequired = required
+			return nil
+		},
+	}
+
+	revokedAll := false
+	sessions := &mockSessionRepo{
+		MockRevokeAllSessions: func(ctx context.Context, userID int) error {
+			revokedAll = true
+			return nil
+		},
+		MockInsertSession: func(ctx context.Context, session *model.Session) error { return nil },
+	}
+	m := &mockMailer{}
+	recorder := &mockRecorder{}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	service := NewUserService(mock, sessions, logger, "dummy scretaljwlkdjflsjdfjldjf",
+		WithPasswordReset(m, "https://syncup.example/reset-password"),
+		WithUsedTokens(&mockTokenRepo{}),
+		WithAuditRecorder(recorder))
+
+	if err := service.ForgotPassword(context.Background(), "nobody@gmail.com", model.ClientInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.sent) != 0 {
+		t.Fatalf("expected no email for an unknown address, got %d", len(m.sent))
+	}
+
+	if err := service.ForgotPassword(context.Background(), credential.Email, model.ClientInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.sent) != 1 || m.sent[0].To != credential.Email {
+		t.Fatalf("expected one reset email, got %+v", m.sent)
+	}
+
+	body := m.sent[0].Body
+	rawURL := strings.Fields(body[strings.Index(body, "https://"):])[0]
+	link, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := link.Query().Get("token")
+
+	if err := service.ReportNotMe(context.Background(), token, model.ClientInfo{}); !errors.Is(err, helper.ErrInvalidToken) {
+		t.Errorf("expected a reset token not to work as a report token, got %v", err)
+	}
+
+	if err := service.ResetPassword(context.Background(), token, credential.Password, model.ClientInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	if user.PasswordResetRequired || !revokedAll {
+		t.Errorf("expected the reset requirement lifted and sessions revoked, got %v, %v", user.PasswordResetRequired, revokedAll)
+	}
+	if n := len(recorder.events); n == 0 || recorder.events[n-1].Type != model.AuthEventPasswordChange || recorder.events[n-1].Reason != "reset" {
+		t.Errorf("expected the reset to be audited as a password change, got %+v", recorder.events)
+	}
+
+	if _, err := service.Login(context.Background(), credential, model.ClientInfo{}); err != nil {
+		t.Errorf("expected login with the new password to succeed, got %v", err)
+	}
+
+	if err := service.ResetPassword(context.Background(), token, "another password", model.ClientInfo{}); !errors.Is(err, helper.ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken for a reused reset token, got %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/helper"
+	"github.com/dosedaf/syncup-users-service/internal/repository"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// emailToken is a token sent by email. It grants one action, named by its
+// purpose, on one account, and is accepted once: whoever redeems it uses up
+// its id with the Tokens repository in the same unit of work as the action.
+type emailToken struct {
+	email     string
+	id        string
+	expiresAt time.Time
+}
+
+// use uses up the token with the unit of work's Tokens repository, which
+// services set up without WithUsedTokens or a transaction manager that
+// provides one lack.
+func (t emailToken) use(ctx context.Context, repos repository.Repositories) error {
+	if repos.Tokens == nil {
+		return errors.New("single-use tokens are not configured")
+	}
+
+	return repos.Tokens.UseToken(ctx, t.id, t.expiresAt)
+}
+
+func (s *Service) signEmailToken(email string, purpose string, ttl time.Duration) (string, error) {
+	id, err := newRandomID()
+	if err != nil {
+		return "", fmt.Errorf("failed while generating token id: %w", err)
+	}
+
+	now := time.Now()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":     email,
+		"purpose": purpose,
+		"jti":     id,
+		"iss":     "app",
+		"exp":     now.Add(ttl).Unix(),
+		"iat":     now.Unix(),
+	}).SignedString(s.jwtSecret)
+	if err != nil {
+		return "", fmt.Errorf("failed while signing %s token: %w", purpose, err)
+	}
+
+	return token, nil
+}
+
+// parseEmailToken returns helper.ErrInvalidToken for anything but an
+// unexpired token signed for purpose.
+func (s *Service) parseEmailToken(ctx context.Context, tokenStr string, purpose string) (emailToken, error) {
+	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return s.jwtSecret, nil
+	})
+	if err != nil {
+		s.logger.InfoContext(ctx, "Rejected invalid token", "purpose", purpose, "error", err)
+		return emailToken{}, helper.ErrInvalidToken
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != purpose {
+		return emailToken{}, helper.ErrInvalidToken
+	}
+
+	email, _ := claims.GetSubject()
+	id, _ := claims["jti"].(string)
+	expiresAt, err := claims.GetExpirationTime()
+	if email == "" || id == "" || err != nil || expiresAt == nil {
+		return emailToken{}, helper.ErrInvalidToken
+	}
+
+	return emailToken{email: email, id: id, expiresAt: expiresAt.Time}, nil
+}
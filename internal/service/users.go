@@ -2,50 +2,158 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log/slog"
+	"net/mail"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/dosedaf/syncup-users-service/helper"
+	"github.com/dosedaf/syncup-users-service/internal/audit"
+	"github.com/dosedaf/syncup-users-service/internal/mailer"
 	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/dosedaf/syncup-users-service/internal/password"
 	"github.com/dosedaf/syncup-users-service/internal/repository"
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
 )
 
+// MaxBatchGetUsers bounds how many users BatchGetUsers looks up at once.
+const MaxBatchGetUsers = 100
+
+// AccessTokenTTL is how long the token of a login, and so its session, lasts.
+const AccessTokenTTL = time.Hour
+
 type ServiceInstance interface {
-	Register(ctx context.Context, credential model.Credential) error
-	Login(ctx context.Context, credential model.Credential) (string, error)
+	Register(ctx context.Context, credential model.Credential, client model.ClientInfo) error
+	Login(ctx context.Context, credential model.Credential, client model.ClientInfo) (string, error)
+	GetUser(ctx context.Context, id int) (*model.User, error)
+	BatchGetUsers(ctx context.Context, ids []int) ([]model.User, error)
+	ListSessions(ctx context.Context, userID int) ([]model.Session, error)
+	RevokeSession(ctx context.Context, userID int, sessionID string, client model.ClientInfo) error
+	ReportNotMe(ctx context.Context, token string, client model.ClientInfo) error
+	ForgotPassword(ctx context.Context, email string, client model.ClientInfo) error
+	ResetPassword(ctx context.Context, token string, newPassword string, client model.ClientInfo) error
 }
 
 type Service struct {
 	repository repository.RepositoryInstance
+	sessions   repository.SessionRepositoryInstance
 	logger     *slog.Logger
 	jwtSecret  []byte
+	hasher     password.Hasher
+	pepper     *password.Pepper
+	audit      audit.RecorderInstance
+	devices    repository.DeviceRepositoryInstance
+	tokens     repository.TokenRepositoryInstance
+	tx         repository.TxManagerInstance
+	mailer     mailer.Mailer
+	notMeURL   string
+
+	resetMailer mailer.Mailer
+	resetURL    string
+}
+
+// Option configures optional Service dependencies.
+type Option func(*Service)
+
+// WithPasswordHasher replaces the default bcrypt hasher.
+func WithPasswordHasher(hasher password.Hasher) Option {
+	return func(s *Service) {
+		s.hasher = hasher
+	}
+}
+
+// WithPepper enables HMAC peppering of passwords before they are hashed.
+func WithPepper(pepper *password.Pepper) Option {
+	return func(s *Service) {
+		s.pepper = pepper
+	}
+}
+
+// WithAuditRecorder records authentication events to the audit log.
+func WithAuditRecorder(recorder audit.RecorderInstance) Option {
+	return func(s *Service) {
+		s.audit = recorder
+	}
+}
+
+// WithTxManager makes operations with several writes atomic. Without it
+// they run directly on the service's repositories, one statement at a time.
+func WithTxManager(tx repository.TxManagerInstance) Option {
+	return func(s *Service) {
+		s.tx = tx
+	}
 }
 
-func NewUserService(repo repository.RepositoryInstance, logger *slog.Logger, jwtSecret string) ServiceInstance {
-	return &Service{
+// WithUsedTokens remembers which single-use tokens, such as the one in a
+// "this wasn't me" link, were redeemed. Services with device alerts or
+// password resets need it unless their WithTxManager units of work come
+// with a token repository; without one, redeeming such a token fails.
+func WithUsedTokens(tokens repository.TokenRepositoryInstance) Option {
+	return func(s *Service) {
+		s.tokens = tokens
+	}
+}
+
+func NewUserService(repo repository.RepositoryInstance, sessions repository.SessionRepositoryInstance, logger *slog.Logger, jwtSecret string, opts ...Option) ServiceInstance {
+	s := &Service{
 		repository: repo,
+		sessions:   sessions,
 		logger:     logger,
 		jwtSecret:  []byte(jwtSecret),
 	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.hasher == nil {
+		s.hasher, _ = password.NewHasher(password.DefaultConfig())
+	}
+
+	if s.audit == nil {
+		s.audit = audit.Nop{}
+	}
+
+	if s.tx == nil {
+		s.tx = noTx{repository.Repositories{
+			Users:    s.repository,
+			Sessions: s.sessions,
+			Devices:  s.devices,
+			Tokens:   s.tokens,
+		}}
+	}
+
+	return s
 }
 
-func (s *Service) Register(ctx context.Context, credential model.Credential) error {
+// noTx runs units of work without a transaction.
+type noTx struct {
+	repos repository.Repositories
+}
+
+func (n noTx) WithinTx(ctx context.Context, fn func(ctx context.Context, repos repository.Repositories) error) error {
+	return fn(ctx, n.repos)
+}
+
+func (s *Service) Register(ctx context.Context, credential model.Credential, client model.ClientInfo) error {
 	err := s.repository.IsEmailAvailable(ctx, credential.Email)
 	if err != nil {
 		if errors.Is(err, helper.ErrEmailAlreadyExists) {
-			s.logger.Info(
+			s.logger.InfoContext(ctx,
 				"User registration blocked: email already exists",
 				"email", credential.Email,
 			)
 
+			s.audit.Record(authEvent(model.AuthEventRegister, model.OutcomeFailure, "email_exists", nil, credential.Email, client))
 			return err
 		}
 
-		s.logger.Error(
+		s.logger.ErrorContext(ctx,
 			"Failed to check email availability",
 			"email", credential.Email,
 			"error", err,
@@ -54,9 +162,9 @@ func (s *Service) Register(ctx context.Context, credential model.Credential) err
 		return fmt.Errorf("failed while checking email availability: %w", err)
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(credential.Password), bcrypt.DefaultCost)
+	hashedPassword, pepperVersion, err := s.hashPassword(credential.Password)
 	if err != nil {
-		s.logger.Error(
+		s.logger.ErrorContext(ctx,
 			"Failed while generating hashed password",
 			"email", credential.Email,
 			"error", err,
@@ -64,11 +172,32 @@ func (s *Service) Register(ctx context.Context, credential model.Credential) err
 		return err
 	}
 
-	credential.Password = string(hashedPassword)
+	credential.Password = hashedPassword
 
-	err = s.repository.InsertUser(ctx, credential)
+	// the check above is only a fast path; a concurrent registration for the
+	// same email can still win, and the insert reports that as a conflict
+	var user *model.User
+	err = s.tx.WithinTx(ctx, func(ctx context.Context, repos repository.Repositories) error {
+		var err error
+		user, err = repos.Users.InsertUser(ctx, credential, pepperVersion)
+		if err != nil {
+			return err
+		}
+
+		return recordUserEvent(ctx, repos, model.UserEventRegistered, user)
+	})
 	if err != nil {
-		s.logger.Error(
+		if errors.Is(err, helper.ErrEmailAlreadyExists) {
+			s.logger.InfoContext(ctx,
+				"User registration blocked: email was registered concurrently",
+				"email", credential.Email,
+			)
+
+			s.audit.Record(authEvent(model.AuthEventRegister, model.OutcomeFailure, "email_exists", nil, credential.Email, client))
+			return err
+		}
+
+		s.logger.ErrorContext(ctx,
 			"Failed while inserting new user",
 			"email", credential.Email,
 			"error", err,
@@ -77,45 +206,58 @@ func (s *Service) Register(ctx context.Context, credential model.Credential) err
 		return fmt.Errorf("failed while inserting new user %s: %w", credential.Email, err)
 	}
 
+	s.audit.Record(authEvent(model.AuthEventRegister, model.OutcomeSuccess, "", &user.ID, credential.Email, client))
+
 	return nil
 }
 
-func (s *Service) Login(ctx context.Context, credential model.Credential) (string, error) {
-	passwordDb, err := s.repository.GetHashedPassword(ctx, credential.Email)
+func (s *Service) Login(ctx context.Context, credential model.Credential, client model.ClientInfo) (string, error) {
+	user, err := s.repository.GetUserByEmail(ctx, credential.Email)
 	if err != nil {
 		if errors.Is(err, helper.ErrUserNotFound) {
-			s.logger.Info(
+			s.logger.InfoContext(ctx,
 				"User login blocked: user with this email does not exist",
 				"email", credential.Email,
 			)
 
+			s.audit.Record(authEvent(model.AuthEventLogin, model.OutcomeFailure, "user_not_found", nil, credential.Email, client))
 			return "", err
 		}
 
-		s.logger.Error(
-			"Failed while getting hashed password",
+		s.logger.ErrorContext(ctx,
+			"Failed while getting user by email",
 			"email", credential.Email,
 			"error", err,
 		)
 
-		return "", fmt.Errorf("failed while getting hashed password from user %s: %w", credential.Email, err)
+		return "", fmt.Errorf("failed while getting user %s: %w", credential.Email, err)
+	}
+
+	if user.PasswordHash == nil {
+		s.logger.InfoContext(ctx,
+			"User login blocked: user has no password set",
+			"email", credential.Email,
+		)
+
+		s.audit.Record(authEvent(model.AuthEventLogin, model.OutcomeFailure, "no_password", &user.ID, credential.Email, client))
+		return "", helper.ErrWrongPassword
 	}
 
-	// could be wrong pass (mismatched) or an actual error. how do i differ them?
-	// https://cs.opensource.google/go/x/crypto/+/refs/tags/v0.37.0:bcrypt/bcrypt.go;l=95
-	// i learnt that u can open the source code and look for yourself what are the errors returned from a specific method
-	err = bcrypt.CompareHashAndPassword([]byte(passwordDb), []byte(credential.Password))
+	peppered, err := s.pepper.Apply(user.PepperVersion, credential.Password)
 	if err != nil {
-		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
-			s.logger.Info(
-				"User login blocked: wrong password",
-				"email", credential.Email,
-			)
+		s.logger.ErrorContext(ctx,
+			"Failed while applying pepper",
+			"email", credential.Email,
+			"pepper_version", user.PepperVersion,
+			"error", err,
+		)
 
-			return "", helper.ErrWrongPassword
-		}
+		return "", fmt.Errorf("failed while applying pepper for user %s: %w", credential.Email, err)
+	}
 
-		s.logger.Error(
+	match, err := s.hasher.Verify(peppered, *user.PasswordHash)
+	if err != nil {
+		s.logger.ErrorContext(ctx,
 			"Failed while comparing hash and password",
 			"email", credential.Email,
 			"error", err,
@@ -124,16 +266,72 @@ func (s *Service) Login(ctx context.Context, credential model.Credential) (strin
 		return "", fmt.Errorf("failed while comparing hash and password from user %s: %w", credential.Email, err)
 	}
 
+	if !match {
+		s.logger.InfoContext(ctx,
+			"User login blocked: wrong password",
+			"email", credential.Email,
+		)
+
+		s.audit.Record(authEvent(model.AuthEventLogin, model.OutcomeFailure, "wrong_password", &user.ID, credential.Email, client))
+		return "", helper.ErrWrongPassword
+	}
+
+	if user.PasswordResetRequired {
+		s.logger.InfoContext(ctx,
+			"User login blocked: password reset required",
+			"email", credential.Email,
+		)
+
+		s.audit.Record(authEvent(model.AuthEventLogin, model.OutcomeFailure, "password_reset_required", &user.ID, credential.Email, client))
+		return "", helper.ErrPasswordResetRequired
+	}
+
+	if s.hasher.NeedsRehash(*user.PasswordHash) || user.PepperVersion != s.pepper.Current() {
+		s.rehashPassword(ctx, user, credential, client)
+	}
+
+	sessionID, err := newRandomID()
+	if err != nil {
+		s.logger.ErrorContext(ctx,
+			"Failed while generating session id",
+			"email", credential.Email,
+			"error", err,
+		)
+
+		return "", err
+	}
+
+	now := time.Now()
+	session := &model.Session{
+		ID:        sessionID,
+		UserID:    user.ID,
+		UserAgent: client.UserAgent,
+		IP:        client.IP,
+		// there is no refresh, so the session ends with its only token
+		ExpiresAt: now.Add(AccessTokenTTL),
+	}
+
+	if err = s.sessions.InsertSession(ctx, session); err != nil {
+		s.logger.ErrorContext(ctx,
+			"Failed while creating session",
+			"email", credential.Email,
+			"error", err,
+		)
+
+		return "", fmt.Errorf("failed while creating session for user %s: %w", credential.Email, err)
+	}
+
 	claims := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"sub": credential.Email,
+		"sid": session.ID,
 		"iss": "app",
-		"exp": time.Now().Add(time.Hour).Unix(),
-		"iat": time.Now().Unix(),
+		"exp": session.ExpiresAt.Unix(),
+		"iat": now.Unix(),
 	})
 
 	tokenString, err := claims.SignedString(s.jwtSecret)
 	if err != nil {
-		s.logger.Error(
+		s.logger.ErrorContext(ctx,
 			"Failed while getting signed string",
 			"email", credential.Email,
 			"error", err,
@@ -142,5 +340,189 @@ func (s *Service) Login(ctx context.Context, credential model.Credential) (strin
 		return "", err
 	}
 
+	s.audit.Record(authEvent(model.AuthEventLogin, model.OutcomeSuccess, "", &user.ID, credential.Email, client))
+	s.checkDevice(ctx, user, client)
+
 	return tokenString, nil
 }
+
+// ValidateCredential checks the fields of a register or login request. Only
+// new registrations need a well formed email; a login with a malformed one
+// simply matches no user.
+func ValidateCredential(credential model.Credential, register bool) error {
+	errs := &helper.ValidationError{}
+
+	if strings.TrimSpace(credential.Email) == "" {
+		errs.Add("email", "is required")
+	} else if register {
+		if addr, err := mail.ParseAddress(credential.Email); err != nil || addr.Address != credential.Email {
+			errs.Add("email", "must be a valid email address")
+		}
+	}
+
+	if credential.Password == "" {
+		errs.Add("password", "is required")
+	}
+
+	return errs.Err()
+}
+
+func (s *Service) GetUser(ctx context.Context, id int) (*model.User, error) {
+	user, err := s.repository.GetUserByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, helper.ErrUserNotFound) {
+			return nil, err
+		}
+
+		s.logger.ErrorContext(ctx,
+			"Failed while getting user",
+			"user_id", id,
+			"error", err,
+		)
+
+		return nil, fmt.Errorf("failed while getting user %d: %w", id, err)
+	}
+
+	return user, nil
+}
+
+// BatchGetUsers returns the users among ids, ordered by ID. IDs without a
+// user are left out rather than failing the batch.
+func (s *Service) BatchGetUsers(ctx context.Context, ids []int) ([]model.User, error) {
+	ids = slices.Compact(slices.Sorted(slices.Values(ids)))
+	if len(ids) > MaxBatchGetUsers {
+		return nil, helper.InvalidField("ids", fmt.Sprintf("must list at most %d IDs", MaxBatchGetUsers))
+	}
+	if len(ids) == 0 {
+		return []model.User{}, nil
+	}
+
+	users, err := s.repository.GetUsersByIDs(ctx, ids)
+	if err != nil {
+		s.logger.ErrorContext(ctx,
+			"Failed while getting users",
+			"count", len(ids),
+			"error", err,
+		)
+
+		return nil, fmt.Errorf("failed while getting %d users: %w", len(ids), err)
+	}
+
+	return users, nil
+}
+
+func (s *Service) ListSessions(ctx context.Context, userID int) ([]model.Session, error) {
+	sessions, err := s.sessions.ListActiveSessions(ctx, userID)
+	if err != nil {
+		s.logger.ErrorContext(ctx,
+			"Failed while listing sessions",
+			"user_id", userID,
+			"error", err,
+		)
+
+		return nil, fmt.Errorf("failed while listing sessions for user %d: %w", userID, err)
+	}
+
+	return sessions, nil
+}
+
+func (s *Service) RevokeSession(ctx context.Context, userID int, sessionID string, client model.ClientInfo) error {
+	err := s.sessions.RevokeSession(ctx, userID, sessionID)
+	if err != nil {
+		if errors.Is(err, helper.ErrSessionNotFound) {
+			s.logger.InfoContext(ctx,
+				"Session revocation blocked: session not found",
+				"user_id", userID,
+			)
+
+			return err
+		}
+
+		s.logger.ErrorContext(ctx,
+			"Failed while revoking session",
+			"user_id", userID,
+			"error", err,
+		)
+
+		return fmt.Errorf("failed while revoking session for user %d: %w", userID, err)
+	}
+
+	s.logger.InfoContext(ctx, "Session revoked", "user_id", userID)
+	s.audit.Record(authEvent(model.AuthEventSessionRevoke, model.OutcomeSuccess, "", &userID, "", client))
+
+	return nil
+}
+
+// authEvent builds an audit event for an action users perform on their own
+// account, where actor and subject are the same.
+func authEvent(eventType, outcome, reason string, userID *int, email string, client model.ClientInfo) model.AuthEvent {
+	return model.AuthEvent{
+		Type:         eventType,
+		Outcome:      outcome,
+		Reason:       reason,
+		ActorID:      userID,
+		SubjectID:    userID,
+		SubjectEmail: email,
+		IP:           client.IP,
+		UserAgent:    client.UserAgent,
+	}
+}
+
+func newRandomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// hashPassword peppers password with the current pepper version and hashes
+// it, returning the version so it can be stored alongside the hash.
+func (s *Service) hashPassword(plain string) (string, int, error) {
+	version := s.pepper.Current()
+
+	peppered, err := s.pepper.Apply(version, plain)
+	if err != nil {
+		return "", 0, err
+	}
+
+	hashed, err := s.hasher.Hash(peppered)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return hashed, version, nil
+}
+
+// rehashPassword upgrades a stored hash to the current algorithm, parameters
+// and pepper version. It runs only after a successful login, the one point
+// where the plaintext is available, and a failure here never blocks the
+// login itself.
+func (s *Service) rehashPassword(ctx context.Context, user *model.User, credential model.Credential, client model.ClientInfo) {
+	hashedPassword, pepperVersion, err := s.hashPassword(credential.Password)
+	if err != nil {
+		s.logger.ErrorContext(ctx,
+			"Failed while rehashing password",
+			"email", credential.Email,
+			"error", err,
+		)
+		return
+	}
+
+	if err = s.repository.UpdatePasswordHash(ctx, credential.Email, hashedPassword, pepperVersion); err != nil {
+		s.logger.ErrorContext(ctx,
+			"Failed while storing rehashed password",
+			"email", credential.Email,
+			"error", err,
+		)
+		return
+	}
+
+	s.logger.InfoContext(ctx,
+		"Password hash upgraded",
+		"email", credential.Email,
+		"pepper_version", pepperVersion,
+	)
+	s.audit.Record(authEvent(model.AuthEventPasswordChange, model.OutcomeSuccess, "rehash", &user.ID, credential.Email, client))
+}
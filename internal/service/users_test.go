@@ -2,36 +2,110 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"log/slog"
 	"os"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/dosedaf/syncup-users-service/helper"
 	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/dosedaf/syncup-users-service/internal/password"
+	"github.com/dosedaf/syncup-users-service/internal/repository"
+	"github.com/golang-jwt/jwt/v5"
 )
 
 type mockRepo struct {
-	MockGetUserByEmail    func(ctx context.Context, email string) (*model.User, error)
-	MockIsEmailAvailable  func(ctx context.Context, email string) error
-	MockInsertUser        func(ctx context.Context, credential model.Credential) error
-	MockGetHashedPassword func(ctx context.Context, email string) (string, error)
+	MockGetUserByEmail           func(ctx context.Context, email string) (*model.User, error)
+	MockGetUserByID              func(ctx context.Context, id int) (*model.User, error)
+	MockGetUsersByIDs            func(ctx context.Context, ids []int) ([]model.User, error)
+	MockIsEmailAvailable         func(ctx context.Context, email string) error
+	MockInsertUser               func(ctx context.Context, credential model.Credential, pepperVersion int) (*model.User, error)
+	MockUpdatePasswordHash       func(ctx context.Context, email string, passwordHash string, pepperVersion int) error
+	MockSetPasswordResetRequired func(ctx context.Context, userID int, required bool) error
 }
 
 func (m *mockRepo) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
 	return m.MockGetUserByEmail(ctx, email)
 }
 
+func (m *mockRepo) GetUserByID(ctx context.Context, id int) (*model.User, error) {
+	return m.MockGetUserByID(ctx, id)
+}
+
+func (m *mockRepo) GetUsersByIDs(ctx context.Context, ids []int) ([]model.User, error) {
+	return m.MockGetUsersByIDs(ctx, ids)
+}
+
 func (m *mockRepo) IsEmailAvailable(ctx context.Context, email string) error {
 	return m.MockIsEmailAvailable(ctx, email)
 }
 
-func (m *mockRepo) InsertUser(ctx context.Context, credential model.Credential) error {
-	return m.MockInsertUser(ctx, credential)
+func (m *mockRepo) InsertUser(ctx context.Context, credential model.Credential, pepperVersion int) (*model.User, error) {
+	return m.MockInsertUser(ctx, credential, pepperVersion)
+}
+
+func (m *mockRepo) UpdatePasswordHash(ctx context.Context, email string, passwordHash string, pepperVersion int) error {
+	return m.MockUpdatePasswordHash(ctx, email, passwordHash, pepperVersion)
+}
+
+type mockSessionRepo struct {
+	MockInsertSession      func(ctx context.Context, session *model.Session) error
+	MockGetSession         func(ctx context.Context, id string) (*model.Session, error)
+	MockListActiveSessions func(ctx context.Context, userID int) ([]model.Session, error)
+	MockRevokeSession      func(ctx context.Context, userID int, id string) error
+	MockRevokeAllSessions  func(ctx context.Context, userID int) error
+	MockTouchSessions      func(ctx context.Context, lastSeen map[string]time.Time) error
+	MockPruneSessions      func(ctx context.Context, before time.Time) (int64, error)
+}
+
+// InsertSession succeeds by default so login tests only configure it when
+// they care about the session.
+func (m *mockSessionRepo) InsertSession(ctx context.Context, session *model.Session) error {
+	if m.MockInsertSession == nil {
+		return nil
+	}
+	return m.MockInsertSession(ctx, session)
+}
+
+func (m *mockSessionRepo) GetSession(ctx context.Context, id string) (*model.Session, error) {
+	return m.MockGetSession(ctx, id)
+}
+
+func (m *mockSessionRepo) ListActiveSessions(ctx context.Context, userID int) ([]model.Session, error) {
+	return m.MockListActiveSessions(ctx, userID)
+}
+
+func (m *mockSessionRepo) RevokeSession(ctx context.Context, userID int, id string) error {
+	return m.MockRevokeSession(ctx, userID, id)
+}
+
+func (m *mockSessionRepo) RevokeAllSessions(ctx context.Context, userID int) error {
+	return m.MockRevokeAllSessions(ctx, userID)
+}
+
+func (m *mockSessionRepo) TouchSessions(ctx context.Context, lastSeen map[string]time.Time) error {
+	return m.MockTouchSessions(ctx, lastSeen)
+}
+
+func (m *mockSessionRepo) PruneSessions(ctx context.Context, before time.Time) (int64, error) {
+	return m.MockPruneSessions(ctx, before)
+}
+
+func (m *mockRepo) SetPasswordResetRequired(ctx context.Context, userID int, required bool) error {
+	return m.MockSetPasswordResetRequired(ctx, userID, required)
 }
 
-func (m *mockRepo) GetHashedPassword(ctx context.Context, email string) (string, error) {
-	return m.MockGetHashedPassword(ctx, email)
+func userWithHash(email string, hash string, pepperVersion int) *model.User {
+	return &model.User{
+		ID:            1,
+		Email:         email,
+		PasswordHash:  &hash,
+		PepperVersion: pepperVersion,
+	}
 }
 
 func TestRegisterNoError(t *testing.T) {
@@ -42,12 +116,14 @@ func TestRegisterNoError(t *testing.T) {
 
 	mock := &mockRepo{
 		MockIsEmailAvailable: func(ctx context.Context, email string) error { return nil },
-		MockInsertUser:       func(context.Context, model.Credential) error { return nil },
+		MockInsertUser: func(ctx context.Context, credential model.Credential, pepperVersion int) (*model.User, error) {
+			return userWithHash(credential.Email, credential.Password, pepperVersion), nil
+		},
 	}
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 
-	service := NewUserService(mock, logger, "dummy scretaljwlkdjflsjdfjldjf")
-	err := service.Register(context.Background(), credential)
+	service := NewUserService(mock, &mockSessionRepo{}, logger, "dummy scretaljwlkdjflsjdfjldjf")
+	err := service.Register(context.Background(), credential, model.ClientInfo{})
 	if err != nil {
 		t.Errorf(err.Error())
 	}
@@ -64,13 +140,112 @@ func TestRegisterErrorEmailAlreadyExists(t *testing.T) {
 	}
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 
-	service := NewUserService(mock, logger, "dummy scretaljwlkdjflsjdfjldjf")
-	err := service.Register(context.Background(), credential)
+	service := NewUserService(mock, &mockSessionRepo{}, logger, "dummy scretaljwlkdjflsjdfjldjf")
+	err := service.Register(context.Background(), credential, model.ClientInfo{})
 	if !errors.Is(err, helper.ErrEmailAlreadyExists) {
 		t.Errorf(err.Error())
 	}
 }
 
+// The availability check can pass for two registrations at once; the loser
+// finds out from the insert and must get a conflict rather than a 500.
+func TestRegisterErrorEmailRegisteredConcurrently(t *testing.T) {
+	credential := model.Credential{
+		Email:    "newemail@gmail.com",
+		Password: "thisisapassword",
+	}
+
+	mock := &mockRepo{
+		MockIsEmailAvailable: func(context.Context, string) error { return nil },
+		MockInsertUser: func(context.Context, model.Credential, int) (*model.User, error) {
+			return nil, helper.ErrEmailAlreadyExists
+		},
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	service := NewUserService(mock, &mockSessionRepo{}, logger, "dummy scretaljwlkdjflsjdfjldjf")
+	err := service.Register(context.Background(), credential, model.ClientInfo{})
+	if !errors.Is(err, helper.ErrEmailAlreadyExists) {
+		t.Errorf("expected ErrEmailAlreadyExists, got %v", err)
+	}
+}
+
+type mockOutboxRepo struct {
+	events []model.OutboxEvent
+	err    error
+}
+
+func (m *mockOutboxRepo) InsertOutboxEvent(ctx context.Context, event *model.OutboxEvent) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.events = append(m.events, *event)
+	return nil
+}
+
+func (m *mockOutboxRepo) ClaimOutboxEvents(ctx context.Context, now time.Time, leaseUntil time.Time, limit int) ([]model.OutboxEvent, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *mockOutboxRepo) MarkOutboxEventPublished(ctx context.Context, id int64) error {
+	return errors.New("not implemented")
+}
+
+func (m *mockOutboxRepo) MarkOutboxEventFailed(ctx context.Context, id int64, nextAttemptAt time.Time, lastError string) error {
+	return errors.New("not implemented")
+}
+
+func TestRegisterRecordsEvent(t *testing.T) {
+	tests := []struct {
+		name          string
+		outboxErr     error
+		wantErr       bool
+		wantCommitted bool
+		wantEvents    int
+	}{
+		{"event is committed with the user", nil, false, true, 1},
+		{"failing to record the event rolls back the user", errors.New("outbox is down"), true, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := &mockRepo{
+				MockIsEmailAvailable: func(context.Context, string) error { return nil },
+				MockInsertUser: func(ctx context.Context, credential model.Credential, pepperVersion int) (*model.User, error) {
+					return userWithHash(credential.Email, credential.Password, pepperVersion), nil
+				},
+			}
+			outbox := &mockOutboxRepo{err: tt.outboxErr}
+			tx := &mockTxManager{repos: repository.Repositories{Users: users, Outbox: outbox}}
+			logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+			service := NewUserService(users, &mockSessionRepo{}, logger, "dummy scretaljwlkdjflsjdfjldjf", WithTxManager(tx))
+			err := service.Register(context.Background(), model.Credential{Email: "new@gmail.com", Password: "password"}, model.ClientInfo{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if tx.committed != tt.wantCommitted {
+				t.Errorf("expected committed %v, got %v", tt.wantCommitted, tx.committed)
+			}
+			if len(outbox.events) != tt.wantEvents {
+				t.Fatalf("expected %d events, got %d", tt.wantEvents, len(outbox.events))
+			}
+			if tt.wantEvents == 0 {
+				return
+			}
+
+			event := outbox.events[0]
+			if event.Type != model.UserEventRegistered || event.UserID != 1 {
+				t.Errorf("unexpected event %+v", event)
+			}
+			var payload model.UserEventPayload
+			if err := json.Unmarshal(event.Payload, &payload); err != nil || payload.Email != "new@gmail.com" || payload.UserID != 1 {
+				t.Errorf("unexpected payload %s", event.Payload)
+			}
+		})
+	}
+}
+
 func TestLoginNoError(t *testing.T) {
 	credential := model.Credential{
 		Email:    "test@gmail.com",
@@ -78,14 +253,14 @@ func TestLoginNoError(t *testing.T) {
 	}
 
 	mock := &mockRepo{
-		MockGetHashedPassword: func(ctx context.Context, email string) (string, error) {
-			return "$2a$10$LpieyNVgH6lpdKZr.bKwPOBR0m.TcppenjlPKWEm5WtUMtPk.ziry", nil
+		MockGetUserByEmail: func(ctx context.Context, email string) (*model.User, error) {
+			return userWithHash(email, "$2a$10$LpieyNVgH6lpdKZr.bKwPOBR0m.TcppenjlPKWEm5WtUMtPk.ziry", 0), nil
 		},
 	}
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 
-	service := NewUserService(mock, logger, "dummy scretaljwlkdjflsjdfjldjf")
-	_, err := service.Login(context.Background(), credential)
+	service := NewUserService(mock, &mockSessionRepo{}, logger, "dummy scretaljwlkdjflsjdfjldjf")
+	_, err := service.Login(context.Background(), credential, model.ClientInfo{})
 	if err != nil {
 		t.Errorf(err.Error())
 	}
@@ -98,15 +273,281 @@ func TestLoginErrWrongPassword(t *testing.T) {
 	}
 
 	mock := &mockRepo{
-		MockGetHashedPassword: func(ctx context.Context, email string) (string, error) {
-			return "$2a$10$jftf7wh9L9R/dzHE06ww/.fD8La7fdth8cDajh1HWY5g3wR.52Nty", nil
+		MockGetUserByEmail: func(ctx context.Context, email string) (*model.User, error) {
+			return userWithHash(email, "$2a$10$jftf7wh9L9R/dzHE06ww/.fD8La7fdth8cDajh1HWY5g3wR.52Nty", 0), nil
 		},
 	}
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 
-	service := NewUserService(mock, logger, "dummy scretaljwlkdjflsjdfjldjf")
-	_, err := service.Login(context.Background(), credential)
+	service := NewUserService(mock, &mockSessionRepo{}, logger, "dummy scretaljwlkdjflsjdfjldjf")
+	_, err := service.Login(context.Background(), credential, model.ClientInfo{})
 	if !errors.Is(err, helper.ErrWrongPassword) {
 		t.Errorf(err.Error())
 	}
 }
+
+func TestLoginRehashesWeakBcrypt(t *testing.T) {
+	credential := model.Credential{
+		Email:    "test@gmail.com",
+		Password: "test",
+	}
+
+	var rehashed string
+	mock := &mockRepo{
+		MockGetUserByEmail: func(ctx context.Context, email string) (*model.User, error) {
+			return userWithHash(email, "$2a$10$LpieyNVgH6lpdKZr.bKwPOBR0m.TcppenjlPKWEm5WtUMtPk.ziry", 0), nil
+		},
+		MockUpdatePasswordHash: func(ctx context.Context, email string, passwordHash string, pepperVersion int) error {
+			rehashed = passwordHash
+			return nil
+		},
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	config := password.DefaultConfig()
+	config.Algorithm = password.AlgorithmArgon2id
+	config.Argon2.Memory = 1024
+	config.Argon2.Iterations = 1
+	hasher, err := password.NewHasher(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := &mockRecorder{}
+	service := NewUserService(mock, &mockSessionRepo{}, logger, "dummy scretaljwlkdjflsjdfjldjf", WithPasswordHasher(hasher), WithAuditRecorder(recorder))
+	_, err = service.Login(context.Background(), credential, model.ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(rehashed, "$argon2id$") {
+		t.Errorf("expected password to be rehashed with argon2id, got %q", rehashed)
+	}
+	if len(recorder.events) == 0 || recorder.events[0].Type != model.AuthEventPasswordChange || recorder.events[0].Reason != "rehash" {
+		t.Errorf("expected the rehash to be audited as a password change, got %+v", recorder.events)
+	}
+}
+
+func testPepper(t *testing.T, versions ...int) *password.Pepper {
+	t.Helper()
+
+	keys := make(map[int][]byte)
+	for _, v := range versions {
+		keys[v] = []byte(strings.Repeat(string(rune('a'+v)), password.MinPepperLength))
+	}
+
+	pepper, err := password.NewPepper(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pepper
+}
+
+func TestRegisterStoresPepperVersion(t *testing.T) {
+	credential := model.Credential{
+		Email:    "newemail@gmail.com",
+		Password: "thisisapassword",
+	}
+
+	var storedHash string
+	var storedVersion int
+	mock := &mockRepo{
+		MockIsEmailAvailable: func(context.Context, string) error { return nil },
+		MockInsertUser: func(ctx context.Context, credential model.Credential, pepperVersion int) (*model.User, error) {
+			storedHash = credential.Password
+			storedVersion = pepperVersion
+			return userWithHash(credential.Email, credential.Password, pepperVersion), nil
+		},
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	pepper := testPepper(t, 1, 2)
+
+	service := NewUserService(mock, &mockSessionRepo{}, logger, "dummy scretaljwlkdjflsjdfjldjf", WithPepper(pepper))
+	if err := service.Register(context.Background(), credential, model.ClientInfo{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if storedVersion != 2 {
+		t.Errorf("expected pepper version 2, got %d", storedVersion)
+	}
+
+	hasher, _ := password.NewHasher(password.DefaultConfig())
+	if ok, _ := hasher.Verify(credential.Password, storedHash); ok {
+		t.Error("stored hash must not verify against the unpeppered password")
+	}
+
+	peppered, _ := pepper.Apply(2, credential.Password)
+	if ok, _ := hasher.Verify(peppered, storedHash); !ok {
+		t.Error("stored hash should verify against the peppered password")
+	}
+}
+
+func TestLoginRepeppersOldVersion(t *testing.T) {
+	credential := model.Credential{
+		Email:    "test@gmail.com",
+		Password: "test",
+	}
+
+	hasher, _ := password.NewHasher(password.DefaultConfig())
+	pepper := testPepper(t, 1, 2)
+	peppered, _ := pepper.Apply(1, credential.Password)
+	hash, err := hasher.Hash(peppered)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updatedVersion := -1
+	mock := &mockRepo{
+		MockGetUserByEmail: func(ctx context.Context, email string) (*model.User, error) {
+			return userWithHash(email, hash, 1), nil
+		},
+		MockUpdatePasswordHash: func(ctx context.Context, email string, passwordHash string, pepperVersion int) error {
+			updatedVersion = pepperVersion
+			return nil
+		},
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	service := NewUserService(mock, &mockSessionRepo{}, logger, "dummy scretaljwlkdjflsjdfjldjf", WithPepper(pepper))
+	if _, err := service.Login(context.Background(), credential, model.ClientInfo{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if updatedVersion != 2 {
+		t.Errorf("expected hash to be re-peppered with version 2, got %d", updatedVersion)
+	}
+}
+
+func TestLoginCreatesSession(t *testing.T) {
+	credential := model.Credential{
+		Email:    "test@gmail.com",
+		Password: "test",
+	}
+	client := model.ClientInfo{UserAgent: "curl/8.0", IP: "10.0.0.1"}
+
+	mock := &mockRepo{
+		MockGetUserByEmail: func(ctx context.Context, email string) (*model.User, error) {
+			return userWithHash(email, "$2a$10$LpieyNVgH6lpdKZr.bKwPOBR0m.TcppenjlPKWEm5WtUMtPk.ziry", 0), nil
+		},
+	}
+
+	var created *model.Session
+	sessions := &mockSessionRepo{
+		MockInsertSession: func(ctx context.Context, session *model.Session) error {
+			created = session
+			return nil
+		},
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	service := NewUserService(mock, sessions, logger, "dummy scretaljwlkdjflsjdfjldjf")
+	tokenStr, err := service.Login(context.Background(), credential, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if created == nil || created.UserID != 1 || created.UserAgent != client.UserAgent || created.IP != client.IP {
+		t.Fatalf("unexpected session %+v", created)
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(tokenStr, claims, func(*jwt.Token) (interface{}, error) {
+		return []byte("dummy scretaljwlkdjflsjdfjldjf"), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims["sid"] != created.ID {
+		t.Errorf("expected sid claim %q, got %v", created.ID, claims["sid"])
+	}
+}
+
+func TestRevokeSessionNotFound(t *testing.T) {
+	sessions := &mockSessionRepo{
+		MockRevokeSession: func(ctx context.Context, userID int, id string) error {
+			return helper.ErrSessionNotFound
+		},
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	service := NewUserService(&mockRepo{}, sessions, logger, "dummy scretaljwlkdjflsjdfjldjf")
+	err := service.RevokeSession(context.Background(), 1, "someone-elses-session", model.ClientInfo{})
+	if !errors.Is(err, helper.ErrSessionNotFound) {
+		t.Errorf("expected ErrSessionNotFound, got %v", err)
+	}
+}
+
+func TestBatchGetUsers(t *testing.T) {
+	var queried [][]int
+	repo := &mockRepo{
+		MockGetUsersByIDs: func(ctx context.Context, ids []int) ([]model.User, error) {
+			queried = append(queried, ids)
+			return []model.User{{ID: 1}, {ID: 3}}, nil
+		},
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	service := NewUserService(repo, &mockSessionRepo{}, logger, "dummy scretaljwlkdjflsjdfjldjf")
+
+	users, err := service.BatchGetUsers(context.Background(), []int{3, 1, 3, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || len(queried) != 1 || !slices.Equal(queried[0], []int{1, 2, 3}) {
+		t.Errorf("expected one lookup of the sorted, deduplicated IDs, got %v returning %+v", queried, users)
+	}
+
+	users, err = service.BatchGetUsers(context.Background(), nil)
+	if err != nil || len(users) != 0 || len(queried) != 1 {
+		t.Errorf("expected an empty batch without a lookup, got %+v, %v", users, err)
+	}
+
+	tooMany := make([]int, MaxBatchGetUsers+1)
+	for i := range tooMany {
+		tooMany[i] = i + 1
+	}
+	if _, err := service.BatchGetUsers(context.Background(), tooMany); !errors.Is(err, helper.ErrValidationFailed) {
+		t.Errorf("expected ErrValidationFailed for %d IDs, got %v", len(tooMany), err)
+	}
+}
+
+type mockRecorder struct {
+	events []model.AuthEvent
+}
+
+func (m *mockRecorder) Record(event model.AuthEvent) {
+	m.events = append(m.events, event)
+}
+
+func TestLoginWrongPasswordRecordsAuthEvent(t *testing.T) {
+	credential := model.Credential{
+		Email:    "test@gmail.com",
+		Password: "test",
+	}
+	client := model.ClientInfo{UserAgent: "curl/8.0", IP: "10.0.0.1"}
+
+	mock := &mockRepo{
+		MockGetUserByEmail: func(ctx context.Context, email string) (*model.User, error) {
+			return userWithHash(email, "$2a$10$jftf7wh9L9R/dzHE06ww/.fD8La7fdth8cDajh1HWY5g3wR.52Nty", 0), nil
+		},
+	}
+	recorder := &mockRecorder{}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	service := NewUserService(mock, &mockSessionRepo{}, logger, "dummy scretaljwlkdjflsjdfjldjf", WithAuditRecorder(recorder))
+	if _, err := service.Login(context.Background(), credential, client); !errors.Is(err, helper.ErrWrongPassword) {
+		t.Fatalf("expected ErrWrongPassword, got %v", err)
+	}
+
+	if len(recorder.events) != 1 {
+		t.Fatalf("expected one auth event, got %d", len(recorder.events))
+	}
+
+	event := recorder.events[0]
+	if event.Type != model.AuthEventLogin || event.Outcome != model.OutcomeFailure || event.Reason != "wrong_password" {
+		t.Errorf("unexpected event %+v", event)
+	}
+	if event.SubjectID == nil || *event.SubjectID != 1 || event.IP != client.IP || event.UserAgent != client.UserAgent {
+		t.Errorf("unexpected event subject or client %+v", event)
+	}
+}
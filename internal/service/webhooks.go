@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/helper"
+	"github.com/dosedaf/syncup-users-service/internal/audit"
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/dosedaf/syncup-users-service/internal/repository"
+	"github.com/dosedaf/syncup-users-service/internal/webhook"
+)
+
+type WebhookServiceInstance interface {
+	CreateSubscription(ctx context.Context, admin *model.User, subscription *model.WebhookSubscription, client model.ClientInfo) error
+	ListSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error)
+	GetSubscription(ctx context.Context, id int) (*model.WebhookSubscription, error)
+	DeleteSubscription(ctx context.Context, admin *model.User, id int, client model.ClientInfo) error
+	ListDeliveries(ctx context.Context, filter model.WebhookDeliveryFilter) ([]model.WebhookDelivery, error)
+	GetDelivery(ctx context.Context, subscriptionID int, deliveryID int64) (*model.WebhookDelivery, []model.WebhookDeliveryAttempt, error)
+	Redeliver(ctx context.Context, admin *model.User, subscriptionID int, deliveryID int64, client model.ClientInfo) error
+}
+
+type WebhookService struct {
+	repository repository.WebhookRepositoryInstance
+	recorder   audit.RecorderInstance
+	logger     *slog.Logger
+}
+
+func NewWebhookService(repo repository.WebhookRepositoryInstance, recorder audit.RecorderInstance, logger *slog.Logger) WebhookServiceInstance {
+	return &WebhookService{
+		repository: repo,
+		recorder:   recorder,
+		logger:     logger,
+	}
+}
+
+// CreateSubscription stores subscription with a freshly generated signing
+// secret, which is set on subscription so it can be shown to the admin once.
+func (s *WebhookService) CreateSubscription(ctx context.Context, admin *model.User, subscription *model.WebhookSubscription, client model.ClientInfo) error {
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		return fmt.Errorf("failed while generating webhook secret: %w", err)
+	}
+	subscription.Secret = secret
+
+	err = s.repository.InsertWebhookSubscription(ctx, subscription)
+	s.recordAdminAction(admin, "webhook_create", err, client)
+	if err != nil {
+		s.logger.ErrorContext(ctx,
+			"Failed while creating webhook subscription",
+			"admin_id", admin.ID,
+			"error", err,
+		)
+
+		return fmt.Errorf("failed while creating webhook subscription: %w", err)
+	}
+
+	s.logger.InfoContext(ctx,
+		"Webhook subscription created",
+		"admin_id", admin.ID,
+		"subscription_id", subscription.ID,
+		"event_types", subscription.EventTypes,
+	)
+
+	return nil
+}
+
+func (s *WebhookService) ListSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error) {
+	subscriptions, err := s.repository.ListWebhookSubscriptions(ctx)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed while listing webhook subscriptions", "error", err)
+
+		return nil, fmt.Errorf("failed while listing webhook subscriptions: %w", err)
+	}
+
+	return subscriptions, nil
+}
+
+func (s *WebhookService) GetSubscription(ctx context.Context, id int) (*model.WebhookSubscription, error) {
+	subscription, err := s.repository.GetWebhookSubscription(ctx, id)
+	if err != nil {
+		if errors.Is(err, helper.ErrWebhookNotFound) {
+			return nil, err
+		}
+
+		s.logger.ErrorContext(ctx,
+			"Failed while getting webhook subscription",
+			"subscription_id", id,
+			"error", err,
+		)
+
+		return nil, fmt.Errorf("failed while getting webhook subscription %d: %w", id, err)
+	}
+
+	return subscription, nil
+}
+
+// DeleteSubscription stops deliveries to the subscription and discards its
+// delivery log.
+func (s *WebhookService) DeleteSubscription(ctx context.Context, admin *model.User, id int, client model.ClientInfo) error {
+	err := s.repository.DeleteWebhookSubscription(ctx, id)
+	if errors.Is(err, helper.ErrWebhookNotFound) {
+		return err
+	}
+	s.recordAdminAction(admin, "webhook_delete", err, client)
+	if err != nil {
+		s.logger.ErrorContext(ctx,
+			"Failed while deleting webhook subscription",
+			"admin_id", admin.ID,
+			"subscription_id", id,
+			"error", err,
+		)
+
+		return fmt.Errorf("failed while deleting webhook subscription %d: %w", id, err)
+	}
+
+	s.logger.InfoContext(ctx,
+		"Webhook subscription deleted",
+		"admin_id", admin.ID,
+		"subscription_id", id,
+	)
+
+	return nil
+}
+
+// ListDeliveries returns a page of the subscription's delivery log, newest
+// first.
+func (s *WebhookService) ListDeliveries(ctx context.Context, filter model.WebhookDeliveryFilter) ([]model.WebhookDelivery, error) {
+	if _, err := s.GetSubscription(ctx, filter.SubscriptionID); err != nil {
+		return nil, err
+	}
+
+	deliveries, err := s.repository.ListWebhookDeliveries(ctx, filter)
+	if err != nil {
+		s.logger.ErrorContext(ctx,
+			"Failed while listing webhook deliveries",
+			"subscription_id", filter.SubscriptionID,
+			"error", err,
+		)
+
+		return nil, fmt.Errorf("failed while listing webhook deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// GetDelivery returns a delivery of the subscription along with every
+// attempt made at it.
+func (s *WebhookService) GetDelivery(ctx context.Context, subscriptionID int, deliveryID int64) (*model.WebhookDelivery, []model.WebhookDeliveryAttempt, error) {
+	delivery, err := s.delivery(ctx, subscriptionID, deliveryID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	attempts, err := s.repository.ListWebhookDeliveryAttempts(ctx, deliveryID)
+	if err != nil {
+		s.logger.ErrorContext(ctx,
+			"Failed while listing webhook delivery attempts",
+			"delivery_id", deliveryID,
+			"error", err,
+		)
+
+		return nil, nil, fmt.Errorf("failed while listing webhook delivery attempts: %w", err)
+	}
+
+	return delivery, attempts, nil
+}
+
+// Redeliver queues the delivery to be sent again right away with a fresh
+// set of attempts, whatever its status. It is how dead-lettered deliveries
+// are retried once the partner's endpoint is fixed.
+func (s *WebhookService) Redeliver(ctx context.Context, admin *model.User, subscriptionID int, deliveryID int64, client model.ClientInfo) error {
+	if _, err := s.delivery(ctx, subscriptionID, deliveryID); err != nil {
+		return err
+	}
+
+	err := s.repository.RedeliverWebhookDelivery(ctx, deliveryID, time.Now())
+	if errors.Is(err, helper.ErrWebhookDeliveryNotFound) {
+		return err
+	}
+	s.recordAdminAction(admin, "webhook_redeliver", err, client)
+	if err != nil {
+		s.logger.ErrorContext(ctx,
+			"Failed while redelivering webhook",
+			"admin_id", admin.ID,
+			"delivery_id", deliveryID,
+			"error", err,
+		)
+
+		return fmt.Errorf("failed while redelivering webhook delivery %d: %w", deliveryID, err)
+	}
+
+	s.logger.InfoContext(ctx,
+		"Webhook delivery queued for redelivery",
+		"admin_id", admin.ID,
+		"subscription_id", subscriptionID,
+		"delivery_id", deliveryID,
+	)
+
+	return nil
+}
+
+// delivery gets a delivery and checks that it belongs to the subscription,
+// so that IDs from another subscription's log are not found.
+func (s *WebhookService) delivery(ctx context.Context, subscriptionID int, deliveryID int64) (*model.WebhookDelivery, error) {
+	delivery, err := s.repository.GetWebhookDelivery(ctx, deliveryID)
+	if err != nil {
+		if errors.Is(err, helper.ErrWebhookDeliveryNotFound) {
+			return nil, err
+		}
+
+		s.logger.ErrorContext(ctx,
+			"Failed while getting webhook delivery",
+			"delivery_id", deliveryID,
+			"error", err,
+		)
+
+		return nil, fmt.Errorf("failed while getting webhook delivery %d: %w", deliveryID, err)
+	}
+
+	if delivery.SubscriptionID != subscriptionID {
+		return nil, helper.ErrWebhookDeliveryNotFound
+	}
+
+	return delivery, nil
+}
+
+func (s *WebhookService) recordAdminAction(admin *model.User, reason string, err error, client model.ClientInfo) {
+	outcome := model.OutcomeSuccess
+	if err != nil {
+		outcome = model.OutcomeFailure
+	}
+
+	s.recorder.Record(model.AuthEvent{
+		Type:      model.AuthEventAdminAction,
+		Outcome:   outcome,
+		Reason:    reason,
+		ActorID:   &admin.ID,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+	})
+}
@@ -0,0 +1,95 @@
+package session
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const DefaultFlushInterval = 30 * time.Second
+
+// Store persists a batch of session last-seen timestamps.
+type Store interface {
+	TouchSessions(ctx context.Context, lastSeen map[string]time.Time) error
+}
+
+// Tracker buffers session last-seen updates in memory and writes them in
+// batches, so authenticating a request never costs a database write.
+type Tracker struct {
+	store    Store
+	logger   *slog.Logger
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending map[string]time.Time
+}
+
+func NewTracker(store Store, logger *slog.Logger, interval time.Duration) *Tracker {
+	if interval <= 0 {
+		interval = DefaultFlushInterval
+	}
+
+	return &Tracker{
+		store:    store,
+		logger:   logger,
+		interval: interval,
+		pending:  make(map[string]time.Time),
+	}
+}
+
+// Touch records that the session was seen at t. Only the latest timestamp
+// per session is kept until the next flush.
+func (t *Tracker) Touch(id string, seen time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if prev, ok := t.pending[id]; !ok || seen.After(prev) {
+		t.pending[id] = seen
+	}
+}
+
+// Flush writes all pending timestamps. On failure they are put back so the
+// next flush retries them.
+func (t *Tracker) Flush(ctx context.Context) error {
+	t.mu.Lock()
+	batch := t.pending
+	t.pending = make(map[string]time.Time)
+	t.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	if err := t.store.TouchSessions(ctx, batch); err != nil {
+		for id, seen := range batch {
+			t.Touch(id, seen)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Run flushes on every interval until ctx is cancelled, then flushes once
+// more so no updates are lost on shutdown.
+func (t *Tracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := t.Flush(ctx); err != nil {
+				t.logger.Error("Failed while flushing session last-seen updates", "error", err)
+			}
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := t.Flush(flushCtx); err != nil {
+				t.logger.Error("Failed while flushing session last-seen updates", "error", err)
+			}
+			cancel()
+			return
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+)
+
+type mockStore struct {
+	MockTouchSessions func(ctx context.Context, lastSeen map[string]time.Time) error
+}
+
+func (m *mockStore) TouchSessions(ctx context.Context, lastSeen map[string]time.Time) error {
+	return m.MockTouchSessions(ctx, lastSeen)
+}
+
+func TestTrackerBatchesLatestTimestamp(t *testing.T) {
+	var calls int
+	var flushed map[string]time.Time
+	store := &mockStore{
+		MockTouchSessions: func(ctx context.Context, lastSeen map[string]time.Time) error {
+			calls++
+			flushed = lastSeen
+			return nil
+		},
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	tracker := NewTracker(store, logger, time.Minute)
+
+	base := time.Now()
+	tracker.Touch("a", base)
+	tracker.Touch("a", base.Add(2*time.Second))
+	tracker.Touch("a", base.Add(time.Second))
+	tracker.Touch("b", base)
+
+	if err := tracker.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != 1 {
+		t.Fatalf("expected a single batched write, got %d", calls)
+	}
+	if len(flushed) != 2 || !flushed["a"].Equal(base.Add(2*time.Second)) {
+		t.Errorf("unexpected batch %v", flushed)
+	}
+
+	if err := tracker.Flush(context.Background()); err != nil || calls != 1 {
+		t.Errorf("empty flush should not write, got %d calls, %v", calls, err)
+	}
+}
+
+func TestTrackerRetriesFailedBatch(t *testing.T) {
+	fail := true
+	var flushed map[string]time.Time
+	store := &mockStore{
+		MockTouchSessions: func(ctx context.Context, lastSeen map[string]time.Time) error {
+			if fail {
+				return errors.New("db down")
+			}
+			flushed = lastSeen
+			return nil
+		},
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	tracker := NewTracker(store, logger, time.Minute)
+
+	tracker.Touch("a", time.Now())
+	if err := tracker.Flush(context.Background()); err == nil {
+		t.Fatal("expected flush error")
+	}
+
+	fail = false
+	if err := tracker.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := flushed["a"]; !ok {
+		t.Error("expected failed update to be retried")
+	}
+}
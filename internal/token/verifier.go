@@ -0,0 +1,150 @@
+// Package token verifies access tokens. JWTMiddleware, the gRPC API and
+// token introspection all go through Verifier, so every transport accepts and
+// rejects exactly the same tokens.
+package token
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/helper"
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/dosedaf/syncup-users-service/internal/repository"
+	"github.com/dosedaf/syncup-users-service/internal/session"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Scopes granted by access tokens. Tokens carry no scope claim, so they
+// grant what their user's role allows.
+const (
+	ScopeUser  = "user"
+	ScopeAdmin = "admin"
+)
+
+// Identity is who a valid access token belongs to.
+type Identity struct {
+	User      *model.User
+	Session   *model.Session
+	Issuer    string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// Scopes lists what the token grants, narrowest first.
+func (i *Identity) Scopes() []string {
+	if i.User.Role == model.RoleAdmin {
+		return []string{ScopeUser, ScopeAdmin}
+	}
+
+	return []string{ScopeUser}
+}
+
+type Verifier struct {
+	users    repository.RepositoryInstance
+	sessions repository.SessionRepositoryInstance
+	tracker  *session.Tracker
+	logger   *slog.Logger
+	secret   []byte
+}
+
+func NewVerifier(users repository.RepositoryInstance, sessions repository.SessionRepositoryInstance, tracker *session.Tracker, logger *slog.Logger, secret string) *Verifier {
+	return &Verifier{
+		users:    users,
+		sessions: sessions,
+		tracker:  tracker,
+		logger:   logger,
+		secret:   []byte(secret),
+	}
+}
+
+// Authenticate verifies the token of a request its user made, and counts
+// it as activity on the token's session.
+func (v *Verifier) Authenticate(ctx context.Context, tokenStr string) (*Identity, error) {
+	identity, err := v.Verify(ctx, tokenStr)
+	if err != nil {
+		return nil, err
+	}
+
+	v.tracker.Touch(identity.Session.ID, time.Now())
+
+	return identity, nil
+}
+
+// Verify checks an access token: its signature and expiry, that its user
+// still exists and that its session has not been revoked. It leaves the
+// session's activity alone, so other services checking a token on the
+// user's behalf do not keep an idle session alive. Unusable tokens fail
+// with ErrUnauthorized, or ErrSessionRevoked when only their session is
+// gone; any other error is an internal failure. Rejected reports whether an
+// error is one of those.
+func (v *Verifier) Verify(ctx context.Context, tokenStr string) (*Identity, error) {
+	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return v.secret, nil
+	})
+
+	if err != nil {
+		v.logger.InfoContext(ctx, "invalid JWT", "error", err)
+		return nil, helper.WithMessage(helper.ErrUnauthorized, "invalid or expired token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, helper.WithMessage(helper.ErrUnauthorized, "invalid token claims")
+	}
+
+	email, _ := claims.GetSubject()
+	user, err := v.users.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, helper.ErrUserNotFound) {
+			return nil, helper.WithMessage(helper.ErrUnauthorized, "user not found")
+		}
+
+		v.logger.ErrorContext(ctx, "Failed while loading token user", "error", err)
+		return nil, err
+	}
+
+	// only access tokens name a session; this also keeps the single purpose
+	// tokens of emailed links from being used as one
+	sessionID, _ := claims["sid"].(string)
+	if sessionID == "" {
+		return nil, helper.WithMessage(helper.ErrUnauthorized, "invalid token claims")
+	}
+
+	sess, err := v.sessions.GetSession(ctx, sessionID)
+	if err != nil {
+		// a signed token outlives its session once old sessions are pruned
+		if errors.Is(err, helper.ErrSessionNotFound) {
+			return nil, helper.ErrSessionRevoked
+		}
+
+		v.logger.ErrorContext(ctx, "Failed while loading token session", "error", err)
+		return nil, err
+	}
+
+	if sess.RevokedAt != nil || sess.UserID != user.ID {
+		v.logger.InfoContext(ctx, "Rejected token for revoked session", "user_id", user.ID)
+		return nil, helper.ErrSessionRevoked
+	}
+
+	identity := &Identity{User: user, Session: sess}
+	identity.Issuer, _ = claims.GetIssuer()
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		identity.IssuedAt = iat.Time
+	}
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		identity.ExpiresAt = exp.Time
+	}
+
+	return identity, nil
+}
+
+// Rejected reports whether err from Verify or Authenticate means the token
+// is unusable, as opposed to an internal failure.
+func Rejected(err error) bool {
+	return errors.Is(err, helper.ErrUnauthorized) || errors.Is(err, helper.ErrSessionRevoked)
+}
@@ -0,0 +1,108 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/helper"
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/dosedaf/syncup-users-service/internal/repository/memory"
+	"github.com/dosedaf/syncup-users-service/internal/session"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "a test secret that is long enough for HS256"
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	users := memory.NewUserRepository()
+	sessions := memory.NewSessionRepository()
+	tracker := session.NewTracker(sessions, logger, time.Minute)
+	verifier := NewVerifier(users, sessions, tracker, logger, testSecret)
+
+	user, err := users.InsertUser(ctx, model.Credential{Email: "someone@example.com", Password: "unused"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess := &model.Session{ID: "session-1", UserID: user.ID, CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)}
+	if err := sessions.InsertSession(ctx, sess); err != nil {
+		t.Fatal(err)
+	}
+
+	issuedAt := time.Now().Add(-time.Minute).Truncate(time.Second)
+	expiresAt := issuedAt.Add(time.Hour)
+	sign := func(claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSecret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	identity, err := verifier.Verify(ctx, sign(jwt.MapClaims{
+		"sub": "someone@example.com",
+		"sid": "session-1",
+		"iss": "app",
+		"iat": issuedAt.Unix(),
+		"exp": expiresAt.Unix(),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.User.ID != user.ID || identity.Session.ID != "session-1" || identity.Issuer != "app" {
+		t.Errorf("unexpected identity %+v", identity)
+	}
+	if !identity.IssuedAt.Equal(issuedAt) || !identity.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("expected issued at %v and expiry %v, got %v and %v", issuedAt, expiresAt, identity.IssuedAt, identity.ExpiresAt)
+	}
+	if scopes := identity.Scopes(); len(scopes) != 1 || scopes[0] != ScopeUser {
+		t.Errorf("expected only the user scope, got %v", scopes)
+	}
+
+	lastSeen := func() time.Time {
+		t.Helper()
+		if err := tracker.Flush(ctx); err != nil {
+			t.Fatal(err)
+		}
+		sess, err := sessions.GetSession(ctx, "session-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sess.LastSeenAt
+	}
+	if seen := lastSeen(); !seen.Equal(sess.LastSeenAt) {
+		t.Errorf("expected Verify to leave the session untouched, got last seen %v", seen)
+	}
+
+	access := sign(jwt.MapClaims{"sub": "someone@example.com", "sid": "session-1", "exp": expiresAt.Unix()})
+	if _, err := verifier.Authenticate(ctx, access); err != nil {
+		t.Fatal(err)
+	}
+	if seen := lastSeen(); !seen.After(sess.LastSeenAt) {
+		t.Error("expected Authenticate to count as session activity")
+	}
+
+	if err := sessions.RevokeSession(ctx, user.ID, "session-1"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = verifier.Verify(ctx, sign(jwt.MapClaims{
+		"sub": "someone@example.com",
+		"sid": "session-1",
+		"exp": expiresAt.Unix(),
+	}))
+	if !errors.Is(err, helper.ErrSessionRevoked) || !Rejected(err) {
+		t.Errorf("expected ErrSessionRevoked for a revoked session, got %v", err)
+	}
+}
+
+func TestScopes(t *testing.T) {
+	admin := &Identity{User: &model.User{Role: model.RoleAdmin}}
+	if scopes := admin.Scopes(); len(scopes) != 2 || scopes[0] != ScopeUser || scopes[1] != ScopeAdmin {
+		t.Errorf("expected user and admin scopes, got %v", scopes)
+	}
+}
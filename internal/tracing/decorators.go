@@ -0,0 +1,216 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/dosedaf/syncup-users-service/internal/handler"
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/dosedaf/syncup-users-service/internal/repository"
+	"github.com/dosedaf/syncup-users-service/internal/service"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// None of the decorators record method arguments apart from ids: they carry
+// passwords, tokens and emails.
+
+type tracedHandler struct {
+	next   handler.HandlerInstance
+	tracer trace.Tracer
+}
+
+// Handler adds a span around every HandlerInstance method.
+func (t *Tracing) Handler(next handler.HandlerInstance) handler.HandlerInstance {
+	return &tracedHandler{next: next, tracer: t.tracer}
+}
+
+func (h *tracedHandler) serve(name string, next handler.Func, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := h.tracer.Start(r.Context(), "handler."+name)
+	err := next(w, r.WithContext(ctx))
+	end(span, err)
+
+	return err
+}
+
+func (h *tracedHandler) Register(w http.ResponseWriter, r *http.Request) error {
+	return h.serve("Register", h.next.Register, w, r)
+}
+
+func (h *tracedHandler) Login(w http.ResponseWriter, r *http.Request) error {
+	return h.serve("Login", h.next.Login, w, r)
+}
+
+func (h *tracedHandler) Me(w http.ResponseWriter, r *http.Request) error {
+	return h.serve("Me", h.next.Me, w, r)
+}
+
+func (h *tracedHandler) Sessions(w http.ResponseWriter, r *http.Request) error {
+	return h.serve("Sessions", h.next.Sessions, w, r)
+}
+
+func (h *tracedHandler) RevokeSession(w http.ResponseWriter, r *http.Request) error {
+	return h.serve("RevokeSession", h.next.RevokeSession, w, r)
+}
+
+func (h *tracedHandler) ReportNotMe(w http.ResponseWriter, r *http.Request) error {
+	return h.serve("ReportNotMe", h.next.ReportNotMe, w, r)
+}
+
+func (h *tracedHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) error {
+	return h.serve("ForgotPassword", h.next.ForgotPassword, w, r)
+}
+
+func (h *tracedHandler) ResetPassword(w http.ResponseWriter, r *http.Request) error {
+	return h.serve("ResetPassword", h.next.ResetPassword, w, r)
+}
+
+type tracedService struct {
+	next   service.ServiceInstance
+	tracer trace.Tracer
+}
+
+// Service adds a span around every ServiceInstance method.
+func (t *Tracing) Service(next service.ServiceInstance) service.ServiceInstance {
+	return &tracedService{next: next, tracer: t.tracer}
+}
+
+func (s *tracedService) Register(ctx context.Context, credential model.Credential, client model.ClientInfo) error {
+	ctx, span := s.tracer.Start(ctx, "service.Register")
+	err := s.next.Register(ctx, credential, client)
+	end(span, err)
+
+	return err
+}
+
+func (s *tracedService) Login(ctx context.Context, credential model.Credential, client model.ClientInfo) (string, error) {
+	ctx, span := s.tracer.Start(ctx, "service.Login")
+	token, err := s.next.Login(ctx, credential, client)
+	end(span, err)
+
+	return token, err
+}
+
+func (s *tracedService) GetUser(ctx context.Context, id int) (*model.User, error) {
+	ctx, span := s.tracer.Start(ctx, "service.GetUser", trace.WithAttributes(semconv.EnduserID(strconv.Itoa(id))))
+	user, err := s.next.GetUser(ctx, id)
+	end(span, err)
+
+	return user, err
+}
+
+func (s *tracedService) BatchGetUsers(ctx context.Context, ids []int) ([]model.User, error) {
+	ctx, span := s.tracer.Start(ctx, "service.BatchGetUsers")
+	users, err := s.next.BatchGetUsers(ctx, ids)
+	end(span, err)
+
+	return users, err
+}
+
+func (s *tracedService) ListSessions(ctx context.Context, userID int) ([]model.Session, error) {
+	ctx, span := s.tracer.Start(ctx, "service.ListSessions", trace.WithAttributes(semconv.EnduserID(strconv.Itoa(userID))))
+	sessions, err := s.next.ListSessions(ctx, userID)
+	end(span, err)
+
+	return sessions, err
+}
+
+func (s *tracedService) RevokeSession(ctx context.Context, userID int, sessionID string, client model.ClientInfo) error {
+	ctx, span := s.tracer.Start(ctx, "service.RevokeSession", trace.WithAttributes(semconv.EnduserID(strconv.Itoa(userID))))
+	err := s.next.RevokeSession(ctx, userID, sessionID, client)
+	end(span, err)
+
+	return err
+}
+
+func (s *tracedService) ReportNotMe(ctx context.Context, token string, client model.ClientInfo) error {
+	ctx, span := s.tracer.Start(ctx, "service.ReportNotMe")
+	err := s.next.ReportNotMe(ctx, token, client)
+	end(span, err)
+
+	return err
+}
+
+func (s *tracedService) ForgotPassword(ctx context.Context, email string, client model.ClientInfo) error {
+	ctx, span := s.tracer.Start(ctx, "service.ForgotPassword")
+	err := s.next.ForgotPassword(ctx, email, client)
+	end(span, err)
+
+	return err
+}
+
+func (s *tracedService) ResetPassword(ctx context.Context, token string, newPassword string, client model.ClientInfo) error {
+	ctx, span := s.tracer.Start(ctx, "service.ResetPassword")
+	err := s.next.ResetPassword(ctx, token, newPassword, client)
+	end(span, err)
+
+	return err
+}
+
+type tracedUserRepository struct {
+	next   repository.RepositoryInstance
+	tracer trace.Tracer
+}
+
+// UserRepository adds a span around every RepositoryInstance method. The
+// SQL itself shows up as child spans from QueryTracer.
+func (t *Tracing) UserRepository(next repository.RepositoryInstance) repository.RepositoryInstance {
+	return &tracedUserRepository{next: next, tracer: t.tracer}
+}
+
+func (r *tracedUserRepository) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	ctx, span := r.tracer.Start(ctx, "repository.GetUserByEmail")
+	user, err := r.next.GetUserByEmail(ctx, email)
+	end(span, err)
+
+	return user, err
+}
+
+func (r *tracedUserRepository) GetUserByID(ctx context.Context, id int) (*model.User, error) {
+	ctx, span := r.tracer.Start(ctx, "repository.GetUserByID", trace.WithAttributes(semconv.EnduserID(strconv.Itoa(id))))
+	user, err := r.next.GetUserByID(ctx, id)
+	end(span, err)
+
+	return user, err
+}
+
+func (r *tracedUserRepository) GetUsersByIDs(ctx context.Context, ids []int) ([]model.User, error) {
+	ctx, span := r.tracer.Start(ctx, "repository.GetUsersByIDs")
+	users, err := r.next.GetUsersByIDs(ctx, ids)
+	end(span, err)
+
+	return users, err
+}
+
+func (r *tracedUserRepository) IsEmailAvailable(ctx context.Context, email string) error {
+	ctx, span := r.tracer.Start(ctx, "repository.IsEmailAvailable")
+	err := r.next.IsEmailAvailable(ctx, email)
+	end(span, err)
+
+	return err
+}
+
+func (r *tracedUserRepository) InsertUser(ctx context.Context, credential model.Credential, pepperVersion int) (*model.User, error) {
+	ctx, span := r.tracer.Start(ctx, "repository.InsertUser")
+	user, err := r.next.InsertUser(ctx, credential, pepperVersion)
+	end(span, err)
+
+	return user, err
+}
+
+func (r *tracedUserRepository) UpdatePasswordHash(ctx context.Context, email string, passwordHash string, pepperVersion int) error {
+	ctx, span := r.tracer.Start(ctx, "repository.UpdatePasswordHash")
+	err := r.next.UpdatePasswordHash(ctx, email, passwordHash, pepperVersion)
+	end(span, err)
+
+	return err
+}
+
+func (r *tracedUserRepository) SetPasswordResetRequired(ctx context.Context, userID int, required bool) error {
+	ctx, span := r.tracer.Start(ctx, "repository.SetPasswordResetRequired", trace.WithAttributes(semconv.EnduserID(strconv.Itoa(userID))))
+	err := r.next.SetPasswordResetRequired(ctx, userID, required)
+	end(span, err)
+
+	return err
+}
@@ -0,0 +1,50 @@
+package tracing
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/dosedaf/syncup-users-service/middleware"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware continues the trace from the caller's traceparent header, or
+// starts a new one, and wraps the request in a server span. It should be
+// the outermost handler so everything below runs inside the span.
+func (t *Tracing) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := t.propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := t.tracer.Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+			),
+		)
+		defer span.End()
+
+		rec := middleware.NewResponseRecorder(w)
+		middleware.ServeWithContext(ctx, next, rec, r)
+
+		if r.Pattern != "" {
+			span.SetName(r.Pattern)
+			span.SetAttributes(semconv.HTTPRoute(routeOf(r.Pattern)))
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(rec.Status()))
+		if rec.Status() >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rec.Status()))
+		}
+	})
+}
+
+// routeOf strips the method from a ServeMux pattern such as
+// "GET /api/v1/me".
+func routeOf(pattern string) string {
+	if i := strings.Index(pattern, " "); i >= 0 {
+		return pattern[i+1:]
+	}
+	return pattern
+}
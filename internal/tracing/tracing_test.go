@@ -0,0 +1,156 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dosedaf/syncup-users-service/internal/handler"
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/jackc/pgx/v5"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const testPassword = "correct horse battery staple"
+
+type stubService struct {
+	logger *slog.Logger
+}
+
+func (s *stubService) Register(ctx context.Context, credential model.Credential, client model.ClientInfo) error {
+	return nil
+}
+
+func (s *stubService) Login(ctx context.Context, credential model.Credential, client model.ClientInfo) (string, error) {
+	s.logger.InfoContext(ctx, "login")
+	return "token", nil
+}
+
+func (s *stubService) GetUser(ctx context.Context, id int) (*model.User, error) {
+	return nil, nil
+}
+
+func (s *stubService) BatchGetUsers(ctx context.Context, ids []int) ([]model.User, error) {
+	return nil, nil
+}
+
+func (s *stubService) ListSessions(ctx context.Context, userID int) ([]model.Session, error) {
+	return nil, nil
+}
+
+func (s *stubService) RevokeSession(ctx context.Context, userID int, sessionID string, client model.ClientInfo) error {
+	return nil
+}
+
+func (s *stubService) ReportNotMe(ctx context.Context, token string, client model.ClientInfo) error {
+	return nil
+}
+
+func (s *stubService) ForgotPassword(ctx context.Context, email string, client model.ClientInfo) error {
+	return nil
+}
+
+func (s *stubService) ResetPassword(ctx context.Context, token string, newPassword string, client model.ClientInfo) error {
+	return nil
+}
+
+func newRecorder() (*tracetest.SpanRecorder, *Tracing) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	return recorder, New(provider)
+}
+
+func TestSpansFollowIncomingTraceContext(t *testing.T) {
+	recorder, tr := newRecorder()
+
+	var logs bytes.Buffer
+	logger := slog.New(NewLogHandler(slog.NewTextHandler(&logs, nil)))
+
+	h := tr.Handler(handler.NewUserHandler(tr.Service(&stubService{logger: logger}), logger))
+	mux := http.NewServeMux()
+	mux.Handle("POST /api/v1/login", handler.NewErrorHandler(logger).Handle(h.Login))
+
+	body := `{"email": "someone@example.com", "password": "` + testPassword + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/login", strings.NewReader(body))
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+
+	tr.Middleware(mux).ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	spans := recorder.Ended()
+	byName := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range spans {
+		if span.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("span %s did not continue the incoming trace", span.Name())
+		}
+		for _, attr := range span.Attributes() {
+			if strings.Contains(attr.Value.Emit(), testPassword) {
+				t.Errorf("span %s leaked the password in %s", span.Name(), attr.Key)
+			}
+		}
+		byName[span.Name()] = span
+	}
+
+	server, ok := byName["POST /api/v1/login"]
+	if !ok {
+		t.Fatalf("expected a server span named after the route, got %d spans", len(spans))
+	}
+	if server.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("server span parent should be the remote caller, got %s", server.Parent().SpanID())
+	}
+
+	handlerSpan, ok := byName["handler.Login"]
+	if !ok || handlerSpan.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Fatal("expected handler.Login as a child of the server span")
+	}
+	serviceSpan, ok := byName["service.Login"]
+	if !ok || serviceSpan.Parent().SpanID() != handlerSpan.SpanContext().SpanID() {
+		t.Fatal("expected service.Login as a child of handler.Login")
+	}
+
+	if !strings.Contains(logs.String(), "trace_id=4bf92f3577b34da6a3ce929d0e0e4736") {
+		t.Errorf("expected trace id in log output:\n%s", logs.String())
+	}
+	if !strings.Contains(logs.String(), "span_id="+serviceSpan.SpanContext().SpanID().String()) {
+		t.Errorf("expected service span id in log output:\n%s", logs.String())
+	}
+}
+
+func TestQueryTracerRecordsSQLNotArguments(t *testing.T) {
+	recorder, tr := newRecorder()
+	qt := tr.QueryTracer()
+
+	sql := "UPDATE users SET password_hash=@password_hash WHERE email=@email"
+	ctx := qt.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{
+		SQL:  sql,
+		Args: []any{pgx.NamedArgs{"password_hash": testPassword, "email": "someone@example.com"}},
+	})
+	qt.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+
+	spans := recorder.Ended()
+	if len(spans) != 1 || spans[0].Name() != "UPDATE" {
+		t.Fatalf("expected a single UPDATE span, got %v", spans)
+	}
+
+	var recorded string
+	for _, attr := range spans[0].Attributes() {
+		if attr.Key == "db.query.text" {
+			recorded = attr.Value.AsString()
+		}
+		if strings.Contains(attr.Value.Emit(), testPassword) || strings.Contains(attr.Value.Emit(), "someone@example.com") {
+			t.Errorf("query span leaked an argument in %s", attr.Key)
+		}
+	}
+	if recorded != sql {
+		t.Errorf("expected the SQL text as an attribute, got %q", recorded)
+	}
+}
@@ -0,0 +1,322 @@
+// Package webhook delivers user lifecycle events to the HTTP endpoints of
+// partner subscriptions. Events reach it through the outbox: the Enqueuer
+// turns each one into a delivery per interested subscription and the
+// Dispatcher sends them, signed, retrying with backoff until they are
+// delivered or dead-lettered.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/helper"
+	"github.com/dosedaf/syncup-users-service/internal/model"
+)
+
+const (
+	DefaultPollInterval = time.Second
+	DefaultTimeout      = 10 * time.Second
+	// with the default backoff, ten attempts span about three hours
+	DefaultMaxAttempts = 10
+	DefaultBatchSize   = 50
+	DefaultConcurrency = 8
+	DefaultLease       = time.Minute
+	DefaultMinBackoff  = 30 * time.Second
+	DefaultMaxBackoff  = time.Hour
+
+	// maxErrorBody bounds how much of a failed response is kept in the log.
+	maxErrorBody = 256
+)
+
+type Config struct {
+	PollInterval time.Duration
+	Timeout      time.Duration
+	MaxAttempts  int
+}
+
+// Store is the part of the webhook repository the Dispatcher uses.
+type Store interface {
+	GetWebhookSubscription(ctx context.Context, id int) (*model.WebhookSubscription, error)
+	ClaimWebhookDeliveries(ctx context.Context, now time.Time, leaseUntil time.Time, limit int) ([]model.WebhookDelivery, error)
+	RecordWebhookAttempt(ctx context.Context, attempt model.WebhookDeliveryAttempt, status string, nextAttemptAt time.Time) error
+}
+
+// Dispatcher sends due deliveries. Every attempt is logged; a delivery that
+// fails maxAttempts times in a row is dead-lettered and waits for an admin
+// to redeliver it. Deliveries are independent, so unlike the outbox a
+// failing one does not hold up later events of the same user, and
+// receivers should order events by occurred_at if they care.
+type Dispatcher struct {
+	store        Store
+	client       *http.Client
+	logger       *slog.Logger
+	pollInterval time.Duration
+	batchSize    int
+	concurrency  int
+	timeout      time.Duration
+	lease        time.Duration
+	maxAttempts  int
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+	now          func() time.Time
+}
+
+func NewDispatcher(store Store, logger *slog.Logger, config Config) *Dispatcher {
+	if config.PollInterval <= 0 {
+		config.PollInterval = DefaultPollInterval
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultTimeout
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = DefaultMaxAttempts
+	}
+
+	return &Dispatcher{
+		store: store,
+		client: &http.Client{
+			Timeout: config.Timeout,
+			// a redirect is a misconfigured endpoint, not a delivery
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		logger:       logger,
+		pollInterval: config.PollInterval,
+		batchSize:    DefaultBatchSize,
+		concurrency:  DefaultConcurrency,
+		timeout:      config.Timeout,
+		lease:        max(DefaultLease, batchLease(DefaultBatchSize, DefaultConcurrency, config.Timeout)),
+		maxAttempts:  config.MaxAttempts,
+		minBackoff:   DefaultMinBackoff,
+		maxBackoff:   DefaultMaxBackoff,
+		now:          time.Now,
+	}
+}
+
+// batchLease is how long a batch may take when every attempt times out:
+// one timeout per wave of concurrent attempts, and one to spare for the
+// claim and the lookups around them.
+func batchLease(batchSize, concurrency int, timeout time.Duration) time.Duration {
+	waves := (batchSize + concurrency - 1) / concurrency
+	return time.Duration(waves+1) * timeout
+}
+
+// Run sends due deliveries until ctx is cancelled. Attempts cut short by
+// the cancellation are not logged and are made again after their lease.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if d.dispatchBatch(ctx) == d.batchSize && ctx.Err() == nil {
+			continue
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// dispatchBatch sends one batch, several deliveries at a time, and returns
+// how many deliveries it claimed.
+func (d *Dispatcher) dispatchBatch(ctx context.Context) int {
+	now := d.now()
+	leaseUntil := now.Add(d.lease)
+	deliveries, err := d.store.ClaimWebhookDeliveries(ctx, now, leaseUntil, d.batchSize)
+	if err != nil {
+		if ctx.Err() == nil {
+			d.logger.ErrorContext(ctx, "Failed while claiming webhook deliveries", "error", err)
+		}
+		return 0
+	}
+
+	subscriptions := make(map[int]*model.WebhookSubscription)
+	for _, delivery := range deliveries {
+		if _, ok := subscriptions[delivery.SubscriptionID]; ok {
+			continue
+		}
+
+		subscription, err := d.store.GetWebhookSubscription(ctx, delivery.SubscriptionID)
+		if err != nil && !errors.Is(err, helper.ErrWebhookNotFound) {
+			d.logger.ErrorContext(ctx,
+				"Failed while getting webhook subscription",
+				"subscription_id", delivery.SubscriptionID,
+				"error", err,
+			)
+		}
+		// nil skips the deliveries; a deleted subscription took them with
+		// it and any other failure is retried after the lease
+		subscriptions[delivery.SubscriptionID] = subscription
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, d.concurrency)
+	for _, delivery := range deliveries {
+		subscription := subscriptions[delivery.SubscriptionID]
+		if subscription == nil {
+			continue
+		}
+
+		sem <- struct{}{}
+		// an attempt that could outlast the lease might be sent twice; the
+		// delivery is claimed again once the lease runs out
+		if d.now().Add(d.timeout).After(leaseUntil) {
+			<-sem
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			d.dispatch(ctx, subscription, delivery)
+		}()
+	}
+	wg.Wait()
+
+	return len(deliveries)
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context, subscription *model.WebhookSubscription, delivery model.WebhookDelivery) {
+	attempt := d.send(ctx, subscription, delivery)
+	if attempt.Error != "" && ctx.Err() != nil {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+
+	status, nextAttemptAt := model.WebhookDeliveryDelivered, attempt.AttemptedAt
+	switch {
+	case attempt.Error == "":
+	case delivery.Attempts+1 >= d.maxAttempts:
+		status = model.WebhookDeliveryDead
+		d.logger.WarnContext(ctx,
+			"Webhook delivery dead-lettered",
+			"delivery_id", delivery.ID,
+			"subscription_id", subscription.ID,
+			"event_id", delivery.EventID,
+			"attempts", delivery.Attempts+1,
+			"error", attempt.Error,
+		)
+	default:
+		status = model.WebhookDeliveryPending
+		delay := d.backoff(delivery.Attempts)
+		nextAttemptAt = d.now().Add(delay)
+		d.logger.WarnContext(ctx,
+			"Failed while delivering webhook",
+			"delivery_id", delivery.ID,
+			"subscription_id", subscription.ID,
+			"event_id", delivery.EventID,
+			"attempts", delivery.Attempts+1,
+			"retry_in", delay,
+			"error", attempt.Error,
+		)
+	}
+
+	if err := d.store.RecordWebhookAttempt(ctx, attempt, status, nextAttemptAt); err != nil {
+		d.logger.ErrorContext(ctx,
+			"Failed while recording webhook delivery attempt",
+			"delivery_id", delivery.ID,
+			"error", err,
+		)
+	}
+}
+
+// body is what receivers get, the same shape the outbox publishes.
+type body struct {
+	ID         int64           `json:"id"`
+	Type       string          `json:"type"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// send POSTs delivery once and describes how it went.
+func (d *Dispatcher) send(ctx context.Context, subscription *model.WebhookSubscription, delivery model.WebhookDelivery) model.WebhookDeliveryAttempt {
+	attempt := model.WebhookDeliveryAttempt{
+		DeliveryID:  delivery.ID,
+		AttemptedAt: d.now(),
+	}
+
+	start := time.Now()
+	statusCode, err := d.post(ctx, subscription, delivery, attempt.AttemptedAt)
+	attempt.DurationMS = time.Since(start).Milliseconds()
+	attempt.StatusCode = statusCode
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+
+	return attempt
+}
+
+// post sends the signed request and returns the response status, or 0 when
+// there was none. Any 2xx response counts as delivered.
+func (d *Dispatcher) post(ctx context.Context, subscription *model.WebhookSubscription, delivery model.WebhookDelivery, timestamp time.Time) (int, error) {
+	b, err := json.Marshal(body{
+		ID:         delivery.EventID,
+		Type:       delivery.EventType,
+		OccurredAt: delivery.OccurredAt,
+		Data:       delivery.Payload,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(b))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "SyncUp-Webhooks/1")
+	req.Header.Set(HeaderEventID, strconv.FormatInt(delivery.EventID, 10))
+	req.Header.Set(HeaderEventType, delivery.EventType)
+	req.Header.Set(HeaderDeliveryID, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp.Unix(), 10))
+	req.Header.Set(HeaderSignature, Sign(subscription.Secret, timestamp, b))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	// drain so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg := fmt.Sprintf("unexpected status %d", resp.StatusCode)
+		if s := strings.TrimSpace(string(snippet)); s != "" {
+			msg += ": " + s
+		}
+		return resp.StatusCode, errors.New(msg)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// backoff doubles the delay with every failed attempt, up to maxBackoff.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.minBackoff
+	for range attempts {
+		delay *= 2
+		if delay >= d.maxBackoff {
+			return d.maxBackoff
+		}
+	}
+
+	return delay
+}
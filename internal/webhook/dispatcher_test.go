@@ -0,0 +1,389 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/dosedaf/syncup-users-service/internal/outbox"
+	"github.com/dosedaf/syncup-users-service/internal/repository/memory"
+)
+
+// receiver is a partner endpoint. It checks every request the way partners
+// are told to and answers with the next of its statuses, repeating the last.
+type receiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	secret   string
+	now      func() time.Time
+	statuses []int
+	delay    time.Duration
+	received []body
+	rejected []error
+}
+
+func newReceiver(t *testing.T, secret string, now func() time.Time, statuses ...int) *receiver {
+	t.Helper()
+
+	r := &receiver{secret: secret, now: now, statuses: statuses}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serve))
+	t.Cleanup(r.Close)
+
+	return r
+}
+
+func (r *receiver) serve(w http.ResponseWriter, req *http.Request) {
+	b, _ := io.ReadAll(req.Body)
+	time.Sleep(r.delay)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := Verify(r.secret, req.Header, b, DefaultTolerance, r.now()); err != nil {
+		r.rejected = append(r.rejected, err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var event body
+	if err := json.Unmarshal(b, &event); err != nil || strconv.FormatInt(event.ID, 10) != req.Header.Get(HeaderEventID) {
+		http.Error(w, "bad body", http.StatusBadRequest)
+		return
+	}
+	r.received = append(r.received, event)
+
+	status := r.statuses[0]
+	if len(r.statuses) > 1 {
+		r.statuses = r.statuses[1:]
+	}
+	if status >= 300 {
+		http.Error(w, "try again later", status)
+		return
+	}
+	w.WriteHeader(status)
+}
+
+func (r *receiver) count() (received int, rejected int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.received), len(r.rejected)
+}
+
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// setup subscribes url to registrations and enqueues one registration.
+func setup(t *testing.T, url string) (*memory.WebhookRepository, *model.WebhookSubscription) {
+	t.Helper()
+
+	ctx := context.Background()
+	store := memory.NewWebhookRepository()
+	subscription := &model.WebhookSubscription{URL: url, Secret: "whsec_test", EventTypes: []string{model.UserEventRegistered}}
+	if err := store.InsertWebhookSubscription(ctx, subscription); err != nil {
+		t.Fatal(err)
+	}
+
+	event := model.OutboxEvent{ID: 42, UserID: 1, Type: model.UserEventRegistered, Payload: []byte(`{"user_id":1,"email":"someone@example.com"}`), CreatedAt: time.Now()}
+	if err := NewEnqueuer(store, testLogger()).Publish(ctx, event); err != nil {
+		t.Fatal(err)
+	}
+
+	return store, subscription
+}
+
+func delivery(t *testing.T, store *memory.WebhookRepository, subscriptionID int) (*model.WebhookDelivery, []model.WebhookDeliveryAttempt) {
+	t.Helper()
+
+	ctx := context.Background()
+	deliveries, err := store.ListWebhookDeliveries(ctx, model.WebhookDeliveryFilter{SubscriptionID: subscriptionID})
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("expected one delivery, got %+v, %v", deliveries, err)
+	}
+	attempts, err := store.ListWebhookDeliveryAttempts(ctx, deliveries[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &deliveries[0], attempts
+}
+
+func TestDispatcherDeliversSignedEvents(t *testing.T) {
+	c := &clock{now: time.Now()}
+	rcv := newReceiver(t, "whsec_test", c.Now, http.StatusNoContent)
+	store, subscription := setup(t, rcv.URL)
+	// deliveries are due from when they were enqueued
+	c.Advance(time.Second)
+
+	dispatcher := NewDispatcher(store, testLogger(), Config{})
+	dispatcher.now = c.Now
+	if n := dispatcher.dispatchBatch(context.Background()); n != 1 {
+		t.Fatalf("expected one delivery claimed, got %d", n)
+	}
+
+	if received, rejected := rcv.count(); received != 1 || rejected != 0 {
+		t.Fatalf("expected one verified delivery, got %d received and %d rejected", received, rejected)
+	}
+	event := rcv.received[0]
+	if event.ID != 42 || event.Type != model.UserEventRegistered || !strings.Contains(string(event.Data), "someone@example.com") {
+		t.Errorf("unexpected body %+v", event)
+	}
+
+	d, attempts := delivery(t, store, subscription.ID)
+	if d.Status != model.WebhookDeliveryDelivered || d.Attempts != 1 || d.DeliveredAt == nil {
+		t.Errorf("unexpected delivery %+v", d)
+	}
+	if len(attempts) != 1 || attempts[0].StatusCode != http.StatusNoContent || attempts[0].Error != "" {
+		t.Errorf("unexpected attempt log %+v", attempts)
+	}
+
+	// delivered events are not sent again
+	if n := dispatcher.dispatchBatch(context.Background()); n != 0 {
+		t.Errorf("expected nothing left to claim, got %d", n)
+	}
+}
+
+func TestDispatcherRetriesThenDeadLetters(t *testing.T) {
+	c := &clock{now: time.Now()}
+	rcv := newReceiver(t, "whsec_test", c.Now, http.StatusServiceUnavailable)
+	store, subscription := setup(t, rcv.URL)
+	// deliveries are due from when they were enqueued
+	c.Advance(time.Second)
+
+	dispatcher := NewDispatcher(store, testLogger(), Config{MaxAttempts: 3})
+	dispatcher.now = c.Now
+
+	steps := []struct {
+		advance    time.Duration
+		wantStatus string
+		wantTries  int
+	}{
+		{0, model.WebhookDeliveryPending, 1},
+		// the first retry is after the minimum backoff
+		{DefaultMinBackoff - time.Second, model.WebhookDeliveryPending, 1},
+		{time.Second, model.WebhookDeliveryPending, 2},
+		// and the next one twice as long after that
+		{DefaultMinBackoff, model.WebhookDeliveryPending, 2},
+		{DefaultMinBackoff, model.WebhookDeliveryDead, 3},
+		// dead deliveries wait for an admin
+		{24 * time.Hour, model.WebhookDeliveryDead, 3},
+	}
+
+	for i, step := range steps {
+		c.Advance(step.advance)
+		dispatcher.dispatchBatch(context.Background())
+
+		d, attempts := delivery(t, store, subscription.ID)
+		if d.Status != step.wantStatus || d.Attempts != step.wantTries || len(attempts) != step.wantTries {
+			t.Fatalf("step %d: expected %s after %d attempts, got %s after %d with %d logged", i, step.wantStatus, step.wantTries, d.Status, d.Attempts, len(attempts))
+		}
+	}
+
+	d, attempts := delivery(t, store, subscription.ID)
+	for _, a := range attempts {
+		if a.StatusCode != http.StatusServiceUnavailable || a.Error != "unexpected status 503: try again later" {
+			t.Errorf("unexpected attempt %+v", a)
+		}
+	}
+
+	// once the partner is fixed an admin redelivers
+	rcv.mu.Lock()
+	rcv.statuses = []int{http.StatusOK}
+	rcv.mu.Unlock()
+	if err := store.RedeliverWebhookDelivery(context.Background(), d.ID, c.Now()); err != nil {
+		t.Fatal(err)
+	}
+	dispatcher.dispatchBatch(context.Background())
+
+	d, attempts = delivery(t, store, subscription.ID)
+	if d.Status != model.WebhookDeliveryDelivered || len(attempts) != 4 {
+		t.Errorf("expected the redelivery to succeed and be logged, got %+v with %d attempts", d, len(attempts))
+	}
+}
+
+// enqueue adds registrations after the one setup enqueued.
+func enqueue(t *testing.T, store *memory.WebhookRepository, n int) {
+	t.Helper()
+
+	for id := int64(43); id < 43+int64(n); id++ {
+		event := model.OutboxEvent{ID: id, UserID: 1, Type: model.UserEventRegistered, Payload: []byte(`{}`), CreatedAt: time.Now()}
+		if err := NewEnqueuer(store, testLogger()).Publish(context.Background(), event); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// ids lists the event IDs r got, failing on any it got twice.
+func (r *receiver) ids(t *testing.T) map[int64]bool {
+	t.Helper()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := make(map[int64]bool)
+	for _, event := range r.received {
+		if ids[event.ID] {
+			t.Errorf("event %d was delivered twice", event.ID)
+		}
+		ids[event.ID] = true
+	}
+	return ids
+}
+
+// A batch against a slow receiver keeps its lease until the last attempt,
+// so another dispatcher polling meanwhile sends nothing twice.
+func TestDispatcherLeaseCoversSlowBatch(t *testing.T) {
+	rcv := newReceiver(t, "whsec_test", time.Now, http.StatusOK)
+	rcv.delay = 40 * time.Millisecond
+	store, _ := setup(t, rcv.URL)
+	enqueue(t, store, 3)
+
+	newDispatcher := func() *Dispatcher {
+		d := NewDispatcher(store, testLogger(), Config{Timeout: 50 * time.Millisecond})
+		d.batchSize, d.concurrency = 4, 1
+		d.lease = batchLease(d.batchSize, d.concurrency, d.timeout)
+		return d
+	}
+	first, second := newDispatcher(), newDispatcher()
+
+	done := make(chan int)
+	go func() { done <- first.dispatchBatch(context.Background()) }()
+
+	var stolen int
+	for claimed := -1; claimed < 0; {
+		select {
+		case claimed = <-done:
+			if claimed != 4 {
+				t.Errorf("expected the first dispatcher to claim 4 deliveries, got %d", claimed)
+			}
+		case <-time.After(10 * time.Millisecond):
+			stolen += second.dispatchBatch(context.Background())
+		}
+	}
+
+	if stolen != 0 {
+		t.Errorf("expected the lease to keep the batch, %d deliveries were claimed again", stolen)
+	}
+	if ids := rcv.ids(t); len(ids) != 4 {
+		t.Errorf("expected 4 events delivered, got %v", ids)
+	}
+}
+
+// Attempts that could outlast the lease are left for the next claim.
+func TestDispatcherSkipsAttemptsPastTheLease(t *testing.T) {
+	rcv := newReceiver(t, "whsec_test", time.Now, http.StatusOK)
+	rcv.delay = 40 * time.Millisecond
+	store, _ := setup(t, rcv.URL)
+	enqueue(t, store, 3)
+
+	dispatcher := NewDispatcher(store, testLogger(), Config{Timeout: 50 * time.Millisecond})
+	dispatcher.batchSize, dispatcher.concurrency = 4, 1
+	dispatcher.lease = 120 * time.Millisecond
+
+	dispatcher.dispatchBatch(context.Background())
+	if received, _ := rcv.count(); received == 0 || received == 4 {
+		t.Fatalf("expected the batch to stop short of its lease, %d of 4 were sent", received)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for received, _ := rcv.count(); received < 4 && time.Now().Before(deadline); received, _ = rcv.count() {
+		time.Sleep(10 * time.Millisecond)
+		dispatcher.dispatchBatch(context.Background())
+	}
+	if ids := rcv.ids(t); len(ids) != 4 {
+		t.Errorf("expected the rest to be sent once the lease ran out, got %v", ids)
+	}
+}
+
+func TestDispatcherUnreachableEndpoint(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	store, subscription := setup(t, url)
+	dispatcher := NewDispatcher(store, testLogger(), Config{})
+	dispatcher.dispatchBatch(context.Background())
+
+	d, attempts := delivery(t, store, subscription.ID)
+	if d.Status != model.WebhookDeliveryPending || len(attempts) != 1 || attempts[0].StatusCode != 0 || attempts[0].Error == "" {
+		t.Errorf("expected a logged failure without a status, got %+v, %+v", d, attempts)
+	}
+}
+
+// Events written to the outbox reach the partner through the relay, the
+// enqueuer and the dispatcher.
+func TestOutboxToWebhook(t *testing.T) {
+	rcv := newReceiver(t, "whsec_test", time.Now, http.StatusOK)
+
+	ctx := context.Background()
+	webhooks := memory.NewWebhookRepository()
+	if err := webhooks.InsertWebhookSubscription(ctx, &model.WebhookSubscription{URL: rcv.URL, Secret: "whsec_test", EventTypes: []string{model.UserEventRegistered}}); err != nil {
+		t.Fatal(err)
+	}
+	events := memory.NewOutboxRepository()
+	for userID := 1; userID <= 3; userID++ {
+		if err := events.InsertOutboxEvent(ctx, &model.OutboxEvent{UserID: userID, Type: model.UserEventRegistered, Payload: []byte(`{}`)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	for _, worker := range []interface{ Run(context.Context) }{
+		outbox.NewRelay(events, NewEnqueuer(webhooks, testLogger()), testLogger(), 10*time.Millisecond),
+		NewDispatcher(webhooks, testLogger(), Config{PollInterval: 10 * time.Millisecond}),
+	} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			worker.Run(ctx)
+		}()
+	}
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	deadline := time.After(5 * time.Second)
+	for {
+		if received, _ := rcv.count(); received == 3 {
+			return
+		}
+		select {
+		case <-deadline:
+			received, rejected := rcv.count()
+			t.Fatalf("expected 3 deliveries, got %d received and %d rejected", received, rejected)
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+}
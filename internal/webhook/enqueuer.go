@@ -0,0 +1,46 @@
+package webhook
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/dosedaf/syncup-users-service/internal/model"
+)
+
+// EnqueueStore is the part of the webhook repository the Enqueuer uses.
+type EnqueueStore interface {
+	EnqueueWebhookDeliveries(ctx context.Context, event model.OutboxEvent) (int, error)
+}
+
+// Enqueuer is the outbox publisher for webhooks. Publishing an event only
+// records a delivery per subscription; the Dispatcher sends them, so a slow
+// or failing partner never holds up the outbox.
+type Enqueuer struct {
+	store  EnqueueStore
+	logger *slog.Logger
+}
+
+func NewEnqueuer(store EnqueueStore, logger *slog.Logger) *Enqueuer {
+	return &Enqueuer{
+		store:  store,
+		logger: logger,
+	}
+}
+
+func (e *Enqueuer) Publish(ctx context.Context, event model.OutboxEvent) error {
+	n, err := e.store.EnqueueWebhookDeliveries(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	if n > 0 {
+		e.logger.DebugContext(ctx,
+			"Webhook deliveries enqueued",
+			"event_id", event.ID,
+			"type", event.Type,
+			"count", n,
+		)
+	}
+
+	return nil
+}
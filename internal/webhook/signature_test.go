@@ -0,0 +1,66 @@
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	const secret = "whsec_test"
+	body := []byte(`{"id":1,"type":"user.registered"}`)
+	sentAt := time.Unix(1_700_000_000, 0)
+
+	headers := func(signature string, timestamp time.Time) http.Header {
+		h := http.Header{}
+		h.Set(HeaderSignature, signature)
+		h.Set(HeaderTimestamp, strconv.FormatInt(timestamp.Unix(), 10))
+		return h
+	}
+	valid := Sign(secret, sentAt, body)
+
+	tests := []struct {
+		name    string
+		header  http.Header
+		body    []byte
+		now     time.Time
+		wantErr error
+	}{
+		{"valid", headers(valid, sentAt), body, sentAt.Add(time.Minute), nil},
+		{"one of several signatures", headers("v1=deadbeef, "+valid, sentAt), body, sentAt, nil},
+		{"tampered body", headers(valid, sentAt), []byte(`{"id":2,"type":"user.registered"}`), sentAt, ErrInvalidSignature},
+		{"wrong secret", headers(Sign("whsec_other", sentAt, body), sentAt), body, sentAt, ErrInvalidSignature},
+		// the timestamp is signed, so a replay cannot simply refresh it
+		{"refreshed timestamp", headers(valid, sentAt.Add(time.Hour)), body, sentAt.Add(time.Hour), ErrInvalidSignature},
+		{"replayed later", headers(valid, sentAt), body, sentAt.Add(DefaultTolerance + time.Second), ErrStaleTimestamp},
+		{"from the future", headers(valid, sentAt), body, sentAt.Add(-DefaultTolerance - time.Second), ErrStaleTimestamp},
+		{"unsigned", http.Header{}, body, sentAt, ErrMissingSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(secret, tt.header, tt.body, DefaultTolerance, tt.now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestNewSecret(t *testing.T) {
+	a, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a == b || !strings.HasPrefix(a, secretPrefix) || len(a) != len(secretPrefix)+64 {
+		t.Errorf("unexpected secrets %q and %q", a, b)
+	}
+}
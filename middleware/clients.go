@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/dosedaf/syncup-users-service/helper"
+	"github.com/dosedaf/syncup-users-service/internal/logging"
+)
+
+const ServiceClientContextKey = contextKey("service_client")
+
+// ServiceClients maps the ID of every service allowed to call the
+// service-to-service endpoints, such as token introspection, to its secret.
+type ServiceClients map[string]string
+
+// ParseServiceClients reads id:secret entries separated by commas or
+// newlines. Blank entries and ones starting with # are skipped.
+func ParseServiceClients(raw string) (ServiceClients, error) {
+	clients := make(ServiceClients)
+	entries := strings.FieldsFunc(raw, func(r rune) bool { return r == '\n' || r == ',' })
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		id, secret, found := strings.Cut(entry, ":")
+		id, secret = strings.TrimSpace(id), strings.TrimSpace(secret)
+		if !found || id == "" || secret == "" {
+			return nil, errors.New("service client entries must have the form id:secret")
+		}
+
+		if _, exists := clients[id]; exists {
+			return nil, fmt.Errorf("duplicate service client %q", id)
+		}
+
+		clients[id] = secret
+	}
+
+	return clients, nil
+}
+
+// Authenticate reports whether secret belongs to the client id. Secrets are
+// compared by hash in constant time, and unknown clients are compared
+// against an empty secret, so response times reveal neither.
+func (c ServiceClients) Authenticate(id, secret string) bool {
+	want, known := c[id]
+	wantSum := sha256.Sum256([]byte(want))
+	gotSum := sha256.Sum256([]byte(secret))
+
+	return subtle.ConstantTimeCompare(wantSum[:], gotSum[:]) == 1 && known
+}
+
+// RequireServiceClient admits only requests carrying the HTTP Basic
+// credentials of one of clients, the client authentication RFC 7662 asks of
+// introspection callers. The client ID is stored in the request context
+// and added to the request logger.
+func RequireServiceClient(clients ServiceClients, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, secret, ok := r.BasicAuth()
+			if !ok {
+				w.Header().Set("WWW-Authenticate", `Basic realm="service clients"`)
+				helper.WriteError(w, RequestID(r.Context()), helper.WithMessage(helper.ErrUnauthorized, "service client credentials required"))
+				return
+			}
+
+			if !clients.Authenticate(id, secret) {
+				logger.InfoContext(r.Context(), "Rejected service client", "client_id", id)
+				w.Header().Set("WWW-Authenticate", `Basic realm="service clients"`)
+				helper.WriteError(w, RequestID(r.Context()), helper.WithMessage(helper.ErrUnauthorized, "invalid service client credentials"))
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), ServiceClientContextKey, id)
+			if requestLogger := logging.FromContext(ctx, nil); requestLogger != nil {
+				ctx = logging.WithLogger(ctx, requestLogger.With("client_id", id))
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
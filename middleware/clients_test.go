@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseServiceClients(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    ServiceClients
+		wantErr bool
+	}{
+		{"empty", "", ServiceClients{}, false},
+		{"entries", "billing:s3cret, search : other:secret\n# comment\n", ServiceClients{"billing": "s3cret", "search": "other:secret"}, false},
+		{"missing secret", "billing", nil, true},
+		{"empty secret", "billing:", nil, true},
+		{"empty id", ":s3cret", nil, true},
+		{"duplicate", "billing:a,billing:b", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clients, err := ParseServiceClients(tt.raw)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %v", clients)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(clients) != len(tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, clients)
+			}
+			for id, secret := range tt.want {
+				if clients[id] != secret {
+					t.Errorf("expected %v, got %v", tt.want, clients)
+				}
+			}
+		})
+	}
+}
+
+func TestRequireServiceClient(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newJSONLogger(&buf)
+	clients := ServiceClients{"billing": "s3cret"}
+
+	var gotClient any
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotClient = r.Context().Value(ServiceClientContextKey)
+	})
+	h := RequireServiceClient(clients, logger)(next)
+
+	tests := []struct {
+		name       string
+		id, secret string
+		basic      bool
+		wantStatus int
+	}{
+		{"valid", "billing", "s3cret", true, http.StatusOK},
+		{"no credentials", "", "", false, http.StatusUnauthorized},
+		{"wrong secret", "billing", "guess", true, http.StatusUnauthorized},
+		{"unknown client", "search", "s3cret", true, http.StatusUnauthorized},
+		{"unknown client with empty secret", "search", "", true, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotClient = nil
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/introspect", nil)
+			if tt.basic {
+				req.SetBasicAuth(tt.id, tt.secret)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if tt.wantStatus == http.StatusOK {
+				if gotClient != tt.id {
+					t.Errorf("expected client %q in context, got %v", tt.id, gotClient)
+				}
+				return
+			}
+			if gotClient != nil {
+				t.Error("rejected request reached the handler")
+			}
+			if rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("expected a WWW-Authenticate challenge")
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package middleware
+
+import "net/http"
+
+// LimitBody caps request bodies at n bytes. Reading past the limit fails
+// with *http.MaxBytesError, which handlers report as 413, and makes the
+// server close the connection instead of draining the rest.
+func LimitBody(n int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Body = http.MaxBytesReader(w, r.Body, n)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
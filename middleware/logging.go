@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dosedaf/syncup-users-service/internal/logging"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds caller supplied ids, which end up in every log
+// line for the request.
+const maxRequestIDLength = 128
+
+type requestStateKey struct{}
+
+// requestState is filled in by middleware further down the chain, which
+// only sees copies of the request, and read back by AccessLog.
+type requestState struct {
+	id     string
+	userID *int
+}
+
+// AccessLog accepts the caller's X-Request-ID or generates one, echoes it
+// in the response, stores a logger carrying it in the request context and
+// writes one line per request once it has been served.
+func AccessLog(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			requestID := r.Header.Get(RequestIDHeader)
+			if !validRequestID(requestID) {
+				requestID = newRequestID()
+			}
+			w.Header().Set(RequestIDHeader, requestID)
+
+			requestLogger := logger.With("request_id", requestID)
+			state := &requestState{id: requestID}
+			ctx := logging.WithLogger(r.Context(), requestLogger)
+			ctx = context.WithValue(ctx, requestStateKey{}, state)
+
+			rec := NewResponseRecorder(w)
+			ServeWithContext(ctx, next, rec, r)
+
+			level := slog.LevelInfo
+			if rec.Status() >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+
+			attrs := []slog.Attr{
+				slog.String("method", r.Method),
+				slog.String("route", r.Pattern),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", rec.Status()),
+				slog.Int("bytes", rec.Bytes()),
+				slog.Duration("duration", time.Since(start)),
+			}
+			if state.userID != nil {
+				attrs = append(attrs, slog.Int("user_id", *state.userID))
+			}
+
+			// logger picks up the request attributes from ctx
+			logger.LogAttrs(ctx, level, "Request served", attrs...)
+		})
+	}
+}
+
+// RequestID returns the id AccessLog assigned to the request, if any.
+func RequestID(ctx context.Context) string {
+	if state, ok := ctx.Value(requestStateKey{}).(*requestState); ok {
+		return state.id
+	}
+	return ""
+}
+
+// ServeWithContext calls next with the request's context replaced by ctx and
+// copies the pattern the ServeMux matched back onto r, so middleware outside
+// this one can still read r.Pattern.
+func ServeWithContext(ctx context.Context, next http.Handler, w http.ResponseWriter, r *http.Request) {
+	inner := r.WithContext(ctx)
+	next.ServeHTTP(w, inner)
+	r.Pattern = inner.Pattern
+}
+
+// setRequestUser records the authenticated user for the access log and
+// adds it to the request logger.
+func setRequestUser(ctx context.Context, userID int) context.Context {
+	if state, ok := ctx.Value(requestStateKey{}).(*requestState); ok {
+		state.userID = &userID
+	}
+
+	if logger := logging.FromContext(ctx, nil); logger != nil {
+		ctx = logging.WithLogger(ctx, logger.With("user_id", userID))
+	}
+	return ctx
+}
+
+// EnsureRequestID returns id if it is acceptable as a request id and a new
+// one otherwise, for transports that do not go through AccessLog.
+func EnsureRequestID(id string) string {
+	if validRequestID(id) {
+		return id
+	}
+	return newRequestID()
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// still unique enough to correlate log lines
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
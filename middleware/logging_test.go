@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dosedaf/syncup-users-service/internal/logging"
+)
+
+func newJSONLogger(buf *bytes.Buffer) *slog.Logger {
+	return slog.New(logging.NewContextHandler(slog.NewJSONHandler(buf, nil)))
+}
+
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+
+	var lines []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		lines = append(lines, entry)
+	}
+
+	return lines
+}
+
+func TestAccessLogCorrelatesComponentLogs(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newJSONLogger(&buf)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		ctx := setRequestUser(r.Context(), 42)
+		// a component logging with the logger it was constructed with
+		logger.InfoContext(ctx, "Item updated")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/items/7", nil)
+	req.Header.Set(RequestIDHeader, "req-123")
+	rec := httptest.NewRecorder()
+	AccessLog(logger)(mux).ServeHTTP(rec, req)
+
+	if got := rec.Header().Get(RequestIDHeader); got != "req-123" {
+		t.Errorf("expected the caller's request id to be echoed, got %q", got)
+	}
+
+	lines := logLines(t, &buf)
+	if len(lines) != 2 {
+		t.Fatalf("expected a component line and an access line, got %d:\n%s", len(lines), buf.String())
+	}
+
+	component := lines[0]
+	if component["msg"] != "Item updated" || component["request_id"] != "req-123" || component["user_id"] != float64(42) {
+		t.Errorf("component log line missing request attributes: %v", component)
+	}
+	if n := strings.Count(buf.String(), `"request_id"`); n != 2 {
+		t.Errorf("expected request_id once per line, found %d times:\n%s", n, buf.String())
+	}
+
+	access := lines[1]
+	for key, want := range map[string]any{
+		"request_id": "req-123",
+		"method":     "POST",
+		"route":      "POST /api/v1/items/{id}",
+		"status":     float64(http.StatusCreated),
+		"bytes":      float64(len("created")),
+		"user_id":    float64(42),
+	} {
+		if access[key] != want {
+			t.Errorf("access log %s: expected %v, got %v", key, want, access[key])
+		}
+	}
+	if _, ok := access["duration"]; !ok {
+		t.Error("access log is missing the duration")
+	}
+}
+
+func TestAccessLogReplacesInvalidRequestIDs(t *testing.T) {
+	handler := AccessLog(newJSONLogger(&bytes.Buffer{}))(http.NotFoundHandler())
+
+	for _, id := range []string{"", "has spaces", "line\nbreak", strings.Repeat("a", maxRequestIDLength+1)} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if id != "" {
+			req.Header.Set(RequestIDHeader, id)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		got := rec.Header().Get(RequestIDHeader)
+		if got == id || !validRequestID(got) {
+			t.Errorf("expected a generated id for %q, got %q", id, got)
+		}
+	}
+}
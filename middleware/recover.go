@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/dosedaf/syncup-users-service/helper"
+)
+
+// Recover turns a panic in next into a logged stack trace and a JSON 500,
+// instead of a dropped connection. It goes inside AccessLog so the log line
+// carries the request id and the access log records the 500.
+func Recover(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := NewResponseRecorder(w)
+
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				// the server uses this to abort a response on purpose
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+
+				logger.ErrorContext(r.Context(), "Recovered from panic",
+					"panic", fmt.Sprint(v),
+					"stack", string(debug.Stack()),
+				)
+
+				if rec.Written() {
+					// the status line is gone, all we can do is cut the response short
+					panic(http.ErrAbortHandler)
+				}
+
+				if err := helper.WriteError(rec, RequestID(r.Context()), fmt.Errorf("panic: %v", v)); err != nil {
+					logger.ErrorContext(r.Context(), "failed to write problem response", "error", err)
+				}
+			}()
+
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dosedaf/syncup-users-service/helper"
+)
+
+func TestRecoverWritesProblemAndLogsStack(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newJSONLogger(&buf)
+
+	panicking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m map[string]int
+		m["boom"]++
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/me", nil)
+	req.Header.Set(RequestIDHeader, "req-panic")
+	rec := httptest.NewRecorder()
+	AccessLog(logger)(Recover(logger)(panicking)).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != helper.ProblemContentType {
+		t.Errorf("expected a problem response, got content type %q", ct)
+	}
+	var problem helper.Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("invalid problem body %q: %v", rec.Body.String(), err)
+	}
+	if strings.Contains(rec.Body.String(), "nil map") {
+		t.Errorf("the panic value leaked to the client: %s", rec.Body.String())
+	}
+
+	lines := logLines(t, &buf)
+	if len(lines) != 2 {
+		t.Fatalf("expected a panic line and an access line, got %d:\n%s", len(lines), buf.String())
+	}
+	panicLine := lines[0]
+	if panicLine["request_id"] != "req-panic" {
+		t.Errorf("expected the request id on the panic line, got %v", panicLine["request_id"])
+	}
+	if stack, _ := panicLine["stack"].(string); !strings.Contains(stack, "recover_test.go") {
+		t.Errorf("expected a stack trace pointing at the handler, got %q", stack)
+	}
+	if status := lines[1]["status"]; status != float64(http.StatusInternalServerError) {
+		t.Errorf("expected the access log to record a 500, got %v", status)
+	}
+}
+
+func TestRecoverRepanicsOnAbort(t *testing.T) {
+	var buf bytes.Buffer
+	aborting := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("expected http.ErrAbortHandler to propagate, got %v", v)
+		}
+		if buf.Len() != 0 {
+			t.Errorf("an intentional abort should not be logged:\n%s", buf.String())
+		}
+	}()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	Recover(newJSONLogger(&buf))(aborting).ServeHTTP(httptest.NewRecorder(), req)
+}
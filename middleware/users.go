@@ -2,31 +2,29 @@ package middleware
 
 import (
 	"context"
-	"errors"
 	"log/slog"
 	"net/http"
 	"strings"
 
 	"github.com/dosedaf/syncup-users-service/helper"
-	"github.com/dosedaf/syncup-users-service/internal/repository"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/dosedaf/syncup-users-service/internal/model"
+	"github.com/dosedaf/syncup-users-service/internal/token"
 )
 
 type contextKey string
 
 const UserContextKey = contextKey("user")
+const SessionContextKey = contextKey("session")
 
 type Middleware struct {
-	repo      repository.RepositoryInstance
-	logger    *slog.Logger
-	jwtSecret []byte
+	verifier *token.Verifier
+	logger   *slog.Logger
 }
 
-func NewMiddleware(repo repository.RepositoryInstance, logger *slog.Logger, jwtSecret string) *Middleware {
+func NewMiddleware(verifier *token.Verifier, logger *slog.Logger) *Middleware {
 	return &Middleware{
-		repo:      repo,
-		logger:    logger,
-		jwtSecret: []byte(jwtSecret),
+		verifier: verifier,
+		logger:   logger,
 	}
 }
 
@@ -34,47 +32,43 @@ func (m *Middleware) JWTMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			helper.JSONError(w, http.StatusUnauthorized, "authorization header required")
+			helper.WriteError(w, RequestID(r.Context()), helper.WithMessage(helper.ErrUnauthorized, "authorization header required"))
 			return
 		}
 
 		tokenStr, found := strings.CutPrefix(authHeader, "Bearer ")
 		if !found {
-			helper.JSONError(w, http.StatusUnauthorized, "invalid authorization header format")
+			helper.WriteError(w, RequestID(r.Context()), helper.WithMessage(helper.ErrUnauthorized, "invalid authorization header format"))
 			return
 		}
 
-		token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, errors.New("unexpected signing method")
-			}
-			return m.jwtSecret, nil
-		})
-
+		identity, err := m.verifier.Authenticate(r.Context(), tokenStr)
 		if err != nil {
-			m.logger.Info("invalid JWT", "error", err)
-			helper.JSONError(w, http.StatusUnauthorized, "invalid or expired token")
+			helper.WriteError(w, RequestID(r.Context()), err)
 			return
 		}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			email, _ := claims.GetSubject()
-			user, err := m.repo.GetUserByEmail(r.Context(), email)
-			if err != nil {
-				if errors.Is(err, helper.ErrUserNotFound) {
-					helper.JSONError(w, http.StatusUnauthorized, "user not found")
-					return
-				}
-
-				helper.JSONError(w, http.StatusInternalServerError, "internal server error")
-				return
-			}
+		ctx := context.WithValue(setRequestUser(r.Context(), identity.User.ID), UserContextKey, identity.User)
+		ctx = context.WithValue(ctx, SessionContextKey, identity.Session)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
 
-			ctx := context.WithValue(r.Context(), UserContextKey, user)
-			next.ServeHTTP(w, r.WithContext(ctx))
+// RequireAdmin must be chained after JWTMiddleware.
+func (m *Middleware) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := r.Context().Value(UserContextKey).(*model.User)
+		if !ok {
+			helper.WriteError(w, RequestID(r.Context()), helper.WithMessage(helper.ErrUnauthorized, "authorization required"))
+			return
+		}
 
-		} else {
-			helper.JSONError(w, http.StatusUnauthorized, "invalid token claims")
+		if user.Role != model.RoleAdmin {
+			m.logger.InfoContext(r.Context(), "Rejected non-admin request", "user_id", user.ID, "path", r.URL.Path)
+			helper.WriteError(w, RequestID(r.Context()), helper.WithMessage(helper.ErrForbidden, "admin access required"))
+			return
 		}
+
+		next.ServeHTTP(w, r)
 	})
 }